@@ -0,0 +1,23 @@
+package blockchain
+
+import "testing"
+
+func TestInspectAnnouncementIgnoresForgedCreators(t *testing.T) {
+	params, saved := networkParams, announcedHeaders
+	networkParams, announcedHeaders = NetworkParams{}, make(map[int]map[string]BlockHeader)
+	t.Cleanup(func() { networkParams, announcedHeaders = params, saved })
+
+	mallory, _ := testKey("mallory")
+	alice, aliceID := testKey("alice")
+
+	// A header naming alice but signed by mallory must not be held against alice
+	inspectAnnouncement("192.0.2.1", signedBlock(mallory, aliceID).BlockHeader)
+	if len(announcedHeaders[1]) != 0 {
+		t.Fatal("a header with a forged creator was remembered for equivocation")
+	}
+	signed := signedBlock(alice, aliceID).BlockHeader
+	inspectAnnouncement("192.0.2.1", signed)
+	if remembered, ok := announcedHeaders[1][aliceID]; !ok || remembered.Hash != signed.Hash {
+		t.Fatal("a header signed by its creator was not remembered")
+	}
+}
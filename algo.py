@@ -44,7 +44,7 @@ if __name__ == "__main__":
 
 
     file_path = sys.argv[1]
-    start_node = 'A'
+    start_node = sys.argv[2] if len(sys.argv) > 2 else 'A'
 
     try:
         distances = dijkstra(file_path, start_node)
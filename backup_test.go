@@ -0,0 +1,84 @@
+package blockchain
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	mock := useIPFSMock(t)
+	dir := t.TempDir()
+	key, creator := testKey("backup")
+	keyFile := filepath.Join(dir, "node.key")
+	if err := os.WriteFile(keyFile, []byte(hex.EncodeToString(key.Seed())), 0600); err != nil {
+		t.Fatal(err)
+	}
+	genesis, err := os.ReadFile("genesis.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesisFile := filepath.Join(dir, "genesis.json")
+	if err := os.WriteFile(genesisFile, genesis, 0644); err != nil {
+		t.Fatal(err)
+	}
+	dataDir := filepath.Join(dir, "data")
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	store, err := openStore("file", dataDir, jsonCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := signedBlock(key, creator)
+	if err := store.Append(head); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	cid, err := backupNode(keyFile, genesisFile, dataDir, "file", jsonCodec{}, "passphrase")
+	if err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	headCID, err := uploadBlockToIPFS(head)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Restoring over a genesis file of another network is refused
+	other := filepath.Join(t.TempDir(), "genesis.json")
+	if err := os.WriteFile(other, []byte(strings.Replace(string(genesis), `"MaxBlockCompute": 180`, `"MaxBlockCompute": 7`, 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	restoreDir := t.TempDir()
+	restoredKey := filepath.Join(restoreDir, "node.key")
+	if _, err := restoreNode(cid, restoredKey, other, restoreDir, "passphrase"); err == nil || !strings.Contains(err.Error(), "network") {
+		t.Fatalf("restore over another network's genesis: %v", err)
+	}
+	if _, err := os.Stat(restoredKey); !os.IsNotExist(err) {
+		t.Fatal("refused restore wrote the node key")
+	}
+
+	backup, err := restoreNode(cid, restoredKey, filepath.Join(restoreDir, "genesis.json"), restoreDir, "passphrase")
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if backup.HeadHash != head.Hash || backup.HeadCID != headCID {
+		t.Fatalf("backup records head %s at %s, want %s at %s", backup.HeadHash, backup.HeadCID, head.Hash, headCID)
+	}
+
+	// An envelope demanding an excessive key derivation cost is refused before any key is derived
+	data, _ := mock.Get(cid)
+	var envelope EncryptedBackup
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		t.Fatal(err)
+	}
+	envelope.Iterations = 1 << 40
+	data, _ = json.Marshal(envelope)
+	if _, err := restoreNode(mock.Add(data), filepath.Join(t.TempDir(), "node.key"), "", t.TempDir(), "passphrase"); err == nil || !strings.Contains(err.Error(), "iterations") {
+		t.Fatalf("restore of a costly envelope: %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package blockchain
+
+import (
+	"testing"
+)
+
+func TestDuplicatedTransactionsRefused(t *testing.T) {
+	params, savedIndex := networkParams, txIndex
+	networkParams = NetworkParams{MaxTransactionSize: 8192, MaxBlockSize: 65536, MaxBlockCompute: 10, MaxRuntime: 60, MaxOutputSize: 4096, AllowedRuntimes: []string{"python"}}
+	txIndex = make(map[string]int)
+	t.Cleanup(func() { networkParams, txIndex = params, savedIndex })
+
+	job := func(id string) Transaction {
+		return Transaction{ID: "127.0.0.1", JobID: id, Data: "output of " + id, Runtime: "python", Network: NetworkPolicy{}.String()}
+	}
+	key, creator := testKey("creator")
+	block := signedBlock(key, creator)
+	block.Transactions = []Transaction{job("a"), job("b"), job("c")}
+	block.TxRoot = merkleRoot(block.Transactions)
+	if err := validateBlockTransactions(block); err != nil {
+		t.Fatalf("original body refused: %v", err)
+	}
+
+	// Repeating the last transaction of an odd level leaves the Merkle root, and so the block hash, unchanged
+	mutated := block
+	mutated.Transactions = append(append([]Transaction(nil), block.Transactions...), job("c"))
+	if err := validateBlockBody(mutated); err != nil {
+		t.Fatalf("expected the mutated body to match the committed root: %v", err)
+	}
+	if err := validateBlockTransactions(mutated); err == nil {
+		t.Fatal("body with a repeated transaction accepted")
+	}
+
+	// A job already confirmed by an earlier block cannot be confirmed again
+	later := block
+	later.BlockNumber = 2
+	txIndex["b"] = 1
+	if confirmed, err := checkConfirmed(later); err == nil || !confirmed["b"] || len(confirmed) != 1 {
+		t.Fatalf("block repeating a confirmed job accepted: %v, %v", confirmed, err)
+	}
+}
@@ -0,0 +1,464 @@
+package blockchain
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// cborCodec encodes values as CBOR (RFC 8949), streaming as a CBOR sequence (RFC 8742)
+type cborCodec struct{}
+
+func (cborCodec) Name() string                   { return "cbor" }
+func (cborCodec) MediaType() string              { return "application/cbor" }
+func (cborCodec) StreamMediaType() string        { return "application/cbor-seq" }
+func (cborCodec) NewEncoder(w io.Writer) Encoder { return &cborEncoder{w: w} }
+func (cborCodec) NewDecoder(r io.Reader) Decoder { return &cborDecoder{r: bufio.NewReader(r)} }
+
+// CBOR major types
+const (
+	cborUnsigned = 0
+	cborNegative = 1
+	cborBytes    = 2
+	cborText     = 3
+	cborArray    = 4
+	cborMap      = 5
+	cborSimple   = 7
+)
+
+// Limits on CBOR data items accepted from peers. The length in an item's head is only a claim: strings are read
+// in chunks of at most cborChunk bytes, so memory grows with the data that actually arrives, and arrays and maps
+// grow one decoded element at a time.
+const (
+	cborMaxLength = 64 << 20 // Length of a string, array or map
+	cborMaxDepth  = 128      // Nesting of arrays and maps
+	cborChunk     = 64 << 10 // Bytes of a string allocated before they are read
+)
+
+// cborEncoder writes values as CBOR data items. Structs are encoded as maps keyed by field name, mirroring JSON.
+type cborEncoder struct {
+	w   io.Writer
+	buf []byte
+}
+
+// Encode writes v as a single CBOR data item
+func (e *cborEncoder) Encode(v interface{}) error {
+	e.buf = e.buf[:0]
+	if err := e.encode(reflect.ValueOf(v)); err != nil {
+		return err
+	}
+	_, err := e.w.Write(e.buf)
+	return err
+}
+
+// writeHead appends a data item head with the given major type and argument
+func (e *cborEncoder) writeHead(major byte, n uint64) {
+	switch {
+	case n < 24:
+		e.buf = append(e.buf, major<<5|byte(n))
+	case n <= 0xff:
+		e.buf = append(e.buf, major<<5|24, byte(n))
+	case n <= 0xffff:
+		e.buf = append(e.buf, major<<5|25)
+		e.buf = binary.BigEndian.AppendUint16(e.buf, uint16(n))
+	case n <= 0xffffffff:
+		e.buf = append(e.buf, major<<5|26)
+		e.buf = binary.BigEndian.AppendUint32(e.buf, uint32(n))
+	default:
+		e.buf = append(e.buf, major<<5|27)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, n)
+	}
+}
+
+func (e *cborEncoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		e.buf = append(e.buf, cborSimple<<5|22) // null
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf = append(e.buf, cborSimple<<5|21)
+		} else {
+			e.buf = append(e.buf, cborSimple<<5|20)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n := v.Int(); n >= 0 {
+			e.writeHead(cborUnsigned, uint64(n))
+		} else {
+			e.writeHead(cborNegative, uint64(-1-n))
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		e.writeHead(cborUnsigned, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		e.buf = append(e.buf, cborSimple<<5|27)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, math.Float64bits(v.Float()))
+	case reflect.String:
+		e.writeHead(cborText, uint64(v.Len()))
+		e.buf = append(e.buf, v.String()...)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			e.buf = append(e.buf, cborSimple<<5|22)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.writeHead(cborBytes, uint64(v.Len()))
+			for i := 0; i < v.Len(); i++ {
+				e.buf = append(e.buf, byte(v.Index(i).Uint()))
+			}
+			return nil
+		}
+		e.writeHead(cborArray, uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("cbor: unsupported map key type %s", v.Type().Key())
+		}
+		if v.IsNil() {
+			e.buf = append(e.buf, cborSimple<<5|22)
+			return nil
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		e.writeHead(cborMap, uint64(len(keys)))
+		for _, key := range keys {
+			e.writeHead(cborText, uint64(key.Len()))
+			e.buf = append(e.buf, key.String()...)
+			if err := e.encode(v.MapIndex(key)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		fields := []int{}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				fields = append(fields, i)
+			}
+		}
+		e.writeHead(cborMap, uint64(len(fields)))
+		for _, i := range fields {
+			name := v.Type().Field(i).Name
+			e.writeHead(cborText, uint64(len(name)))
+			e.buf = append(e.buf, name...)
+			if err := e.encode(v.Field(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			e.buf = append(e.buf, cborSimple<<5|22)
+			return nil
+		}
+		return e.encode(v.Elem())
+	default:
+		return fmt.Errorf("cbor: unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// cborDecoder reads consecutive CBOR data items into Go values
+type cborDecoder struct {
+	r     *bufio.Reader
+	depth int // Arrays and maps enclosing the item being decoded
+}
+
+// Decode reads the next data item into v, which must be a non-nil pointer
+func (d *cborDecoder) Decode(v interface{}) error {
+	target := reflect.ValueOf(v)
+	if target.Kind() != reflect.Pointer || target.IsNil() {
+		return fmt.Errorf("cbor: Decode requires a non-nil pointer")
+	}
+	if _, err := d.r.Peek(1); err != nil {
+		return err // io.EOF at an item boundary ends the stream
+	}
+	return d.decode(target.Elem())
+}
+
+// readHead reads a data item head, returning its major type, additional info and argument
+func (d *cborDecoder) readHead() (byte, byte, uint64, error) {
+	initial, err := d.r.ReadByte()
+	if err != nil {
+		return 0, 0, 0, unexpectedEOF(err)
+	}
+	major, info := initial>>5, initial&0x1f
+	var size int
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	default:
+		return 0, 0, 0, fmt.Errorf("cbor: unsupported additional info %d", info)
+	}
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(d.r, buf[8-size:]); err != nil {
+		return 0, 0, 0, unexpectedEOF(err)
+	}
+	return major, info, binary.BigEndian.Uint64(buf), nil
+}
+
+// unexpectedEOF converts an EOF inside a data item into io.ErrUnexpectedEOF
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// readBytes reads the n bytes of a string, allocating them as they arrive so a forged length cannot force a large
+// allocation up front
+func (d *cborDecoder) readBytes(n int) ([]byte, error) {
+	data := make([]byte, 0, min(n, cborChunk))
+	for len(data) < n {
+		if len(data) == cap(data) {
+			data = slices.Grow(data, min(n-len(data), len(data)))
+		}
+		read, err := d.r.Read(data[len(data):min(n, cap(data))])
+		data = data[:len(data)+read]
+		if err != nil && len(data) < n {
+			return nil, unexpectedEOF(err)
+		}
+	}
+	return data, nil
+}
+
+// enter and leave track the nesting of arrays and maps, refusing items nested deeper than cborMaxDepth
+func (d *cborDecoder) enter() error {
+	if d.depth >= cborMaxDepth {
+		return fmt.Errorf("cbor: items nested deeper than %d", cborMaxDepth)
+	}
+	d.depth++
+	return nil
+}
+
+func (d *cborDecoder) leave() { d.depth-- }
+
+// readLength validates a length argument against cborMaxLength
+func readLength(n uint64) (int, error) {
+	if n > cborMaxLength {
+		return 0, fmt.Errorf("cbor: length %d exceeds limit", n)
+	}
+	return int(n), nil
+}
+
+func (d *cborDecoder) decode(v reflect.Value) error {
+	major, info, arg, err := d.readHead()
+	if err != nil {
+		return err
+	}
+
+	if major == cborSimple && info == 22 { // null
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decodeValue(v.Elem(), major, info, arg)
+	}
+	return d.decodeValue(v, major, info, arg)
+}
+
+func (d *cborDecoder) decodeValue(v reflect.Value, major, info byte, arg uint64) error {
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		generic, err := d.decodeGeneric(major, info, arg)
+		if err != nil {
+			return err
+		}
+		if generic != nil {
+			v.Set(reflect.ValueOf(generic))
+		}
+		return nil
+	}
+
+	switch major {
+	case cborUnsigned, cborNegative:
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if arg > math.MaxInt64 {
+				return fmt.Errorf("cbor: integer overflows %s", v.Type())
+			}
+			n := int64(arg)
+			if major == cborNegative {
+				n = -1 - n
+			}
+			v.SetInt(n)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if major == cborNegative {
+				return fmt.Errorf("cbor: negative integer for %s", v.Type())
+			}
+			v.SetUint(arg)
+		case reflect.Float32, reflect.Float64:
+			if major == cborNegative {
+				v.SetFloat(-1 - float64(arg))
+			} else {
+				v.SetFloat(float64(arg))
+			}
+		default:
+			return fmt.Errorf("cbor: cannot decode integer into %s", v.Type())
+		}
+	case cborBytes, cborText:
+		n, err := readLength(arg)
+		if err != nil {
+			return err
+		}
+		data, err := d.readBytes(n)
+		if err != nil {
+			return err
+		}
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(string(data))
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			v.SetBytes(data)
+		default:
+			return fmt.Errorf("cbor: cannot decode string into %s", v.Type())
+		}
+	case cborArray:
+		n, err := readLength(arg)
+		if err != nil {
+			return err
+		}
+		if v.Kind() != reflect.Slice {
+			return fmt.Errorf("cbor: cannot decode array into %s", v.Type())
+		}
+		if err := d.enter(); err != nil {
+			return err
+		}
+		defer d.leave()
+		slice := reflect.MakeSlice(v.Type(), 0, 0)
+		for i := 0; i < n; i++ {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := d.decode(elem); err != nil {
+				return err
+			}
+			slice = reflect.Append(slice, elem)
+		}
+		v.Set(slice)
+	case cborMap:
+		n, err := readLength(arg)
+		if err != nil {
+			return err
+		}
+		switch v.Kind() {
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String {
+				return fmt.Errorf("cbor: unsupported map key type %s", v.Type().Key())
+			}
+			if v.IsNil() {
+				v.Set(reflect.MakeMap(v.Type()))
+			}
+		case reflect.Struct:
+		default:
+			return fmt.Errorf("cbor: cannot decode map into %s", v.Type())
+		}
+		if err := d.enter(); err != nil {
+			return err
+		}
+		defer d.leave()
+		for i := 0; i < n; i++ {
+			var key string
+			if err := d.decode(reflect.ValueOf(&key).Elem()); err != nil {
+				return err
+			}
+			if v.Kind() == reflect.Map {
+				elem := reflect.New(v.Type().Elem()).Elem()
+				if err := d.decode(elem); err != nil {
+					return err
+				}
+				v.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), elem)
+				continue
+			}
+			field := v.FieldByNameFunc(func(name string) bool { return strings.EqualFold(name, key) })
+			if !field.IsValid() || !field.CanSet() {
+				var skipped interface{}
+				if err := d.decode(reflect.ValueOf(&skipped).Elem()); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := d.decode(field); err != nil {
+				return err
+			}
+		}
+	case cborSimple:
+		switch {
+		case info == 20 || info == 21:
+			if v.Kind() != reflect.Bool {
+				return fmt.Errorf("cbor: cannot decode boolean into %s", v.Type())
+			}
+			v.SetBool(info == 21)
+		case info == 23: // undefined
+			v.Set(reflect.Zero(v.Type()))
+		case info == 26 || info == 27:
+			if v.Kind() != reflect.Float32 && v.Kind() != reflect.Float64 {
+				return fmt.Errorf("cbor: cannot decode float into %s", v.Type())
+			}
+			if info == 26 {
+				v.SetFloat(float64(math.Float32frombits(uint32(arg))))
+			} else {
+				v.SetFloat(math.Float64frombits(arg))
+			}
+		default:
+			return fmt.Errorf("cbor: unsupported simple value %d", info)
+		}
+	default:
+		return fmt.Errorf("cbor: unsupported major type %d", major)
+	}
+	return nil
+}
+
+// decodeGeneric decodes a data item into the same generic types encoding/json produces
+func (d *cborDecoder) decodeGeneric(major, info byte, arg uint64) (interface{}, error) {
+	switch major {
+	case cborUnsigned, cborNegative, cborSimple:
+		if major == cborSimple && info != 26 && info != 27 {
+			switch info {
+			case 20, 21:
+				return info == 21, nil
+			case 22, 23:
+				return nil, nil
+			}
+			return nil, fmt.Errorf("cbor: unsupported simple value %d", info)
+		}
+		var f float64
+		if err := d.decodeValue(reflect.ValueOf(&f).Elem(), major, info, arg); err != nil {
+			return nil, err
+		}
+		return f, nil
+	case cborBytes:
+		var b []byte
+		err := d.decodeValue(reflect.ValueOf(&b).Elem(), major, info, arg)
+		return b, err
+	case cborText:
+		var s string
+		err := d.decodeValue(reflect.ValueOf(&s).Elem(), major, info, arg)
+		return s, err
+	case cborArray:
+		var a []interface{}
+		err := d.decodeValue(reflect.ValueOf(&a).Elem(), major, info, arg)
+		return a, err
+	case cborMap:
+		m := map[string]interface{}{}
+		err := d.decodeValue(reflect.ValueOf(&m).Elem(), major, info, arg)
+		return m, err
+	}
+	return nil, fmt.Errorf("cbor: unsupported major type %d", major)
+}
@@ -0,0 +1,89 @@
+package blockchain
+
+import (
+	"bytes"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestCBORForgedLength(t *testing.T) {
+	// A text string claiming 60 MiB, followed by only a few bytes
+	input := []byte{0x7a, 0x03, 0xc0, 0x00, 0x00, 'a', 'b', 'c'}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	var s string
+	err := (cborCodec{}).NewDecoder(bytes.NewReader(input)).Decode(&s)
+	runtime.ReadMemStats(&after)
+	if err == nil {
+		t.Fatal("truncated string decoded")
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("decoding %d bytes allocated %d bytes", len(input), allocated)
+	}
+}
+
+func TestCBORNestingLimit(t *testing.T) {
+	// Arrays of one element nested deeper than the limit
+	input := append(bytes.Repeat([]byte{0x81}, cborMaxDepth+1), 0x00)
+	var v interface{}
+	if err := (cborCodec{}).NewDecoder(bytes.NewReader(input)).Decode(&v); err == nil {
+		t.Fatal("items nested beyond the limit decoded")
+	}
+	input = append(bytes.Repeat([]byte{0x81}, cborMaxDepth), 0x00)
+	if err := (cborCodec{}).NewDecoder(bytes.NewReader(input)).Decode(&v); err != nil {
+		t.Fatalf("items nested at the limit: %v", err)
+	}
+}
+
+// cborEncode encodes v as a single CBOR data item
+func cborEncode(t *testing.T, v interface{}) []byte {
+	var buf bytes.Buffer
+	if err := (cborCodec{}).NewEncoder(&buf).Encode(v); err != nil {
+		t.Fatalf("encode %v: %v", v, err)
+	}
+	return buf.Bytes()
+}
+
+func FuzzCBORDecode(f *testing.F) {
+	for _, block := range testBlocks(2) {
+		var buf bytes.Buffer
+		(cborCodec{}).NewEncoder(&buf).Encode(block)
+		f.Add(buf.Bytes())
+	}
+	f.Add([]byte{0x7a, 0x03, 0xc0, 0x00, 0x00, 'a'})
+	f.Add([]byte{0xa1, 0x61, 'k', 0x82, 0x01, 0xf6})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Peer input never panics, whatever it is decoded into
+		var block Block
+		(cborCodec{}).NewDecoder(bytes.NewReader(data)).Decode(&block)
+		var v interface{}
+		if err := (cborCodec{}).NewDecoder(bytes.NewReader(data)).Decode(&v); err != nil {
+			return
+		}
+		// Whatever decodes re-encodes to an item that decodes to the same value
+		encoded := cborEncode(t, v)
+		var again interface{}
+		if err := (cborCodec{}).NewDecoder(bytes.NewReader(encoded)).Decode(&again); err != nil {
+			t.Fatalf("re-encoded %v does not decode: %v", v, err)
+		}
+		if !bytes.Equal(cborEncode(t, again), encoded) {
+			t.Fatalf("decoded %v, then %v", v, again)
+		}
+	})
+}
+
+func FuzzCBORTransaction(f *testing.F) {
+	f.Add("192.0.2.1", "job-1", "42\n", int64(1200), int64(-3), int64(7))
+	f.Add("", "", "", int64(0), int64(0), int64(-1))
+	f.Fuzz(func(t *testing.T, id, jobID, data string, executionTime, amount, nonce int64) {
+		tx := Transaction{ID: id, JobID: jobID, Data: data, ExecutionTime: executionTime, Amount: amount, Nonce: nonce, Labels: map[string]string{jobID: data}, Args: []string{id}}
+		var decoded Transaction
+		if err := (cborCodec{}).NewDecoder(bytes.NewReader(cborEncode(t, tx))).Decode(&decoded); err != nil {
+			t.Fatalf("decode %+v: %v", tx, err)
+		}
+		if !reflect.DeepEqual(decoded, tx) {
+			t.Fatalf("decoded %+v, want %+v", decoded, tx)
+		}
+	})
+}
@@ -0,0 +1,1193 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	blockchain "github.com/msherazsadiq/IPFSBlockchain"
+)
+
+var ipfsAPIURL = "http://localhost:5001/api/v0" // IPFS RPC API, overridable to point at a mock IPFS server
+var ipfsChunker = "size-1048576"                // Chunker files are added with; the same chunker always yields the same CID
+
+// IPFSUploadResponse represents the response from IPFS
+type IPFSUploadResponse struct {
+	Hash string `json:"Hash"`
+}
+
+// CachedUpload records a file that was already uploaded to IPFS
+type CachedUpload struct {
+	ModTime int64  // Modification time of the file when it was uploaded (Unix nanoseconds)
+	Size    int64  // Size of the file when it was uploaded
+	CID     string // CID returned by IPFS
+	API     string // IPFS API the file was uploaded to
+	Chunker string // Chunker the file was added with
+}
+
+const uploadCacheFile = ".ipfs-upload-cache.json" // Local cache of uploaded file CIDs
+
+// httpClient is shared by all IPFS calls, and by peer calls without mutual TLS, so keep-alive connections are pooled
+// and reused
+var httpClient = &http.Client{Transport: newTransport()}
+
+var peerClient = httpClient // Client for peer calls, presenting the client certificate under mutual TLS
+var peerScheme = "http"     // URL scheme of the peers' APIs, https under mutual TLS
+
+// newTransport creates the transport of the shared clients
+func newTransport() *http.Transport {
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          64,
+		MaxIdleConnsPerHost:   8,
+		IdleConnTimeout:       2 * time.Minute,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// configureTLS switches peer calls to mutual TLS, presenting the client certificate and accepting only peers
+// whose certificate fingerprints are listed in peersFile, in the "<sha256 fingerprint> <identity>" format the
+// miners use
+func configureTLS(certFile, keyFile, peersFile string) error {
+	config, err := blockchain.ClientTLSConfig(certFile, keyFile, peersFile)
+	if err != nil {
+		return err
+	}
+	transport := newTransport()
+	transport.TLSClientConfig = config
+	peerClient = &http.Client{Transport: transport}
+	peerScheme = "https"
+	return nil
+}
+
+const maxPoWAttempts = 3 // Proof-of-work retries per peer when its required difficulty keeps rising
+
+const maxResultSize = 64 << 20 // Largest encrypted result downloaded from IPFS
+
+// JobTemplate is a reusable job definition stored in the templates file
+type JobTemplate struct {
+	Script string   // Python script to execute
+	Input  string   // Default input file passed to the script
+	Inputs []string // Further input files passed to the script after Input; submissions with them are streamed
+	Args   []string // Extra arguments passed to the script after the input file
+	Peers  []string // Miners to submit to; Tailscale peers are used when empty
+
+	OutputSchema json.RawMessage   // JSON Schema the script's output must match, checked by the miners
+	Labels       map[string]string // Metadata attached to the job's transaction, such as project=alpha
+
+	ScriptSignature string // "<author>:<signature>" from miner script sign, for miners that only run trusted scripts
+
+	Network  string // Network policy of the script: none (the default) or egress=<host:port,...>
+	Priority string // Execution priority: normal (the default) or low, for jobs miners may defer while mining or syncing
+	Fee      int64  // Fee offered for the job, which miners record in its transaction and bill with its usage
+}
+
+// SubmitOptions controls how a job is uploaded and followed until it confirms
+type SubmitOptions struct {
+	ConfirmBlocks  int
+	MaxRetries     int
+	PollInterval   time.Duration
+	ConfirmTimeout time.Duration
+	Force          bool
+	UploadRetries  int                // Upload attempts after the first for each file
+	Stream         bool               // Print the job's output from the first peer while it runs
+	ResultKey      *ecdh.PrivateKey   // Key the miners encrypt the result for, nil for public results
+	SubmitterKey   ed25519.PrivateKey // Key the confirmed usage is co-signed with, nil to leave it unsigned
+}
+
+// JobStatus represents the status of a job as reported by a miner
+type JobStatus struct {
+	ID          string
+	Status      string
+	Error       string
+	BlockNumber int
+	Height      int
+	ResultCID   string // CID of the result encrypted for the submitter
+	OutputCID   string // CID of the full output when the recorded result was truncated
+}
+
+// uploadToIPFS streams a file to IPFS and returns the file hash. The multipart body is produced while it is
+// sent, so files of any size are uploaded without being held in memory, and progress is printed for large files.
+func uploadToIPFS(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	body, pipe := io.Pipe()
+	writer := multipart.NewWriter(pipe)
+	go func() {
+		part, err := writer.CreateFormFile("file", filepath.Base(filePath))
+		if err != nil {
+			pipe.CloseWithError(fmt.Errorf("failed to create form file: %w", err))
+			return
+		}
+		var source io.Reader = file
+		if info.Size() >= progressThreshold {
+			progress := &progressReader{reader: file, name: filepath.Base(filePath), total: info.Size(), started: time.Now()}
+			defer progress.finish()
+			source = progress
+		}
+		if _, err := io.Copy(part, source); err != nil {
+			pipe.CloseWithError(fmt.Errorf("failed to copy file content: %w", err))
+			return
+		}
+		pipe.CloseWithError(writer.Close())
+	}()
+
+	query := url.Values{"chunker": {ipfsChunker}}
+	resp, err := httpClient.Post(ipfsAPIURL+"/add?"+query.Encode(), writer.FormDataContentType(), body)
+	body.Close() // Stops the writer if the request ended early
+	if err != nil {
+		return "", fmt.Errorf("failed to upload to IPFS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("IPFS upload failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var ipfsResponse IPFSUploadResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ipfsResponse); err != nil {
+		return "", fmt.Errorf("failed to decode IPFS response: %w", err)
+	}
+
+	return ipfsResponse.Hash, nil
+}
+
+// progressThreshold is the file size from which upload progress is printed
+const progressThreshold = 8 << 20
+
+// progressReader prints how much of a file has been read, at most twice a second
+type progressReader struct {
+	reader  io.Reader
+	name    string
+	total   int64
+	read    int64
+	started time.Time
+	printed time.Time
+}
+
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.reader.Read(buf)
+	p.read += int64(n)
+	if time.Since(p.printed) >= 500*time.Millisecond {
+		p.print()
+	}
+	return n, err
+}
+
+// print draws the progress bar over the previous one
+func (p *progressReader) print() {
+	p.printed = time.Now()
+	const width = 30
+	done := int(float64(width) * float64(p.read) / float64(p.total))
+	rate := float64(p.read) / max(time.Since(p.started).Seconds(), 0.001)
+	fmt.Printf("\rUploading %s [%s%s] %3.0f%% %s of %s, %s/s ", p.name, strings.Repeat("#", done), strings.Repeat(".", width-done),
+		100*float64(p.read)/float64(p.total), formatBytes(p.read), formatBytes(p.total), formatBytes(int64(rate)))
+}
+
+// finish prints the final state of the progress bar and ends its line
+func (p *progressReader) finish() {
+	p.print()
+	fmt.Println()
+}
+
+// formatBytes formats a byte count with a binary unit
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// uploadWithRetries uploads a file, retrying failed attempts. Every attempt uses the same chunker, so IPFS
+// produces the same blocks each time and keeps the ones a failed attempt already stored.
+func uploadWithRetries(filePath string, retries int) (string, error) {
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			fmt.Printf("Upload of %s failed: %v; retrying (%d of %d)\n", filePath, err, attempt, retries)
+			time.Sleep(time.Duration(attempt) * 2 * time.Second)
+		}
+		var hash string
+		if hash, err = uploadToIPFS(filePath); err == nil {
+			return hash, nil
+		}
+	}
+	return "", err
+}
+
+// checkInputSizes refuses files larger than the smallest job file limit the peers advertise in /status
+func checkInputSizes(files []string, peers []string) error {
+	for _, peer := range peers {
+		resp, err := peerClient.Get(minerURL(peer, "/status"))
+		if err != nil {
+			continue // Unreachable peers are reported when the job is sent
+		}
+		var status struct{ MaxInputSize int64 }
+		err = json.NewDecoder(resp.Body).Decode(&status)
+		resp.Body.Close()
+		if err != nil || status.MaxInputSize <= 0 {
+			continue
+		}
+		for _, filePath := range files {
+			info, err := os.Stat(filePath)
+			if err != nil {
+				return fmt.Errorf("failed to stat %s: %w", filePath, err)
+			}
+			if info.Size() > status.MaxInputSize {
+				return fmt.Errorf("%s is %s, but %s accepts job files of at most %s", filePath, formatBytes(info.Size()), peer, formatBytes(status.MaxInputSize))
+			}
+		}
+	}
+	return nil
+}
+
+// loadUploadCache reads the upload cache, returning an empty cache if it is missing or unreadable
+func loadUploadCache() map[string]CachedUpload {
+	cache := make(map[string]CachedUpload)
+	data, err := os.ReadFile(uploadCacheFile)
+	if err != nil {
+		return cache
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		fmt.Printf("Ignoring corrupt upload cache: %v\n", err)
+		return make(map[string]CachedUpload)
+	}
+	return cache
+}
+
+// saveUploadCache writes the upload cache
+func saveUploadCache(cache map[string]CachedUpload) error {
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode upload cache: %w", err)
+	}
+	return os.WriteFile(uploadCacheFile, data, 0644)
+}
+
+// uploadWithCache uploads a file unless an unchanged copy was already uploaded to the same IPFS API with the
+// same chunker
+func uploadWithCache(filePath string, cache map[string]CachedUpload, force bool, retries int) (string, bool, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to stat file: %w", err)
+	}
+	key, err := filepath.Abs(filePath)
+	if err != nil {
+		key = filePath
+	}
+
+	entry, ok := cache[key]
+	if ok && !force && entry.ModTime == info.ModTime().UnixNano() && entry.Size == info.Size() && entry.API == ipfsAPIURL && entry.Chunker == ipfsChunker {
+		return entry.CID, true, nil
+	}
+
+	hash, err := uploadWithRetries(filePath, retries)
+	if err != nil {
+		return "", false, err
+	}
+	cache[key] = CachedUpload{ModTime: info.ModTime().UnixNano(), Size: info.Size(), CID: hash, API: ipfsAPIURL, Chunker: ipfsChunker}
+	return hash, false, nil
+}
+
+var tailscaleSocket = "/var/run/tailscale/tailscaled.sock" // Unix socket of the local tailscaled's LocalAPI
+var tailscaleTag string                                    // ACL tag of the tailnet devices used as miners, every online device when empty
+
+// TailscaleStatus is the part of the tailnet status, as served by the tailscaled LocalAPI, that the client reads
+type TailscaleStatus struct {
+	Peer map[string]struct {
+		TailscaleIPs []string // Tailnet addresses of the device, IPv4 first
+		Online       bool     // Whether the device is connected to the tailnet
+		Tags         []string // ACL tags of the device, such as tag:ipfs-miner
+	}
+}
+
+// fetchTailscaleStatus reads the tailnet status from the tailscaled LocalAPI, falling back to the tailscale CLI
+// where the socket is not available, such as on macOS
+func fetchTailscaleStatus() (TailscaleStatus, error) {
+	var status TailscaleStatus
+	var data []byte
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", tailscaleSocket)
+		}},
+	}
+	resp, err := client.Get("http://local-tailscaled.sock/localapi/v0/status")
+	if err == nil {
+		data, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err == nil && resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("tailscaled returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+		}
+	}
+	if err != nil {
+		var cliErr error
+		if data, cliErr = exec.Command("tailscale", "status", "--json").Output(); cliErr != nil {
+			return status, fmt.Errorf("failed to query tailscaled at %s (%v) or run 'tailscale status --json': %w", tailscaleSocket, err, cliErr)
+		}
+	}
+	if err := json.Unmarshal(data, &status); err != nil {
+		return status, fmt.Errorf("failed to decode the tailnet status: %w", err)
+	}
+	return status, nil
+}
+
+// getTailscalePeers retrieves the online Tailscale-connected peers, only those tagged tailscaleTag when it is set
+func getTailscalePeers() ([]string, error) {
+	status, err := fetchTailscaleStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	peers := []string{}
+	for _, device := range status.Peer {
+		if !device.Online || len(device.TailscaleIPs) == 0 {
+			continue
+		}
+		if tailscaleTag != "" && !slices.Contains(device.Tags, tailscaleTag) {
+			continue
+		}
+		// The first address is the peer's IPv4 Tailscale address, or its IPv6 one on IPv6-only tailnets
+		if addr, err := netip.ParseAddr(device.TailscaleIPs[0]); err == nil {
+			peers = append(peers, addr.Unmap().String())
+		}
+	}
+	sort.Strings(peers)
+	if len(peers) == 0 && tailscaleTag != "" {
+		return nil, fmt.Errorf("no online tailnet device is tagged %s", tailscaleTag)
+	}
+
+	// Print peers
+	fmt.Println("Tailscale peers: ", peers)
+
+	return peers, nil
+}
+
+// minerURL returns the URL of path on a miner, bracketing IPv6 addresses
+func minerURL(peer, path string) string {
+	host := strings.TrimSuffix(strings.TrimPrefix(peer, "["), "]")
+	return peerScheme + "://" + net.JoinHostPort(host, "8080") + path
+}
+
+// SubmissionLine is a line of a streamed job submission, sent for each file and answered by the miner with an
+// acknowledgement or an error, followed by a final line with the outcome
+type SubmissionLine struct {
+	CID    string            // IPFS hash of a file, echoed in its acknowledgement
+	Line   int               // Number of the acknowledged line, counting from 1
+	Error  string            // Why the miner refused the line
+	Done   bool              // Whether this is the final line
+	Status int               // HTTP status of the submission, in the final line
+	Header map[string]string // Headers of the outcome, in the final line
+	Body   string            // Body of the outcome, in the final line
+}
+
+// streamHashes submits the hashes one NDJSON line at a time, keeping no more lines unacknowledged than the
+// miner's X-Submission-Window allows, and returns the status and headers of the outcome
+func streamHashes(newRequest func(io.Reader) (*http.Request, error), hashList []string) (int, http.Header, error) {
+	reader, writer := io.Pipe()
+	defer writer.Close()
+	req, err := newRequest(reader)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	resp, err := peerClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "application/x-ndjson" {
+		// Refused before the stream started, or by a miner that does not stream
+		io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode, resp.Header, nil
+	}
+	window, err := strconv.Atoi(resp.Header.Get("X-Submission-Window"))
+	if err != nil || window < 1 {
+		window = 1
+	}
+
+	encoder, decoder := json.NewEncoder(writer), json.NewDecoder(resp.Body)
+	sent, acknowledged := 0, 0
+	for {
+		for sent < len(hashList) && sent-acknowledged < window {
+			if err := encoder.Encode(SubmissionLine{CID: hashList[sent]}); err != nil {
+				return 0, nil, fmt.Errorf("failed to send line %d: %w", sent+1, err)
+			}
+			sent++
+		}
+		if sent == len(hashList) {
+			writer.Close()
+		}
+		var line SubmissionLine
+		if err := decoder.Decode(&line); err != nil {
+			return 0, nil, fmt.Errorf("stream ended without an outcome: %w", err)
+		}
+		switch {
+		case line.Done:
+			header := make(http.Header)
+			for name, value := range line.Header {
+				header.Set(name, value)
+			}
+			if line.Status != http.StatusOK && line.Status != http.StatusAccepted {
+				fmt.Printf("Miner answered: %s\n", strings.TrimSpace(line.Body))
+			}
+			return line.Status, header, nil
+		case line.Error != "":
+			fmt.Printf("Miner refused line %d: %s\n", line.Line, line.Error)
+			writer.Close()
+		default:
+			acknowledged = line.Line
+		}
+	}
+}
+
+// sendHashToTailscalePeers sends the job's hashes to all Tailscale-connected peers: as one comma-separated string
+// for a script and its input file, streamed line by line when the job has further input files
+func sendHashToTailscalePeers(hashList []string, jobID string, job JobTemplate, encryptTo, submitterKey string, peers []string) {
+	hashes := strings.Join(hashList, ",")
+	args, outputSchema := job.Args, job.OutputSchema
+	encodedArgs, err := json.Marshal(args)
+	if err != nil {
+		fmt.Printf("Error encoding job arguments: %v\n", err)
+		return
+	}
+	// Headers cannot span lines, so the schema is sent compacted
+	var schema bytes.Buffer
+	if len(outputSchema) > 0 {
+		if err := json.Compact(&schema, outputSchema); err != nil {
+			fmt.Printf("Error encoding output schema: %v\n", err)
+			return
+		}
+	}
+	labels := make([]string, 0, len(job.Labels))
+	for key, value := range job.Labels {
+		labels = append(labels, key+"="+value)
+	}
+	sort.Strings(labels)
+	for _, peer := range peers {
+		url := minerURL(peer, "/jobs") // Assuming peers listen on port 8080
+		nonce, challenge := "", ""
+		status := 0
+		newRequest := func(body io.Reader) (*http.Request, error) {
+			req, err := http.NewRequest(http.MethodPost, url, body)
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Content-Type", "text/plain")
+			req.Header.Set("X-Job-ID", jobID)
+			req.Header.Set("Idempotency-Key", jobID) // Resubmissions return the existing job instead of rerunning it
+			if len(args) > 0 {
+				req.Header.Set("X-Job-Args", string(encodedArgs))
+			}
+			if schema.Len() > 0 {
+				req.Header.Set("X-Job-Output-Schema", schema.String())
+			}
+			if len(labels) > 0 {
+				req.Header.Set("X-Job-Labels", strings.Join(labels, ","))
+			}
+			if encryptTo != "" {
+				req.Header.Set("X-Job-Encrypt-To", encryptTo)
+			}
+			if submitterKey != "" {
+				req.Header.Set("X-Submitter-Key", submitterKey)
+			}
+			if job.ScriptSignature != "" {
+				req.Header.Set("X-Job-Script-Signature", job.ScriptSignature)
+			}
+			if job.Network != "" {
+				req.Header.Set("X-Job-Network", job.Network)
+			}
+			if job.Priority != "" {
+				req.Header.Set("X-Job-Priority", job.Priority)
+			}
+			if job.Fee > 0 {
+				req.Header.Set("X-Job-Fee", strconv.FormatInt(job.Fee, 10))
+			}
+			if nonce != "" {
+				req.Header.Set("X-Job-PoW", nonce)
+				req.Header.Set("X-Job-PoW-Challenge", challenge)
+			}
+			return req, nil
+		}
+		for attempt := 0; attempt <= maxPoWAttempts; attempt++ {
+			var header http.Header
+			var err error
+			if len(hashList) > 2 {
+				status, header, err = streamHashes(newRequest, hashList)
+			} else {
+				var req *http.Request
+				var resp *http.Response
+				if req, err = newRequest(strings.NewReader(hashes)); err == nil {
+					if resp, err = peerClient.Do(req); err == nil {
+						resp.Body.Close()
+						status, header = resp.StatusCode, resp.Header
+					}
+				}
+			}
+			if err != nil {
+				fmt.Printf("Error sending hash to %s: %v\n", peer, err)
+				status = 0
+				break
+			}
+
+			// Peers with spam protection announce the proof of work they require and the challenge it must
+			// cover; the difficulty rises with their load and challenges expire, so both may change between
+			// attempts
+			difficulty, err := strconv.Atoi(header.Get("X-PoW-Difficulty"))
+			if status != http.StatusPreconditionRequired || err != nil {
+				break
+			}
+			fmt.Printf("%s requires a proof of work of %d bits, solving...\n", peer, difficulty)
+			challenge = header.Get("X-PoW-Challenge")
+			nonce = blockchain.SolveSubmissionPoW(jobID, hashes, args, challenge, difficulty)
+		}
+		if status == 0 {
+			continue
+		}
+		if status == http.StatusOK {
+			fmt.Printf("Successfully sent hash to %s\n", peer)
+		} else if status == http.StatusAccepted {
+			fmt.Printf("Job %s is awaiting approval on %s\n", jobID, peer)
+		} else {
+			fmt.Printf("Failed to send hash to %s, status: %d\n", peer, status)
+		}
+	}
+}
+
+// queryJobStatus fetches the status of a job from a peer, returning nil if the peer does not know the job
+func queryJobStatus(peer, jobID string) (*JobStatus, error) {
+	url := minerURL(peer, "/job?id="+jobID)
+	resp, err := peerClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query job status: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("job status query failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var status JobStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("failed to decode job status: %w", err)
+	}
+	return &status, nil
+}
+
+// waitForConfirmation polls the peers until the job is confirmed or confirmBlocks blocks pass without it.
+// When the job is not confirmed, it returns the peers that lost or failed the job and can take a resubmission.
+func waitForConfirmation(jobID string, peers []string, confirmBlocks int, pollInterval, timeout time.Duration) (bool, []string) {
+	startHeight := -1
+	deadline := time.Now().Add(timeout)
+	for {
+		maxHeight := -1
+		retryPeers := []string{}
+		awaitingApproval := false
+		for _, peer := range peers {
+			status, err := queryJobStatus(peer, jobID)
+			if err != nil {
+				fmt.Printf("Error querying job status from %s: %v\n", peer, err)
+				continue
+			}
+			if status == nil || status.Status == "failed" {
+				retryPeers = append(retryPeers, peer)
+				continue
+			}
+			if status.Status == "confirmed" {
+				fmt.Printf("Job %s confirmed by %s in block %d\n", jobID, peer, status.BlockNumber)
+				if status.OutputCID != "" {
+					fmt.Printf("The recorded output was truncated; the full output is at /ipfs/%s\n", status.OutputCID)
+				}
+				return true, nil
+			}
+			if status.Status == "rejected" {
+				fmt.Printf("Job %s was rejected by the approvers of %s: %s\n", jobID, peer, status.Error)
+				return false, nil
+			}
+			if status.Status == "awaiting-approval" {
+				awaitingApproval = true
+			}
+			if status.Height > maxHeight {
+				maxHeight = status.Height
+			}
+		}
+
+		if len(retryPeers) == len(peers) {
+			fmt.Printf("No peer is executing job %s\n", jobID)
+			return false, retryPeers
+		}
+		if startHeight < 0 || awaitingApproval {
+			// Blocks mined while approvers deliberate do not count against the confirmation window
+			startHeight = maxHeight
+		}
+		if startHeight >= 0 && maxHeight-startHeight >= confirmBlocks {
+			fmt.Printf("Job %s not confirmed within %d blocks\n", jobID, confirmBlocks)
+			return false, retryPeers
+		}
+		if time.Now().After(deadline) {
+			fmt.Printf("Job %s not confirmed within %s\n", jobID, timeout)
+			return false, retryPeers
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// streamJobOutput prints a job's output lines as the peer's server-sent events arrive.
+// The job only becomes known to the peer once its submission is received, so missing jobs are retried briefly.
+func streamJobOutput(peer, jobID string) {
+	url := minerURL(peer, "/job/stream?id="+jobID)
+	for attempt := 0; attempt < 20; attempt++ {
+		resp, err := peerClient.Get(url)
+		if err != nil {
+			fmt.Printf("Error streaming job output from %s: %v\n", peer, err)
+			return
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			time.Sleep(500 * time.Millisecond)
+			continue
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			fmt.Printf("Failed to stream job output from %s, status: %d\n", peer, resp.StatusCode)
+			return
+		}
+
+		event := ""
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: ") && event == "line":
+				fmt.Printf("[%s] %s\n", peer, strings.TrimPrefix(line, "data: "))
+			case strings.HasPrefix(line, "data: ") && event == "done":
+				fmt.Printf("[%s] job finished with status %s\n", peer, strings.TrimPrefix(line, "data: "))
+				return
+			}
+		}
+		return
+	}
+}
+
+// loadResultKey reads the X25519 key results are encrypted for, creating it on first use
+func loadResultKey(path string) (*ecdh.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		key, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, []byte(hex.EncodeToString(key.Bytes())+"\n"), 0600); err != nil {
+			return nil, fmt.Errorf("failed to save result key: %w", err)
+		}
+		fmt.Printf("Created result key %s\n", path)
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read result key: %w", err)
+	}
+	raw, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("result key %s is not hex-encoded", path)
+	}
+	return ecdh.X25519().NewPrivateKey(raw)
+}
+
+// loadSubmitterKey reads the ed25519 key confirmed usage is co-signed with, creating it on first use
+func loadSubmitterKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		seed := make([]byte, ed25519.SeedSize)
+		if _, err := rand.Read(seed); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, []byte(hex.EncodeToString(seed)+"\n"), 0600); err != nil {
+			return nil, fmt.Errorf("failed to save submitter key: %w", err)
+		}
+		fmt.Printf("Created submitter key %s\n", path)
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read submitter key: %w", err)
+	}
+	seed, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("submitter key %s is not a hex-encoded ed25519 seed", path)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// cosignUsage co-signs the usage a confirmed job's transaction records and posts the receipt to the peers, which
+// keep it for billing. Usage is only co-signed once its Merkle proof leads to a block that hashes correctly.
+func cosignUsage(jobID string, peers []string, key ed25519.PrivateKey) {
+	for _, peer := range peers {
+		proof, err := fetchTxProof(peer, jobID)
+		if err != nil || proof == nil {
+			continue
+		}
+		var tx blockchain.Transaction
+		if err := json.Unmarshal(proof.Transaction, &tx); err != nil || tx.JobID != jobID {
+			fmt.Printf("Not co-signing the usage of job %s: %s served another transaction\n", jobID, peer)
+			continue
+		}
+		root, err := blockchain.ProofRoot(*proof)
+		if err != nil || root != proof.Header.TxRoot || blockchain.BlockHash(proof.Header) != proof.Header.Hash {
+			fmt.Printf("Not co-signing the usage of job %s: the proof from %s does not lead to its block\n", jobID, peer)
+			continue
+		}
+
+		receipt := blockchain.UsageReceipt{JobID: jobID, Signature: hex.EncodeToString(ed25519.Sign(key, blockchain.ReceiptMessage(tx)))}
+		body, _ := json.Marshal(receipt)
+		resp, err := peerClient.Post(minerURL(peer, "/job/receipt"), "application/json", bytes.NewReader(body))
+		if err != nil {
+			fmt.Printf("Error sending the usage receipt of job %s to %s: %v\n", jobID, peer, err)
+			continue
+		}
+		reply, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusNoContent:
+			fmt.Printf("Co-signed the usage of job %s for %s: %.3f CPU seconds, %.3f wall seconds, fee %d\n", jobID, peer, float64(tx.CPUTime)/1000, float64(tx.ExecutionTime)/1000, tx.Fee)
+		case http.StatusNotFound:
+			// The job was submitted to another peer, which keeps its receipt
+		default:
+			fmt.Printf("%s refused the usage receipt of job %s with status %d: %s\n", peer, jobID, resp.StatusCode, strings.TrimSpace(string(reply)))
+		}
+	}
+}
+
+// fetchEncryptedResult downloads a confirmed job's encrypted result from IPFS and prints it decrypted
+func fetchEncryptedResult(jobID string, peers []string, key *ecdh.PrivateKey) {
+	for _, peer := range peers {
+		status, err := queryJobStatus(peer, jobID)
+		if err != nil || status == nil || status.ResultCID == "" {
+			continue
+		}
+		sealed, err := blockchain.CatFromIPFS(ipfsAPIURL, status.ResultCID, maxResultSize)
+		if err != nil {
+			fmt.Printf("Error downloading result %s: %v\n", status.ResultCID, err)
+			return
+		}
+		result, err := blockchain.OpenResult(key, jobID, sealed)
+		if err != nil {
+			fmt.Printf("Error decrypting result %s: %v\n", status.ResultCID, err)
+			return
+		}
+		fmt.Printf("Result of job %s:\n%s", jobID, result)
+		return
+	}
+	fmt.Printf("No peer reported an encrypted result for job %s\n", jobID)
+}
+
+// fetchTxProof fetches the Merkle proof of a job's transaction from a miner, nil when it is not confirmed there
+func fetchTxProof(peer, jobID string) (*blockchain.TxProof, error) {
+	resp, err := peerClient.Get(minerURL(peer, "/tx/proof?id="+url.QueryEscape(jobID)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query the transaction proof: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("transaction proof query failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var proof blockchain.TxProof
+	if err := json.NewDecoder(resp.Body).Decode(&proof); err != nil {
+		return nil, fmt.Errorf("failed to decode the transaction proof: %w", err)
+	}
+	return &proof, nil
+}
+
+// verifyTransaction checks a job's transaction against the chain and its result against IPFS: the Merkle proof
+// must lead to the block's transaction root, the block hash must carry its proof of work, every other peer must
+// hold the same block, and the content in IPFS must hash to what the transaction recorded. It reports every check
+// and returns whether all of them passed.
+func verifyTransaction(jobID string, peers []string, key *ecdh.PrivateKey) bool {
+	ok := true
+	check := func(passed bool, format string, args ...interface{}) {
+		status := "PASS"
+		if !passed {
+			status, ok = "FAIL", false
+		}
+		fmt.Printf("%s  %s\n", status, fmt.Sprintf(format, args...))
+	}
+
+	var proof *blockchain.TxProof
+	var source string
+	for _, peer := range peers {
+		var err error
+		proof, err = fetchTxProof(peer, jobID)
+		if err != nil {
+			fmt.Printf("Error querying %s: %v\n", peer, err)
+			continue
+		}
+		if proof != nil {
+			source = peer
+			break
+		}
+	}
+	if proof == nil {
+		fmt.Printf("No peer holds a confirmed transaction for job %s\n", jobID)
+		return false
+	}
+	header := proof.Header
+	fmt.Printf("Transaction of job %s is at position %d of block %d (%s), proof from %s\n", jobID, proof.Index, header.BlockNumber, header.Hash, source)
+
+	var tx blockchain.Transaction
+	if err := json.Unmarshal(proof.Transaction, &tx); err != nil {
+		check(false, "transaction decodes: %v", err)
+		return false
+	}
+	check(tx.JobID == jobID, "transaction belongs to job %s", jobID)
+	root, err := blockchain.ProofRoot(*proof)
+	if err != nil {
+		check(false, "Merkle proof: %v", err)
+	} else {
+		check(root == header.TxRoot, "Merkle proof leads to the block's transaction root %s", header.TxRoot)
+	}
+	check(blockchain.BlockHash(header) == header.Hash, "block hash matches the block header")
+	check(blockchain.ValidProof(header.Hash, header.Difficulty), "block hash meets difficulty %d", header.Difficulty)
+
+	// The proof came from a single peer; the others must agree on the block at that height
+	for _, peer := range peers {
+		if peer == source {
+			continue
+		}
+		resp, err := peerClient.Get(minerURL(peer, "/block?number="+strconv.Itoa(header.BlockNumber)))
+		if err != nil {
+			fmt.Printf("SKIP  %s is unreachable: %v\n", peer, err)
+			continue
+		}
+		var block blockchain.BlockHeader
+		err = json.NewDecoder(resp.Body).Decode(&block)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || err != nil {
+			fmt.Printf("SKIP  %s does not have block %d\n", peer, header.BlockNumber)
+			continue
+		}
+		check(block.Hash == header.Hash, "%s holds the same block %d", peer, header.BlockNumber)
+	}
+
+	switch {
+	case tx.ResultCID != "":
+		sealed, err := blockchain.CatFromIPFS(ipfsAPIURL, tx.ResultCID, maxResultSize)
+		if err != nil {
+			check(false, "encrypted result %s downloads from IPFS: %v", tx.ResultCID, err)
+			break
+		}
+		if key == nil {
+			fmt.Printf("SKIP  result %s is encrypted; pass -encrypt-key to check its hash\n", tx.ResultCID)
+			break
+		}
+		result, err := blockchain.OpenResult(key, jobID, sealed)
+		if err != nil {
+			check(false, "encrypted result %s decrypts: %v", tx.ResultCID, err)
+			break
+		}
+		check(fmt.Sprintf("%x", sha256.Sum256(result)) == tx.ResultHash, "result %s hashes to the recorded %s", tx.ResultCID, tx.ResultHash)
+	case tx.OutputCID != "":
+		output, err := blockchain.CatFromIPFS(ipfsAPIURL, tx.OutputCID, tx.OutputSize+1)
+		if err != nil {
+			check(false, "full output %s downloads from IPFS: %v", tx.OutputCID, err)
+			break
+		}
+		check(int64(len(output)) == tx.OutputSize, "full output %s is %d bytes", tx.OutputCID, tx.OutputSize)
+		check(fmt.Sprintf("%x", sha256.Sum256(output)) == tx.OutputHash, "full output %s hashes to the recorded %s", tx.OutputCID, tx.OutputHash)
+		check(bytes.HasPrefix(output, []byte(tx.Data)), "recorded output is the beginning of the full output")
+	default:
+		// The result is recorded in the transaction itself, so the Merkle proof already covers it
+		fmt.Printf("PASS  result is recorded on chain, SHA-256 %x\n", sha256.Sum256([]byte(tx.Data)))
+	}
+
+	if ok {
+		fmt.Printf("Job %s is verified\n", jobID)
+	} else {
+		fmt.Printf("Job %s FAILED verification\n", jobID)
+	}
+	return ok
+}
+
+// runVerify verifies a job's transaction and result, exiting with status 1 when a check fails
+func runVerify(args []string, key *ecdh.PrivateKey) {
+	verifyFlags := flag.NewFlagSet("verify", flag.ExitOnError)
+	jobID := verifyFlags.String("tx", "", "ID of the job whose transaction is verified")
+	peerList := verifyFlags.String("peers", "", "Comma-separated miners to check against; Tailscale peers are used when empty")
+	verifyFlags.Parse(args)
+	if *jobID == "" {
+		fmt.Println("Usage: client verify --tx <job id> [--peers a,b]")
+		os.Exit(2)
+	}
+
+	peers := []string{}
+	for _, peer := range strings.Split(*peerList, ",") {
+		if peer = strings.TrimSpace(peer); peer != "" {
+			peers = append(peers, peer)
+		}
+	}
+	if len(peers) == 0 {
+		var err error
+		peers, err = getTailscalePeers()
+		if err != nil {
+			fmt.Printf("Error retrieving Tailscale peers: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if !verifyTransaction(*jobID, peers, key) {
+		os.Exit(1)
+	}
+}
+
+// loadJobTemplates reads the named job templates from a JSON file
+func loadJobTemplates(path string) (map[string]JobTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read templates file: %w", err)
+	}
+	templates := make(map[string]JobTemplate)
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return nil, fmt.Errorf("failed to parse templates file: %w", err)
+	}
+	return templates, nil
+}
+
+// submitJob uploads the job's files and sends it to the peers, resubmitting until it confirms
+func submitJob(job JobTemplate, opts SubmitOptions) {
+	// Use the job's peers, or retrieve Tailscale-connected peers
+	peers := job.Peers
+	if len(peers) == 0 {
+		var err error
+		peers, err = getTailscalePeers()
+		if err != nil {
+			fmt.Printf("Error retrieving Tailscale peers: %v\n", err)
+			return
+		}
+	}
+
+	// List of files to upload, checked against the peers' limits before a large upload starts
+	files := append([]string{job.Script, job.Input}, job.Inputs...)
+	hashList := []string{}
+	if err := checkInputSizes(files, peers); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	// Upload files and store hashes, skipping files that have not changed since their last upload
+	cache := loadUploadCache()
+	for _, filePath := range files {
+		hash, cached, err := uploadWithCache(filePath, cache, opts.Force, opts.UploadRetries)
+		if err != nil {
+			fmt.Printf("Error uploading %s: %v\n", filePath, err)
+			return
+		}
+		hashList = append(hashList, hash) // Keep the order of files; miners expect the script first
+		if cached {
+			fmt.Printf("Skipped unchanged %s, cached hash: %s\n", filePath, hash)
+		} else {
+			fmt.Printf("Uploaded %s to IPFS with hash: %s\n", filePath, hash)
+		}
+	}
+	if err := saveUploadCache(cache); err != nil {
+		fmt.Printf("Error saving upload cache: %v\n", err)
+	}
+
+	// Send hashes to all peers, resubmitting to peers that lost or failed the job until it confirms.
+	// The job ID is reused on every attempt so miners can recognise a resubmission.
+	jobID := blockchain.GenerateJobID()
+	encryptTo, submitterKey := "", ""
+	if opts.SubmitterKey != nil {
+		submitterKey = hex.EncodeToString(opts.SubmitterKey.Public().(ed25519.PublicKey))
+	}
+	if opts.ResultKey != nil {
+		encryptTo = hex.EncodeToString(opts.ResultKey.PublicKey().Bytes())
+		if opts.Stream {
+			fmt.Println("The output of encrypted jobs is not streamed; only their completion is reported")
+		}
+	}
+	if opts.Stream && len(peers) > 0 {
+		go streamJobOutput(peers[0], jobID)
+	}
+	targets := peers
+	for attempt := 0; attempt <= opts.MaxRetries; attempt++ {
+		if len(targets) > 0 {
+			sendHashToTailscalePeers(hashList, jobID, job, encryptTo, submitterKey, targets)
+		}
+		confirmed, retryPeers := waitForConfirmation(jobID, peers, opts.ConfirmBlocks, opts.PollInterval, opts.ConfirmTimeout)
+		if confirmed {
+			if opts.ResultKey != nil {
+				fetchEncryptedResult(jobID, peers, opts.ResultKey)
+			}
+			if opts.SubmitterKey != nil {
+				cosignUsage(jobID, peers, opts.SubmitterKey)
+			}
+			return
+		}
+		if len(retryPeers) == 0 {
+			fmt.Printf("No peer available to fail over job %s to, waiting for pending executions\n", jobID)
+		}
+		targets = retryPeers
+	}
+	fmt.Printf("Job %s was not confirmed after %d retries\n", jobID, opts.MaxRetries)
+}
+
+// runTemplate runs a named job template, letting the command line override its input, arguments and fee
+func runTemplate(args []string, templatesFile string, opts SubmitOptions) {
+	if len(args) == 0 {
+		fmt.Println("Usage: client run <template> [--input file] [--args a,b] [--labels key=value,...] [--fee n]")
+		return
+	}
+	templates, err := loadJobTemplates(templatesFile)
+	if err != nil {
+		fmt.Printf("Error loading job templates: %v\n", err)
+		return
+	}
+	job, ok := templates[args[0]]
+	if !ok {
+		fmt.Printf("Unknown job template %q in %s\n", args[0], templatesFile)
+		return
+	}
+
+	runFlags := flag.NewFlagSet("run", flag.ExitOnError)
+	input := runFlags.String("input", job.Input, "Input file passed to the script")
+	extraArgs := runFlags.String("args", strings.Join(job.Args, ","), "Comma-separated arguments passed to the script")
+	labels := runFlags.String("labels", "", "Comma-separated key=value labels added to the template's labels")
+	fee := runFlags.Int64("fee", job.Fee, "Fee offered for the job")
+	runFlags.Parse(args[1:])
+
+	if *fee < 0 {
+		fmt.Printf("Invalid fee %d: fees cannot be negative\n", *fee)
+		return
+	}
+	job.Input, job.Fee = *input, *fee
+	job.Args = nil
+	for _, arg := range strings.Split(*extraArgs, ",") {
+		if arg = strings.TrimSpace(arg); arg != "" {
+			job.Args = append(job.Args, arg)
+		}
+	}
+	if *labels != "" {
+		merged := make(map[string]string, len(job.Labels))
+		for key, value := range job.Labels {
+			merged[key] = value
+		}
+		for _, pair := range strings.Split(*labels, ",") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if !ok {
+				fmt.Printf("Label %q is not of the form key=value\n", pair)
+				return
+			}
+			merged[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+		job.Labels = merged
+	}
+	if job.Script == "" || job.Input == "" {
+		fmt.Printf("Job template %q needs a script and an input file\n", args[0])
+		return
+	}
+	submitJob(job, opts)
+}
+
+func main() {
+	var opts SubmitOptions
+	flag.IntVar(&opts.ConfirmBlocks, "confirm-blocks", 6, "Number of blocks to wait for the job's transaction before resubmitting")
+	flag.IntVar(&opts.MaxRetries, "max-retries", 3, "Maximum number of resubmissions of an unconfirmed job")
+	flag.DurationVar(&opts.PollInterval, "poll-interval", 5*time.Second, "Interval between job status checks")
+	flag.DurationVar(&opts.ConfirmTimeout, "confirm-timeout", 10*time.Minute, "Maximum time to wait for confirmation per attempt")
+	flag.StringVar(&ipfsAPIURL, "ipfs-api", ipfsAPIURL, "IPFS RPC API URL used to upload files")
+	flag.StringVar(&ipfsChunker, "chunker", ipfsChunker, "IPFS chunker files are added with, such as size-1048576 or rabin")
+	flag.IntVar(&opts.UploadRetries, "upload-retries", 3, "Upload attempts after the first for each file")
+	flag.BoolVar(&opts.Force, "force", false, "Upload files even if an unchanged copy is in the upload cache")
+	flag.BoolVar(&opts.Stream, "stream", false, "Stream the job's output from the first peer while it runs")
+	templatesFile := flag.String("templates", "jobs.json", "File with named job templates used by the run command")
+	tlsCert := flag.String("tls-cert", "", "PEM client certificate for miners that require mutual TLS")
+	tlsKey := flag.String("tls-key", "", "PEM private key of the -tls-cert certificate")
+	tlsPeers := flag.String("tls-peers", "tls-peers.txt", "File listing the SHA-256 fingerprints of the miners' certificates")
+	flag.StringVar(&tailscaleTag, "tailscale-tag", "", "ACL tag, such as tag:ipfs-miner, of the tailnet devices used as miners; every online device when empty")
+	flag.StringVar(&tailscaleSocket, "tailscale-socket", tailscaleSocket, "Unix socket of the tailscaled LocalAPI")
+	resultKey := flag.String("encrypt-key", "", "X25519 key file the result is encrypted for, created if missing; the result is public when empty")
+	submitterKey := flag.String("submitter-key", "submitter.key", "Ed25519 key file confirmed usage is co-signed with, created if missing; usage is not co-signed when empty")
+	flag.Parse()
+
+	if *tlsCert != "" {
+		if err := configureTLS(*tlsCert, *tlsKey, *tlsPeers); err != nil {
+			fmt.Printf("Error configuring TLS: %v\n", err)
+			return
+		}
+	}
+
+	if *resultKey != "" {
+		key, err := loadResultKey(*resultKey)
+		if err != nil {
+			fmt.Printf("Error loading result key: %v\n", err)
+			return
+		}
+		opts.ResultKey = key
+	}
+	if *submitterKey != "" && (flag.Arg(0) == "" || flag.Arg(0) == "run") {
+		key, err := loadSubmitterKey(*submitterKey)
+		if err != nil {
+			fmt.Printf("Error loading submitter key: %v\n", err)
+			return
+		}
+		opts.SubmitterKey = key
+	}
+
+	switch flag.Arg(0) {
+	case "run":
+		runTemplate(flag.Args()[1:], *templatesFile, opts)
+		return
+	case "verify":
+		runVerify(flag.Args()[1:], opts.ResultKey)
+		return
+	}
+	submitJob(JobTemplate{Script: "algo.py", Input: "data.txt"}, opts)
+}
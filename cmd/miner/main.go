@@ -0,0 +1,9 @@
+// Command miner runs a node of the IPFS blockchain, or one of its subcommands. The node itself lives in the
+// blockchain package at the root of the module, so other programs can embed it.
+package main
+
+import blockchain "github.com/msherazsadiq/IPFSBlockchain"
+
+func main() {
+	blockchain.Main()
+}
@@ -0,0 +1,58 @@
+package blockchain
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	blocks := testBlocks(3)
+	for _, codec := range codecs {
+		t.Run(codec.Name(), func(t *testing.T) {
+			var buf bytes.Buffer
+			encoder := codec.NewEncoder(&buf)
+			for _, block := range blocks {
+				if err := encoder.Encode(block); err != nil {
+					t.Fatalf("encode block %d: %v", block.BlockNumber, err)
+				}
+			}
+			decoder := codec.NewDecoder(&buf)
+			var decoded []Block
+			for {
+				var block Block
+				err := decoder.Decode(&block)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("decode block %d: %v", len(decoded), err)
+				}
+				decoded = append(decoded, block)
+			}
+			if !reflect.DeepEqual(decoded, blocks) {
+				t.Fatalf("decoded %+v, want %+v", decoded, blocks)
+			}
+		})
+	}
+}
+
+func TestCodecTruncatedInput(t *testing.T) {
+	block := testBlocks(1)[0]
+	for _, codec := range codecs {
+		t.Run(codec.Name(), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := codec.NewEncoder(&buf).Encode(block); err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			encoded := buf.Bytes()
+			for _, size := range []int{1, len(encoded) / 2, len(encoded) - 2} {
+				var decoded Block
+				if err := codec.NewDecoder(bytes.NewReader(encoded[:size])).Decode(&decoded); err == nil {
+					t.Errorf("decoding the first %d of %d bytes succeeded", size, len(encoded))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,388 @@
+package blockchain
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"math"
+	"os"
+	"strings"
+	"testing"
+)
+
+var updateVectors = flag.Bool("update-vectors", false, "regenerate conformance/vectors.json")
+
+// vectorKey returns the deterministic key of a named party of the conformance vectors
+func vectorKey(name string) ed25519.PrivateKey {
+	seed := sha256.Sum256([]byte("conformance key " + name))
+	return ed25519.NewKeyFromSeed(seed[:])
+}
+
+// TestGenerateConformanceVectors rewrites conformance/vectors.json when run with -update-vectors. It refuses to
+// change the vectors of a version listed in frozenVectors, so they change only when conformanceVersion is raised.
+func TestGenerateConformanceVectors(t *testing.T) {
+	if !*updateVectors {
+		t.Skip("run with -update-vectors to regenerate the conformance vectors")
+	}
+	params, network, registered := networkParams, genesisHash, hooks
+	defer func() { networkParams, genesisHash, hooks = params, network, registered }()
+
+	key := vectorKey
+	pub := func(k ed25519.PrivateKey) string { return hex.EncodeToString(k.Public().(ed25519.PublicKey)) }
+	sign := func(k ed25519.PrivateKey, m []byte) string { return hex.EncodeToString(ed25519.Sign(k, m)) }
+	signers := make(map[string]ed25519.PrivateKey)
+	mine := func(b Block) Block {
+		b.TxRoot = merkleRoot(b.Transactions)
+		b.Nonce = proofOfWork(b.BlockHeader, b.Difficulty)
+		b.Hash = generateHash(b.BlockHeader, b.Nonce)
+		b.Signature = sign(signers[b.Creator], blockMessage(b.BlockHeader))
+		return b
+	}
+	raw := func(v interface{}) json.RawMessage { d, _ := json.Marshal(v); return d }
+
+	alice, bob, admin, exec, fwd, miner, validator, author, mallory := key("alice"), key("bob"), key("admin"), key("executor"), key("forwarder"), key("miner"), key("validator"), key("author"), key("mallory")
+	oracle := key("oracle")
+	for _, k := range []ed25519.PrivateKey{alice, bob, admin, exec, fwd, miner, validator, author, mallory} {
+		signers[pub(k)] = k
+	}
+	const script = "bafkreib5nstk2uu7oc2hrr6bnxadprklb4hkficsr3wuuqtkkt6oyt53dm"
+	const input = "bafkreideqme5t3sl5x42obyilta6oieevjth4c4dt54r63litof6cimrim"
+	const output = "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku"
+	v := ConformanceVectors{Version: conformanceVersion}
+	v.Params = NetworkParams{Difficulty: 2, MaxRuntime: 60, MaxOutputSize: 4096, AllowedRuntimes: []string{"python"}, Validators: []string{pub(validator)}, Admins: []string{pub(admin)},
+		MaxTransactionSize: 8192, MaxBlockSize: 65536, MaxBlockCompute: 10, Emission: EmissionSchedule{Schedule: "fixed", Reward: 50}, Upgrades: map[string]int{"compute-units": 1, "recorded-network-policy": 1, "usage-signature": 1}}
+	setNetworkParams(v.Params)
+	v.GenesisHash = genesisHash
+	hooks = lifecycleHooks{}
+
+	job := Transaction{ID: "192.0.2.10", Data: "42\n", JobID: "job-1", Executor: pub(exec), Args: []string{"--seed", "7"}, Runtime: "python", ExecutionTime: 1200, CPUTime: 900, ComputeUnits: 1, PythonHash: script, TxtHash: input, Network: "none", Labels: map[string]string{"project": "alpha"}}
+	long := strings.Repeat("0123456789abcdef", 8)
+	full := long + strings.Repeat("x", 5000)
+	fullHash := sha256.Sum256([]byte(full))
+	truncated := Transaction{ID: "192.0.2.11", Data: long, JobID: "job-2", Executor: pub(exec), Runtime: "python", ExecutionTime: 2500, CPUTime: 2100, ComputeUnits: 3, PythonHash: script, TxtHash: input, Inputs: []string{input}, Network: "egress=198.51.100.7:443", OutputCID: output, OutputSize: int64(len(full)), OutputHash: hex.EncodeToString(fullHash[:])}
+	encrypted := Transaction{ID: "192.0.2.12", JobID: "job-3", Executor: pub(exec), Runtime: "python", ExecutionTime: 300, CPUTime: 100, ComputeUnits: 1, PythonHash: script, TxtHash: input, Network: "none", ResultCID: output, ResultHash: hex.EncodeToString(fullHash[:])}
+	forwarded := Transaction{ID: "192.0.2.13", Data: "ok\n", JobID: "job-4", Executor: pub(exec), Runtime: "python", ExecutionTime: 800, CPUTime: 500, ComputeUnits: 1, PythonHash: script, TxtHash: input, Network: "none", Forwarder: pub(fwd)}
+	forwarded.ForwarderSignature = sign(fwd, forwardMessage(forwarded.JobID, forwarded.ID))
+	signUsage := func(k ed25519.PrivateKey, tx Transaction) Transaction {
+		tx.UsageSignature = sign(k, usageMessage(tx))
+		return tx
+	}
+	job, truncated, encrypted, forwarded = signUsage(exec, job), signUsage(exec, truncated), signUsage(exec, encrypted), signUsage(exec, forwarded)
+	transfer := Transaction{Type: TxTransfer, From: pub(alice), To: pub(bob), Amount: 25, Fee: 1, Nonce: 1, Timestamp: 1700000000}
+	transfer.Signature = sign(alice, transferMessage(transfer))
+	labeled := Transaction{Type: TxTransfer, From: pub(alice), To: pub(bob), Amount: 5, Nonce: 2, Timestamp: 1700000060, Labels: map[string]string{"invoice": "2023-11", "project": "alpha"}}
+	labeled.Signature = sign(alice, transferMessage(labeled))
+	revocation := Transaction{Type: TxRevocation, From: pub(admin), To: pub(mallory), Timestamp: 1700000120, Labels: map[string]string{"reason": "key-leaked"}}
+	revocation.Signature = sign(admin, transferMessage(revocation))
+
+	tv := func(name string, tx Transaction, reason string) {
+		v.Transactions = append(v.Transactions, TransactionVector{Name: name, Transaction: tx, ID: txID(tx), Valid: reason == "", Reason: reason})
+	}
+	tv("job-result", job, "")
+	tv("job-truncated-output", truncated, "")
+	tv("job-encrypted-result", encrypted, "")
+	tv("job-forwarded", forwarded, "")
+	tv("transfer", transfer, "")
+	tv("transfer-labeled", labeled, "")
+	tv("revocation", revocation, "")
+	bad := job
+	bad.Runtime = "node"
+	tv("job-runtime-not-allowed", bad, "the runtime is not in AllowedRuntimes")
+	bad = job
+	bad.CPUTime, bad.ComputeUnits = 10500, 11
+	bad = signUsage(exec, bad)
+	tv("job-over-compute-budget", bad, "the job takes more compute units than MaxBlockCompute")
+	bad = job
+	bad.ExecutionTime = 60001
+	bad = signUsage(exec, bad)
+	tv("job-over-runtime", bad, "the job ran longer than MaxRuntime")
+	bad = job
+	bad.Data = strings.Repeat("y", 4097)
+	tv("job-output-too-large", bad, "the output exceeds MaxOutputSize")
+	bad = encrypted
+	bad.Data = "42\n"
+	tv("job-encrypted-with-plaintext", bad, "an encrypted result leaves Data empty")
+	bad = truncated
+	bad.OutputSize = int64(len(truncated.Data))
+	tv("job-truncated-size-not-larger", bad, "OutputSize must exceed the recorded output")
+	bad = job
+	bad.Network = "egress=nowhere"
+	tv("job-invalid-network-policy", bad, "the network policy does not parse")
+	bad = forwarded
+	bad.ID = "192.0.2.99"
+	bad = signUsage(exec, bad)
+	tv("job-forwarder-signature-mismatch", bad, "the forwarder signed another submitter")
+	bad = forwarded
+	bad.Executor = bad.Forwarder
+	bad = signUsage(fwd, bad)
+	tv("job-forwarder-is-executor", bad, "a node cannot forward a job to itself")
+	bad = job
+	bad.Labels = map[string]string{"Project": "alpha"}
+	tv("job-invalid-label-key", bad, "label keys are lowercase")
+	bad = job
+	bad.CPUTime = -1
+	bad = signUsage(exec, bad)
+	tv("job-negative-cpu-time", bad, "usage cannot be negative")
+	bad = job
+	bad.ExecutionTime = -1
+	bad = signUsage(exec, bad)
+	tv("job-negative-execution-time", bad, "usage cannot be negative")
+	bad = job
+	bad.CPUTime = 60001
+	bad = signUsage(exec, bad)
+	tv("job-cpu-time-over-runtime", bad, "the job used more CPU time than MaxRuntime")
+	bad = job
+	bad.CPUTime = 500
+	tv("job-usage-changed", bad, "the usage signature covers a CPU time of 900ms")
+	bad = signUsage(mallory, job)
+	tv("job-usage-signed-by-other", bad, "the usage signature is not the executor's")
+	bad = job
+	bad.Data = strings.Repeat("z", 4000)
+	bad.Args = []string{strings.Repeat("a", 4200)}
+	tv("job-transaction-too-large", bad, "the serialized transaction exceeds MaxTransactionSize")
+	bad = transfer
+	bad.Amount = 250
+	tv("transfer-amount-changed", bad, "the signature covers an amount of 25")
+	bad = transfer
+	bad.To = bad.From
+	bad.Signature = sign(alice, transferMessage(bad))
+	tv("transfer-to-self", bad, "sender and recipient are the same")
+	bad = transfer
+	bad.Amount = 0
+	bad.Signature = sign(alice, transferMessage(bad))
+	tv("transfer-zero-amount", bad, "amounts must be positive")
+	bad = transfer
+	bad.Amount, bad.Fee = math.MaxInt64, 1
+	bad.Signature = sign(alice, transferMessage(bad))
+	tv("transfer-amount-and-fee-overflow", bad, "the amount and fee together exceed the largest balance")
+	bad = transfer
+	bad.Nonce = 0
+	bad.Signature = sign(alice, transferMessage(bad))
+	tv("transfer-zero-nonce", bad, "nonces start at 1")
+	bad = labeled
+	bad.Labels = map[string]string{"invoice": "2023-12", "project": "alpha"}
+	tv("transfer-label-changed", bad, "the signature covers the labels")
+	bad = revocation
+	bad.From = pub(alice)
+	bad.Signature = sign(alice, transferMessage(bad))
+	tv("revocation-not-admin", bad, "only network admins sign revocations")
+	bad = revocation
+	bad.Amount = 1
+	bad.Signature = sign(admin, transferMessage(bad))
+	tv("revocation-with-amount", bad, "revocations move no funds")
+	bad = revocation
+	bad.To = pub(admin)
+	bad.Signature = sign(admin, transferMessage(bad))
+	tv("revocation-of-admin", bad, "admin keys cannot be revoked")
+	bad = transfer
+	bad.Type = "mint"
+	bad.Signature = sign(alice, transferMessage(bad))
+	tv("unknown-type", bad, "mint is not a transaction type")
+
+	// Hashes
+	genesis := BlockHeader{PrevHash: "-1", BlockNumber: 1, Timestamp: 1700000000, Creator: pub(miner), Difficulty: 2, TxRoot: merkleRoot(nil), Nonce: 0}
+	v.Hashes = append(v.Hashes, HashVector{Name: "first-block-nonce-0", Header: genesis, Hash: generateHash(genesis, 0)})
+	h := genesis
+	h.Nonce = 123456
+	v.Hashes = append(v.Hashes, HashVector{Name: "first-block-nonce-123456", Header: h, Hash: generateHash(h, h.Nonce)})
+	h = genesis
+	h.Creator = pub(alice)
+	v.Hashes = append(v.Hashes, HashVector{Name: "creator-committed", Header: h, Hash: generateHash(h, h.Nonce)})
+	h = genesis
+	h.Timestamp = 1700000001
+	v.Hashes = append(v.Hashes, HashVector{Name: "timestamp-committed", Header: h, Hash: generateHash(h, h.Nonce)})
+	h = genesis
+	h.Difficulty = 9
+	v.Hashes = append(v.Hashes, HashVector{Name: "difficulty-committed", Header: h, Hash: generateHash(h, h.Nonce)})
+	h = genesis
+	h.PrevCID = input
+	v.Hashes = append(v.Hashes, HashVector{Name: "prev-cid-committed", Header: h, Hash: generateHash(h, h.Nonce)})
+	h = genesis
+	h.Signature = sign(miner, []byte("block|"+generateHash(genesis, 0)))
+	v.Hashes = append(v.Hashes, HashVector{Name: "signature-not-committed", Header: h, Hash: generateHash(h, h.Nonce)})
+	h = BlockHeader{PrevHash: generateHash(genesis, 0), BlockNumber: 2, Timestamp: 1700000030, Creator: pub(miner), Difficulty: 2, TxRoot: merkleRoot([]Transaction{job}), Nonce: 77}
+	v.Hashes = append(v.Hashes, HashVector{Name: "second-block", Header: h, Hash: generateHash(h, h.Nonce)})
+	attested := h
+	attested.TimeAttestation = &TimeAttestation{Source: "pool.ntp.org", Time: 1700000029, PublicKey: pub(oracle)}
+	attested.TimeAttestation.Signature = sign(oracle, timeAttestationMessage(attested, attested.TimeAttestation.Source, attested.TimeAttestation.Time))
+	v.Hashes = append(v.Hashes, HashVector{Name: "time-attested-block", Header: attested, Hash: generateHash(attested, attested.Nonce)})
+
+	// Merkle
+	sets := []struct {
+		name string
+		txs  []Transaction
+	}{{"empty", nil}, {"one", []Transaction{job}}, {"two", []Transaction{job, transfer}}, {"three", []Transaction{job, transfer, revocation}}, {"five", []Transaction{job, truncated, encrypted, forwarded, labeled}}}
+	for _, set := range sets {
+		mv := MerkleVector{Name: set.name, Transactions: set.txs, Encodings: []string{}, Leaves: []string{}, Root: merkleRoot(set.txs), Proofs: []BundleProof{}}
+		if mv.Transactions == nil {
+			mv.Transactions = []Transaction{}
+		}
+		for i, tx := range set.txs {
+			enc, _ := json.Marshal(tx)
+			leaf := txHash(tx)
+			mv.Encodings = append(mv.Encodings, string(enc))
+			mv.Leaves = append(mv.Leaves, hex.EncodeToString(leaf[:]))
+			if len(set.txs) > 1 {
+				mv.Proofs = append(mv.Proofs, BundleProof{TxID: txID(tx), Index: i, Siblings: merkleProof(set.txs, i)})
+			}
+		}
+		v.MerkleRoots = append(v.MerkleRoots, mv)
+	}
+
+	// Proof of work
+	pw := func(name, hash string, d int) {
+		v.ProofOfWork = append(v.ProofOfWork, ProofOfWorkVector{Name: name, Hash: hash, Difficulty: d, Valid: validProof(hash, d)})
+	}
+	zero := "00b" + generateHash(genesis, 0)[3:]
+	pw("difficulty-0-any-hash", generateHash(genesis, 0), 0)
+	pw("two-zeros-meet-2", zero, 2)
+	pw("two-zeros-miss-3", zero, 3)
+	pw("one-zero-misses-2", "0a"+zero[2:], 2)
+	pw("zeros-not-at-start-miss-2", "a00"+zero[3:], 2)
+	pw("six-zeros-meet-6", "000000"+zero[6:], 6)
+	pw("difficulty-longer-than-hash", "0000", 5)
+
+	// Signatures
+	b1 := mine(Block{BlockHeader: BlockHeader{PrevHash: "-1", BlockNumber: 1, Timestamp: 1700000000, Creator: pub(miner), Difficulty: 2}, BlockBody: BlockBody{Transactions: []Transaction{job, transfer, revocation}}})
+	sv := func(name, kind string, payload interface{}, message []byte, signer ed25519.PrivateKey, signature string) {
+		m, _ := conformanceMessage(kind, raw(payload))
+		if string(m) != string(message) {
+			t.Fatalf("signature vector %s: the %s payload does not build its message", name, kind)
+		}
+		s, _ := hex.DecodeString(signature)
+		v.Signatures = append(v.Signatures, SignatureVector{Name: name, Kind: kind, Payload: raw(payload), Message: string(message), Signer: pub(signer), Signature: signature, Valid: ed25519.Verify(signer.Public().(ed25519.PublicKey), message, s)})
+	}
+	sv("transfer", "transfer", transfer, transferMessage(transfer), alice, transfer.Signature)
+	sv("transfer-labeled", "transfer", labeled, transferMessage(labeled), alice, labeled.Signature)
+	sv("revocation", "transfer", revocation, transferMessage(revocation), admin, revocation.Signature)
+	changed := transfer
+	changed.Fee = 2
+	sv("transfer-fee-changed", "transfer", changed, transferMessage(changed), alice, transfer.Signature)
+	sv("transfer-wrong-signer", "transfer", transfer, transferMessage(transfer), bob, transfer.Signature)
+	list := PeerList{NodeID: pub(miner), Peers: []string{"192.0.2.1:8080", "[2001:db8::1]:8080"}, Timestamp: 1700000000}
+	list.Signature = sign(miner, peerListMessage(list))
+	sv("peer-list", "peer-list", list, peerListMessage(list), miner, list.Signature)
+	reordered := list
+	reordered.Peers = []string{list.Peers[1], list.Peers[0]}
+	sv("peer-list-reordered", "peer-list", reordered, peerListMessage(reordered), miner, list.Signature)
+	vote := FinalityVote{BlockNumber: 2, BlockHash: h.PrevHash, Validator: pub(validator)}
+	vote.Signature = sign(validator, finalityVoteMessage(vote))
+	sv("finality-vote", "finality-vote", vote, finalityVoteMessage(vote), validator, vote.Signature)
+	fpayload := struct{ JobID, Submitter string }{forwarded.JobID, forwarded.ID}
+	sv("forward", "forward", fpayload, forwardMessage(fpayload.JobID, fpayload.Submitter), fwd, forwarded.ForwarderSignature)
+	other := struct{ JobID, Submitter string }{forwarded.JobID, "192.0.2.99"}
+	sv("forward-other-submitter", "forward", other, forwardMessage(other.JobID, other.Submitter), fwd, forwarded.ForwarderSignature)
+	spayload := struct{ CID string }{script}
+	sv("usage", "usage", job, usageMessage(job), exec, job.UsageSignature)
+	cheaper := job
+	cheaper.ExecutionTime = 600
+	sv("usage-time-changed", "usage", cheaper, usageMessage(cheaper), exec, job.UsageSignature)
+	paid := job
+	paid.Fee = 5
+	paid.UsageSignature = sign(exec, usageMessage(paid))
+	sv("usage-with-fee", "usage", paid, usageMessage(paid), exec, paid.UsageSignature)
+	discounted := paid
+	discounted.Fee = 1
+	sv("usage-fee-changed", "usage", discounted, usageMessage(discounted), exec, paid.UsageSignature)
+	sv("block", "block", b1.BlockHeader, blockMessage(b1.BlockHeader), miner, b1.BlockHeader.Signature)
+	sv("block-wrong-signer", "block", b1.BlockHeader, blockMessage(b1.BlockHeader), mallory, b1.BlockHeader.Signature)
+	sv("script", "script", spayload, scriptSignatureMessage(script), author, sign(author, scriptSignatureMessage(script)))
+	sv("script-truncated-signature", "script", spayload, scriptSignatureMessage(script), author, sign(author, scriptSignatureMessage(script))[:126])
+	sv("time-attestation", "time-attestation", attested, timeAttestationMessage(attested, attested.TimeAttestation.Source, attested.TimeAttestation.Time), oracle, attested.TimeAttestation.Signature)
+	moved := attested
+	moved.TimeAttestation = &TimeAttestation{Source: "pool.ntp.org", Time: 1700000099, PublicKey: pub(oracle), Signature: attested.TimeAttestation.Signature}
+	sv("time-attestation-time-changed", "time-attestation", moved, timeAttestationMessage(moved, moved.TimeAttestation.Source, moved.TimeAttestation.Time), oracle, attested.TimeAttestation.Signature)
+
+	// Blocks
+	bv := func(name string, b Block, reason string) {
+		v.Blocks = append(v.Blocks, BlockVector{Name: name, Block: b, Valid: reason == "", Reason: reason})
+		if err := validateBlock(b); (err == nil) != (reason == "") {
+			t.Fatalf("block vector %s: validation returned %v", name, err)
+		}
+	}
+	bv("first-block", b1, "")
+	b2 := mine(Block{BlockHeader: BlockHeader{PrevHash: b1.Hash, PrevCID: input, BlockNumber: 2, Timestamp: 1700000030, Creator: pub(miner), Difficulty: 2}, BlockBody: BlockBody{Transactions: []Transaction{}}})
+	bv("empty-block", b2, "")
+	b3 := mine(Block{BlockHeader: BlockHeader{PrevHash: b2.Hash, BlockNumber: 3, Timestamp: 1700000060, Creator: pub(exec), Difficulty: 2}, BlockBody: BlockBody{Transactions: []Transaction{truncated, encrypted, forwarded, labeled}}})
+	bv("mixed-block", b3, "")
+	bb := b1
+	bb.Nonce++
+	bv("hash-mismatch", bb, "the hash is not the hash of the header with its nonce")
+	bb = b1
+	for n := 0; ; n++ {
+		if hash := generateHash(bb.BlockHeader, n); !validProof(hash, 2) {
+			bb.Nonce, bb.Hash = n, hash
+			break
+		}
+	}
+	bb.Signature = sign(miner, blockMessage(bb.BlockHeader))
+	bv("difficulty-not-met", bb, "the hash does not start with two zeros")
+	bb = b1
+	bb.Difficulty = 1
+	bb = mine(bb)
+	bv("wrong-difficulty", bb, "the block was mined at difficulty 1 instead of the network's 2")
+	bb = b1
+	bb.Signature = ""
+	bv("unsigned-block", bb, "blocks carry their creator's signature")
+	bb = b1
+	bb.Signature = sign(mallory, blockMessage(bb.BlockHeader))
+	bv("signed-by-other-key", bb, "the signature is not the creator's")
+	bb = b1
+	bb.Creator = pub(alice)
+	bb = mine(bb)
+	bb.Signature = b1.Signature
+	bv("creator-replaced", bb, "the creator was replaced and the block re-mined, but the signature covers the original hash")
+	bb = b1
+	bb.Timestamp++
+	bv("timestamp-changed", bb, "the hash commits to the timestamp")
+	bb = b1
+	bb.Transactions = []Transaction{job, transfer}
+	bv("body-not-committed", bb, "the transactions do not hash to the header's transaction root")
+	bad = transfer
+	bad.Amount = 250
+	bb = mine(Block{BlockHeader: b1.BlockHeader, BlockBody: BlockBody{Transactions: []Transaction{job, bad}}})
+	bv("invalid-transaction", bb, "a transfer's signature does not cover its amount")
+	heavy := job
+	heavy.JobID, heavy.CPUTime, heavy.ComputeUnits = "job-5", 5500, 6
+	heavy = signUsage(exec, heavy)
+	heavy2 := heavy
+	heavy2.JobID = "job-6"
+	heavy2 = signUsage(exec, heavy2)
+	bb = mine(Block{BlockHeader: b1.BlockHeader, BlockBody: BlockBody{Transactions: []Transaction{heavy, heavy2}}})
+	bv("over-compute-budget", bb, "the jobs take 12 compute units together, more than MaxBlockCompute")
+	undeclared := job
+	undeclared.CPUTime = 3000
+	undeclared = signUsage(exec, undeclared)
+	bb = mine(Block{BlockHeader: b1.BlockHeader, BlockBody: BlockBody{Transactions: []Transaction{undeclared}}})
+	bv("compute-units-rule", bb, "the compute-units rule requires 3 compute units for 3000ms of CPU time")
+	unrecorded := job
+	unrecorded.Network = ""
+	bb = mine(Block{BlockHeader: b1.BlockHeader, BlockBody: BlockBody{Transactions: []Transaction{unrecorded}}})
+	bv("network-policy-rule", bb, "the recorded-network-policy rule requires jobs to record their network policy")
+	unsigned := job
+	unsigned.UsageSignature = ""
+	bb = mine(Block{BlockHeader: b1.BlockHeader, BlockBody: BlockBody{Transactions: []Transaction{unsigned}}})
+	bv("usage-signature-rule", bb, "the usage-signature rule requires jobs to carry their executor's usage signature")
+
+	for _, vector := range v.Transactions {
+		if err := validateTransaction(vector.Transaction); (err == nil) != vector.Valid {
+			t.Fatalf("transaction vector %s: validation returned %v", vector.Name, err)
+		}
+	}
+	data, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(data, '\n')
+	digest := sha256.Sum256(data)
+	if frozen, ok := frozenVectors[v.Version]; ok && frozen != hex.EncodeToString(digest[:]) {
+		t.Fatalf("the vectors of version %d are frozen and this build changes them; raise conformanceVersion if the break is deliberate", v.Version)
+	} else if !ok {
+		t.Logf("record %q for version %d in frozenVectors", hex.EncodeToString(digest[:]), v.Version)
+	}
+	if err := os.WriteFile("conformance/vectors.json", data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,49 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+)
+
+// frozenVectors holds the SHA-256 digest of conformance/vectors.json for each protocol version. A version's
+// vectors are never changed once its digest is recorded here.
+var frozenVectors = map[int]string{
+	6: "0c429a705d989dbf2ce38e79b91dc4bda32ece218ca795b1cff2631552f6e9b8",
+}
+
+func TestConformanceVectors(t *testing.T) {
+	var vectors ConformanceVectors
+	if err := json.Unmarshal(conformanceVectors, &vectors); err != nil {
+		t.Fatalf("decode vectors: %v", err)
+	}
+	params, network, registered := networkParams, genesisHash, hooks
+	defer func() { networkParams, genesisHash, hooks = params, network, registered }()
+
+	total := 0
+	checkConformance(vectors, func(passed bool, section, name, detail string) {
+		total++
+		if !passed {
+			t.Errorf("%s/%s: %s", section, name, detail)
+		}
+	})
+	if total == 0 {
+		t.Fatal("no conformance checks ran")
+	}
+}
+
+// TestConformanceVectorsFrozen checks that the embedded vectors are the ones recorded for this build's version
+func TestConformanceVectorsFrozen(t *testing.T) {
+	var vectors ConformanceVectors
+	if err := json.Unmarshal(conformanceVectors, &vectors); err != nil {
+		t.Fatalf("decode vectors: %v", err)
+	}
+	if vectors.Version != conformanceVersion {
+		t.Fatalf("vectors are for version %d, this build implements version %d", vectors.Version, conformanceVersion)
+	}
+	digest := sha256.Sum256(conformanceVectors)
+	if frozen, ok := frozenVectors[vectors.Version]; !ok || frozen != hex.EncodeToString(digest[:]) {
+		t.Fatalf("conformance/vectors.json differs from the frozen vectors of version %d", vectors.Version)
+	}
+}
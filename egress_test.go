@@ -0,0 +1,64 @@
+package blockchain
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// proxyGet sends a GET for url through the egress proxy's socket, opening the connection with opening
+func proxyGet(p *egressProxy, opening, url string) (*http.Response, error) {
+	conn, err := net.Dial("unix", p.path)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(opening)); err != nil {
+		return nil, err
+	}
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	if err := req.WriteProxy(conn); err != nil {
+		return nil, err
+	}
+	return http.ReadResponse(bufio.NewReader(conn), req)
+}
+
+func TestEgressProxy(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("reached")) }))
+	defer target.Close()
+	host := strings.TrimPrefix(target.URL, "http://")
+	t.Setenv("TMPDIR", t.TempDir())
+
+	p, err := startEgressProxy(NetworkPolicy{Egress: []string{host}})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	info, err := os.Stat(p.dir)
+	if err != nil || info.Mode().Perm() != 0700 {
+		t.Fatalf("proxy directory has mode %v, %v; want 0700", info.Mode().Perm(), err)
+	}
+
+	resp, err := proxyGet(p, p.secret+"\n", target.URL+"/")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("request with the secret failed: %v %v", resp, err)
+	}
+	resp.Body.Close()
+	resp, err = proxyGet(p, p.secret+"\n", "http://127.0.0.1:1/")
+	if err != nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("destination outside the policy returned %v %v, want 403", resp, err)
+	}
+	resp.Body.Close()
+	if resp, err := proxyGet(p, strings.Repeat("x", len(p.secret))+"\n", target.URL+"/"); err == nil {
+		resp.Body.Close()
+		t.Fatalf("request with a wrong secret returned %d", resp.StatusCode)
+	}
+
+	p.Close()
+	if _, err := os.Stat(p.dir); !os.IsNotExist(err) {
+		t.Errorf("proxy directory remains after Close: %v", err)
+	}
+}
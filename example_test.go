@@ -0,0 +1,25 @@
+package blockchain_test
+
+import (
+	"fmt"
+	"strings"
+
+	blockchain "github.com/msherazsadiq/IPFSBlockchain"
+)
+
+// ExampleValidateTx registers a custom transaction check and a block callback before running the miner
+func ExampleValidateTx() {
+	limitData := func(tx blockchain.Transaction) error {
+		if len(tx.Data) > 1024 {
+			return fmt.Errorf("transaction data is larger than 1 KiB")
+		}
+		return nil
+	}
+	blockchain.ValidateTx(limitData)
+	blockchain.OnBlockMined(func(block blockchain.Block) {
+		fmt.Printf("Mined block %d\n", block.BlockNumber)
+	})
+	// blockchain.Main() would now run the miner with the hooks in place, refusing transactions such as this one
+	fmt.Println(limitData(blockchain.Transaction{Data: strings.Repeat("x", 2048)}))
+	// Output: transaction data is larger than 1 KiB
+}
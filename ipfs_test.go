@@ -0,0 +1,48 @@
+package blockchain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/msherazsadiq/IPFSBlockchain/testutil"
+)
+
+// useIPFSMock points the node's IPFS API and gateway at a fresh IPFS mock for the duration of the test
+func useIPFSMock(t *testing.T) *testutil.IPFSMock {
+	mock, server := testutil.NewIPFSServer()
+	api, gateway, fallbacks := ipfsAPIURL, ipfsGatewayURL, ipfsFallbackGateways
+	ipfsAPIURL, ipfsGatewayURL, ipfsFallbackGateways = server.URL+"/api/v0", server.URL+"/ipfs/", nil
+	t.Cleanup(func() {
+		server.Close()
+		ipfsAPIURL, ipfsGatewayURL, ipfsFallbackGateways = api, gateway, fallbacks
+	})
+	return mock
+}
+
+func TestIPFSUploadAndFetch(t *testing.T) {
+	mock := useIPFSMock(t)
+	data := []byte("print('hello')\n")
+	cid, err := uploadBytesToIPFS("job.py", data)
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if !mock.Pinned(cid) {
+		t.Errorf("uploaded %s is not pinned", cid)
+	}
+	if stored, ok := mock.Get(cid); !ok || !bytes.Equal(stored, data) {
+		t.Fatalf("mock holds %q for %s, want %q", stored, cid, data)
+	}
+	fetched, err := fetchFromIPFS(cid, 1024)
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if !bytes.Equal(fetched, data) {
+		t.Fatalf("fetched %q, want %q", fetched, data)
+	}
+	if _, err := fetchFromIPFS(cid, int64(len(data)-1)); err == nil {
+		t.Error("fetching past the size limit succeeded")
+	}
+	if _, err := fetchFromIPFS("not a cid", 1024); err == nil {
+		t.Error("fetching an invalid CID succeeded")
+	}
+}
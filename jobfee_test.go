@@ -0,0 +1,47 @@
+package blockchain
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestUnpaidJobFees(t *testing.T) {
+	withLedger(t)
+	withChain(t, nil)
+	params := networkParams
+	networkParams = NetworkParams{}
+	t.Cleanup(func() { networkParams = params })
+
+	alice, from := testKey("alice")
+	_, bob := testKey("bob")
+	balances[from] = 1000
+	for i := 0; i < blockTransactions; i++ {
+		job := Transaction{ID: "127.0.0.1", JobID: fmt.Sprintf("greedy-%d", i), Fee: math.MaxInt64}
+		if err := admitTransaction(job); err != nil {
+			t.Fatalf("admit job: %v", err)
+		}
+	}
+	transfer := signedTransfer(alice, bob, 10, 5, 1)
+	if err := admitTransaction(transfer); err != nil {
+		t.Fatalf("admit transfer: %v", err)
+	}
+
+	// A fee nobody pays must not outrank one that is charged, nor drive up the estimate
+	if transactionPool[0].Type != TxTransfer {
+		t.Fatalf("job offering an unpaid fee was ordered ahead of a paying transfer")
+	}
+	if estimate := estimateFee(1); estimate.Fee > transfer.Fee+1 {
+		t.Fatalf("unpaid job fees raised the estimate to %d", estimate.Fee)
+	}
+
+	// Billing totals stop at the largest int64 instead of wrapping around
+	block := Block{BlockHeader: BlockHeader{BlockNumber: 1, Timestamp: time.Now().Unix()}}
+	block.Transactions = transactionPool[1:]
+	withChain(t, []Block{block})
+	report := billingReport(time.Unix(0, 0), time.Now().Add(time.Hour), "")
+	if len(report) != 1 || report[0].Fees != math.MaxInt64 {
+		t.Fatalf("billing report %+v, want the fees capped at the largest int64", report)
+	}
+}
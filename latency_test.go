@@ -0,0 +1,39 @@
+package blockchain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPeerStatePruning(t *testing.T) {
+	savedPeers, savedLatency, savedSeen := peers, peerLatency, invalidPoWSeen
+	t.Cleanup(func() { peers, peerLatency, invalidPoWSeen = savedPeers, savedLatency, savedSeen })
+	peers = []string{"192.0.2.1", "192.0.2.2"}
+	peerLatency, invalidPoWSeen = make(map[string]measuredLatency), make(map[string][]invalidAnnouncement)
+
+	// Addresses outside the peer list are not measured at all
+	recordPeerLatency("192.0.2.1", 40*time.Millisecond)
+	recordPeerLatency("192.0.2.2", 10*time.Millisecond)
+	recordPeerLatency("198.51.100.9", time.Millisecond)
+	if _, ok := peerLatency["198.51.100.9"]; ok || len(peerLatency) != 2 {
+		t.Fatalf("latencies %v, want only the two peers", peerLatency)
+	}
+	if ordered := peersByLatency(); ordered[0] != "192.0.2.2" {
+		t.Fatalf("peers ordered %v, want the faster one first", ordered)
+	}
+
+	// Stale measurements, peers that left the list and quiet announcers are dropped
+	stale := peerLatency["192.0.2.2"]
+	stale.at = time.Now().Add(-peerStateTTL - time.Minute)
+	peerLatency["192.0.2.2"] = stale
+	peerLatency["192.0.2.3"] = measuredLatency{rtt: time.Millisecond, at: time.Now()}
+	invalidPoWSeen["203.0.113.5"] = []invalidAnnouncement{{at: time.Now().Add(-invalidPoWWindow)}}
+	invalidPoWSeen["203.0.113.6"] = []invalidAnnouncement{{at: time.Now()}}
+	prunePeerState()
+	if _, ok := peerLatency["192.0.2.1"]; !ok || len(peerLatency) != 1 {
+		t.Fatalf("latencies %v after pruning, want only the fresh peer", peerLatency)
+	}
+	if _, ok := invalidPoWSeen["203.0.113.6"]; !ok || len(invalidPoWSeen) != 1 {
+		t.Fatalf("invalid proofs of work %v after pruning, want only the recent announcer", invalidPoWSeen)
+	}
+}
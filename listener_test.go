@@ -0,0 +1,66 @@
+package blockchain
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLimitListenerCapsEachClient(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := limitListener(inner, 8, 2)
+	defer listener.Close()
+
+	accepted := make(chan net.Conn, 8)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	first, second, third := dial(), dial(), dial()
+	defer first.Close()
+	defer second.Close()
+	defer third.Close()
+
+	// The third connection from the same address is closed by the listener
+	third.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := third.Read(make([]byte, 1)); err == nil {
+		t.Fatal("the connection over the per-client cap was not closed")
+	}
+	var served []net.Conn
+	for i := 0; i < 2; i++ {
+		select {
+		case conn := <-accepted:
+			served = append(served, conn)
+		case <-time.After(5 * time.Second):
+			t.Fatal("connections within the cap were not accepted")
+		}
+	}
+
+	// Closing one frees its place for the client
+	served[0].Close()
+	defer served[1].Close()
+	fourth := dial()
+	defer fourth.Close()
+	select {
+	case conn := <-accepted:
+		conn.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("a closed connection did not free its place")
+	}
+}
@@ -1,279 +1,14443 @@
-package main
+package blockchain
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"container/list"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"embed"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"html/template"
 	"io"
+	"io/fs"
+	"math"
+	"math/big"
+	"math/bits"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 const IPFSDownloadURL = "http://127.0.0.1:8080/ipfs/"
 
+var ipfsGatewayURL = IPFSDownloadURL            // Gateway used for downloads, a path prefix or a subdomain template with {cid}
+var ipfsFallbackGateways []string               // Gateways tried in order when a download from ipfsGatewayURL fails
+var ipfsAPIURL = "http://127.0.0.1:5001/api/v0" // IPFS RPC API used for uploads
+
 // Transaction represents a transaction in the blockchain
 type Transaction struct {
-	ID   string // The IP address or unique identifier of the transaction
-	Data string // The result or output of the computation
+	ID    string // The IP address or unique identifier of the transaction
+	Data  string // The result or output of the computation
+	JobID string // Identifier of the job that produced this transaction
+
+	Executor       string   // Identity of the node that executed the job
+	Args           []string // Extra arguments passed to the script after the input file
+	Runtime        string   // Runtime the job was executed with
+	ExecutionTime  int64    // Wall-clock execution time in milliseconds
+	CPUTime        int64    // CPU time consumed by the script in milliseconds
+	ComputeUnits   int64    // Share of the block's compute budget the job takes, its CPU time bucketed by computeUnits
+	UsageSignature string   // Hex-encoded signature of the executor over the job's usage, see usageMessage
+	PythonHash     string   // IPFS hash of the job's script, so any node can re-execute the job
+	TxtHash        string   // IPFS hash of the job's input file
+	Inputs         []string // IPFS hashes of further input files, passed to the script after the input file
+
+	Type      string // Transaction type, empty for job results
+	From      string // Sending node identity of a transfer
+	To        string // Receiving node identity of a transfer
+	Amount    int64  // Amount moved by a transfer
+	Timestamp int64  // Unix time a transfer was created, keeping otherwise identical transfers distinct
+	Signature string // Hex-encoded ed25519 signature of the sender over the transfer
+	Fee       int64  // Fee paid by the sender of a transfer to the block creator, or offered by the submitter of a job
+	Nonce     int64  // Position of a transfer among its sender's transfers, starting at 1
+
+	Labels map[string]string // Client-supplied metadata such as project=alpha, searchable with /tx?label=key:value
+
+	ResultCID  string // IPFS CID of the result encrypted for the submitter, which then leaves Data empty
+	ResultHash string // Hex-encoded SHA-256 hash of the plaintext of an encrypted result
+
+	OutputCID  string // IPFS CID of the full output when Data holds only its beginning, see truncateOutput
+	OutputSize int64  // Size of the full output in bytes, set with OutputCID
+	OutputHash string // Hex-encoded SHA-256 hash of the full output, set with OutputCID
+
+	Network string // Network policy the script ran under: none, egress=<host:port,...> or host; see NetworkPolicy
+
+	Forwarder          string // Identity of the node that received the job and forwarded it to the executor, empty when the executor received it
+	ForwarderSignature string // Hex-encoded signature of the forwarder over the job ID and submitter, see forwardMessage
+}
+
+// Limits on transaction labels
+const (
+	maxLabels      = 8   // Labels attached to one transaction
+	maxLabelKey    = 32  // Length of a label key
+	maxLabelValue  = 64  // Length of a label value
+	maxLabelResult = 100 // Transactions returned by a label search
+)
+
+// Transaction types
+const (
+	TxJob        = ""           // Result of a computation job
+	TxTransfer   = "transfer"   // Transfer of funds between node identities
+	TxRevocation = "revocation" // Revocation of a compromised node identity by a network admin
+)
+
+// Emission schedules of the block reward
+const (
+	EmissionFixed   = "fixed"   // Every block earns the same reward
+	EmissionHalving = "halving" // The reward halves every HalvingInterval blocks
+	EmissionNone    = "none"    // Blocks earn no reward, for private networks that do not need the incentive
+)
+
+// blockTransactions is the number of pooled transactions mined into each block
+const blockTransactions = 3
+
+const computeUnitMillis = 1000 // CPU time in milliseconds charged as one compute unit
+
+// feeHistoryBlocks is the number of recent blocks analyzed by the fee estimator
+const feeHistoryBlocks = 20
+
+// NetworkParams are the consensus parameters shared by all miners through the genesis file
+type NetworkParams struct {
+	Difficulty      int      // Proof-of-work difficulty
+	MaxRuntime      int      // Maximum execution time of a job in seconds
+	MaxOutputSize   int      // Maximum size of a job's output in bytes
+	AllowedRuntimes []string // Runtimes jobs may be executed with
+	Validators      []string // Public keys of the finality validators; empty disables the finality gadget
+	Admins          []string // Public keys allowed to sign revocation transactions; empty disables revocations
+
+	MaxTransactionSize int // Maximum size of a serialized transaction in bytes
+	MaxBlockSize       int // Maximum size of a serialized block in bytes
+	MaxBlockCompute    int // Maximum compute units of the transactions of a block
+
+	Allocations map[string]int64 // Balances credited to node identities by the first block of the chain
+	Emission    EmissionSchedule // Reward credited to the creator of each block
+
+	Upgrades map[string]int // Activation height of each consensus rule added after the chain started, see consensusRules
+}
+
+// EmissionSchedule defines the reward credited to the creator of each block
+type EmissionSchedule struct {
+	Schedule        string // One of fixed, halving or none
+	Reward          int64  // Reward of the first block, kept by every block under the fixed schedule
+	HalvingInterval int    // Number of blocks after which the halving schedule halves the reward
+}
+
+// SizeError reports a transaction or block whose serialized size exceeds the network limit
+type SizeError struct {
+	Kind  string // Either transaction or block
+	ID    string // Job ID of the transaction or hash of the block
+	Size  int    // Measured serialized size in bytes
+	Limit int    // Allowed size in bytes
+}
+
+func (e *SizeError) Error() string {
+	return fmt.Sprintf("%s %s is %d bytes, exceeding the maximum of %d bytes", e.Kind, e.ID, e.Size, e.Limit)
+}
+
+// FinalityVote is a validator's signature on a block, counted towards that block's finality
+type FinalityVote struct {
+	BlockNumber int    // Number of the block being signed
+	BlockHash   string // Hash of the block being signed
+	Validator   string // Public key of the signing validator
+	Signature   string // Hex-encoded ed25519 signature over the block number and hash
+}
+
+// Job tracks a computation request received by this miner
+type Job struct {
+	ID          string // Client-supplied (or generated) job identifier
+	Submitter   string // IP address of the submitting client
+	Status      string // One of executing, pending, confirmed or failed
+	Error       string // Failure reason when Status is failed
+	Result      string // Output of the computation once executed
+	BlockNumber int    // Block that included the job's transaction once confirmed
+	Height      int    // Current chain height at the time of the lookup
+
+	PythonHash string   // IPFS hash of the job's script
+	TxtHash    string   // IPFS hash of the job's input file
+	Inputs     []string // IPFS hashes of further input files, passed to the script after the input file
+	Args       []string // Extra script arguments
+	Approvals  []string // Approvers who signed off on running the job
+	Rejections []string // Approvers who refused to run the job
+
+	OutputSchema string   // JSON Schema the script's output must match, empty when the job declares none
+	SchemaErrors []string // Violations of OutputSchema when the output was rejected
+
+	Labels map[string]string // Metadata copied into the job's transaction
+	Worker string            // Executor worker that ran the job, empty when the node ran it itself
+
+	ScriptSignature string // "<author>:<signature>" of a trusted author over the script's CID, if supplied
+
+	EncryptTo string // Hex-encoded X25519 public key the result is encrypted for, empty for public results
+	ResultCID string // IPFS CID of the encrypted result, once executed
+	OutputCID string // IPFS CID of the full output when Result holds only its beginning
+
+	Network  string // Network policy requested for the script, see NetworkPolicy
+	Priority string // Execution priority, low for jobs that may wait out mining rushes and syncs, empty otherwise
+	Fee      int64  // Fee the submitter offered for the job, carried by its transaction and billed with its usage
+
+	PoW                string // Proof-of-work nonce the submitter solved for this node
+	DelegatedTo        string // Peer the job was forwarded to because this node cannot run it
+	Forwarder          string // Identity of the node that forwarded the job to this one
+	ForwarderSignature string // Signature of the forwarder over the job ID and submitter
+
+	ExecutionTime int64 // Wall-clock execution time in milliseconds, once executed
+	CPUTime       int64 // CPU time consumed by the script in milliseconds, once executed
+
+	SubmitterKey string // Hex-encoded ed25519 key the submitter co-signs the job's usage with, from X-Submitter-Key
+	Receipt      string // Hex-encoded signature of SubmitterKey over the confirmed usage, see ReceiptMessage
 }
 
+// Limits on extra script arguments supplied with a job
+const (
+	maxJobArgs      = 16
+	maxJobArgLength = 256
+)
+
+// Limits of streamed job submissions, see receiveStreamedHashes
+const (
+	maxJobInputs         = 64   // Further input files a job may reference besides its script and input file
+	submissionWindow     = 8    // Lines a client may send ahead of the miner's acknowledgements
+	maxSubmissionLineLen = 1024 // Longest line of a streamed submission in bytes
+)
+
+// Limits on job output schemas
+const (
+	maxOutputSchemaBytes = 16 << 10 // Largest accepted output schema
+	maxSchemaErrors      = 10       // Violations recorded for a rejected output
+)
+
+// Limits on the proof of work required from job submitters
+const (
+	maxSubmitPoWBits  = 32              // Upper bound on the required difficulty, however loaded the node is
+	submitPoWLoadStep = 4               // Number of executing jobs that raise the required difficulty by one bit
+	submitPoWWindow   = 5 * time.Minute // Lifetime of a challenge; stamps over the current or previous one are accepted
+)
+
+// Job statuses
+const (
+	JobQueued    = "queued"
+	JobExecuting = "executing"
+	JobPending   = "pending"
+	JobConfirmed = "confirmed"
+	JobFailed    = "failed"
+
+	JobAwaitingApproval = "awaiting-approval"
+	JobRejected         = "rejected"
+)
+
+// Job priorities
+const (
+	PriorityNormal = ""
+	PriorityLow    = "low"
+)
+
 // Block represents a block in the blockchain
 type Block struct {
-	PrevHash     string        // Hash of the previous block in the chain
+	BlockHeader
+	BlockBody
+}
+
+// BlockHeader holds the fields consensus checks operate on; its hash commits to the body through TxRoot
+type BlockHeader struct {
+	PrevHash    string // Hash of the previous block in the chain
+	Nonce       int    // Nonce for proof-of-work
+	Hash        string // Hash of the current block
+	PrevCID     string // IPFS CID of the previous block, or -1 when the creator could not upload it
+	BlockNumber int    // The block number in the chain (0 for genesis block)
+	Timestamp   int64  // Unix timestamp of when the block was created
+	Creator     string // Identifier of the node that created the block
+	Difficulty  int    // Mining difficulty level
+	TxRoot      string // Merkle root of the block's transactions
+	Signature   string // Hex-encoded ed25519 signature of the creator over the block hash, see blockMessage
+
+	TimeAttestation *TimeAttestation // Signed NTP time attestation, present when the time oracle is enabled
+}
+
+// BlockBody holds the transactions of a block, stored and transmitted apart from its header
+type BlockBody struct {
 	Transactions []Transaction // List of transactions included in this block
-	Nonce        int           // Nonce for proof-of-work
-	Hash         string        // Hash of the current block
-	PrevCID      string        // IPFS CID of the previous block
-	BlockNumber  int           // The block number in the chain (0 for genesis block)
-	Timestamp    int64         // Unix timestamp of when the block was created
-	Creator      string        // Identifier of the node that created the block
-	Difficulty   int           // Mining difficulty level
 }
 
-var transactionPool []Transaction
-var mutex sync.Mutex   // Mutex to synchronize access to the transaction pool
-var currentBlock Block // Each miner has their own current block
+// TimeAttestation is a time oracle's signed statement of the NTP time it observed while a block was created
+type TimeAttestation struct {
+	Source    string // NTP server that was queried
+	Time      int64  // Unix timestamp reported by the NTP server
+	PublicKey string // Hex-encoded ed25519 public key of the time oracle, one of -time-oracle-keys
+	Signature string // Hex-encoded signature over the block position and attested time
+}
+
+var transactionPool []Transaction
+var mutex sync.Mutex   // Mutex to synchronize access to the transaction pool
+var currentBlock Block // Each miner has their own current block
+
+var finalityVotes = make(map[string]map[string]string) // Validator signatures keyed by block hash and validator
+var finalizedHeight int                                // Highest block signed by a validator quorum
+var finalizedHash string                               // Hash of the highest finalized block
+
+var chainStore ChainStore // Local chain store, nil until it is opened and while the chain is kept in memory
+
+// TxLocation is a confirmed transaction together with the block that contains it
+type TxLocation struct {
+	Transaction Transaction
+	BlockNumber int
+	BlockHash   string
+	Redacted    bool
+}
+
+// TxProof is a Merkle proof that a confirmed transaction is included in its block
+type TxProof struct {
+	Transaction json.RawMessage // JSON encoding of the transaction, whose SHA-256 hash is the Merkle leaf
+	Index       int             // Position of the transaction in the block
+	Siblings    []string        // Hex-encoded sibling hashes from the leaf up to the root
+	Header      BlockHeader     // Header of the block, whose TxRoot the proof leads to
+}
+
+var blockCache = newLRUCache[string, Block](1024)   // Recently accessed blocks keyed by hash
+var txCache = newLRUCache[string, TxLocation](4096) // Recently accessed transactions keyed by job ID
+
+var txIndex = make(map[string]int)    // Block number of every confirmed transaction, keyed by transaction ID
+var balances = make(map[string]int64) // Spendable balance of every node identity, derived from the chain
+var nonces = make(map[string]int64)   // Nonce of the last confirmed transfer of every node identity
+
+// Revocation is a confirmed revocation of a node identity. Nodes refuse blocks created by a revoked identity
+// and job results it executed or forwarded in any later block.
+type Revocation struct {
+	Identity    string // Revoked node identity
+	Admin       string // Admin key that signed the revocation
+	Reason      string // Value of the revocation's reason label, empty when it has none
+	TxID        string // ID of the revocation transaction
+	BlockNumber int    // Block that confirmed the revocation
+}
+
+var revoked = make(map[string]Revocation) // Confirmed revocations keyed by the revoked identity, derived from the chain
+
+var labelIndex = make(map[string][]string) // IDs of the confirmed transactions carrying each key:value label, oldest first
+
+var futureTransfers = make(map[string]map[int64]Transaction) // Transfers held until their sender's earlier nonces arrive
+var poolAdmitted = make(map[string]time.Time)                // Time each pooled or held transaction entered this node, guarded by mutex
+
+// Limits on transfers held until their sender's earlier nonces arrive
+const (
+	maxFutureNonces  = 16               // How far ahead of a sender's next nonce a transfer may be held
+	maxHeldTransfers = 1024             // Held transfers of all senders together
+	heldTransferTTL  = 10 * time.Minute // How long a transfer may be held before it is dropped
+)
+
+var snapshotDir = filepath.Join("data", "snapshots") // Directory holding state snapshots
+var snapshotInterval = 100                           // Blocks between state snapshots (0 disables snapshots)
+var snapshotKeep = 3                                 // Number of state snapshots kept
+
+var redactionFile = filepath.Join("data", "redactions.jsonl") // Append-only log of redaction markers
+var redactedJobs = make(map[string]bool)                      // Jobs whose results are withheld from the read APIs
+var redactedSubmitters = make(map[string]bool)                // Submitters whose results are withheld from the read APIs
+
+var invalidBlockFile = filepath.Join("data", "invalid-blocks.jsonl") // Append-only log of blocks invalidated by the operator
+
+var publishedBlockFile = filepath.Join("data", "published-blocks.jsonl") // Log of the blocks pinned when publishing the chain head
+var invalidBlocks = make(map[string]bool)                                // Hashes of blocks that are never appended again
+
+var validationWorkers = runtime.NumCPU() // Goroutines used to validate blocks concurrently during sync
+
+var archiveMode bool // Whether historical blocks are served to peers over HTTP
+var peers []string   // Addresses of other miners, listening on peerPort
+
+var peerLatency = make(map[string]measuredLatency) // Smoothed response latency of each current peer, guarded by mutex
+
+// Measurements of peers are kept while they stay fresh
+const (
+	peerStateTTL           = 30 * time.Minute // How long a peer's latency is kept after it was last measured
+	peerStatePruneInterval = 5 * time.Minute  // How often stale peer measurements are dropped
+)
+
+const peerPort = "8080" // Port every node serves its API on
+
+// Limits applied to peer lists received through peer exchange
+const (
+	maxPeers          = 64               // Maximum number of known peers
+	maxPEXAccept      = 16               // Maximum number of new peers accepted from a single exchange
+	maxPEXListAge     = 10 * time.Minute // Maximum age of a signed peer list
+	maxPeerAddressLen = 253              // Maximum length of a peer host name
+)
+
+// PeerList is a node's signed list of the peers it knows about
+type PeerList struct {
+	NodeID    string   // Identity (public key) of the node that signed the list
+	Peers     []string // Addresses of known peers
+	Timestamp int64    // Unix time the list was signed
+	Signature string   // Hex-encoded ed25519 signature over the identity, timestamp and peers
+}
+
+// syncBatchSize is the number of blocks requested from a peer in a single download
+const syncBatchSize = 50
+
+// NodeStatus summarises a node's view of the chain
+type NodeStatus struct {
+	NodeID      string   // Identity of the node
+	GenesisHash string   // Hash of the network's parameters, see genesisHash
+	Height      int      // Number of the block at the tip of the chain
+	HeadHash    string   // Hash of the block at the tip of the chain
+	Codecs      []string // Serialization codecs the node supports
+	Features    []string // Optional protocol features the node supports, such as gzip and compact-blocks
+	Rules       []string // Consensus rules the node can enforce, so peers can tell whether it follows scheduled upgrades
+	Version     string   // Version of the node software, so mixed-version networks can be diagnosed
+	Runtimes    []string // Allowed runtimes that work on the node, so clients and peers can tell whether it runs jobs
+
+	MiningHold string        // Why the node refuses to mine, empty when it is mining
+	Pressure   string        // Resource pressure pausing proof of work, empty when it runs
+	Sync       *SyncProgress // Progress of the running sync, nil when the node is not syncing
+
+	MaxInputSize int64 // Largest job file the node downloads in bytes, 0 when unlimited
+
+	Maintenance bool // Whether the node is in maintenance mode and accepts no new jobs
+	InFlight    int  // Jobs queued or executing on the node
+
+	Shedding string // Rushes deferring low-priority jobs, such as mining or sync, empty when they run
+}
+
+// SyncProgress reports how far a sync from a peer has come
+type SyncProgress struct {
+	Peer            string  // Peer the blocks are downloaded from
+	StartHeight     int     // Local height when the sync started
+	CurrentHeight   int     // Local height reached so far
+	TargetHeight    int     // Height of the peer at the start of the sync
+	BlocksPerSecond float64 // Average rate of committed blocks since the sync started
+	ETA             float64 // Estimated seconds until the sync completes, 0 until a rate is known
+
+	started time.Time
+}
+
+var syncProgress *SyncProgress // Progress of the running sync, guarded by mutex
+var initialSync bool           // Whether the node is still catching up on startup; it neither mines nor executes until done
+
+var blockchain []Block                        // Blocks in the local chain, in order
+var jobs = make(map[string]*Job)              // Jobs received by this node, keyed by job ID
+var idempotencyKeys = make(map[string]string) // Job IDs keyed by submitter and idempotency key
+
+var approvers []string    // Hex-encoded public keys of the approvers jobs on this node need, empty to run jobs right away
+var approvalThreshold int // Number of approvals a job needs before it runs
+
+var scriptAllowlist map[string]bool // CIDs of the scripts this node may execute, set with -script-allowlist
+var trustedAuthors []string         // Hex-encoded public keys of authors whose signed scripts this node may execute
+
+var explorerMode bool // Whether the node is a read-only public window onto the network
+
+var maintenanceMode bool   // Whether the node refuses new work and mining so it can be taken down, guarded by mutex
+var maintenanceSince int64 // Unix time maintenance mode was entered
+
+var devMode bool // Whether the node is a local development node that mines every transaction immediately
+
+var requestTimeout = 30 * time.Second             // Deadline for reading a request and writing its response
+var endpointTimeouts = map[string]time.Duration{} // Deadlines of endpoints that need longer than requestTimeout, 0 for none
+var endpointBodyLimits = map[string]int64{}       // Body limits of endpoints that accept more than maxRequestBodyBytes
+var downloadTimeout = 2 * time.Minute             // Deadline for downloading a job file from IPFS
+var maxInputSize int64                            // Largest job file downloaded from IPFS in bytes, 0 when unlimited
+var outputCap int                                 // Bytes of a job's output kept in its transaction, 0 for the network's MaxOutputSize
+var maxScriptOutput int64 = 16 << 20              // Largest output captured from a script; scripts producing more are stopped
+
+// Outgoing connection tuning shared by the peer and IPFS clients
+const (
+	dialTimeout           = 5 * time.Second
+	responseHeaderTimeout = time.Minute
+	maxIdleConns          = 256
+	maxIdleConnsPerHost   = 16
+	maxConnsPerHost       = 64
+)
+
+var httpClient = &http.Client{Transport: newTransport(false)}          // Shared client for IPFS calls
+var peerClient = &http.Client{Transport: guarded(newTransport(false))} // Shared client for peer calls, switched to HTTP/2 by -peer-h2c
+var nodeClient = httpClient                                            // Client of the operator commands calling a node's API
+
+var peerScheme = "http" // URL scheme of node APIs, https under mutual TLS
+
+var tlsIdentities map[string]string // Identities of the known certificates, keyed by SHA-256 fingerprint
+var tlsOwnFingerprint string        // Fingerprint of this node's own certificate, identified as nodeID
+
+// Limits protecting the HTTP server from slow or oversized requests
+const (
+	maxHeaderBytes      = 64 << 10 // Largest accepted request header
+	maxRequestBodyBytes = 1 << 20  // Largest accepted request body
+	readHeaderTimeout   = 10 * time.Second
+	idleTimeout         = 2 * time.Minute
+)
+
+var submitPoWBits int // Leading zero bits required of a job submission's proof of work when idle, 0 disables it
+
+var submitPoWKey = []byte(GenerateJobID())             // Key the node's proof-of-work challenges are authenticated with
+var spentSubmitPoW = make(map[int64]map[[32]byte]bool) // Accepted proof-of-work stamps by the window of their challenge, guarded by mutex
+
+// networkParams holds the active consensus parameters, defaulting to these values when no genesis file is given
+var networkParams = defaultNetworkParams()
+
+// genesisHash identifies the network by the hash of its parameters. Nodes refuse peers on another network, and
+// signed messages include it, so signatures cannot be replayed on another network.
+var genesisHash = networkGenesisHash(networkParams)
+
+// networkGenesisHash returns the hex-encoded SHA-256 hash of the JSON encoding of a network's parameters
+func networkGenesisHash(params NetworkParams) string {
+	data, err := json.Marshal(params)
+	if err != nil {
+		panic(fmt.Sprintf("network parameters cannot be encoded: %v", err))
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+// setNetworkParams makes params the active consensus parameters
+func setNetworkParams(params NetworkParams) {
+	networkParams, genesisHash = params, networkGenesisHash(params)
+}
+
+// defaultGenesis is the repository's genesis.json, embedded at build time as the default network parameters
+//
+//go:embed genesis.json
+var defaultGenesis []byte
+
+// defaultNetworkParams decodes the embedded default genesis file
+func defaultNetworkParams() NetworkParams {
+	var params NetworkParams
+	if err := json.Unmarshal(defaultGenesis, &params); err != nil {
+		panic(fmt.Sprintf("embedded genesis.json is invalid: %v", err))
+	}
+	return params
+}
+
+// defaultConfig is the repository's miner.conf, embedded at build time and written by the init command
+//
+//go:embed miner.conf
+var defaultConfig []byte
+
+var configFile = "miner.conf" // File of flag settings applied before the node starts, see applyConfig
+
+var nodeKey ed25519.PrivateKey // Signing key identifying this node
+var nodeID string              // Hex-encoded public key of this node, used as its identity
+
+// MinerStats aggregates the work done by a single node identity
+type MinerStats struct {
+	Identity             string  // Node identity the statistics belong to
+	BlocksMined          int     // Blocks accepted into the chain
+	StaleBlocks          int     // Blocks mined on top of a tip that had already moved on
+	JobsExecuted         int     // Confirmed jobs executed by the node
+	TotalExecutionTime   int64   // Sum of execution times of confirmed jobs in milliseconds
+	AverageExecutionTime float64 // Average execution time of confirmed jobs in milliseconds
+	StaleRate            float64 // Fraction of mined blocks that went stale
+}
+
+var minerStats = make(map[string]*MinerStats) // Statistics keyed by node identity
+
+var timeOracleEnabled bool           // Whether blocks must carry a signed NTP time attestation
+var timeOracleKeys []string          // Hex-encoded public keys of the time oracles whose attestations blocks may carry
+var timeOraclePeer string            // Time oracle the node asks for attestations; empty attests with its own key
+var ntpServer = "pool.ntp.org:123"   // NTP server queried for time attestations
+var timeTolerance = 30 * time.Second // Maximum drift between a block timestamp and its attested time
+
+var previousBlockCID string = "-1"  // Genesis block's PrevCID will be -1 initially
+var previousBlockHash string = "-1" // Genesis block's PrevHash will be empty initially
+
+var headKey string            // IPFS key the chain head is published under in IPNS, empty to not publish it
+var headPointer string        // IPFS path of a published chain head to recover from on startup, such as /ipns/<name>
+var forceGenesis bool         // Whether to mine even when the local chain may be behind an existing one
+var lastPublishedHead string  // Hash of the head last published to IPNS
+var miningHold string         // Why the node refuses to mine, empty when it may mine
+var miningHoldHeight int      // Height the local chain must reach before the mining hold lifts
+var miningHoldUntil time.Time // When the mining hold lifts even if the chain has not caught up
+
+// headPublishInterval is how often the chain head is republished to IPNS when it changed
+const headPublishInterval = time.Minute
+
+// jobFlushInterval is how often the job history is written to chain stores that keep it
+const jobFlushInterval = 30 * time.Second
+
+// downloadFromIPFS downloads a file from IPFS using the provided hash, giving up after downloadTimeout
+func downloadFromIPFS(hash, filename string) error {
+	gateways := append([]string{ipfsGatewayURL}, ipfsFallbackGateways...)
+	var err error
+	for i, gateway := range gateways {
+		err = downloadFromGateway(gateway, hash, filename)
+		if err == nil || !(errors.Is(err, errGatewayContent) || errors.Is(err, errGatewayUnavailable)) {
+			return err
+		}
+		if i < len(gateways)-1 {
+			fmt.Printf("Download of %s failed, trying the next gateway: %v\n", hash, err)
+		}
+	}
+	os.Remove(filename)
+	return err
+}
+
+// errGatewayContent marks a gateway response that is not the requested file, such as an HTML error page served
+// with status 200. Downloads failing with it move on to the next gateway.
+var errGatewayContent = errors.New("gateway did not serve the requested file")
+
+// errGatewayUnavailable marks a gateway that could not be reached or refused the request. Downloads failing with
+// it move on to the next gateway.
+var errGatewayUnavailable = errors.New("gateway is unavailable")
+
+// downloadFromGateway downloads a file from one gateway, limited to maxInputSize
+func downloadFromGateway(gateway, hash, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer file.Close()
+	return copyFromGateway(gateway, hash, file, maxInputSize)
+}
+
+// fetchFromIPFS reads a CID of at most limit bytes into memory, trying the fallback gateways like downloadFromIPFS
+func fetchFromIPFS(hash string, limit int64) ([]byte, error) {
+	gateways := append([]string{ipfsGatewayURL}, ipfsFallbackGateways...)
+	var content bytes.Buffer
+	var err error
+	for _, gateway := range gateways {
+		content.Reset()
+		err = copyFromGateway(gateway, hash, &content, limit)
+		if err == nil {
+			return content.Bytes(), nil
+		}
+		if !(errors.Is(err, errGatewayContent) || errors.Is(err, errGatewayUnavailable)) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// copyFromGateway copies a CID from one gateway to dst, failing once it exceeds limit bytes (0 for no limit).
+// Content with a raw CIDv1 is checked against the digest in its CID; for other CIDs, which cannot be checked
+// without rebuilding the DAG, HTML pages are refused.
+func copyFromGateway(gateway, hash string, dst io.Writer, limit int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), downloadTimeout)
+	defer cancel()
+	source, err := gatewayURLFor(gateway, hash)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create download request: %w", err)
+	}
+	resp, err := gatewayClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: failed to download file from IPFS: %w", errGatewayUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: failed to download file, status: %d", errGatewayUnavailable, resp.StatusCode)
+	}
+
+	if limit > 0 && resp.ContentLength > limit {
+		return fmt.Errorf("file %s is %d bytes, exceeding the maximum of %d bytes", hash, resp.ContentLength, limit)
+	}
+
+	digest, verifiable := rawCIDDigest(hash)
+	body := bufio.NewReader(resp.Body)
+	if !verifiable {
+		head, _ := body.Peek(512)
+		if htmlResponse(resp.Header.Get("Content-Type"), head) {
+			return fmt.Errorf("%w: %s answered %s with an HTML page", errGatewayContent, req.URL.Host, hash)
+		}
+	}
+
+	hasher := sha256.New()
+	var reader io.Reader = body
+	if limit > 0 {
+		// Gateways do not always announce the size, so the limit is enforced on the bytes received as well
+		reader = io.LimitReader(body, limit+1)
+	}
+	n, err := io.Copy(io.MultiWriter(dst, hasher), reader)
+	if err != nil {
+		return err
+	}
+	if limit > 0 && n > limit {
+		return fmt.Errorf("file %s exceeds the maximum of %d bytes", hash, limit)
+	}
+	if verifiable && !bytes.Equal(hasher.Sum(nil), digest) {
+		return fmt.Errorf("%w: content from %s does not match %s", errGatewayContent, req.URL.Host, hash)
+	}
+	return nil
+}
+
+// htmlResponse reports whether a gateway response is an HTML page by both its declared and its sniffed type, the
+// signature of gateway error and interstitial pages
+func htmlResponse(contentType string, head []byte) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(contentType)), "text/html") &&
+		strings.HasPrefix(http.DetectContentType(head), "text/html")
+}
+
+// rawCIDDigest returns the SHA-256 digest held by a base32 CIDv1 of raw content, as produced by ipfs add
+// --cid-version 1 for files that fit in a single block
+func rawCIDDigest(cid string) ([]byte, bool) {
+	if len(cid) < 2 || cid[0] != 'b' {
+		return nil, false
+	}
+	decoded, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(cid[1:]))
+	// Version 1, raw codec (0x55), sha2-256 multihash (0x12) of 32 bytes
+	if err != nil || len(decoded) != 36 || decoded[0] != 0x01 || decoded[1] != 0x55 || decoded[2] != 0x12 || decoded[3] != 0x20 {
+		return nil, false
+	}
+	return decoded[4:], true
+}
+
+// gatewayClient downloads from the IPFS gateway. It follows redirects only within the gateway, such as from a path
+// gateway to its subdomain form, and dials *.localhost names on the loopback address as browsers do.
+var gatewayClient = &http.Client{Transport: newGatewayTransport(), CheckRedirect: checkGatewayRedirect}
+
+// maxGatewayRedirects bounds the redirects followed by a single gateway request
+const maxGatewayRedirects = 5
+
+// newGatewayTransport returns the transport of gatewayClient
+func newGatewayTransport() *http.Transport {
+	transport := guarded(newTransport(false))
+	dial := transport.DialContext
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		// Subdomain gateways such as <cid>.ipfs.localhost are not in DNS
+		if host, port, err := net.SplitHostPort(addr); err == nil && strings.HasSuffix(strings.ToLower(host), ".localhost") {
+			addr = net.JoinHostPort("localhost", port)
+		}
+		return dial(ctx, network, addr)
+	}
+	return transport
+}
+
+// checkGatewayRedirect refuses redirects that leave the gateway, so a gateway cannot point downloads at
+// arbitrary addresses
+func checkGatewayRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxGatewayRedirects {
+		return fmt.Errorf("stopped after %d redirects", len(via))
+	}
+	if !gatewayRedirectAllowed(via[0].URL, req.URL) {
+		return fmt.Errorf("refusing redirect to %s outside the IPFS gateway", req.URL.Host)
+	}
+	return nil
+}
+
+// gatewayRedirectAllowed reports whether a redirect of a gateway request for origin to target stays on the
+// gateway: the same host, or its subdomain form <cid>.ipfs.<host>, on the same port. The scheme may only change
+// from http to https.
+func gatewayRedirectAllowed(origin, target *url.URL) bool {
+	if target.User != nil || target.Port() != origin.Port() {
+		return false
+	}
+	if target.Scheme != origin.Scheme && !(origin.Scheme == "http" && target.Scheme == "https") {
+		return false
+	}
+	host, base := strings.ToLower(target.Hostname()), strings.ToLower(origin.Hostname())
+	if host == base {
+		return true
+	}
+	// A subdomain gateway may redirect between CIDs under its own domain
+	if i := strings.Index(base, ".ipfs."); i >= 0 {
+		base = base[i+len(".ipfs."):]
+	}
+	label, ok := strings.CutSuffix(host, ".ipfs."+base)
+	return ok && label != "" && !strings.Contains(label, ".")
+}
+
+// gatewayURL returns the gateway URL of a CID. A gateway configured with a {cid} placeholder, such as
+// http://{cid}.ipfs.localhost:8080/, is a subdomain gateway and gets the CID in its DNS-safe base32 form.
+func gatewayURL(cid string) (string, error) {
+	return gatewayURLFor(ipfsGatewayURL, cid)
+}
+
+// gatewayURLFor returns the URL of a CID on a gateway, configured as a path prefix or a subdomain template
+func gatewayURLFor(gateway, cid string) (string, error) {
+	if !validCID(cid) {
+		return "", fmt.Errorf("invalid CID %q", cid)
+	}
+	if !strings.Contains(gateway, "{cid}") {
+		return gateway + cid, nil
+	}
+	label, err := subdomainCID(cid)
+	if err != nil {
+		return "", err
+	}
+	return strings.Replace(gateway, "{cid}", label, 1), nil
+}
+
+// validCID reports whether a string is a CIDv0 (Qm...) or a base32 CIDv1, the forms accepted from requests and peers
+// before they are put in a URL
+func validCID(cid string) bool {
+	if strings.HasPrefix(cid, "Qm") {
+		return len(cid) == 46 && strings.Trim(cid, "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz") == ""
+	}
+	return len(cid) >= 8 && len(cid) <= 128 && cid[0] == 'b' && strings.Trim(cid, "abcdefghijklmnopqrstuvwxyz234567") == ""
+}
+
+// subdomainCID returns a CID as a lowercase base32 CIDv1, converting CIDv0 (Qm...) hashes, so it fits in a DNS label
+func subdomainCID(cid string) (string, error) {
+	if strings.HasPrefix(cid, "Qm") {
+		multihash, ok := decodeBase58(cid)
+		if !ok || len(multihash) != 34 || multihash[0] != 0x12 || multihash[1] != 0x20 {
+			return "", fmt.Errorf("invalid CIDv0 %q", cid)
+		}
+		encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+		cid = "b" + strings.ToLower(encoding.EncodeToString(append([]byte{0x01, 0x70}, multihash...))) // CIDv1, dag-pb
+	}
+	if len(cid) < 2 || len(cid) > 63 || cid[0] != 'b' || strings.Trim(cid, "abcdefghijklmnopqrstuvwxyz234567") != "" {
+		return "", fmt.Errorf("CID %q cannot be used with a subdomain gateway", cid)
+	}
+	return cid, nil
+}
+
+// decodeBase58 decodes a base58btc string
+func decodeBase58(text string) ([]byte, bool) {
+	const alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+	value := new(big.Int)
+	for _, c := range text {
+		digit := strings.IndexRune(alphabet, c)
+		if digit < 0 {
+			return nil, false
+		}
+		value.Mul(value, big.NewInt(58))
+		value.Add(value, big.NewInt(int64(digit)))
+	}
+	zeros := len(text) - len(strings.TrimLeft(text, "1"))
+	return append(make([]byte, zeros), value.Bytes()...), true
+}
+
+// lineWriter splits written output into lines and passes each complete line to onLine
+type lineWriter struct {
+	onLine  func(string)
+	pending []byte
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.pending = append(lw.pending, p...)
+	for {
+		i := bytes.IndexByte(lw.pending, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		lw.onLine(strings.TrimRight(string(lw.pending[:i]), "\r"))
+		lw.pending = lw.pending[i+1:]
+	}
+}
+
+// Flush passes any trailing output without a newline to onLine
+func (lw *lineWriter) Flush() {
+	if len(lw.pending) > 0 {
+		lw.onLine(string(lw.pending))
+		lw.pending = nil
+	}
+}
+
+// cappedWriter passes on at most limit bytes, calling exceeded once when more arrive and
+// discarding the rest
+type cappedWriter struct {
+	w          io.Writer
+	limit      int64
+	written    int64
+	exceeded   func()
+	overflowed bool
+}
+
+func (c *cappedWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if c.written+int64(n) > c.limit {
+		p = p[:c.limit-c.written]
+		if !c.overflowed {
+			c.overflowed = true
+			c.exceeded()
+		}
+	}
+	c.written += int64(len(p))
+	if _, err := c.w.Write(p); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+var pythonInterpreter = "python" // Interpreter job scripts are run with, set with -python
+var customExecutor bool          // Whether jobs run on an executor set with WithExecutor, which needs no local interpreter
+
+// runtimeProbes return the command showing whether a runtime works on this host, by the runtime's name
+var runtimeProbes = map[string]func() []string{
+	"python": func() []string { return []string{pythonInterpreter, "--version"} },
+	"docker": func() []string { return []string{"docker", "info", "--format", "{{.ServerVersion}}"} },
+	"wasm":   func() []string { return []string{"wasmtime", "--version"} },
+}
+
+// RuntimeStatus is the outcome of probing a runtime
+type RuntimeStatus struct {
+	Name      string // Runtime name as listed in AllowedRuntimes
+	Available bool   // Whether the probe succeeded
+	Detail    string // Version reported by the runtime, or why it is unavailable
+}
+
+var availableRuntimes []string // Allowed runtimes whose probe succeeded at startup, guarded by mutex
+
+// probeRuntime runs a runtime's probe command, which must succeed within ten seconds
+func probeRuntime(name string) RuntimeStatus {
+	status := RuntimeStatus{Name: name}
+	probe, ok := runtimeProbes[name]
+	if !ok {
+		status.Detail = "this node does not know how to run it"
+		return status
+	}
+	command := probe()
+	path, err := exec.LookPath(command[0])
+	if err != nil {
+		status.Detail = fmt.Sprintf("%s is not installed or not on PATH", command[0])
+		return status
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, path, command[1:]...).CombinedOutput()
+	version, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n")
+	if err != nil {
+		status.Detail = fmt.Sprintf("%s failed: %v", strings.Join(command, " "), err)
+		if version != "" {
+			status.Detail += ": " + version
+		}
+		return status
+	}
+	status.Available, status.Detail = true, version
+	return status
+}
+
+// probeRuntimes probes the runtimes the network allows and records the available ones, which the node
+// advertises and accepts jobs for
+func probeRuntimes() {
+	var available []string
+	for _, name := range networkParams.AllowedRuntimes {
+		if name == "python" && customExecutor {
+			available = append(available, name)
+			continue
+		}
+		status := probeRuntime(name)
+		if status.Available {
+			fmt.Printf("Runtime %s is available: %s\n", name, status.Detail)
+			available = append(available, name)
+		} else {
+			fmt.Printf("Runtime %s is unavailable, forwarding or refusing its jobs: %s\n", name, status.Detail)
+		}
+	}
+	mutex.Lock()
+	availableRuntimes = available
+	mutex.Unlock()
+}
+
+// runtimeAvailable reports why jobs needing a runtime cannot run on this node, nil when they can
+func runtimeAvailable(name string) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if !supports(availableRuntimes, name) {
+		return fmt.Errorf("runtime %s is not available on this node; see its startup log or miner doctor", name)
+	}
+	return nil
+}
+
+// executePythonFile executes the specified Python file with its arguments under a network policy and displays
+// the output, also returning the CPU time the script consumed. Each output line is also passed to onLine as it is
+// produced, when onLine is not nil.
+func executePythonFile(filename string, policy NetworkPolicy, onLine func(string), args ...string) (string, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(networkParams.MaxRuntime)*time.Second)
+	defer cancel()
+
+	command := append([]string{pythonInterpreter, filename}, args...)
+	var extraFiles []*os.File
+	if jobSandbox == sandboxNetns && !policy.Host {
+		if err := checkSandbox(); err != nil {
+			return "", 0, err
+		}
+		if len(policy.Egress) > 0 {
+			proxy, err := startEgressProxy(policy)
+			if err != nil {
+				return "", 0, err
+			}
+			defer proxy.Close()
+			self, err := os.Executable()
+			if err != nil {
+				return "", 0, fmt.Errorf("failed to locate the node binary for the sandbox: %w", err)
+			}
+			// The proxy's secret reaches sandbox-exec on an inherited pipe rather than its arguments or
+			// environment, which the script and other jobs could read
+			secretReader, secretWriter, err := os.Pipe()
+			if err != nil {
+				return "", 0, fmt.Errorf("failed to pass the egress proxy secret: %w", err)
+			}
+			secretWriter.Write([]byte(proxy.secret))
+			secretWriter.Close()
+			defer secretReader.Close()
+			extraFiles = []*os.File{secretReader}
+			command = append([]string{self, "sandbox-exec", proxy.path}, command...)
+		}
+		// A new network namespace has no interfaces besides a loopback that is down
+		command = append([]string{"unshare", "--net", "--map-root-user", "--"}, command...)
+	}
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.ExtraFiles = extraFiles
+	killProcessGroupOnCancel(cmd)
+	var buffer bytes.Buffer
+	writer := io.Writer(&buffer)
+	lines := &lineWriter{onLine: onLine}
+	if onLine != nil {
+		writer = io.MultiWriter(&buffer, lines)
+	}
+	capture := &cappedWriter{w: writer, limit: maxScriptOutput, exceeded: cancel}
+	cmd.Stdout = capture // Capture both stdout and stderr
+	cmd.Stderr = capture
+	err := cmd.Run()
+	if onLine != nil {
+		lines.Flush()
+	}
+	output := buffer.Bytes()
+	var cpuTime time.Duration
+	if cmd.ProcessState != nil {
+		cpuTime = cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime()
+	}
+	if capture.overflowed {
+		return "", cpuTime, fmt.Errorf("File execution produced more than %d bytes of output", maxScriptOutput)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", cpuTime, fmt.Errorf("File execution exceeded the maximum runtime of %ds", networkParams.MaxRuntime)
+	}
+	if err != nil {
+		return "", cpuTime, fmt.Errorf("File execution failed: %v, output: %s", err, string(output))
+	}
+	return string(output), cpuTime, nil
+}
+
+// NetworkPolicy is the network access a job's script is given. Scripts have no network by default; a job can ask
+// for egress to a list of host:port destinations permitted by the node operator, which is then the only traffic
+// the sandbox lets out, through an HTTP proxy. Host is only recorded by nodes that run scripts without a sandbox.
+type NetworkPolicy struct {
+	Egress []string // Destinations the script may reach, sorted; none when empty
+	Host   bool     // The script ran with the host's network
+}
+
+// Limits on the egress destinations of a job
+const (
+	maxEgressDestinations = 16
+	egressDialTimeout     = 10 * time.Second
+)
+
+func (p NetworkPolicy) String() string {
+	switch {
+	case p.Host:
+		return "host"
+	case len(p.Egress) == 0:
+		return "none"
+	}
+	return "egress=" + strings.Join(p.Egress, ",")
+}
+
+// parseNetworkPolicy decodes a policy in its String form; an empty string is no network
+func parseNetworkPolicy(spec string) (NetworkPolicy, error) {
+	spec = strings.TrimSpace(spec)
+	switch spec {
+	case "", "none":
+		return NetworkPolicy{}, nil
+	case "host":
+		return NetworkPolicy{Host: true}, nil
+	}
+	list, ok := strings.CutPrefix(spec, "egress=")
+	if !ok {
+		return NetworkPolicy{}, fmt.Errorf("expected none or egress=<host:port,...>")
+	}
+	seen := make(map[string]bool)
+	var policy NetworkPolicy
+	for _, destination := range strings.Split(list, ",") {
+		host, port, err := net.SplitHostPort(strings.TrimSpace(destination))
+		if err != nil {
+			return NetworkPolicy{}, fmt.Errorf("invalid destination %q: %w", destination, err)
+		}
+		if number, err := strconv.Atoi(port); err != nil || number < 1 || number > 65535 {
+			return NetworkPolicy{}, fmt.Errorf("invalid port in %q", destination)
+		}
+		host = normalizePeerAddress(host)
+		if !validEgressHost(host) {
+			return NetworkPolicy{}, fmt.Errorf("invalid host in %q", destination)
+		}
+		if normalized := net.JoinHostPort(host, port); !seen[normalized] {
+			seen[normalized] = true
+			policy.Egress = append(policy.Egress, normalized)
+		}
+	}
+	if len(policy.Egress) > maxEgressDestinations {
+		return NetworkPolicy{}, fmt.Errorf("%d destinations exceed the maximum of %d", len(policy.Egress), maxEgressDestinations)
+	}
+	sort.Strings(policy.Egress)
+	return policy, nil
+}
+
+// validEgressHost reports whether a host of an egress destination is an IP address without a zone or a DNS name
+func validEgressHost(host string) bool {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr.Zone() == ""
+	}
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, c := range host {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '.' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// egressRule is an entry of -job-egress: a host name, IP address or network and a port, or any port
+type egressRule struct {
+	host    string       // Host name, empty for a network rule
+	network netip.Prefix // Network of an address rule
+	port    string       // Port, or * for any
+}
+
+var jobEgressRules []egressRule // Destinations jobs may ask to reach, set with -job-egress; none by default
+
+// parseEgressRules decodes a comma-separated list of host:port rules, where the host may be a network and the
+// port may be *
+func parseEgressRules(list string) ([]egressRule, error) {
+	var rules []egressRule
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		i := strings.LastIndex(entry, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("%q has no port", entry)
+		}
+		host, port := strings.Trim(entry[:i], "[]"), entry[i+1:]
+		if number, err := strconv.Atoi(port); port != "*" && (err != nil || number < 1 || number > 65535) {
+			return nil, fmt.Errorf("invalid port in %q", entry)
+		}
+		rule := egressRule{port: port}
+		if prefix, err := netip.ParsePrefix(host); err == nil {
+			rule.network = prefix.Masked()
+		} else if addr, err := netip.ParseAddr(host); err == nil {
+			rule.network = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		} else if host = strings.ToLower(host); validEgressHost(host) {
+			rule.host = host
+		} else {
+			return nil, fmt.Errorf("invalid host in %q", entry)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// egressPermitted reports whether the operator lets jobs reach a host:port destination
+func egressPermitted(destination string) bool {
+	host, port, err := net.SplitHostPort(destination)
+	if err != nil {
+		return false
+	}
+	addr, addrErr := netip.ParseAddr(host)
+	for _, rule := range jobEgressRules {
+		if rule.port != "*" && rule.port != port {
+			continue
+		}
+		if rule.host != "" && rule.host == host || addrErr == nil && rule.network.IsValid() && rule.network.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Job sandboxes, selected with -job-sandbox
+const (
+	sandboxNetns = "netns" // Scripts run in their own network namespace, created with unshare
+	sandboxOff   = "off"   // Scripts run with the host's network and network policies cannot be enforced
+)
+
+var jobSandbox = sandboxOff // Sandbox scripts run in, netns by default on Linux
+
+var sandboxCheck struct {
+	once sync.Once
+	err  error
+}
+
+// checkSandbox verifies once that scripts can be started in a network namespace of their own
+func checkSandbox() error {
+	sandboxCheck.once.Do(func() {
+		if output, err := exec.Command("unshare", "--net", "--map-root-user", "--", "true").CombinedOutput(); err != nil {
+			sandboxCheck.err = fmt.Errorf("cannot start scripts in a network namespace (%v: %s); enable unprivileged user namespaces and install util-linux, or run with -job-sandbox off", err, strings.TrimSpace(string(output)))
+		}
+	})
+	return sandboxCheck.err
+}
+
+// enforcedPolicy returns the policy a script requesting policy actually runs under on this node
+func enforcedPolicy(policy NetworkPolicy) NetworkPolicy {
+	if jobSandbox == sandboxOff {
+		return NetworkPolicy{Host: true}
+	}
+	return policy
+}
+
+// egressProxy is the HTTP proxy through which a sandboxed script reaches the destinations of its network policy.
+// It listens on a Unix socket in a directory only the node's user can enter, which the sandbox relays connections
+// to from a loopback port. Scripts of other jobs run as the same user, so every connection must also open with the
+// proxy's secret, which only the job's own sandbox-exec process knows.
+type egressProxy struct {
+	dir     string // Private directory holding the socket, removed on Close
+	path    string
+	secret  string
+	policy  map[string]bool
+	server  *http.Server
+	forward *http.Transport
+}
+
+// egressSecretTimeout bounds how long a connection to an egress proxy may take to present the proxy's secret
+const egressSecretTimeout = 5 * time.Second
+
+// startEgressProxy serves an egress proxy for a policy on a new Unix socket in a private directory of the job
+// working directory
+func startEgressProxy(policy NetworkPolicy) (*egressProxy, error) {
+	if err := os.MkdirAll(jobWorkDir(), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	dir, err := os.MkdirTemp(jobWorkDir(), "egress-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the egress proxy directory: %w", err)
+	}
+	p := &egressProxy{
+		dir:     dir,
+		path:    filepath.Join(dir, "proxy.sock"),
+		secret:  GenerateJobID(),
+		policy:  make(map[string]bool),
+		forward: &http.Transport{DialContext: (&net.Dialer{Timeout: egressDialTimeout}).DialContext, Proxy: nil},
+	}
+	for _, destination := range policy.Egress {
+		p.policy[destination] = true
+	}
+	listener, err := net.Listen("unix", p.path)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to start the egress proxy: %w", err)
+	}
+	p.server = &http.Server{Handler: p, ReadHeaderTimeout: readHeaderTimeout}
+	go p.server.Serve(&secretListener{Listener: listener, secret: p.secret})
+	return p, nil
+}
+
+// Close stops the proxy and removes its socket and directory
+func (p *egressProxy) Close() {
+	p.server.Close()
+	p.forward.CloseIdleConnections()
+	os.RemoveAll(p.dir)
+}
+
+// secretListener accepts connections that open with secret followed by a newline, which it strips. Connections
+// with another opening are closed on their first read.
+type secretListener struct {
+	net.Listener
+	secret string
+}
+
+func (l *secretListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &secretConn{Conn: conn, secret: l.secret}, nil
+}
+
+// secretConn checks the opening secret of a connection before its first read returns data
+type secretConn struct {
+	net.Conn
+	secret  string
+	checked bool
+}
+
+func (c *secretConn) Read(b []byte) (int, error) {
+	if !c.checked {
+		c.Conn.SetReadDeadline(time.Now().Add(egressSecretTimeout))
+		opening := make([]byte, len(c.secret)+1)
+		_, err := io.ReadFull(c.Conn, opening)
+		c.Conn.SetReadDeadline(time.Time{})
+		if err != nil || subtle.ConstantTimeCompare(opening, []byte(c.secret+"\n")) != 1 {
+			c.Conn.Close()
+			return 0, fmt.Errorf("egress proxy connection did not present the proxy's secret")
+		}
+		c.checked = true
+	}
+	return c.Conn.Read(b)
+}
+
+func (p *egressProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	destination := r.Host
+	if r.Method != http.MethodConnect {
+		if r.URL.Scheme != "http" || r.URL.Host == "" {
+			http.Error(w, "Only proxy requests are accepted", http.StatusBadRequest)
+			return
+		}
+		destination = r.URL.Host
+		if r.URL.Port() == "" {
+			destination = net.JoinHostPort(r.URL.Hostname(), "80")
+		}
+	}
+	if host, port, err := net.SplitHostPort(destination); err == nil {
+		destination = net.JoinHostPort(normalizePeerAddress(host), port)
+	}
+	if !p.policy[destination] {
+		http.Error(w, fmt.Sprintf("The job's network policy does not allow %s", destination), http.StatusForbidden)
+		return
+	}
+
+	if r.Method != http.MethodConnect {
+		out := r.Clone(r.Context())
+		out.RequestURI = ""
+		out.Header.Del("Proxy-Connection")
+		out.Header.Del("Proxy-Authorization")
+		resp, err := p.forward.RoundTrip(out)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		for key, values := range resp.Header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+		return
+	}
+
+	upstream, err := net.DialTimeout("tcp", destination, egressDialTimeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "Tunnels are not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, buffered, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+	if buffered.Reader.Buffered() > 0 {
+		io.CopyN(upstream, buffered, int64(buffered.Reader.Buffered()))
+	}
+	relay(conn, upstream)
+}
+
+// relay copies data both ways between two connections until either side closes
+func relay(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	for _, pair := range [][2]net.Conn{{a, b}, {b, a}} {
+		go func(dst, src net.Conn) {
+			io.Copy(dst, src)
+			done <- struct{}{}
+		}(pair[0], pair[1])
+	}
+	<-done
+	a.Close()
+	b.Close()
+	<-done
+}
+
+// runSandboxExec runs inside a script's network namespace when its policy allows egress: it brings the loopback
+// interface up, relays connections to a loopback port to the node's egress proxy socket and runs the script with
+// that port as its HTTP and HTTPS proxy, exiting with the script's status. It reads the proxy's secret from file
+// descriptor 3 and opens every relayed connection with it.
+func runSandboxExec(args []string) {
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "Usage: miner sandbox-exec <proxy socket> <command> [args...]")
+		os.Exit(2)
+	}
+	socket, command := args[0], args[1:]
+	secretFile := os.NewFile(3, "egress-secret")
+	secret, err := io.ReadAll(io.LimitReader(secretFile, 256))
+	secretFile.Close()
+	if err != nil || len(secret) == 0 {
+		fmt.Fprintln(os.Stderr, "Sandbox error: the egress proxy secret was not passed on file descriptor 3")
+		os.Exit(1)
+	}
+	if output, err := exec.Command("ip", "link", "set", "lo", "up").CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "Sandbox error: failed to bring up the loopback interface: %v: %s\n", err, strings.TrimSpace(string(output)))
+		os.Exit(1)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Sandbox error: %v\n", err)
+		os.Exit(1)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				upstream, err := net.Dial("unix", socket)
+				if err != nil {
+					conn.Close()
+					return
+				}
+				if _, err := upstream.Write(append(secret, '\n')); err != nil {
+					conn.Close()
+					upstream.Close()
+					return
+				}
+				relay(conn, upstream)
+			}()
+		}
+	}()
+
+	proxy := "http://" + listener.Addr().String()
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Env = append(os.Environ(), "HTTP_PROXY="+proxy, "HTTPS_PROXY="+proxy, "http_proxy="+proxy, "https_proxy="+proxy, "NO_PROXY=", "no_proxy=")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		os.Exit(exitErr.ExitCode())
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Sandbox error: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// uploadBytesToIPFS adds data to IPFS through the RPC API, pinning it, and returns its CID
+func uploadBytesToIPFS(name string, data []byte) (string, error) {
+	var requestBody bytes.Buffer
+	writer := multipart.NewWriter(&requestBody)
+	part, err := writer.CreateFormFile("file", name)
+	if err != nil {
+		return "", fmt.Errorf("failed to create form file: %w", err)
+	}
+	if _, err := part.Write(data); err != nil {
+		return "", fmt.Errorf("failed to write file content: %w", err)
+	}
+	writer.Close()
+
+	resp, err := httpClient.Post(ipfsAPIURL+"/add?pin=true", writer.FormDataContentType(), &requestBody)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload to IPFS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("IPFS upload failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var added struct{ Hash string }
+	if err := json.NewDecoder(resp.Body).Decode(&added); err != nil {
+		return "", fmt.Errorf("failed to decode IPFS response: %w", err)
+	}
+	return added.Hash, nil
+}
+
+// removeFile removes a file from the filesystem
+func removeFile(filename string) error {
+	err := os.Remove(filename)
+	if err != nil {
+		return fmt.Errorf("failed to remove file: %v", err)
+	}
+	return nil
+}
+
+// proofOfWork performs the proof-of-work algorithm to find a valid nonce
+func proofOfWork(header BlockHeader, difficulty int) int {
+	nonce := 0
+	var hash string
+	for {
+		// Generate the hash of the block with the current nonce
+		hash = generateHash(header, nonce)
+
+		// Check if the hash satisfies the difficulty condition
+		if validProof(hash, difficulty) {
+			break
+		}
+
+		nonce++
+		if nonce%powPauseCheckNonces == 0 {
+			perfCounters.hashes.Add(powPauseCheckNonces)
+			waitForResources()
+		}
+	}
+	perfCounters.hashes.Add(int64(nonce%powPauseCheckNonces + 1))
+	return nonce
+}
+
+// Resource guard timing
+const (
+	resourceCheckInterval = 5 * time.Second // Interval between resource readings
+	resourceResumeRatio   = 0.8             // Fraction of each limit every reading must fall below before proof of work resumes
+	powPauseCheckNonces   = 1 << 16         // Nonces tried between checks for a pause
+)
+
+// ResourceLimits are the readings above which proof of work pauses, so the node yields the CPU to job execution
+// and to other workloads on the same hardware; zero disables a limit
+type ResourceLimits struct {
+	Load        float64 // One-minute load average per CPU
+	CPUPressure float64 // Percentage of the last 10 seconds in which runnable tasks waited for a CPU
+	Temperature float64 // Temperature of the hottest thermal zone in degrees Celsius
+}
+
+var resourceLimits ResourceLimits // Limits of the resource guard, set by the -pause-* flags
+var powPaused atomic.Bool         // Whether proof of work is paused for resource pressure
+var resourcePressure string       // Why proof of work is paused, empty when it runs; guarded by mutex
+
+// readLoad returns the one-minute load average per CPU
+func readLoad() (float64, error) {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("unexpected /proc/loadavg format")
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, err
+	}
+	return load / float64(runtime.NumCPU()), nil
+}
+
+// readCPUPressure returns the share of the last 10 seconds in which tasks waited for a CPU, from the node's
+// cgroup when it runs in one with pressure accounting and from the whole system otherwise
+func readCPUPressure() (float64, error) {
+	data, err := os.ReadFile("/sys/fs/cgroup/cpu.pressure")
+	if err != nil {
+		data, err = os.ReadFile("/proc/pressure/cpu")
+	}
+	if err != nil {
+		return 0, err
+	}
+	// some avg10=1.23 avg60=0.80 avg300=0.50 total=123456
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "some" {
+			continue
+		}
+		if value, ok := strings.CutPrefix(fields[1], "avg10="); ok {
+			return strconv.ParseFloat(value, 64)
+		}
+	}
+	return 0, fmt.Errorf("unexpected CPU pressure format")
+}
+
+// readTemperature returns the temperature of the hottest thermal zone in degrees Celsius
+func readTemperature() (float64, error) {
+	zones, _ := filepath.Glob("/sys/class/thermal/thermal_zone*/temp")
+	hottest, found := 0.0, false
+	for _, zone := range zones {
+		data, err := os.ReadFile(zone)
+		if err != nil {
+			continue
+		}
+		millidegrees, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+		if err != nil {
+			continue
+		}
+		if !found || millidegrees/1000 > hottest {
+			hottest, found = millidegrees/1000, true
+		}
+	}
+	if !found {
+		return 0, fmt.Errorf("no readable thermal zones")
+	}
+	return hottest, nil
+}
+
+// resourceReading is a resource the guard watches, with its limit
+type resourceReading struct {
+	name   string
+	unit   string
+	limit  float64
+	reader func() (float64, error)
+}
+
+// resourceReadings returns the resources whose limit is enabled
+func resourceReadings() []resourceReading {
+	all := []resourceReading{
+		{"load", " per CPU", resourceLimits.Load, readLoad},
+		{"CPU pressure", "%", resourceLimits.CPUPressure, readCPUPressure},
+		{"temperature", "°C", resourceLimits.Temperature, readTemperature},
+	}
+	enabled := all[:0]
+	for _, reading := range all {
+		if reading.limit > 0 {
+			enabled = append(enabled, reading)
+		}
+	}
+	return enabled
+}
+
+// checkResources pauses proof of work when a reading exceeds its limit and resumes it once every reading has
+// fallen below resourceResumeRatio of its limit. Readings that cannot be taken are ignored.
+func checkResources() {
+	over, high := "", false
+	for _, reading := range resourceReadings() {
+		value, err := reading.reader()
+		if err != nil {
+			continue
+		}
+		if value > reading.limit && over == "" {
+			over = fmt.Sprintf("%s %.1f%s above %.1f%s", reading.name, value, reading.unit, reading.limit, reading.unit)
+		}
+		if value >= reading.limit*resourceResumeRatio {
+			high = true
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	switch {
+	case over != "" && resourcePressure == "":
+		fmt.Printf("Pausing proof of work: %s\n", over)
+		resourcePressure = over
+		powPaused.Store(true)
+	case over == "" && !high && resourcePressure != "":
+		fmt.Println("Resource pressure subsided, resuming proof of work")
+		resourcePressure = ""
+		powPaused.Store(false)
+	}
+}
+
+// waitForResources blocks while proof of work is paused for resource pressure
+func waitForResources() {
+	for powPaused.Load() {
+		time.Sleep(time.Second)
+	}
+}
+
+// validProof validates the proof of work by checking if the hash has the required number of leading zeros
+func validProof(hash string, difficulty int) bool {
+	prefix := strings.Repeat("0", difficulty)
+	return strings.HasPrefix(hash, prefix)
+}
+
+// generateHash generates a SHA256 hash for the block header with the given nonce
+func generateHash(header BlockHeader, nonce int) string {
+	blockData := fmt.Sprintf("%s|%d|%d|%s|%s|%d|%s|%d", header.PrevHash, header.BlockNumber, nonce, header.TxRoot,
+		header.PrevCID, header.Timestamp, header.Creator, header.Difficulty)
+	if header.TimeAttestation != nil {
+		blockData += "|" + header.TimeAttestation.Signature
+	}
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(blockData)))
+}
+
+// BlockHash recomputes the hash of a block header with the nonce it records, for clients checking a header a node
+// served them
+func BlockHash(header BlockHeader) string {
+	return generateHash(header, header.Nonce)
+}
+
+// ValidProof reports whether a block hash meets a difficulty
+func ValidProof(hash string, difficulty int) bool {
+	return validProof(hash, difficulty)
+}
+
+// txHash returns the hash of a transaction's JSON encoding, the leaf of the block's Merkle tree
+func txHash(tx Transaction) [32]byte {
+	data, _ := json.Marshal(tx)
+	return sha256.Sum256(data)
+}
+
+// merkleRoot returns the hex-encoded Merkle root over the hashes of the transactions, duplicating the last
+// node of odd levels; an empty body has the hash of no data as its root
+func merkleRoot(transactions []Transaction) string {
+	if len(transactions) == 0 {
+		return fmt.Sprintf("%x", sha256.Sum256(nil))
+	}
+	level := make([][32]byte, len(transactions))
+	for i, tx := range transactions {
+		level[i] = txHash(tx)
+	}
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+		next := make([][32]byte, len(level)/2)
+		for i := range next {
+			next[i] = sha256.Sum256(append(level[2*i][:], level[2*i+1][:]...))
+		}
+		level = next
+	}
+	return fmt.Sprintf("%x", level[0])
+}
+
+// merkleProof returns the hex-encoded sibling hashes leading from the transaction at index to the Merkle root
+func merkleProof(transactions []Transaction, index int) []string {
+	level := make([][32]byte, len(transactions))
+	for i, tx := range transactions {
+		level[i] = txHash(tx)
+	}
+	siblings := []string{}
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+		siblings = append(siblings, fmt.Sprintf("%x", level[index^1]))
+		next := make([][32]byte, len(level)/2)
+		for i := range next {
+			next[i] = sha256.Sum256(append(level[2*i][:], level[2*i+1][:]...))
+		}
+		level = next
+		index /= 2
+	}
+	return siblings
+}
+
+// computeUnits buckets a job's CPU time into compute units: one unit per started CPU-second, and at least one
+// unit for any job, so even trivial jobs take a share of the block's budget
+func computeUnits(cpuMillis int64) int64 {
+	return max((cpuMillis+computeUnitMillis-1)/computeUnitMillis, 1)
+}
+
+// blockCompute returns the compute units the transactions declare in total
+func blockCompute(transactions []Transaction) int64 {
+	var total int64
+	for _, tx := range transactions {
+		total += tx.ComputeUnits
+	}
+	return total
+}
+
+// mineBlock mines a new block using proof of work and adds it to the local chain once the pool fills a block
+func mineBlock(miner string, difficulty int) {
+	minimum := blockTransactions
+	if devMode {
+		// Development nodes mine every transaction as soon as it arrives
+		minimum = 1
+	}
+	mineTransactions(miner, difficulty, minimum)
+}
+
+// dropRuleViolations removes pooled transactions admitted before a consensus rule activated that break it at
+// height; the caller must hold mutex
+func dropRuleViolations(height int) {
+	kept := transactionPool[:0]
+	for _, tx := range transactionPool {
+		if err := checkRules(tx, height); err != nil {
+			fmt.Printf("Dropping transaction %s from the pool: %v\n", txID(tx), err)
+			delete(poolAdmitted, txID(tx))
+			continue
+		}
+		kept = append(kept, tx)
+	}
+	clear(transactionPool[len(kept):])
+	transactionPool = kept
+}
+
+// mineTransactions mines a block of up to blockTransactions pooled transactions if at least minimum are waiting
+// or the waiting jobs fill the block's compute budget
+func mineTransactions(miner string, difficulty, minimum int) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if reason := miningHeld(); reason != "" {
+		fmt.Printf("Not mining: %s\n", reason)
+		return
+	}
+
+	dropRuleViolations(currentBlock.BlockNumber + 1)
+	full := len(transactionPool) > 0 && blockCompute(transactionPool) >= int64(networkParams.MaxBlockCompute)
+	if len(transactionPool) >= max(minimum, 1) || full {
+		selected := selectTransactions(blockTransactions)
+
+		// Create a new block
+		block := Block{
+			BlockHeader: BlockHeader{
+				PrevHash:    previousBlockHash,            // The hash of the previous block (starting with -1 for the genesis block)
+				PrevCID:     previousBlockCID,             // Set the PrevCID of the previous block
+				BlockNumber: currentBlock.BlockNumber + 1, // Increment BlockNumber
+				Timestamp:   time.Now().Unix(),            // Set the current timestamp
+				Creator:     miner,                        // Set the creator to the miner's identifier
+				Difficulty:  difficulty,                   // Set the difficulty
+				TxRoot:      merkleRoot(selected),         // Commit the header to the highest-fee transactions
+			},
+			BlockBody: BlockBody{Transactions: selected},
+		}
+
+		// Run Proof of Work in a Goroutine
+		go func() {
+			if timeOracleEnabled {
+				attestation, err := obtainTimeAttestation(block.BlockHeader)
+				if err != nil {
+					fmt.Printf("Error attesting block time: %v\n", err)
+					return
+				}
+				block.TimeAttestation = attestation
+			}
+
+			endRush := scheduler.Rush(rushMining)
+			nonce := proofOfWork(block.BlockHeader, difficulty)
+			endRush()
+			block.Nonce = nonce
+			block.Hash = generateHash(block.BlockHeader, nonce)
+			block.Signature = hex.EncodeToString(ed25519.Sign(nodeKey, blockMessage(block.BlockHeader)))
+
+			if err := validateBlock(block); err != nil {
+				fmt.Printf("Mined block %d failed validation: %v\n", block.BlockNumber, err)
+				return
+			}
+
+			// Upload the block before adding it to the chain, so the next block can link to its CID
+			cid, err := pinBlock(block)
+			if err != nil {
+				fmt.Printf("Error uploading block %d to IPFS: %v\n", block.BlockNumber, err)
+			}
+
+			mutex.Lock()
+			if block.PrevHash != previousBlockHash {
+				// Another block extended the chain while this one was being mined
+				statsFor(block.Creator).StaleBlocks++
+				winner := ""
+				if block.BlockNumber <= len(blockchain) {
+					winner = blockchain[block.BlockNumber-1].Hash
+				}
+				mutex.Unlock()
+				fmt.Printf("Discarding stale block %d\n", block.BlockNumber)
+				noteFork(forkStale, block.BlockNumber, winner, []Block{block})
+				return
+			}
+			if invalidBlocks[block.Hash] {
+				// The same transactions on the same parent reproduce the invalidated block, so they cannot be mined
+				removeFromPool(blockTxIDs(block))
+				reconcilePool()
+				mutex.Unlock()
+				fmt.Printf("Discarding block %d: it reproduces invalidated block %s\n", block.BlockNumber, block.Hash)
+				return
+			}
+			if confirmed, err := checkConfirmed(block); err != nil {
+				// A peer's block confirmed some of these transactions while this one was mined
+				removeFromPool(confirmed)
+				reconcilePool()
+				mutex.Unlock()
+				fmt.Printf("Discarding block %d: %v\n", block.BlockNumber, err)
+				return
+			}
+			if invalid, err := checkBlockBalances(block); err != nil {
+				// Drop the uncovered transfers so the next attempt can mine the remaining transactions
+				removeFromPool(invalid)
+				reconcilePool()
+				mutex.Unlock()
+				fmt.Printf("Discarding block %d: %v\n", block.BlockNumber, err)
+				return
+			}
+			if invalid, err := checkRevocations(block); err != nil {
+				// A revocation confirmed while this block was mined refuses some of its transactions
+				removeFromPool(invalid)
+				reconcilePool()
+				mutex.Unlock()
+				fmt.Printf("Discarding block %d: %v\n", block.BlockNumber, err)
+				return
+			}
+			appendBlock(block)
+			if cid != "" {
+				previousBlockCID = cid
+			}
+			mutex.Unlock()
+			for _, hook := range hooks.onBlockMined {
+				hook(block)
+			}
+
+			// Broadcast the block to other miners
+			go broadcastBlock(block)
+
+			// Clear the processed transactions from the pool
+			mutex.Lock()
+			removeFromPool(blockTxIDs(block))
+			reconcilePool()
+			remaining := len(transactionPool)
+			mutex.Unlock()
+			if devMode && remaining > 0 {
+				// Transactions that arrived while this block was mined would otherwise wait for the next one
+				go mineBlock(miner, difficulty)
+			}
+		}()
+	}
+}
+
+// appendBlock makes block the new tip of the local chain; the caller must hold mutex
+func appendBlock(block Block) {
+	applyBlock(block)
+	storeBlock(block)
+
+	if isValidator(nodeID) {
+		vote := FinalityVote{BlockNumber: block.BlockNumber, BlockHash: block.Hash, Validator: nodeID}
+		vote.Signature = hex.EncodeToString(ed25519.Sign(nodeKey, finalityVoteMessage(vote)))
+		addFinalityVote(vote)
+		go broadcastFinalityVote(vote)
+	}
+	updateFinality()
+
+	// Checkpoint derived state while running; replays during startup already start from a snapshot
+	if chainStore != nil && snapshotInterval > 0 && block.BlockNumber%snapshotInterval == 0 {
+		takeSnapshot()
+	}
+}
+
+// applyBlock moves the tip of the in-memory chain to block and updates the state derived from it; the caller
+// must hold mutex
+func applyBlock(block Block) {
+	recordBlockStats(block)
+	previousBlockHash = block.Hash
+	previousBlockCID = "-1" // The new tip has no known CID until it is published
+	currentBlock = block    // Update current block to the new tip
+	blockchain = append(blockchain, block)
+	applyBlockBalances(block)
+	applyRevocations(block)
+	for _, tx := range block.Transactions {
+		txIndex[txID(tx)] = block.BlockNumber
+		indexLabels(tx)
+		if job, ok := jobs[tx.JobID]; ok {
+			job.Status = JobConfirmed
+			job.BlockNumber = block.BlockNumber
+		}
+	}
+}
+
+// StateSnapshot is a checkpoint of the state derived from the chain up to Height
+type StateSnapshot struct {
+	Height     int                    // Number of the last block included in the snapshot
+	HeadHash   string                 // Hash of that block, used to check the snapshot matches the chain
+	MinerStats map[string]*MinerStats // Per-miner statistics
+	TxIndex    map[string]int         // Block number of every confirmed transaction
+	Balances   map[string]int64       // Balance of every node identity
+	Nonces     map[string]int64       // Last confirmed transfer nonce of every node identity
+
+	Labels  map[string][]string   // Transaction IDs carrying each label
+	Revoked map[string]Revocation // Confirmed revocations keyed by the revoked identity
+}
+
+// snapshotPath returns the file holding the snapshot taken at height
+func snapshotPath(height int) string {
+	return filepath.Join(snapshotDir, fmt.Sprintf("%010d.json", height))
+}
+
+// takeSnapshot copies the derived state and writes it to the snapshot directory in the background,
+// keeping only the most recent snapshotKeep snapshots; the caller must hold mutex
+func takeSnapshot() {
+	snapshot := StateSnapshot{
+		Height:     currentBlock.BlockNumber,
+		HeadHash:   currentBlock.Hash,
+		MinerStats: make(map[string]*MinerStats, len(minerStats)),
+		TxIndex:    make(map[string]int, len(txIndex)),
+		Balances:   make(map[string]int64, len(balances)),
+		Nonces:     make(map[string]int64, len(nonces)),
+		Labels:     make(map[string][]string, len(labelIndex)),
+		Revoked:    make(map[string]Revocation, len(revoked)),
+	}
+	for identity, stats := range minerStats {
+		copied := *stats
+		snapshot.MinerStats[identity] = &copied
+	}
+	for id, number := range txIndex {
+		snapshot.TxIndex[id] = number
+	}
+	for address, balance := range balances {
+		snapshot.Balances[address] = balance
+	}
+	for address, nonce := range nonces {
+		snapshot.Nonces[address] = nonce
+	}
+	for label, ids := range labelIndex {
+		snapshot.Labels[label] = append([]string(nil), ids...)
+	}
+	for identity, revocation := range revoked {
+		snapshot.Revoked[identity] = revocation
+	}
+
+	go func() {
+		data, err := json.Marshal(snapshot)
+		if err == nil {
+			err = os.MkdirAll(snapshotDir, 0755)
+		}
+		if err == nil {
+			err = os.WriteFile(snapshotPath(snapshot.Height), data, 0644)
+		}
+		if err != nil {
+			fmt.Printf("Error writing state snapshot at block %d: %v\n", snapshot.Height, err)
+			return
+		}
+		pruneSnapshots()
+	}()
+}
+
+// snapshotHeights lists the heights of the stored snapshots, newest first
+func snapshotHeights() []int {
+	entries, err := os.ReadDir(snapshotDir)
+	if err != nil {
+		return nil
+	}
+	heights := []int{}
+	for _, entry := range entries {
+		if height, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), ".json")); err == nil {
+			heights = append(heights, height)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(heights)))
+	return heights
+}
+
+// pruneSnapshots removes all but the most recent snapshotKeep snapshots
+func pruneSnapshots() {
+	heights := snapshotHeights()
+	for i := snapshotKeep; i < len(heights); i++ {
+		os.Remove(snapshotPath(heights[i]))
+	}
+}
+
+// loadSnapshot returns the newest snapshot at or below maxHeight that matches the given chain
+func loadSnapshot(chain []Block, maxHeight int) *StateSnapshot {
+	for _, height := range snapshotHeights() {
+		if height > maxHeight || height > len(chain) || height < 1 {
+			continue
+		}
+		data, err := os.ReadFile(snapshotPath(height))
+		if err != nil {
+			continue
+		}
+		var snapshot StateSnapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil || snapshot.HeadHash != chain[height-1].Hash {
+			continue
+		}
+		return &snapshot
+	}
+	return nil
+}
+
+// restoreSnapshot resets the local chain to chain[:snapshot.Height] and the derived state to the snapshot,
+// so the remaining blocks only need to be replayed on top; the caller must hold mutex
+func restoreSnapshot(snapshot *StateSnapshot, chain []Block) {
+	blockchain = append([]Block(nil), chain[:snapshot.Height]...)
+	currentBlock = blockchain[len(blockchain)-1]
+	previousBlockHash = currentBlock.Hash
+	previousBlockCID = "-1"
+	minerStats = snapshot.MinerStats
+	txIndex = snapshot.TxIndex
+	balances = snapshot.Balances
+	nonces = snapshot.Nonces
+	if minerStats == nil {
+		minerStats = make(map[string]*MinerStats)
+	}
+	if txIndex == nil {
+		txIndex = make(map[string]int)
+	}
+	if balances == nil {
+		balances = make(map[string]int64)
+	}
+	if nonces == nil {
+		nonces = make(map[string]int64)
+	}
+	revoked = snapshot.Revoked
+	if revoked == nil {
+		// Snapshots taken before revocations existed: collect whatever the restored chain holds
+		revoked = make(map[string]Revocation)
+		for _, block := range blockchain {
+			applyRevocations(block)
+		}
+	}
+	labelIndex = snapshot.Labels
+	if labelIndex == nil {
+		// Snapshots taken before labels existed: index whatever bodies the restored chain holds
+		labelIndex = make(map[string][]string)
+		for _, block := range blockchain {
+			for _, tx := range block.Transactions {
+				indexLabels(tx)
+			}
+		}
+	}
+	blockCache.Purge()
+	txCache.Purge()
+}
+
+// storeBlock appends a block to the local chain store once it is open; the caller must hold mutex
+func storeBlock(block Block) {
+	if chainStore == nil {
+		return
+	}
+	if err := chainStore.Append(block); err != nil {
+		fmt.Printf("Error storing block %d: %v\n", block.BlockNumber, err)
+	}
+}
+
+// ChainStore persists the local chain and, for backends that support it, the job history. Stores are used with
+// mutex held.
+type ChainStore interface {
+	Load() ([]Block, error)       // Returns the stored blocks in order, together with any error past the last intact one
+	Append(block Block) error     // Adds a block on top of the stored chain
+	Rewrite(blocks []Block) error // Replaces the stored chain, after a repair or rollback
+	LoadJobs() ([]Job, error)     // Returns the stored job history
+	SaveJobs(jobs []Job) error    // Replaces the stored job history
+	Sync() error                  // Flushes written blocks to disk
+	Close() error
+}
+
+// StoreBackend opens a chain store in a data directory; codec is the storage codec selected with -storage-codec
+type StoreBackend func(dataDir string, codec Codec) (ChainStore, error)
+
+// storeBackends lists the chain store backends by name. The file store is built in; other backends, such as the
+// SQLite store in sqlite_store.go, register themselves from init when compiled into the node.
+var storeBackends = map[string]StoreBackend{"file": openFileStore}
+
+// RegisterStore makes a chain store backend selectable with -store
+func RegisterStore(name string, backend StoreBackend) {
+	storeBackends[name] = backend
+}
+
+// storeNames returns the names of the available chain store backends
+func storeNames() []string {
+	names := make([]string, 0, len(storeBackends))
+	for name := range storeBackends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// openStore opens the chain store backend registered under name
+func openStore(name, dataDir string, codec Codec) (ChainStore, error) {
+	backend, ok := storeBackends[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported chain store %q, expected one of %s", name, strings.Join(storeNames(), ", "))
+	}
+	return backend(dataDir, codec)
+}
+
+// fileStore keeps block headers and bodies in two append-only files of the storage codec. Every append and rewrite
+// is journaled to a write-ahead log first, so one interrupted by a crash is completed on the next start. Job
+// history is not persisted.
+type fileStore struct {
+	dataDir       string
+	codec         Codec
+	headers       *os.File // Header file, appended to as blocks are accepted
+	bodies        *os.File // Body file, holding the body of every header in the same order
+	headerEncoder Encoder  // Writes block headers to headers
+	bodyEncoder   Encoder  // Writes block bodies to bodies
+}
+
+// openFileStore completes any mutation left in the write-ahead log, then opens the header and body files in
+// dataDir for appending
+func openFileStore(dataDir string, codec Codec) (ChainStore, error) {
+	if err := replayWAL(dataDir, codec); err != nil {
+		return nil, err
+	}
+	store := &fileStore{dataDir: dataDir, codec: codec}
+	if err := store.open(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// open opens the header and body files for appending
+func (s *fileStore) open() error {
+	headerPath, bodyPath := chainStorePaths(s.dataDir, s.codec)
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	headers, err := os.OpenFile(headerPath, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open header store: %w", err)
+	}
+	bodies, err := os.OpenFile(bodyPath, flags, 0644)
+	if err != nil {
+		headers.Close()
+		return fmt.Errorf("failed to open body store: %w", err)
+	}
+	s.headers, s.bodies = headers, bodies
+	s.headerEncoder, s.bodyEncoder = s.codec.NewEncoder(headers), s.codec.NewEncoder(bodies)
+	return nil
+}
+
+func (s *fileStore) Load() ([]Block, error) {
+	return loadStoredChain(s.dataDir, s.codec)
+}
+
+func (s *fileStore) Append(block Block) error {
+	headerInfo, err := s.headers.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read header store: %w", err)
+	}
+	bodyInfo, err := s.bodies.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read body store: %w", err)
+	}
+	wal := walPath(s.dataDir, s.codec)
+	record := walRecord{Op: walAppend, Block: block, HeaderSize: headerInfo.Size(), BodySize: bodyInfo.Size()}
+	if err := writeWAL(wal, s.codec, record); err != nil {
+		return err
+	}
+	if err := s.appendBlock(block); err != nil {
+		// Cut off the partial record so later appends stay decodable; the journal repeats the append on restart
+		s.bodies.Truncate(record.BodySize)
+		s.headers.Truncate(record.HeaderSize)
+		return err
+	}
+	if err := s.Sync(); err != nil {
+		return fmt.Errorf("failed to flush the chain store: %w", err)
+	}
+	return clearWAL(wal)
+}
+
+// appendBlock writes a block's body and header to the store files
+func (s *fileStore) appendBlock(block Block) error {
+	// The body goes first, so a crash in between leaves a body without a header rather than the reverse
+	if err := s.bodyEncoder.Encode(block.BlockBody); err != nil {
+		return fmt.Errorf("failed to store body: %w", err)
+	}
+	if err := s.headerEncoder.Encode(block.BlockHeader); err != nil {
+		return fmt.Errorf("failed to store header: %w", err)
+	}
+	return nil
+}
+
+func (s *fileStore) Rewrite(blocks []Block) error {
+	s.Close()
+	if err := rewriteChainStore(s.dataDir, s.codec, blocks); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+func (s *fileStore) LoadJobs() ([]Job, error) { return nil, nil }
+func (s *fileStore) SaveJobs([]Job) error     { return nil }
+
+func (s *fileStore) Sync() error {
+	if err := s.bodies.Sync(); err != nil {
+		return err
+	}
+	return s.headers.Sync()
+}
+
+func (s *fileStore) Close() error {
+	err := s.bodies.Close()
+	if closeErr := s.headers.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// chainStorePaths returns the header and body files of the chain store in dataDir
+func chainStorePaths(dataDir string, codec Codec) (string, string) {
+	return filepath.Join(dataDir, "headers."+codec.Name()), filepath.Join(dataDir, "bodies."+codec.Name())
+}
+
+// decodeStored decodes the consecutive records of a store file, returning the records decoded before any error
+func decodeStored[T any](path string, codec Codec) ([]T, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	records := []T{}
+	decoder := codec.NewDecoder(file)
+	for {
+		var record T
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, fmt.Errorf("failed to decode record %d of %s: %w", len(records)+1, path, err)
+		}
+		records = append(records, record)
+	}
+}
+
+// loadStoredChain reads the headers and bodies in the local chain store and pairs them into blocks, returning
+// the blocks assembled before any error
+func loadStoredChain(dataDir string, codec Codec) ([]Block, error) {
+	headerPath, bodyPath := chainStorePaths(dataDir, codec)
+	headers, headerErr := decodeStored[BlockHeader](headerPath, codec)
+	bodies, bodyErr := decodeStored[BlockBody](bodyPath, codec)
+
+	blocks := make([]Block, 0, len(headers))
+	for i := 0; i < min(len(headers), len(bodies)); i++ {
+		blocks = append(blocks, Block{BlockHeader: headers[i], BlockBody: bodies[i]})
+	}
+	switch {
+	case headerErr != nil:
+		return blocks, headerErr
+	case bodyErr != nil:
+		return blocks, bodyErr
+	case len(headers) != len(bodies):
+		return blocks, fmt.Errorf("chain store holds %d headers but %d bodies", len(headers), len(bodies))
+	}
+	return blocks, nil
+}
+
+// cidAvailable reports whether a CID can be retrieved through the IPFS gateway. An error means the gateway gave
+// no definite answer, because it could not be reached or failed.
+func cidAvailable(cid string) (bool, error) {
+	source, err := gatewayURL(cid)
+	if err != nil {
+		return false, nil
+	}
+	resp, err := gatewayClient.Head(source)
+	if err != nil {
+		return false, fmt.Errorf("failed to reach the IPFS gateway: %w", err)
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound, http.StatusGone:
+		return false, nil
+	}
+	return false, fmt.Errorf("IPFS gateway answered with status %d", resp.StatusCode)
+}
+
+// verifyChainIntegrity checks heights, hashes, links, bodies, proof of work, creator signatures and PrevCID
+// availability of the last depth blocks (the whole chain when depth is 0), returning how many leading blocks are
+// intact. PrevCIDs are no longer checked once the gateway fails to answer, so an outage does not truncate the chain.
+func verifyChainIntegrity(blocks []Block, depth int) (int, error) {
+	checkCIDs := true
+	start := 0
+	if depth > 0 && len(blocks) > depth {
+		start = len(blocks) - depth
+	}
+	for i := start; i < len(blocks); i++ {
+		block := blocks[i]
+		prevHash := "-1"
+		if i > 0 {
+			prevHash = blocks[i-1].Hash
+		}
+		switch {
+		case block.BlockNumber != i+1:
+			return i, fmt.Errorf("block at position %d has height %d", i+1, block.BlockNumber)
+		case block.PrevHash != prevHash:
+			return i, fmt.Errorf("block %d does not link to the hash of block %d", block.BlockNumber, i)
+		case generateHash(block.BlockHeader, block.Nonce) != block.Hash:
+			return i, fmt.Errorf("block %d hash does not match its header", block.BlockNumber)
+		case merkleRoot(block.Transactions) != block.TxRoot:
+			return i, fmt.Errorf("block %d body does not match its header", block.BlockNumber)
+		case !validProof(block.Hash, block.Difficulty):
+			return i, fmt.Errorf("block %d does not satisfy its difficulty", block.BlockNumber)
+		case validateCreatorSignature(block.BlockHeader) != nil:
+			return i, fmt.Errorf("block %d is not signed by its creator", block.BlockNumber)
+		}
+		if block.PrevCID == "-1" || !checkCIDs {
+			continue
+		}
+		available, err := cidAvailable(block.PrevCID)
+		if err != nil {
+			fmt.Printf("Not checking PrevCIDs: %v\n", err)
+			checkCIDs = false
+		} else if !available {
+			return i, fmt.Errorf("block %d references PrevCID %s which is not available in IPFS", block.BlockNumber, block.PrevCID)
+		}
+	}
+	return len(blocks), nil
+}
+
+// openChainStore loads the local chain and job history, verifies the chain's integrity and replays the intact
+// part. A corrupted store is rewritten without the damaged blocks and true is returned so the caller can resync
+// them from peers.
+func openChainStore(dataDir, backend string, codec Codec, depth int) (bool, error) {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return false, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	store, err := openStore(backend, dataDir, codec)
+	if err != nil {
+		return false, err
+	}
+	storedJobs, err := store.LoadJobs()
+	if err != nil {
+		store.Close()
+		return false, fmt.Errorf("failed to load job history: %w", err)
+	}
+	blocks, loadErr := store.Load()
+	intact, verifyErr := verifyChainIntegrity(blocks, depth)
+	corrupted := loadErr != nil || verifyErr != nil
+	for _, err := range []error{loadErr, verifyErr} {
+		if err != nil {
+			fmt.Printf("Chain store corruption detected: %v\n", err)
+		}
+	}
+
+	mutex.Lock()
+	for _, job := range storedJobs {
+		if job.Status == JobExecuting || job.Status == JobQueued {
+			// The execution ended with the previous process
+			job.Status, job.Error = JobFailed, "node restarted before the job finished"
+		}
+		jobs[job.ID] = &job
+	}
+
+	// Start from the newest matching snapshot and replay only the blocks after it
+	replayFrom := 0
+	if snapshot := loadSnapshot(blocks, intact); snapshot != nil {
+		restoreSnapshot(snapshot, blocks)
+		replayFrom = snapshot.Height
+		fmt.Printf("Restored state snapshot at block %d\n", snapshot.Height)
+	}
+	for _, block := range blocks[replayFrom:intact] {
+		appendBlock(block)
+	}
+	mutex.Unlock()
+	if removed := blocks[intact:]; len(removed) > 0 {
+		for _, hook := range hooks.onTruncate {
+			hook(removed)
+		}
+	}
+
+	if corrupted {
+		// Rewrite the store from the intact blocks
+		if err := store.Rewrite(blocks[:intact]); err != nil {
+			store.Close()
+			return corrupted, err
+		}
+	}
+
+	mutex.Lock()
+	chainStore = store
+	mutex.Unlock()
+	fmt.Printf("Loaded %d blocks and %d jobs from the %s store in %s\n", intact, len(storedJobs), backend, dataDir)
+	return corrupted, nil
+}
+
+// flushJobs writes the job history to the chain store, for backends that keep it
+func flushJobs() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if chainStore == nil {
+		return
+	}
+	records := make([]Job, 0, len(jobs))
+	for _, job := range jobs {
+		records = append(records, *job)
+	}
+	if err := chainStore.SaveJobs(records); err != nil {
+		fmt.Printf("Error saving job history: %v\n", err)
+	}
+}
+
+// rewriteChainStore replaces the chain store in dataDir with the given blocks. Both files are written out in full
+// before the journal commits to swapping them in, so a crash leaves either the old chain or the new one.
+func rewriteChainStore(dataDir string, codec Codec, blocks []Block) error {
+	headerPath, bodyPath := chainStorePaths(dataDir, codec)
+	headers := make([]BlockHeader, len(blocks))
+	bodies := make([]BlockBody, len(blocks))
+	for i, block := range blocks {
+		headers[i], bodies[i] = block.BlockHeader, block.BlockBody
+	}
+	if err := writeStored(bodyPath+".tmp", codec, bodies); err != nil {
+		return err
+	}
+	if err := writeStored(headerPath+".tmp", codec, headers); err != nil {
+		return err
+	}
+	wal := walPath(dataDir, codec)
+	if err := writeWAL(wal, codec, walRecord{Op: walRewrite}); err != nil {
+		return err
+	}
+	if err := commitRewrite(dataDir, codec); err != nil {
+		return err
+	}
+	return clearWAL(wal)
+}
+
+// writeStored writes records to a new file and flushes it to disk
+func writeStored[T any](path string, codec Codec, records []T) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer file.Close()
+	encoder := codec.NewEncoder(file)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to flush %s: %w", path, err)
+	}
+	return nil
+}
+
+// commitRewrite moves rewritten store files into place, skipping any a previous attempt already moved
+func commitRewrite(dataDir string, codec Codec) error {
+	headerPath, bodyPath := chainStorePaths(dataDir, codec)
+	for _, path := range []string{bodyPath, headerPath} {
+		if err := os.Rename(path+".tmp", path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to replace %s: %w", path, err)
+		}
+	}
+	return syncDir(dataDir)
+}
+
+// Operations journaled in the write-ahead log
+const (
+	walAppend  = "append"  // A block is being appended to the store files
+	walRewrite = "rewrite" // Rewritten store files are being moved into place
+)
+
+// walRecord journals a chain store mutation before it touches the store files
+type walRecord struct {
+	Op         string // walAppend or walRewrite
+	Block      Block  // Block being appended
+	HeaderSize int64  // Size of the header file before the append
+	BodySize   int64  // Size of the body file before the append
+}
+
+// walPath returns the write-ahead log of the chain store in dataDir
+func walPath(dataDir string, codec Codec) string {
+	return filepath.Join(dataDir, "wal."+codec.Name())
+}
+
+// writeWAL journals a mutation and flushes it to disk before the mutation starts
+func writeWAL(path string, codec Codec, record walRecord) error {
+	if err := writeStored(path, codec, []walRecord{record}); err != nil {
+		return fmt.Errorf("failed to journal %s: %w", record.Op, err)
+	}
+	return nil
+}
+
+// clearWAL marks the journaled mutation as complete. The log is emptied rather than removed, so its directory
+// entry does not have to be flushed for every mutation.
+func clearWAL(path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to clear the write-ahead log: %w", err)
+	}
+	defer file.Close()
+	return file.Sync()
+}
+
+// syncDir flushes a directory, making renames and new files in it durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// replayWAL completes the mutation journaled in the chain store's write-ahead log, if the node stopped before it
+// finished. An incomplete journal record means the store files were not touched yet, so it is discarded.
+func replayWAL(dataDir string, codec Codec) error {
+	path := walPath(dataDir, codec)
+	records, err := decodeStored[walRecord](path, codec)
+	if err != nil || len(records) == 0 {
+		if _, statErr := os.Stat(path); os.IsNotExist(statErr) {
+			if err := clearWAL(path); err != nil {
+				return err
+			}
+			return syncDir(dataDir)
+		}
+		return clearWAL(path)
+	}
+
+	record := records[0]
+	headerPath, bodyPath := chainStorePaths(dataDir, codec)
+	switch record.Op {
+	case walAppend:
+		// Undo whatever part of the append reached the files, then repeat it
+		for _, file := range []struct {
+			path string
+			size int64
+		}{{bodyPath, record.BodySize}, {headerPath, record.HeaderSize}} {
+			if err := os.Truncate(file.path, file.size); err != nil && !(os.IsNotExist(err) && file.size == 0) {
+				return fmt.Errorf("failed to roll back %s: %w", file.path, err)
+			}
+		}
+		store := &fileStore{dataDir: dataDir, codec: codec}
+		if err := store.open(); err != nil {
+			return err
+		}
+		err := store.appendBlock(record.Block)
+		if err == nil {
+			err = store.Sync()
+		}
+		store.Close()
+		if err != nil {
+			return fmt.Errorf("failed to repeat the append of block %d: %w", record.Block.BlockNumber, err)
+		}
+		fmt.Printf("Completed the interrupted append of block %d to the chain store\n", record.Block.BlockNumber)
+	case walRewrite:
+		if err := commitRewrite(dataDir, codec); err != nil {
+			return err
+		}
+		fmt.Println("Completed the interrupted rewrite of the chain store")
+	default:
+		return fmt.Errorf("unknown operation %q in the write-ahead log", record.Op)
+	}
+	return clearWAL(path)
+}
+
+// ChainHead is the record a node publishes to IPNS so its chain can be found again after local state is lost
+type ChainHead struct {
+	Height int      // Number of the head block
+	Hash   string   // Hash of the head block
+	CID    string   // IPFS CID of the head block
+	Peers  []string // Peers the node knew when it published the record
+	Time   int64    // Unix time the record was published
+}
+
+// publishHead uploads the head block and a ChainHead record pointing at it, then points the head key's IPNS name
+// at the record; nothing is published while the head is unchanged
+func publishHead() error {
+	mutex.Lock()
+	block := currentBlock
+	list := append([]string(nil), peers...)
+	unchanged := block.BlockNumber == 0 || block.Hash == lastPublishedHead
+	mutex.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	cid, err := uploadBlockToIPFS(block)
+	if err != nil {
+		return err
+	}
+	record, err := json.Marshal(ChainHead{Height: block.BlockNumber, Hash: block.Hash, CID: cid, Peers: list, Time: time.Now().Unix()})
+	if err != nil {
+		return fmt.Errorf("failed to encode chain head: %w", err)
+	}
+	recordCID, err := uploadBytesToIPFS("head.json", record)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Post(ipfsAPIURL+"/name/publish?arg=/ipfs/"+recordCID+"&key="+url.QueryEscape(headKey), "", nil)
+	if err != nil {
+		return fmt.Errorf("failed to publish chain head: %w", err)
+	}
+	defer resp.Body.Close()
+	var published struct{ Name string }
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&published) != nil {
+		return fmt.Errorf("publishing chain head failed with status %d", resp.StatusCode)
+	}
+
+	mutex.Lock()
+	if lastPublishedHead == "" {
+		fmt.Printf("Publishing the chain head to /ipns/%s\n", published.Name)
+	}
+	lastPublishedHead = block.Hash
+	if previousBlockHash == block.Hash {
+		previousBlockCID = cid
+	}
+	mutex.Unlock()
+	pinned := PublishedBlock{Height: block.BlockNumber, Hash: block.Hash, CID: cid, RecordCID: recordCID, Time: time.Now().Unix()}
+	if err := recordPublishedBlock(pinned); err != nil {
+		fmt.Printf("Error recording published block %d: %v\n", block.BlockNumber, err)
+	}
+	return nil
+}
+
+// fetchChainHead reads the chain head record a head pointer refers to
+func fetchChainHead(pointer string) (ChainHead, error) {
+	var head ChainHead
+	data, err := catFromIPFS(pointer, 1<<20)
+	if err != nil {
+		return head, err
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return head, fmt.Errorf("failed to decode chain head: %w", err)
+	}
+	return head, nil
+}
+
+// headRecoveryTimeout bounds the mining hold of recoverHead, so a head the chain can never reach, such as one
+// claimed by peers that then stop serving it, does not stop the node for good
+const headRecoveryTimeout = 30 * time.Minute
+
+// verifyPublishedHead downloads the block a published chain head points to and checks that it is the recorded
+// block, signed by its creator, with valid proof of work
+func verifyPublishedHead(head ChainHead) error {
+	data, err := catFromIPFS(head.CID, 64<<20)
+	if err != nil {
+		return err
+	}
+	var block Block
+	if err := json.Unmarshal(data, &block); err != nil {
+		return fmt.Errorf("failed to decode head block: %w", err)
+	}
+	if block.BlockNumber != head.Height || block.Hash != head.Hash {
+		return fmt.Errorf("%s holds block %d (%s), not the recorded head", head.CID, block.BlockNumber, block.Hash)
+	}
+	return validateHeader(block.BlockHeader)
+}
+
+// verifyPeerHead fetches the header a peer claims as its head and checks that it has the claimed height and hash,
+// is signed by its creator and has valid proof of work
+func verifyPeerHead(peer string, status NodeStatus) error {
+	headers, err := fetchRange[BlockHeader](peer, "/headers", status.Height, status.Height)
+	if err != nil {
+		return err
+	}
+	if len(headers) != 1 || headers[0].BlockNumber != status.Height || headers[0].Hash != status.HeadHash {
+		return fmt.Errorf("the peer does not serve its claimed head block %d", status.Height)
+	}
+	return validateHeader(headers[0])
+}
+
+// recoverHead compares the local chain with the head published to IPNS and the heads of the peers after the
+// store was loaded. A missing chain is resynced from the peers recorded with the published head, the head's CID
+// is restored, and mining is held while the local chain is behind, or empty without any head to compare against,
+// so a node that lost its state does not fork the network with a new genesis block. Only heads whose header has
+// valid proof of work count, and the hold lasts at most headRecoveryTimeout.
+func recoverHead(syncWorkers int) {
+	mutex.Lock()
+	height := currentBlock.BlockNumber
+	mutex.Unlock()
+	best, source := height, ""
+	unverified := false
+
+	if headPointer != "" {
+		head, err := fetchChainHead(headPointer)
+		if err != nil {
+			fmt.Printf("Error recovering the chain head from %s: %v\n", headPointer, err)
+			unverified = true
+		} else {
+			if head.Height > height && addPeers(head.Peers) > 0 {
+				fmt.Printf("Resyncing from the peers recorded with the chain head at block %d\n", head.Height)
+				if err := syncChain(knownPeers(), syncWorkers); err != nil {
+					fmt.Printf("Error syncing chain: %v\n", err)
+				}
+			}
+			mutex.Lock()
+			if previousBlockHash == head.Hash {
+				previousBlockCID = head.CID
+				lastPublishedHead = head.Hash
+			}
+			height = currentBlock.BlockNumber
+			mutex.Unlock()
+			if head.Height > best {
+				if err := verifyPublishedHead(head); err != nil {
+					fmt.Printf("Ignoring the head published at %s: %v\n", headPointer, err)
+				} else {
+					best, source = head.Height, "the head published at "+headPointer
+				}
+			}
+		}
+	}
+
+	known := knownPeers()
+	reachable := 0
+	for _, peer := range known {
+		status, err := fetchPeerStatus(peer)
+		if err != nil {
+			continue
+		}
+		reachable++
+		if status.Height > best {
+			if err := verifyPeerHead(peer, status); err != nil {
+				fmt.Printf("Ignoring the head claimed by peer %s: %v\n", peer, err)
+				continue
+			}
+			best, source = status.Height, "peer "+peer
+		}
+	}
+	if len(known) > 0 && reachable == 0 {
+		unverified = true
+	}
+
+	hold, holdHeight := "", 0
+	switch {
+	case height < best:
+		hold, holdHeight = fmt.Sprintf("the local chain is at block %d but %s is at block %d", height, source, best), best
+	case height == 0 && unverified:
+		hold, holdHeight = "the local chain is empty and no existing chain head could be checked", 1
+	}
+	if hold == "" {
+		return
+	}
+	if forceGenesis {
+		fmt.Printf("Mining anyway because of -force-genesis: %s\n", hold)
+		return
+	}
+	mutex.Lock()
+	miningHold, miningHoldHeight, miningHoldUntil = hold, holdHeight, time.Now().Add(headRecoveryTimeout)
+	mutex.Unlock()
+	fmt.Printf("Refusing to mine for up to %s until the chain catches up: %s (start with -force-genesis to mine regardless)\n", headRecoveryTimeout, hold)
+}
+
+// miningHeld returns why the node refuses to mine, lifting the hold once the chain caught up; the caller must
+// hold mutex
+func miningHeld() string {
+	if initialSync {
+		return "initial sync in progress"
+	}
+	if revocation, ok := revoked[nodeID]; ok {
+		return fmt.Sprintf("this node's identity was revoked in block %d", revocation.BlockNumber)
+	}
+	if maintenanceMode && pooledResults() == 0 {
+		// Blocks are still mined while they commit the results of jobs accepted before maintenance began
+		return "maintenance mode"
+	}
+	if miningHold != "" && currentBlock.BlockNumber >= miningHoldHeight {
+		fmt.Printf("Chain caught up to block %d, resuming mining\n", currentBlock.BlockNumber)
+		miningHold = ""
+	} else if miningHold != "" && time.Now().After(miningHoldUntil) {
+		fmt.Printf("Chain did not catch up to block %d within %s, resuming mining at block %d\n", miningHoldHeight, headRecoveryTimeout, currentBlock.BlockNumber)
+		miningHold = ""
+	}
+	if miningHold == "" {
+		if _, unsupported := activeRules(currentBlock.BlockNumber + 1); unsupported != "" {
+			return fmt.Sprintf("consensus rule %s activates at block %d and is not supported by this node", unsupported, networkParams.Upgrades[unsupported])
+		}
+	}
+	return miningHold
+}
+
+// NodeBackup is the plaintext content of a node backup
+type NodeBackup struct {
+	NodeKey     string // Hex-encoded seed of the node's signing key
+	Genesis     string // Content of the genesis file, empty when the node runs on defaults
+	GenesisHash string // Hash of the network the node ran on, see genesisHash
+	Height      int    // Height of the chain head when the backup was taken
+	HeadHash    string // Hash of the chain head
+	HeadCID     string // IPFS CID of the chain head
+	CreatedAt   int64  // Unix time the backup was taken
+}
+
+// EncryptedBackup is the envelope uploaded to IPFS, holding a NodeBackup sealed with AES-256-GCM
+type EncryptedBackup struct {
+	Version    int    // Envelope format version
+	KDF        string // Key derivation function used for the passphrase
+	Iterations int    // Key derivation iterations
+	Salt       string // Hex-encoded key derivation salt
+	Nonce      string // Hex-encoded AES-GCM nonce
+	Ciphertext string // Hex-encoded sealed NodeBackup
+}
+
+// backupIterations is the PBKDF2 iteration count used for new backups
+const backupIterations = 600000
+
+// maxBackupIterations bounds the iteration count a backup may ask for, so a crafted envelope cannot keep the
+// restoring node deriving keys for hours
+const maxBackupIterations = 10 * backupIterations
+
+// backupCipher derives an AES-GCM cipher from the backup passphrase
+func backupCipher(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive backup key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// backupNode encrypts the node key, genesis file and chain head with passphrase, uploads them to IPFS,
+// copies the result into MFS under /node-backups and returns the CID
+func backupNode(keyFile, genesisFile, dataDir, storeBackend string, storageCodec Codec, passphrase string) (string, error) {
+	seed, err := os.ReadFile(keyFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read node key: %w", err)
+	}
+	backup := NodeBackup{NodeKey: strings.TrimSpace(string(seed)), HeadHash: "-1", HeadCID: "-1", CreatedAt: time.Now().Unix()}
+	if genesisFile != "" {
+		genesis, err := os.ReadFile(genesisFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read genesis file: %w", err)
+		}
+		backup.Genesis = string(genesis)
+	}
+	params, err := loadNetworkParams(genesisFile)
+	if err != nil {
+		return "", err
+	}
+	backup.GenesisHash = networkGenesisHash(params)
+	store, err := openStore(storeBackend, dataDir, storageCodec)
+	if err != nil {
+		return "", err
+	}
+	blocks, err := store.Load()
+	store.Close()
+	if err != nil {
+		return "", err
+	}
+	if len(blocks) > 0 {
+		head := blocks[len(blocks)-1]
+		cid, err := uploadBlockToIPFS(head)
+		if err != nil {
+			return "", fmt.Errorf("failed to upload chain head: %w", err)
+		}
+		backup.Height, backup.HeadHash, backup.HeadCID = head.BlockNumber, head.Hash, cid
+	}
+
+	plaintext, err := json.Marshal(backup)
+	if err != nil {
+		return "", err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	aead, err := backupCipher(passphrase, salt, backupIterations)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	envelope := EncryptedBackup{
+		Version:    1,
+		KDF:        "pbkdf2-sha256",
+		Iterations: backupIterations,
+		Salt:       hex.EncodeToString(salt),
+		Nonce:      hex.EncodeToString(nonce),
+		Ciphertext: hex.EncodeToString(aead.Seal(nil, nonce, plaintext, nil)),
+	}
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return "", err
+	}
+
+	cid, err := uploadBytesToIPFS("node-backup.json", data)
+	if err != nil {
+		return "", err
+	}
+
+	// Keep a named copy in MFS so backups are easy to find from the IPFS web UI
+	mfsPath := fmt.Sprintf("/node-backups/%s-%d.json", nodeIDFromSeed(backup.NodeKey), backup.CreatedAt)
+	for _, call := range []string{"/files/mkdir?parents=true&arg=/node-backups", "/files/cp?arg=/ipfs/" + cid + "&arg=" + mfsPath} {
+		resp, err := httpClient.Post(ipfsAPIURL+call, "", nil)
+		if err != nil {
+			fmt.Printf("Warning: failed to copy backup into MFS: %v\n", err)
+			break
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			fmt.Printf("Warning: failed to copy backup into MFS, status: %d\n", resp.StatusCode)
+			break
+		}
+	}
+	return cid, nil
+}
+
+// nodeIDFromSeed returns a short identity prefix for a hex-encoded key seed
+func nodeIDFromSeed(seedHex string) string {
+	seed, err := hex.DecodeString(seedHex)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return "unknown"
+	}
+	return hex.EncodeToString(ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey))[:16]
+}
+
+// restoreNode downloads and decrypts a backup, writing the node key, genesis file and chain head pointer.
+// The chain itself is rebuilt by syncing from peers once the node starts. A backup of another network than the
+// genesis file already in place, or than this build's defaults, is refused.
+func restoreNode(cid, keyFile, genesisFile, dataDir, passphrase string) (NodeBackup, error) {
+	var backup NodeBackup
+	source, err := gatewayURL(cid)
+	if err != nil {
+		return backup, err
+	}
+	resp, err := gatewayClient.Get(source)
+	if err != nil {
+		return backup, fmt.Errorf("failed to download backup: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return backup, fmt.Errorf("failed to download backup, status: %d", resp.StatusCode)
+	}
+
+	var envelope EncryptedBackup
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&envelope); err != nil {
+		return backup, fmt.Errorf("failed to decode backup: %w", err)
+	}
+	if envelope.Version != 1 || envelope.KDF != "pbkdf2-sha256" {
+		return backup, fmt.Errorf("unsupported backup format version %d (%s)", envelope.Version, envelope.KDF)
+	}
+	if envelope.Iterations < 1 || envelope.Iterations > maxBackupIterations {
+		return backup, fmt.Errorf("backup asks for %d key derivation iterations, at most %d are allowed", envelope.Iterations, maxBackupIterations)
+	}
+	salt, err1 := hex.DecodeString(envelope.Salt)
+	nonce, err2 := hex.DecodeString(envelope.Nonce)
+	ciphertext, err3 := hex.DecodeString(envelope.Ciphertext)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return backup, fmt.Errorf("malformed backup: %w", err)
+	}
+	aead, err := backupCipher(passphrase, salt, envelope.Iterations)
+	if err != nil {
+		return backup, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return backup, fmt.Errorf("malformed backup nonce")
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return backup, fmt.Errorf("failed to decrypt backup, wrong passphrase?")
+	}
+	if err := json.Unmarshal(plaintext, &backup); err != nil {
+		return backup, fmt.Errorf("failed to decode backup contents: %w", err)
+	}
+
+	if genesisFile == "" {
+		genesisFile = "genesis.json"
+	}
+	if err := checkBackupGenesis(backup, genesisFile); err != nil {
+		return backup, err
+	}
+	if _, err := os.Stat(keyFile); err == nil {
+		return backup, fmt.Errorf("refusing to overwrite existing node key %s", keyFile)
+	}
+	if err := os.WriteFile(keyFile, []byte(backup.NodeKey), 0600); err != nil {
+		return backup, fmt.Errorf("failed to write node key: %w", err)
+	}
+	if _, err := os.Stat(genesisFile); os.IsNotExist(err) && backup.Genesis != "" {
+		if err := os.WriteFile(genesisFile, []byte(backup.Genesis), 0644); err != nil {
+			return backup, fmt.Errorf("failed to write genesis file: %w", err)
+		}
+	}
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return backup, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	head, err := json.Marshal(map[string]interface{}{"Height": backup.Height, "HeadHash": backup.HeadHash, "HeadCID": backup.HeadCID})
+	if err != nil {
+		return backup, err
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, "head.json"), head, 0644); err != nil {
+		return backup, fmt.Errorf("failed to write chain head pointer: %w", err)
+	}
+	return backup, nil
+}
+
+// checkBackupGenesis refuses a backup whose network differs from the one its genesis content gives on this build,
+// or from the genesis file already at genesisFile
+func checkBackupGenesis(backup NodeBackup, genesisFile string) error {
+	params := defaultNetworkParams()
+	if backup.Genesis != "" {
+		var err error
+		if params, err = parseNetworkParams(params, []byte(backup.Genesis)); err != nil {
+			return fmt.Errorf("backup holds an invalid genesis file: %w", err)
+		}
+	}
+	backupHash := networkGenesisHash(params)
+	if backup.GenesisHash != "" && backup.GenesisHash != backupHash {
+		return fmt.Errorf("backup was taken on network %s, but this build would restore it onto %s", backup.GenesisHash, backupHash)
+	}
+	data, err := os.ReadFile(genesisFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read genesis file: %w", err)
+	}
+	local, err := parseNetworkParams(defaultNetworkParams(), data)
+	if err != nil {
+		return err
+	}
+	if localHash := networkGenesisHash(local); localHash != backupHash {
+		return fmt.Errorf("refusing to restore a backup of network %s over %s, which defines network %s", backupHash, genesisFile, localHash)
+	}
+	return nil
+}
+
+// runCommand executes a maintenance subcommand given after the flags, reporting whether one was run
+func runCommand(args []string, keyFile, genesisFile, dataDir, storeBackend string, storageCodec Codec) bool {
+	if len(args) == 0 {
+		return false
+	}
+	passphrase := os.Getenv("NODE_BACKUP_PASSPHRASE")
+	switch args[0] {
+	case "backup":
+		if passphrase == "" {
+			fmt.Println("Set NODE_BACKUP_PASSPHRASE to encrypt the backup")
+			return true
+		}
+		cid, err := backupNode(keyFile, genesisFile, dataDir, storeBackend, storageCodec, passphrase)
+		if err != nil {
+			fmt.Printf("Error backing up node: %v\n", err)
+			return true
+		}
+		fmt.Printf("Node backup uploaded to IPFS with CID: %s\n", cid)
+	case "restore":
+		if len(args) != 2 || passphrase == "" {
+			fmt.Println("Usage: NODE_BACKUP_PASSPHRASE=... miner [flags] restore <cid>")
+			return true
+		}
+		backup, err := restoreNode(args[1], keyFile, genesisFile, dataDir, passphrase)
+		if err != nil {
+			fmt.Printf("Error restoring node: %v\n", err)
+			return true
+		}
+		fmt.Printf("Restored node %s; start it with -peers to resync the chain to height %d (%s)\n", nodeIDFromSeed(backup.NodeKey), backup.Height, backup.HeadHash)
+	case "wallet":
+		runWallet(args[1:], keyFile)
+	case "approval":
+		runApproval(args[1:], keyFile)
+	case "script":
+		runScript(args[1:], keyFile)
+	case "purge":
+		runPurge(args[1:])
+	case "gc":
+		runGC(args[1:])
+	case "maintenance":
+		runMaintenance(args[1:])
+	case "doctor":
+		runDoctor(keyFile, genesisFile, dataDir)
+	case "sandbox-exec":
+		runSandboxExec(args[1:])
+	case "update":
+		runUpdate(args[1:])
+	case "billing":
+		runBilling(args[1:])
+	case "verify":
+		runVerify(args[1:], genesisFile)
+	case "worker":
+		runWorker(args[1:])
+	case "console":
+		runConsole(args[1:])
+	case "debug":
+		runDebug(args[1:])
+	case "release":
+		runRelease(args[1:])
+	case "init":
+		runInit(args[1:], keyFile, genesisFile, dataDir)
+	case "block":
+		runBlock(args[1:], genesisFile)
+	case "conformance":
+		runConformance(args[1:])
+	default:
+		fmt.Printf("Unknown command %q\n", args[0])
+	}
+	return true
+}
+
+// applyConfig sets the flags listed in a configuration file of name = value lines, skipping blank lines, comments
+// starting with # and flags given on the command line. A missing default configuration file is not an error.
+func applyConfig(path string) error {
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && !given["config"] {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read configuration: %w", err)
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		switch {
+		case !ok:
+			return fmt.Errorf("%s:%d: expected name = value", path, i+1)
+		case name == "config" || flag.Lookup(name) == nil:
+			return fmt.Errorf("%s:%d: unknown setting %q", path, i+1, name)
+		case given[name]:
+			continue
+		}
+		if err := flag.Set(name, value); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, i+1, err)
+		}
+	}
+	return nil
+}
+
+// runInit materializes a node's files on first run: the data directory, the node key, the genesis file and the
+// configuration, the latter two from the copies embedded in the binary. Existing files are kept unless --force
+// is given, and the node key is never overwritten.
+func runInit(args []string, keyFile, genesisFile, dataDir string) {
+	initFlags := flag.NewFlagSet("init", flag.ExitOnError)
+	force := initFlags.Bool("force", false, "Overwrite an existing genesis file and configuration with the defaults")
+	initFlags.Parse(args)
+
+	if dataDir == "" {
+		fmt.Println("Usage: miner [-data-dir DIR] [-key-file FILE] [-genesis FILE] [-config FILE] init [--force]")
+		return
+	}
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		fmt.Printf("Error creating data directory: %v\n", err)
+		return
+	}
+	_, statErr := os.Stat(keyFile)
+	key, err := loadOrCreateNodeKey(keyFile)
+	if err != nil {
+		fmt.Printf("Error preparing node key: %v\n", err)
+		return
+	}
+	if statErr == nil {
+		fmt.Printf("Kept node key %s\n", keyFile)
+	} else {
+		fmt.Printf("Created node key %s\n", keyFile)
+	}
+
+	if genesisFile == "" {
+		genesisFile = "genesis.json"
+	}
+	// The configuration names the genesis file it was written with
+	config := bytes.Replace(defaultConfig, []byte("genesis = genesis.json"), []byte("genesis = "+genesisFile), 1)
+	for _, file := range []struct {
+		path    string
+		content []byte
+	}{{genesisFile, defaultGenesis}, {configFile, config}} {
+		if _, err := os.Stat(file.path); err == nil && !*force {
+			fmt.Printf("Kept %s\n", file.path)
+			continue
+		}
+		if err := os.WriteFile(file.path, file.content, 0644); err != nil {
+			fmt.Printf("Error writing %s: %v\n", file.path, err)
+			return
+		}
+		fmt.Printf("Wrote %s\n", file.path)
+	}
+	fmt.Printf("Initialized node %s with data directory %s\n", hex.EncodeToString(key.Public().(ed25519.PublicKey)), dataDir)
+	fmt.Printf("Start an IPFS daemon, edit %s if needed, then run the miner from this directory\n", configFile)
+}
+
+// Build information, set at build time with -ldflags "-X $pkg.nodeVersion=... -X $pkg.buildCommit=... -X $pkg.buildDate=...",
+// where $pkg is github.com/msherazsadiq/IPFSBlockchain
+var (
+	nodeVersion = "1.0.0" // Version of this node's software, compared against published releases
+	buildCommit string    // Commit the binary was built from, read from the Go build info when not set
+	buildDate   string    // UTC time the binary was built, empty when not set
+)
+
+// BuildInfo describes the running binary, served by /version and printed by -version
+type BuildInfo struct {
+	Version            string            // Version of the node software
+	Commit             string            // Commit the binary was built from, empty when unknown
+	BuildDate          string            // UTC time the binary was built, empty when unknown
+	GoVersion          string            // Go release the binary was built with
+	Platform           string            // GOOS/GOARCH of the binary
+	DefaultGenesis     NetworkParams     // Network parameters used when no genesis file is given
+	DefaultGenesisHash string            // SHA-256 of the embedded default genesis file
+	Peers              map[string]string // Versions the known peers announced in their status handshake
+}
+
+// buildInfo returns the information about the running binary
+func buildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:            nodeVersion,
+		Commit:             buildCommit,
+		BuildDate:          buildDate,
+		GoVersion:          runtime.Version(),
+		Platform:           runtime.GOOS + "/" + runtime.GOARCH,
+		DefaultGenesis:     defaultNetworkParams(),
+		DefaultGenesisHash: fmt.Sprintf("%x", sha256.Sum256(defaultGenesis)),
+	}
+	if info.Commit == "" {
+		// Module builds inside a repository record the revision themselves
+		if build, ok := debug.ReadBuildInfo(); ok {
+			for _, setting := range build.Settings {
+				if setting.Key == "vcs.revision" {
+					info.Commit = setting.Value
+				}
+			}
+		}
+	}
+	return info
+}
+
+// handleVersion serves the build information of the node and the versions of its known peers
+func handleVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	info := buildInfo()
+	info.Peers = make(map[string]string)
+	mutex.Lock()
+	for peer, caps := range peerCapabilities {
+		if caps.Version != "" {
+			info.Peers[peer] = caps.Version
+		}
+	}
+	mutex.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+// printVersion prints the build information for -version
+func printVersion() {
+	info := buildInfo()
+	fmt.Printf("miner %s\n", info.Version)
+	fmt.Printf("commit:          %s\n", valueOr(info.Commit, "unknown"))
+	fmt.Printf("built:           %s\n", valueOr(info.BuildDate, "unknown"))
+	fmt.Printf("go:              %s %s\n", info.GoVersion, info.Platform)
+	fmt.Printf("default genesis: sha256 %s, difficulty %d, runtimes %s, emission %s\n", info.DefaultGenesisHash, info.DefaultGenesis.Difficulty, strings.Join(info.DefaultGenesis.AllowedRuntimes, ", "), describeEmission(info.DefaultGenesis.Emission))
+}
+
+// valueOr returns value, or fallback when value is empty
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// ReleaseBinary is a release build for one platform
+type ReleaseBinary struct {
+	CID    string // IPFS CID of the binary
+	SHA256 string // Hex-encoded SHA-256 digest of the binary
+}
+
+// ReleaseManifest describes a signed release published to IPFS and pointed to by the release IPNS name
+type ReleaseManifest struct {
+	Version   string                   // Release version
+	Binaries  map[string]ReleaseBinary // Builds keyed by GOOS/GOARCH
+	Signature string                   // Hex-encoded ed25519 signature of the maintainer over the manifest
+}
+
+// UpdateStatus reports the state of the updater
+type UpdateStatus struct {
+	Current   string // Version of the running node
+	Available string // Newer verified release, empty if none
+	Ready     bool   // Whether the release binary is downloaded and verified, waiting for operator approval
+}
+
+var releaseKey string               // Hex-encoded public key of the maintainer that signs releases
+var releasePointer string           // IPFS path of the release manifest, typically /ipns/<name>
+var pendingRelease *ReleaseManifest // Verified newer release whose binary is staged next to the executable
+
+const maxReleaseSize = 1 << 30 // Largest release binary the updater downloads
+
+// releaseMessage returns the bytes signed by the maintainer for a release manifest
+func releaseMessage(manifest ReleaseManifest) []byte {
+	platforms := make([]string, 0, len(manifest.Binaries))
+	for platform := range manifest.Binaries {
+		platforms = append(platforms, platform)
+	}
+	sort.Strings(platforms)
+	message := "release|" + manifest.Version
+	for _, platform := range platforms {
+		binary := manifest.Binaries[platform]
+		message += fmt.Sprintf("\n%s|%s|%s", platform, binary.CID, binary.SHA256)
+	}
+	return []byte(message)
+}
+
+// compareVersions compares dotted numeric versions, returning -1, 0 or 1
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < max(len(as), len(bs)); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// catFromIPFS reads an IPFS path through the RPC API, which also resolves IPNS names
+func catFromIPFS(path string, limit int64) ([]byte, error) {
+	return CatFromIPFS(ipfsAPIURL, path, limit)
+}
+
+// CatFromIPFS reads up to limit bytes of an IPFS path through the RPC API at apiURL
+func CatFromIPFS(apiURL, path string, limit int64) ([]byte, error) {
+	body, err := openFromIPFS(apiURL, path)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(io.LimitReader(body, limit))
+}
+
+// openFromIPFS starts reading an IPFS path through the RPC API at apiURL, for content too large to hold in memory
+func openFromIPFS(apiURL, path string) (io.ReadCloser, error) {
+	resp, err := httpClient.Post(apiURL+"/cat?arg="+url.QueryEscape(path), "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from IPFS: %w", path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("reading %s from IPFS failed with status %d", path, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// fetchReleaseManifest downloads the manifest the release pointer refers to and verifies the maintainer's signature
+func fetchReleaseManifest() (ReleaseManifest, error) {
+	var manifest ReleaseManifest
+	data, err := catFromIPFS(releasePointer, 1<<20)
+	if err != nil {
+		return manifest, err
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, fmt.Errorf("failed to decode release manifest: %w", err)
+	}
+	publicKey, err := hex.DecodeString(releaseKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return manifest, fmt.Errorf("invalid release key %q", releaseKey)
+	}
+	signature, err := hex.DecodeString(manifest.Signature)
+	if err != nil || !ed25519.Verify(publicKey, releaseMessage(manifest), signature) {
+		return manifest, fmt.Errorf("release %s has an invalid signature", manifest.Version)
+	}
+	return manifest, nil
+}
+
+// stagedBinaryPath returns where a downloaded release waits for approval, next to the running executable
+func stagedBinaryPath() (string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate executable: %w", err)
+	}
+	return executable + ".new", nil
+}
+
+// checkForUpdate stages a newer signed release for this platform, leaving it to the operator to apply
+func checkForUpdate() error {
+	manifest, err := fetchReleaseManifest()
+	if err != nil {
+		return err
+	}
+	mutex.Lock()
+	known := pendingRelease != nil && compareVersions(pendingRelease.Version, manifest.Version) >= 0
+	mutex.Unlock()
+	if compareVersions(manifest.Version, nodeVersion) <= 0 || known {
+		return nil
+	}
+
+	platform := runtime.GOOS + "/" + runtime.GOARCH
+	binary, ok := manifest.Binaries[platform]
+	if !ok {
+		return fmt.Errorf("release %s has no build for %s", manifest.Version, platform)
+	}
+	staged, err := stagedBinaryPath()
+	if err != nil {
+		return err
+	}
+	if err := downloadRelease(binary, staged); err != nil {
+		return fmt.Errorf("release %s: %w", manifest.Version, err)
+	}
+
+	mutex.Lock()
+	pendingRelease = &manifest
+	mutex.Unlock()
+	if err := inPlaceUpdateError(staged); err != nil {
+		fmt.Printf("Release %s is verified and staged; %v\n", manifest.Version, err)
+	} else {
+		fmt.Printf("Release %s is verified and staged; apply it with \"miner update apply\"\n", manifest.Version)
+	}
+	return nil
+}
+
+// downloadRelease streams a release binary from IPFS to a temporary file next to staged, moving it into place
+// only once its size and digest match the signed manifest
+func downloadRelease(binary ReleaseBinary, staged string) error {
+	body, err := openFromIPFS(ipfsAPIURL, binary.CID)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	file, err := os.CreateTemp(filepath.Dir(staged), filepath.Base(staged)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to stage release binary: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(file, hash), io.LimitReader(body, maxReleaseSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to download release binary: %w", err)
+	}
+	if n > maxReleaseSize {
+		return fmt.Errorf("binary is larger than %d bytes", maxReleaseSize)
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != binary.SHA256 {
+		return fmt.Errorf("binary does not match its signed digest")
+	}
+	if err := file.Chmod(0755); err != nil {
+		return fmt.Errorf("failed to stage release binary: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to stage release binary: %w", err)
+	}
+	if err := os.Rename(file.Name(), staged); err != nil {
+		return fmt.Errorf("failed to stage release binary: %w", err)
+	}
+	return nil
+}
+
+// inPlaceUpdateError explains why this platform cannot apply a staged release itself, or returns nil. Windows can
+// neither rename a running executable nor replace a process with a new one.
+func inPlaceUpdateError(staged string) error {
+	if runtime.GOOS != "windows" {
+		return nil
+	}
+	return fmt.Errorf("a running node cannot replace itself on Windows; stop it, replace %s with %s and start it again",
+		strings.TrimSuffix(staged, ".new"), staged)
+}
+
+// applyUpdate replaces the executable with the staged release and restarts the node with the same arguments
+func applyUpdate() error {
+	staged, err := stagedBinaryPath()
+	if err != nil {
+		return err
+	}
+	if err := inPlaceUpdateError(staged); err != nil {
+		return err
+	}
+	executable := strings.TrimSuffix(staged, ".new")
+	if err := os.Rename(staged, executable); err != nil {
+		return fmt.Errorf("failed to install release binary: %w", err)
+	}
+	if chainStore != nil {
+		chainStore.Sync()
+	}
+	return syscall.Exec(executable, os.Args, os.Environ())
+}
+
+// handleUpdate reports the updater status (GET) and lets the local operator apply a staged release (POST)
+func handleUpdate(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		mutex.Lock()
+		status := UpdateStatus{Current: nodeVersion}
+		if pendingRelease != nil {
+			status.Available, status.Ready = pendingRelease.Version, true
+		}
+		mutex.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	case http.MethodPost:
+		if !fromLoopback(r) {
+			http.Error(w, "Updates are only applied from the local host", http.StatusForbidden)
+			return
+		}
+		mutex.Lock()
+		ready := pendingRelease != nil
+		mutex.Unlock()
+		if !ready {
+			http.Error(w, "No staged release to apply", http.StatusConflict)
+			return
+		}
+		staged, err := stagedBinaryPath()
+		if err == nil {
+			err = inPlaceUpdateError(staged)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("Restarting into the staged release"))
+		// Give the response a moment to reach the operator before the process is replaced
+		time.AfterFunc(time.Second, func() {
+			if err := applyUpdate(); err != nil {
+				fmt.Printf("Error applying update: %v\n", err)
+			}
+		})
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// runUpdate implements the update subcommands, which inspect and approve staged releases on the local node
+func runUpdate(args []string) {
+	updateFlags := flag.NewFlagSet("update", flag.ExitOnError)
+	node := updateFlags.String("node", localNodeURL(), "URL of the local node")
+	if len(args) == 0 {
+		fmt.Println("Usage: miner [flags] update status|apply [--node URL]")
+		return
+	}
+	updateFlags.Parse(args[1:])
+
+	switch args[0] {
+	case "status":
+		resp, err := nodeClient.Get(*node + "/update")
+		if err != nil {
+			fmt.Printf("Error querying update status: %v\n", err)
+			return
+		}
+		defer resp.Body.Close()
+		var status UpdateStatus
+		if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+			fmt.Printf("Error decoding update status: %v\n", err)
+			return
+		}
+		if status.Available == "" {
+			fmt.Printf("Running %s, no newer release staged\n", status.Current)
+			return
+		}
+		fmt.Printf("Running %s, release %s is staged and ready to apply\n", status.Current, status.Available)
+	case "apply":
+		resp, err := nodeClient.Post(*node+"/update", "", nil)
+		if err != nil {
+			fmt.Printf("Error applying update: %v\n", err)
+			return
+		}
+		defer resp.Body.Close()
+		reply, _ := io.ReadAll(resp.Body)
+		fmt.Printf("%s\n", strings.TrimSpace(string(reply)))
+	default:
+		fmt.Printf("Unknown update command %q\n", args[0])
+	}
+}
+
+// runRelease implements the release subcommands used by the maintainer. keygen creates the signing key once;
+// publish uploads the given platform=path builds, signs the manifest with the key file and points the IPNS name
+// at it.
+func runRelease(args []string) {
+	releaseFlags := flag.NewFlagSet("release", flag.ExitOnError)
+	version := releaseFlags.String("version", "", "Version of the release")
+	keyFile := releaseFlags.String("key-file", "release.key", "Maintainer signing key")
+	ipnsKey := releaseFlags.String("ipns-key", "self", "IPFS key whose IPNS name points at the latest release")
+	if len(args) == 0 || (args[0] != "publish" && args[0] != "keygen") {
+		fmt.Println("Usage: miner [flags] release keygen [--key-file F]")
+		fmt.Println("       miner [flags] release publish --version V [--key-file F] [--ipns-key K] goos/goarch=path...")
+		return
+	}
+	releaseFlags.Parse(args[1:])
+	if args[0] == "keygen" {
+		if _, err := os.Stat(*keyFile); err == nil {
+			fmt.Printf("%s already exists; refusing to replace the release key\n", *keyFile)
+			os.Exit(1)
+		}
+		key, err := loadOrCreateNodeKey(*keyFile)
+		if err != nil {
+			fmt.Printf("Error creating release key: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Release key saved to %s; nodes verify releases with -release-key %s\n", *keyFile, hex.EncodeToString(key.Public().(ed25519.PublicKey)))
+		return
+	}
+	if *version == "" || releaseFlags.NArg() == 0 {
+		fmt.Println("A version and at least one platform=path build are required")
+		return
+	}
+	// The key is never created here: a mistyped path must not sign a release with a key nodes do not trust
+	key, err := loadKeyFile(*keyFile)
+	if err != nil {
+		fmt.Printf("Error loading release key: %v\n", err)
+		os.Exit(1)
+	}
+
+	manifest := ReleaseManifest{Version: *version, Binaries: make(map[string]ReleaseBinary)}
+	for _, build := range releaseFlags.Args() {
+		platform, path, ok := strings.Cut(build, "=")
+		if !ok {
+			fmt.Printf("Expected platform=path, got %q\n", build)
+			return
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Printf("Error reading %s: %v\n", path, err)
+			return
+		}
+		cid, err := uploadBytesToIPFS(filepath.Base(path), data)
+		if err != nil {
+			fmt.Printf("Error uploading %s: %v\n", path, err)
+			return
+		}
+		digest := sha256.Sum256(data)
+		manifest.Binaries[platform] = ReleaseBinary{CID: cid, SHA256: hex.EncodeToString(digest[:])}
+	}
+	manifest.Signature = hex.EncodeToString(ed25519.Sign(key, releaseMessage(manifest)))
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		fmt.Printf("Error encoding release manifest: %v\n", err)
+		return
+	}
+	cid, err := uploadBytesToIPFS("release.json", data)
+	if err != nil {
+		fmt.Printf("Error uploading release manifest: %v\n", err)
+		return
+	}
+	fmt.Printf("Release %s manifest: /ipfs/%s (release key %s)\n", *version, cid, hex.EncodeToString(key.Public().(ed25519.PublicKey)))
+
+	resp, err := httpClient.Post(ipfsAPIURL+"/name/publish?arg=/ipfs/"+cid+"&key="+url.QueryEscape(*ipnsKey), "", nil)
+	if err != nil {
+		fmt.Printf("Error publishing release to IPNS: %v\n", err)
+		return
+	}
+	defer resp.Body.Close()
+	var published struct{ Name string }
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(resp.Body).Decode(&published) != nil {
+		fmt.Printf("Publishing release to IPNS failed with status %d; nodes can use the manifest path directly\n", resp.StatusCode)
+		return
+	}
+	fmt.Printf("Published to /ipns/%s\n", published.Name)
+}
+
+// isValidator reports whether identity belongs to the configured finality validator set
+func isValidator(identity string) bool {
+	for _, validator := range networkParams.Validators {
+		if validator == identity {
+			return true
+		}
+	}
+	return false
+}
+
+// finalityVoteMessage returns the bytes signed by a finality vote
+func finalityVoteMessage(vote FinalityVote) []byte {
+	return []byte(fmt.Sprintf("%d|%s", vote.BlockNumber, vote.BlockHash))
+}
+
+// verifyFinalityVote checks that a vote comes from a configured validator and carries a valid signature
+func verifyFinalityVote(vote FinalityVote) error {
+	if !isValidator(vote.Validator) {
+		return fmt.Errorf("%s is not a finality validator", vote.Validator)
+	}
+	publicKey, err := hex.DecodeString(vote.Validator)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid validator public key")
+	}
+	signature, err := hex.DecodeString(vote.Signature)
+	if err != nil || !ed25519.Verify(publicKey, finalityVoteMessage(vote), signature) {
+		return fmt.Errorf("finality vote signature is invalid")
+	}
+	return nil
+}
+
+// addFinalityVote records a verified vote; the caller must hold mutex
+func addFinalityVote(vote FinalityVote) {
+	votes, ok := finalityVotes[vote.BlockHash]
+	if !ok {
+		votes = make(map[string]string)
+		finalityVotes[vote.BlockHash] = votes
+	}
+	votes[vote.Validator] = vote.Signature
+}
+
+// updateFinality finalizes the highest local block signed by at least two thirds of the validators;
+// finalizing a block implicitly finalizes its ancestors. The caller must hold mutex.
+func updateFinality() {
+	validators := len(networkParams.Validators)
+	if validators == 0 {
+		return
+	}
+	for i := len(blockchain) - 1; i >= 0 && blockchain[i].BlockNumber > finalizedHeight; i-- {
+		if 3*len(finalityVotes[blockchain[i].Hash]) >= 2*validators {
+			finalizedHeight = blockchain[i].BlockNumber
+			finalizedHash = blockchain[i].Hash
+			fmt.Printf("Block %d is final\n", finalizedHeight)
+			return
+		}
+	}
+}
+
+// broadcastFinalityVote sends this node's finality vote to all known peers
+func broadcastFinalityVote(vote FinalityVote) {
+	body, err := json.Marshal(vote)
+	if err != nil {
+		fmt.Printf("Error encoding finality vote: %v\n", err)
+		return
+	}
+	for _, peer := range knownPeers() {
+		resp, err := peerClient.Post(peerURL(peer, "/finality"), "application/json", bytes.NewReader(body))
+		if err != nil {
+			fmt.Printf("Error sending finality vote to %s: %v\n", peer, err)
+			continue
+		}
+		resp.Body.Close()
+	}
+}
+
+// handleFinality accepts finality votes from validators (POST) and reports the finalized tip (GET)
+func handleFinality(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		mutex.Lock()
+		status := map[string]interface{}{"FinalizedHeight": finalizedHeight, "FinalizedHash": finalizedHash, "Validators": len(networkParams.Validators)}
+		mutex.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	case http.MethodPost:
+		var vote FinalityVote
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<16)).Decode(&vote); err != nil {
+			http.Error(w, "Failed to decode finality vote", http.StatusBadRequest)
+			return
+		}
+		if err := verifyFinalityVote(vote); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		mutex.Lock()
+		addFinalityVote(vote)
+		updateFinality()
+		mutex.Unlock()
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// lifecycleHooks holds the callbacks registered through the hook functions below
+type lifecycleHooks struct {
+	validateTx      []func(Transaction) error
+	validateBlock   []func(Block) error
+	onTxAccepted    []func(Transaction)
+	onBlockMined    []func(Block)
+	onBlockAccepted []func(Block)
+	onReorg         []func(removed []Block)
+	onTruncate      []func(removed []Block)
+}
+
+// hooks are registered by programs that import this package, before they call Main or start a Node. Hooks run
+// synchronously without mutex held, so they may call back into the node but should return quickly.
+var hooks lifecycleHooks
+
+// ValidateTx registers a custom check that every pooled or mined transaction must pass
+func ValidateTx(validator func(Transaction) error) {
+	hooks.validateTx = append(hooks.validateTx, validator)
+}
+
+// ValidateBlock registers a custom check that every mined or received block must pass
+func ValidateBlock(validator func(Block) error) {
+	hooks.validateBlock = append(hooks.validateBlock, validator)
+}
+
+// OnTxAccepted registers a callback for transactions admitted to the pool
+func OnTxAccepted(hook func(Transaction)) {
+	hooks.onTxAccepted = append(hooks.onTxAccepted, hook)
+}
+
+// OnBlockMined registers a callback for blocks mined by this node
+func OnBlockMined(hook func(Block)) {
+	hooks.onBlockMined = append(hooks.onBlockMined, hook)
+}
+
+// OnBlockAccepted registers a callback for blocks received from peers and appended to the local chain
+func OnBlockAccepted(hook func(Block)) {
+	hooks.onBlockAccepted = append(hooks.onBlockAccepted, hook)
+}
+
+// OnReorg registers a callback for blocks rolled back from the running chain, such as blocks invalidated by the
+// operator
+func OnReorg(hook func(removed []Block)) {
+	hooks.onReorg = append(hooks.onReorg, hook)
+}
+
+// OnStoreTruncated registers a callback for blocks dropped on startup because the chain store was corrupt from
+// that block on. They were never part of the chain this process ran with.
+func OnStoreTruncated(hook func(removed []Block)) {
+	hooks.onTruncate = append(hooks.onTruncate, hook)
+}
+
+// acceptBlock validates a block received from a peer and appends it if it extends the local tip. The header is
+// checked first so blocks that cannot be appended are turned away before their transactions are validated.
+func acceptBlock(block Block) error {
+	if err := validateHeader(block.BlockHeader); err != nil {
+		return err
+	}
+	mutex.Lock()
+	extends := block.BlockNumber == currentBlock.BlockNumber+1 && block.PrevHash == previousBlockHash
+	mutex.Unlock()
+	if !extends {
+		return fmt.Errorf("block %d does not extend the local tip", block.BlockNumber)
+	}
+	if err := validateBlock(block); err != nil {
+		return err
+	}
+	return commitBlock(block)
+}
+
+// commitBlock appends a block that already passed validation if it extends the local tip
+func commitBlock(block Block) error {
+	mutex.Lock()
+	err := extendChain(block)
+	mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	seenBlocks.Add(block.Hash)
+	for _, hook := range hooks.onBlockAccepted {
+		hook(block)
+	}
+	return nil
+}
+
+// extendChain appends a block received from a peer if it extends the local tip; the caller must hold mutex
+func extendChain(block Block) error {
+	if invalidBlocks[block.Hash] {
+		return fmt.Errorf("block %d (%s) was invalidated by the operator", block.BlockNumber, block.Hash)
+	}
+	if block.BlockNumber <= finalizedHeight {
+		return fmt.Errorf("block %d conflicts with finalized block %d", block.BlockNumber, finalizedHeight)
+	}
+	if block.BlockNumber != currentBlock.BlockNumber+1 || block.PrevHash != previousBlockHash {
+		return fmt.Errorf("block %d does not extend the local tip %d (%s)", block.BlockNumber, currentBlock.BlockNumber, previousBlockHash)
+	}
+	if _, err := checkConfirmed(block); err != nil {
+		return err
+	}
+	if _, err := checkBlockBalances(block); err != nil {
+		return err
+	}
+	if _, err := checkRevocations(block); err != nil {
+		return err
+	}
+	appendBlock(block)
+
+	// Transactions confirmed by another miner's block no longer need mining here
+	removeFromPool(blockTxIDs(block))
+	reconcilePool()
+	return nil
+}
+
+// InvalidBlock is an operator's marker that a block must not be part of the chain
+type InvalidBlock struct {
+	Hash        string // Hash of the invalidated block
+	BlockNumber int    // Height of the block when it was invalidated, 0 if it was not in the local chain
+	Reason      string // Operator-supplied reason
+	Time        int64  // Unix time the block was invalidated
+}
+
+// InvalidationReport describes the effect of invalidating a block
+type InvalidationReport struct {
+	InvalidBlock
+	RolledBack int      // Number of blocks removed from the local chain, the invalid block and its descendants
+	Requeued   int      // Number of their transactions returned to the pool
+	Dropped    []string // Transactions that no longer pass validation, with the reason
+}
+
+// loadInvalidBlocks reads the blocks invalidated by the operator in earlier runs
+func loadInvalidBlocks(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read invalidated blocks: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for decoder.More() {
+		var invalid InvalidBlock
+		if err := decoder.Decode(&invalid); err != nil {
+			return fmt.Errorf("failed to decode invalidated blocks: %w", err)
+		}
+		invalidBlocks[invalid.Hash] = true
+	}
+	return nil
+}
+
+// recordInvalidBlock appends an invalidation marker to the invalidated block log
+func recordInvalidBlock(invalid InvalidBlock) error {
+	if invalidBlockFile == "" {
+		// In-memory nodes keep invalidations only until they stop
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(invalidBlockFile), 0755); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+	file, err := os.OpenFile(invalidBlockFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open invalidated block log: %w", err)
+	}
+	defer file.Close()
+	return json.NewEncoder(file).Encode(invalid)
+}
+
+// rollbackChain truncates the local chain to its first height blocks, rebuilding the derived state and the chain
+// store, and returns the removed blocks; the caller must hold mutex
+func rollbackChain(height int) ([]Block, error) {
+	removed := append([]Block(nil), blockchain[height:]...)
+	kept := append([]Block(nil), blockchain[:height]...)
+
+	blockchain = nil
+	currentBlock = Block{}
+	previousBlockHash, previousBlockCID = "-1", "-1"
+	minerStats = make(map[string]*MinerStats)
+	txIndex = make(map[string]int)
+	balances = make(map[string]int64)
+	nonces = make(map[string]int64)
+	labelIndex = make(map[string][]string)
+	revoked = make(map[string]Revocation)
+	for _, block := range kept {
+		applyBlock(block)
+	}
+	for _, block := range removed {
+		for _, tx := range block.Transactions {
+			if job, ok := jobs[tx.JobID]; ok && job.Status == JobConfirmed {
+				job.Status = JobPending
+				job.BlockNumber = 0
+			}
+		}
+	}
+	blockCache.Purge()
+	txCache.Purge()
+
+	if chainStore == nil {
+		return removed, nil
+	}
+	return removed, chainStore.Rewrite(kept)
+}
+
+// invalidateBlock marks a block invalid so it is never appended again. If it is part of the local chain, the
+// chain is rolled back to its parent, the transactions of the removed blocks go back to the pool and the node
+// mines them again.
+func invalidateBlock(hash, reason string) (InvalidationReport, error) {
+	report := InvalidationReport{InvalidBlock: InvalidBlock{Hash: hash, Reason: reason, Time: time.Now().Unix()}}
+
+	mutex.Lock()
+	position := -1
+	for i, block := range blockchain {
+		if block.Hash == hash {
+			position = i
+			break
+		}
+	}
+	if position >= 0 && blockchain[position].BlockNumber <= finalizedHeight {
+		mutex.Unlock()
+		return report, fmt.Errorf("block %d is final and cannot be invalidated", blockchain[position].BlockNumber)
+	}
+	if position < 0 && invalidBlocks[hash] {
+		mutex.Unlock()
+		return report, nil
+	}
+	invalidBlocks[hash] = true
+	var removed []Block
+	var err error
+	if position >= 0 {
+		report.BlockNumber = blockchain[position].BlockNumber
+		removed, err = rollbackChain(position)
+	}
+	mutex.Unlock()
+
+	if recordErr := recordInvalidBlock(report.InvalidBlock); recordErr != nil {
+		fmt.Printf("Error recording invalidated block %s: %v\n", hash, recordErr)
+	}
+	if err != nil {
+		return report, fmt.Errorf("failed to rewrite chain store: %w", err)
+	}
+	if len(removed) == 0 {
+		return report, nil
+	}
+
+	for _, hook := range hooks.onReorg {
+		hook(removed)
+	}
+	noteFork(forkReorg, report.BlockNumber, "", removed)
+	report.RolledBack = len(removed)
+	for _, block := range removed {
+		for _, tx := range block.Transactions {
+			if err := addTransaction(tx); err != nil {
+				report.Dropped = append(report.Dropped, fmt.Sprintf("%s: %v", txID(tx), err))
+				continue
+			}
+			report.Requeued++
+		}
+	}
+	go mineTransactions(nodeID, networkParams.Difficulty, 1)
+	return report, nil
+}
+
+// handleInvalidateBlock invalidates the block given by ?hash= at the local operator's request
+func handleInvalidateBlock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if !fromLoopback(r) {
+		http.Error(w, "Blocks can only be invalidated from the local host", http.StatusForbidden)
+		return
+	}
+	hash := r.URL.Query().Get("hash")
+	if hash == "" {
+		http.Error(w, "Missing hash parameter", http.StatusBadRequest)
+		return
+	}
+
+	report, err := invalidateBlock(hash, r.URL.Query().Get("reason"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to invalidate block: %v", err), http.StatusConflict)
+		return
+	}
+	fmt.Printf("Invalidated block %s, rolling back %d blocks\n", hash, report.RolledBack)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// runDebug implements the debug subcommands, which act on the local node to recover from faults
+func runDebug(args []string) {
+	if len(args) < 2 || args[0] != "invalidateblock" {
+		fmt.Println("Usage: miner [flags] debug invalidateblock <hash> [--reason R] [--node URL]")
+		return
+	}
+	debugFlags := flag.NewFlagSet("debug", flag.ExitOnError)
+	node := debugFlags.String("node", localNodeURL(), "URL of the local node")
+	reason := debugFlags.String("reason", "", "Reason recorded with the invalidated block")
+	debugFlags.Parse(args[2:])
+
+	query := url.Values{"hash": {args[1]}, "reason": {*reason}}
+	resp, err := nodeClient.Post(*node+"/debug/invalidateblock?"+query.Encode(), "", nil)
+	if err != nil {
+		fmt.Printf("Error invalidating block: %v\n", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		reply, _ := io.ReadAll(resp.Body)
+		fmt.Printf("Invalidation failed with status %d: %s\n", resp.StatusCode, strings.TrimSpace(string(reply)))
+		return
+	}
+	var report InvalidationReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		fmt.Printf("Error decoding invalidation report: %v\n", err)
+		return
+	}
+	if report.BlockNumber == 0 {
+		fmt.Printf("Block %s is not in the local chain; it will be rejected if it arrives\n", report.Hash)
+		return
+	}
+	fmt.Printf("Invalidated block %d; rolled back %d blocks and returned %d transactions to the pool\n", report.BlockNumber, report.RolledBack, report.Requeued)
+	for _, dropped := range report.Dropped {
+		fmt.Printf("Dropped %s\n", dropped)
+	}
+}
+
+// loadNetworkParams reads consensus parameters from a genesis file, keeping defaults for omitted fields
+func loadNetworkParams(path string) (NetworkParams, error) {
+	params := networkParams
+	if path == "" {
+		return params, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return params, fmt.Errorf("failed to read genesis file: %w", err)
+	}
+	return parseNetworkParams(params, data)
+}
+
+// parseNetworkParams applies the content of a genesis file to base and validates the result
+func parseNetworkParams(base NetworkParams, data []byte) (NetworkParams, error) {
+	params := base
+	// The emission schedule is replaced as a whole, so a file choosing none does not inherit the default reward
+	params.Emission = EmissionSchedule{}
+	if err := json.Unmarshal(data, &params); err != nil {
+		return params, fmt.Errorf("failed to parse genesis file: %w", err)
+	}
+	if params.Emission == (EmissionSchedule{}) {
+		params.Emission = base.Emission
+	}
+	if params.MaxRuntime <= 0 || params.MaxOutputSize <= 0 || len(params.AllowedRuntimes) == 0 {
+		return params, fmt.Errorf("genesis file must define positive execution limits and at least one runtime")
+	}
+	if params.MaxTransactionSize <= 0 || params.MaxBlockSize < params.MaxTransactionSize {
+		return params, fmt.Errorf("genesis file must define a positive transaction size no larger than the block size")
+	}
+	if params.MaxBlockCompute <= 0 {
+		return params, fmt.Errorf("genesis file must define a positive block compute budget")
+	}
+	if err := validateAllocations(params.Allocations); err != nil {
+		return params, fmt.Errorf("invalid genesis allocation: %w", err)
+	}
+	if err := validateEmission(params.Emission); err != nil {
+		return params, fmt.Errorf("invalid genesis emission schedule: %w", err)
+	}
+	for _, admin := range params.Admins {
+		if key, err := hex.DecodeString(admin); err != nil || len(key) != ed25519.PublicKeySize || admin != strings.ToLower(admin) {
+			return params, fmt.Errorf("genesis admin %q is not a lowercase hex-encoded node identity", admin)
+		}
+	}
+	for name, height := range params.Upgrades {
+		if height < 1 {
+			return params, fmt.Errorf("upgrade %s must activate at a block height of at least 1", name)
+		}
+		if _, ok := consensusRules[name]; !ok {
+			fmt.Printf("Warning: the genesis file activates consensus rule %s at block %d, which this node does not support; upgrade it before then\n", name, height)
+		}
+	}
+	return params, nil
+}
+
+// validateAllocations checks that every genesis allocation credits a valid node identity with a positive amount
+// and that together they cannot overflow a balance
+func validateAllocations(allocations map[string]int64) error {
+	var total int64
+	for address, amount := range allocations {
+		if key, err := hex.DecodeString(address); err != nil || len(key) != ed25519.PublicKeySize {
+			return fmt.Errorf("%q is not a hex-encoded node identity", address)
+		}
+		if address != strings.ToLower(address) {
+			return fmt.Errorf("%q must be lowercase", address)
+		}
+		if amount <= 0 {
+			return fmt.Errorf("%s is allocated %d; allocations must be positive", address, amount)
+		}
+		if total > math.MaxInt64/2-amount { // Leaves headroom for block rewards and fees
+			return fmt.Errorf("the allocations exceed the maximum total supply")
+		}
+		total += amount
+	}
+	return nil
+}
+
+// validateEmission checks that an emission schedule is known and its reward and interval fit it
+func validateEmission(emission EmissionSchedule) error {
+	switch emission.Schedule {
+	case EmissionFixed, EmissionHalving:
+		if emission.Reward <= 0 || emission.Reward > math.MaxInt64/1024 {
+			return fmt.Errorf("the %s schedule needs a positive reward below %d", emission.Schedule, int64(math.MaxInt64/1024))
+		}
+		if emission.Schedule == EmissionHalving && emission.HalvingInterval <= 0 {
+			return fmt.Errorf("the halving schedule needs a positive halving interval")
+		}
+		if emission.Schedule == EmissionFixed && emission.HalvingInterval != 0 {
+			return fmt.Errorf("the fixed schedule takes no halving interval")
+		}
+	case EmissionNone:
+		if emission.Reward != 0 || emission.HalvingInterval != 0 {
+			return fmt.Errorf("the none schedule takes no reward or halving interval")
+		}
+	default:
+		return fmt.Errorf("unknown schedule %q, expected fixed, halving or none", emission.Schedule)
+	}
+	return nil
+}
+
+// describeEmission summarizes an emission schedule for display
+func describeEmission(emission EmissionSchedule) string {
+	switch emission.Schedule {
+	case EmissionFixed:
+		return fmt.Sprintf("fixed reward %d", emission.Reward)
+	case EmissionHalving:
+		return fmt.Sprintf("reward %d halving every %d blocks", emission.Reward, emission.HalvingInterval)
+	}
+	return emission.Schedule
+}
+
+// blockRewardAt returns the reward the emission schedule credits to the creator of the block at height
+func blockRewardAt(height int) int64 {
+	emission := networkParams.Emission
+	switch emission.Schedule {
+	case EmissionFixed:
+		return emission.Reward
+	case EmissionHalving:
+		halvings := (height - 1) / emission.HalvingInterval
+		if halvings >= 63 {
+			return 0
+		}
+		return emission.Reward >> halvings
+	}
+	return 0
+}
+
+// serializedSize returns the size of v encoded as JSON, the format blocks are exchanged in
+func serializedSize(v interface{}) int {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+// txID returns the identifier of a transaction: the job ID for job results, the signature hash for transfers
+func txID(tx Transaction) string {
+	if tx.Type == TxJob {
+		return tx.JobID
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(transferMessage(tx)))
+}
+
+// transferMessage returns the bytes signed by the sender of a transfer; labels are covered only when present,
+// so unlabeled transfers keep their signatures and IDs
+func transferMessage(tx Transaction) []byte {
+	message := fmt.Sprintf("%s|%s|%s|%s|%d|%d|%d|%d", genesisHash, tx.Type, tx.From, tx.To, tx.Amount, tx.Fee, tx.Nonce, tx.Timestamp)
+	if len(tx.Labels) > 0 {
+		message += "|" + formatLabels(tx.Labels)
+	}
+	return []byte(message)
+}
+
+// parseLabels decodes a comma-separated list of key=value labels, as sent in X-Job-Labels
+func parseLabels(list string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(list, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("label %q is not of the form key=value", pair)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if _, duplicate := labels[key]; duplicate {
+			return nil, fmt.Errorf("label %q is given more than once", key)
+		}
+		labels[key] = value
+	}
+	if len(labels) == 0 {
+		return nil, nil
+	}
+	return labels, validateLabels(labels)
+}
+
+// formatLabels encodes labels as a comma-separated list of key=value pairs sorted by key
+func formatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// validLabelKey reports whether a label key only uses lowercase letters, digits, '_', '.' and '-'
+func validLabelKey(key string) bool {
+	if key == "" || len(key) > maxLabelKey {
+		return false
+	}
+	for _, c := range key {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// validateLabels checks the number and form of a transaction's labels
+func validateLabels(labels map[string]string) error {
+	if len(labels) > maxLabels {
+		return fmt.Errorf("at most %d labels are allowed", maxLabels)
+	}
+	for key, value := range labels {
+		if !validLabelKey(key) {
+			return fmt.Errorf("invalid label key %q: keys are up to %d lowercase letters, digits, '_', '.' or '-'", key, maxLabelKey)
+		}
+		if len(value) > maxLabelValue || strings.ContainsAny(value, ",=") || strings.IndexFunc(value, unicode.IsControl) >= 0 {
+			return fmt.Errorf("invalid value for label %q: values are up to %d characters without ',', '=' or control characters", key, maxLabelValue)
+		}
+	}
+	return nil
+}
+
+// indexLabels records a confirmed transaction under each of its labels; the caller must hold mutex
+func indexLabels(tx Transaction) {
+	for key, value := range tx.Labels {
+		label := key + ":" + value
+		labelIndex[label] = append(labelIndex[label], txID(tx))
+	}
+}
+
+// findByLabel returns the newest confirmed transactions carrying a key:value label, at most limit of them
+func findByLabel(label string, limit int) []TxLocation {
+	mutex.Lock()
+	defer mutex.Unlock()
+	ids := labelIndex[label]
+	locations := []TxLocation{}
+	for i := len(ids) - 1; i >= 0 && len(locations) < limit; i-- {
+		number, ok := txIndex[ids[i]]
+		if !ok || number < 1 || number > len(blockchain) {
+			continue
+		}
+		block := blockchain[number-1]
+		for _, tx := range block.Transactions {
+			if txID(tx) == ids[i] {
+				location := TxLocation{Transaction: tx, BlockNumber: block.BlockNumber, BlockHash: block.Hash}
+				if redactedJobs[tx.JobID] || redactedSubmitters[tx.ID] {
+					location.Transaction.Data = ""
+					location.Redacted = true
+				}
+				locations = append(locations, location)
+				break
+			}
+		}
+	}
+	return locations
+}
+
+// validateTransfer checks the amount, addresses and sender signature of a transfer
+func validateTransfer(tx Transaction) error {
+	if tx.Amount <= 0 {
+		return fmt.Errorf("transfer amount must be positive")
+	}
+	if tx.Fee < 0 {
+		return fmt.Errorf("transfer fee must not be negative")
+	}
+	if tx.Fee > math.MaxInt64-tx.Amount {
+		return fmt.Errorf("transfer amount and fee exceed %d together", int64(math.MaxInt64))
+	}
+	if tx.From == tx.To {
+		return fmt.Errorf("transfer sender and recipient are the same")
+	}
+	if tx.Nonce < 1 {
+		return fmt.Errorf("transfer nonce must be at least 1")
+	}
+	if tx.ComputeUnits != 0 {
+		return fmt.Errorf("transfers consume no compute units")
+	}
+	to, err := hex.DecodeString(tx.To)
+	if err != nil || len(to) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid transfer recipient %q", tx.To)
+	}
+	from, err := hex.DecodeString(tx.From)
+	if err != nil || len(from) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid transfer sender %q", tx.From)
+	}
+	signature, err := hex.DecodeString(tx.Signature)
+	if err != nil || !ed25519.Verify(from, transferMessage(tx), signature) {
+		return fmt.Errorf("transfer signature is invalid")
+	}
+	return nil
+}
+
+// validateRevocation checks that a revocation names a node identity and is signed by a network admin. It moves
+// no funds, so it carries no amount, fee or nonce; its timestamp tells repeated revocations apart.
+func validateRevocation(tx Transaction) error {
+	if !isAdmin(tx.From) {
+		return fmt.Errorf("revocation signer %q is not a network admin", tx.From)
+	}
+	if tx.Amount != 0 || tx.Fee != 0 || tx.Nonce != 0 || tx.ComputeUnits != 0 {
+		return fmt.Errorf("revocations carry no amount, fee, nonce or compute units")
+	}
+	if key, err := hex.DecodeString(tx.To); err != nil || len(key) != ed25519.PublicKeySize || tx.To != strings.ToLower(tx.To) {
+		return fmt.Errorf("invalid revoked identity %q", tx.To)
+	}
+	if isAdmin(tx.To) {
+		return fmt.Errorf("admin key %s cannot be revoked; remove it from the genesis parameters instead", tx.To)
+	}
+	from, _ := hex.DecodeString(tx.From)
+	signature, err := hex.DecodeString(tx.Signature)
+	if err != nil || !ed25519.Verify(from, transferMessage(tx), signature) {
+		return fmt.Errorf("revocation signature is invalid")
+	}
+	return nil
+}
+
+// isAdmin reports whether key is one of the network admin keys of the genesis parameters
+func isAdmin(key string) bool {
+	for _, admin := range networkParams.Admins {
+		if admin == key {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRevoked reports a transaction that a confirmed revocation makes unacceptable: a job result executed or
+// forwarded by a revoked identity, or a revocation of an identity that is already revoked. The caller must hold
+// mutex.
+func checkRevoked(tx Transaction) error {
+	switch tx.Type {
+	case TxJob:
+		for _, identity := range []string{tx.Executor, tx.Forwarder} {
+			if revocation, ok := revoked[identity]; ok && identity != "" {
+				return fmt.Errorf("transaction %s involves %s, whose identity was revoked in block %d", tx.JobID, identity, revocation.BlockNumber)
+			}
+		}
+	case TxRevocation:
+		if revocation, ok := revoked[tx.To]; ok {
+			return fmt.Errorf("%s was already revoked in block %d", tx.To, revocation.BlockNumber)
+		}
+	}
+	return nil
+}
+
+// checkRevocations verifies that a block was not created by a revoked identity and returns the IDs of its
+// transactions that checkRevoked refuses. The creator is authenticated by validateHeader, which every block
+// passes before it reaches the chain. The caller must hold mutex.
+func checkRevocations(block Block) (map[string]bool, error) {
+	if revocation, ok := revoked[block.Creator]; ok {
+		return nil, fmt.Errorf("block %d was created by %s, whose identity was revoked in block %d", block.BlockNumber, block.Creator, revocation.BlockNumber)
+	}
+	invalid := make(map[string]bool)
+	for _, tx := range block.Transactions {
+		if checkRevoked(tx) != nil {
+			invalid[txID(tx)] = true
+		}
+	}
+	if len(invalid) > 0 {
+		return invalid, fmt.Errorf("block %d contains %d transactions refused by a confirmed revocation", block.BlockNumber, len(invalid))
+	}
+	return nil, nil
+}
+
+// applyRevocations records the revocations confirmed by a block; the caller must hold mutex
+func applyRevocations(block Block) {
+	for _, tx := range block.Transactions {
+		if tx.Type != TxRevocation {
+			continue
+		}
+		revoked[tx.To] = Revocation{Identity: tx.To, Admin: tx.From, Reason: tx.Labels["reason"], TxID: txID(tx), BlockNumber: block.BlockNumber}
+		fmt.Printf("Node identity %s revoked by admin %s in block %d\n", tx.To, tx.From, block.BlockNumber)
+	}
+}
+
+// checkBlockBalances verifies that every transfer in a block continues its sender's nonce sequence and is covered
+// by the sender's balance when the block's transfers are applied in order; it returns the IDs of the transfers
+// that are not. The caller must hold mutex.
+func checkBlockBalances(block Block) (map[string]bool, error) {
+	pending := make(map[string]int64)
+	if block.BlockNumber == 1 {
+		for address, amount := range networkParams.Allocations {
+			pending[address] += amount
+		}
+	}
+	next := make(map[string]int64)
+	invalid := make(map[string]bool)
+	for _, tx := range block.Transactions {
+		if tx.Type != TxTransfer {
+			continue
+		}
+		if _, ok := next[tx.From]; !ok {
+			next[tx.From] = nonces[tx.From] + 1
+		}
+		// Compared without summing the amount and fee, so huge values cannot wrap around
+		available := balances[tx.From] + pending[tx.From]
+		if tx.Nonce != next[tx.From] || tx.Fee > available || tx.Amount > available-tx.Fee {
+			invalid[txID(tx)] = true
+			continue
+		}
+		next[tx.From]++
+		pending[tx.From] -= tx.Amount + tx.Fee
+		pending[tx.To] += tx.Amount
+	}
+	if len(invalid) > 0 {
+		return invalid, fmt.Errorf("block %d contains %d transfers out of nonce order or exceeding the sender's balance", block.BlockNumber, len(invalid))
+	}
+	return nil, nil
+}
+
+// applyBlockBalances credits the block reward and fees and applies the block's transfers. The first block also
+// credits the genesis allocations. Blocks do not carry their reward: every node derives it from the emission
+// schedule of the genesis parameters, so a creator cannot claim more. The caller must hold mutex.
+func applyBlockBalances(block Block) {
+	if block.BlockNumber == 1 {
+		for address, amount := range networkParams.Allocations {
+			balances[address] += amount
+		}
+	}
+	balances[block.Creator] += blockRewardAt(block.BlockNumber)
+	for _, tx := range block.Transactions {
+		if tx.Type == TxTransfer {
+			balances[tx.From] -= tx.Amount + tx.Fee
+			balances[tx.To] += tx.Amount
+			balances[block.Creator] += tx.Fee
+			nonces[tx.From] = tx.Nonce
+		}
+	}
+}
+
+// validateTransaction checks that a transaction is well formed and, for job results, that its size and
+// execution stayed within the network's limits
+func validateTransaction(tx Transaction) error {
+	if size := serializedSize(tx); size > networkParams.MaxTransactionSize {
+		return &SizeError{Kind: "transaction", ID: txID(tx), Size: size, Limit: networkParams.MaxTransactionSize}
+	}
+	if err := validateLabels(tx.Labels); err != nil {
+		return fmt.Errorf("transaction %s: %w", txID(tx), err)
+	}
+	switch tx.Type {
+	case TxJob:
+	case TxTransfer:
+		if err := validateTransfer(tx); err != nil {
+			return err
+		}
+		return validateTxHooks(tx)
+	case TxRevocation:
+		if err := validateRevocation(tx); err != nil {
+			return err
+		}
+		return validateTxHooks(tx)
+	default:
+		return fmt.Errorf("unknown transaction type %q", tx.Type)
+	}
+	allowed := false
+	for _, runtime := range networkParams.AllowedRuntimes {
+		if tx.Runtime == runtime {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("transaction %s used runtime %q which is not allowed", tx.JobID, tx.Runtime)
+	}
+	if tx.ComputeUnits < 0 || tx.ComputeUnits > int64(networkParams.MaxBlockCompute) {
+		return fmt.Errorf("transaction %s uses %d compute units, exceeding a block's budget of %d", tx.JobID, tx.ComputeUnits, networkParams.MaxBlockCompute)
+	}
+	if tx.Fee < 0 {
+		return fmt.Errorf("transaction %s offers a negative fee", tx.JobID)
+	}
+	if tx.ExecutionTime < 0 || tx.ExecutionTime > int64(networkParams.MaxRuntime)*1000 {
+		return fmt.Errorf("transaction %s ran for %dms, outside the maximum runtime of %ds", tx.JobID, tx.ExecutionTime, networkParams.MaxRuntime)
+	}
+	if tx.CPUTime < 0 || tx.CPUTime > int64(networkParams.MaxRuntime)*1000 {
+		return fmt.Errorf("transaction %s used %dms of CPU time, outside the maximum runtime of %ds", tx.JobID, tx.CPUTime, networkParams.MaxRuntime)
+	}
+	if tx.UsageSignature != "" && !verifyUsage(tx) {
+		return fmt.Errorf("transaction %s has an invalid usage signature", tx.JobID)
+	}
+	if len(tx.Data) > networkParams.MaxOutputSize {
+		return fmt.Errorf("transaction %s output is %d bytes, exceeding the maximum of %d", tx.JobID, len(tx.Data), networkParams.MaxOutputSize)
+	}
+	if tx.ResultCID != "" || tx.ResultHash != "" {
+		if hash, err := hex.DecodeString(tx.ResultHash); err != nil || len(hash) != sha256.Size || !validCID(tx.ResultCID) {
+			return fmt.Errorf("transaction %s needs both a valid result CID and result hash for its encrypted result", tx.JobID)
+		}
+		if tx.Data != "" {
+			return fmt.Errorf("transaction %s carries a plaintext result besides its encrypted result", tx.JobID)
+		}
+	}
+	if tx.OutputCID != "" || tx.OutputSize != 0 || tx.OutputHash != "" {
+		if hash, err := hex.DecodeString(tx.OutputHash); err != nil || len(hash) != sha256.Size || !validCID(tx.OutputCID) || tx.OutputSize <= int64(len(tx.Data)) {
+			return fmt.Errorf("transaction %s needs a valid CID, hash and size for its truncated output", tx.JobID)
+		}
+		if tx.ResultCID != "" {
+			return fmt.Errorf("transaction %s truncates an output it encrypted", tx.JobID)
+		}
+	}
+	if _, err := parseNetworkPolicy(tx.Network); err != nil {
+		return fmt.Errorf("transaction %s has an invalid network policy: %w", tx.JobID, err)
+	}
+	if tx.Forwarder != "" || tx.ForwarderSignature != "" {
+		if tx.Forwarder == tx.Executor || !verifyForwarder(tx.Forwarder, tx.ForwarderSignature, tx.JobID, tx.ID) {
+			return fmt.Errorf("transaction %s records an invalid forwarder", tx.JobID)
+		}
+	}
+	return validateTxHooks(tx)
+}
+
+// validateTxHooks runs the custom transaction validators registered with ValidateTx
+func validateTxHooks(tx Transaction) error {
+	for _, validator := range hooks.validateTx {
+		if err := validator(tx); err != nil {
+			return fmt.Errorf("transaction %s rejected by custom validation: %w", txID(tx), err)
+		}
+	}
+	return nil
+}
+
+// statsFor returns the statistics entry of a node identity, creating it if needed; the caller must hold mutex
+func statsFor(identity string) *MinerStats {
+	stats, ok := minerStats[identity]
+	if !ok {
+		stats = &MinerStats{Identity: identity}
+		minerStats[identity] = stats
+	}
+	return stats
+}
+
+// recordBlockStats credits an accepted block to its creator and its jobs to their executors; the caller must hold mutex
+func recordBlockStats(block Block) {
+	statsFor(block.Creator).BlocksMined++
+	for _, tx := range block.Transactions {
+		stats := statsFor(tx.Executor)
+		stats.JobsExecuted++
+		stats.TotalExecutionTime += tx.ExecutionTime
+	}
+}
+
+// BillingEntry is the resource usage of one submitter's confirmed jobs
+type BillingEntry struct {
+	Submitter     string // Submitter the jobs were executed for
+	Jobs          int    // Number of confirmed jobs
+	CPUTime       int64  // Total CPU time in milliseconds
+	ExecutionTime int64  // Total wall-clock execution time in milliseconds
+	Fees          int64  // Total fees offered for the jobs, capped at the largest int64
+	CoSigned      int    // Jobs whose usage the submitter co-signed with a receipt held by this node
+}
+
+// saturatingAdd adds two non-negative amounts, stopping at the largest int64 instead of wrapping around
+func saturatingAdd(a, b int64) int64 {
+	if b > math.MaxInt64-a {
+		return math.MaxInt64
+	}
+	return a + b
+}
+
+// parseReportTime parses a report boundary given as a date, an RFC 3339 time or a Unix timestamp
+func parseReportTime(value string) (time.Time, error) {
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(unix, 0), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+// billingReport aggregates the usage of confirmed jobs per submitter for blocks mined in [from, to),
+// optionally limited to the jobs of one executor; the caller must hold mutex
+func billingReport(from, to time.Time, executor string) []BillingEntry {
+	entries := make(map[string]*BillingEntry)
+	for _, block := range blockchain {
+		if block.Timestamp < from.Unix() || block.Timestamp >= to.Unix() {
+			continue
+		}
+		for _, tx := range block.Transactions {
+			if tx.Type != TxJob || (executor != "" && tx.Executor != executor) {
+				continue
+			}
+			entry, ok := entries[tx.ID]
+			if !ok {
+				entry = &BillingEntry{Submitter: tx.ID}
+				entries[tx.ID] = entry
+			}
+			entry.Jobs++
+			entry.CPUTime = saturatingAdd(entry.CPUTime, tx.CPUTime)
+			entry.ExecutionTime = saturatingAdd(entry.ExecutionTime, tx.ExecutionTime)
+			entry.Fees = saturatingAdd(entry.Fees, tx.Fee)
+			if job, ok := jobs[tx.JobID]; ok && verifyReceipt(job.SubmitterKey, job.Receipt, tx) {
+				entry.CoSigned++
+			}
+		}
+	}
+	report := make([]BillingEntry, 0, len(entries))
+	for _, entry := range entries {
+		report = append(report, *entry)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Submitter < report[j].Submitter })
+	return report
+}
+
+// handleBilling reports per-submitter usage between ?from= and ?to=, for ?executor= (an identity or "self") if given
+func handleBilling(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, to := time.Unix(0, 0), time.Now()
+	var err error
+	if value := r.URL.Query().Get("from"); value != "" {
+		if from, err = parseReportTime(value); err != nil {
+			http.Error(w, "Invalid from time", http.StatusBadRequest)
+			return
+		}
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		if to, err = parseReportTime(value); err != nil {
+			http.Error(w, "Invalid to time", http.StatusBadRequest)
+			return
+		}
+	}
+	executor := r.URL.Query().Get("executor")
+	if executor == "self" {
+		executor = nodeID
+	}
+
+	mutex.Lock()
+	report := billingReport(from, to, executor)
+	mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// runBilling implements the billing subcommand, which prints a node's per-submitter usage report
+func runBilling(args []string) {
+	billingFlags := flag.NewFlagSet("billing", flag.ExitOnError)
+	node := billingFlags.String("node", localNodeURL(), "URL of the node to report from")
+	from := billingFlags.String("from", "", "Start of the period (date, RFC 3339 time or Unix timestamp)")
+	to := billingFlags.String("to", "", "End of the period, exclusive (defaults to now)")
+	executor := billingFlags.String("executor", "self", "Executor whose jobs are billed (an identity, self, or empty for all)")
+	billingFlags.Parse(args)
+
+	query := url.Values{"from": {*from}, "to": {*to}, "executor": {*executor}}
+	resp, err := nodeClient.Get(*node + "/billing?" + query.Encode())
+	if err != nil {
+		fmt.Printf("Error requesting billing report: %v\n", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		reply, _ := io.ReadAll(resp.Body)
+		fmt.Printf("Billing report failed with status %d: %s\n", resp.StatusCode, strings.TrimSpace(string(reply)))
+		return
+	}
+	var report []BillingEntry
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		fmt.Printf("Error decoding billing report: %v\n", err)
+		return
+	}
+	fmt.Printf("%-40s %8s %14s %14s %12s %9s\n", "SUBMITTER", "JOBS", "CPU SECONDS", "WALL SECONDS", "FEES", "COSIGNED")
+	for _, entry := range report {
+		fmt.Printf("%-40s %8d %14.3f %14.3f %12d %9d\n", entry.Submitter, entry.Jobs, float64(entry.CPUTime)/1000, float64(entry.ExecutionTime)/1000, entry.Fees, entry.CoSigned)
+	}
+}
+
+// VerifySummary counts the results of one executor checked by verify results
+type VerifySummary struct {
+	Executor   string
+	Checked    int // Results re-executed locally
+	Mismatched int // Results whose output differs from the local re-execution
+	Skipped    int // Results that could not be re-executed
+}
+
+// runVerify audits the chain of a node: verify results re-executes confirmed jobs and verify difficulty
+// recomputes the difficulty of every block
+func runVerify(args []string, genesisFile string) {
+	if len(args) == 0 {
+		fmt.Println("Usage: miner verify results|difficulty [flags]")
+		return
+	}
+	switch args[0] {
+	case "results":
+		verifyResults(args, genesisFile)
+	case "difficulty":
+		verifyDifficulty(args, genesisFile)
+	default:
+		fmt.Printf("Unknown verify command %q\n", args[0])
+	}
+}
+
+// verifyDifficulty checks that every block of a node's chain was mined at the difficulty the network rules give
+// for its height, with a hash that matches its header and meets that difficulty, and that the node's
+// /difficulty/history agrees with the retargets recomputed from the headers
+func verifyDifficulty(args []string, genesisFile string) {
+	verifyFlags := flag.NewFlagSet("verify difficulty", flag.ExitOnError)
+	node := verifyFlags.String("node", localNodeURL(), "URL of the node whose chain is verified")
+	verifyFlags.Parse(args[1:])
+
+	params, err := loadNetworkParams(genesisFile)
+	if err != nil {
+		fmt.Printf("Error loading network parameters: %v\n", err)
+		return
+	}
+	setNetworkParams(params)
+
+	resp, err := nodeClient.Get(*node + "/headers")
+	if err != nil {
+		fmt.Printf("Error fetching headers: %v\n", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("Error fetching headers: status %d\n", resp.StatusCode)
+		return
+	}
+	headers := []BlockHeader{}
+	failures := 0
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var header BlockHeader
+		if err := decoder.Decode(&header); err == io.EOF {
+			break
+		} else if err != nil {
+			fmt.Printf("Error decoding headers: %v\n", err)
+			return
+		}
+		if header.BlockNumber != len(headers)+1 {
+			fmt.Printf("Expected block %d, got block %d\n", len(headers)+1, header.BlockNumber)
+			return
+		}
+		if expected := expectedDifficulty(header.BlockNumber); header.Difficulty != expected {
+			failures++
+			fmt.Printf("WRONG    block %d: mined at difficulty %d, the rules require %d\n", header.BlockNumber, header.Difficulty, expected)
+		} else if hash := generateHash(header, header.Nonce); hash != header.Hash || !validProof(hash, header.Difficulty) {
+			failures++
+			fmt.Printf("INVALID  block %d: hash %s does not match its header or does not meet difficulty %d\n", header.BlockNumber, header.Hash, header.Difficulty)
+		} else if err := validateCreatorSignature(header); err != nil {
+			failures++
+			fmt.Printf("INVALID  %v\n", err)
+		}
+		headers = append(headers, header)
+	}
+
+	recomputed := difficultyHistory(headers)
+	var reported DifficultyHistory
+	if err := getNodeJSON(*node+"/difficulty/history", &reported); err != nil {
+		fmt.Printf("Error fetching the difficulty history: %v\n", err)
+		return
+	}
+	if reported.Height == len(headers) && !reflect.DeepEqual(reported.Events, recomputed) {
+		failures++
+		fmt.Printf("HISTORY  the node reports %d difficulty changes, the headers show %d\n", len(reported.Events), len(recomputed))
+	}
+	for _, event := range recomputed {
+		if event.Blocks == 0 {
+			fmt.Printf("block %-8d difficulty %d at the start of the chain\n", event.Height, event.NewDifficulty)
+			continue
+		}
+		fmt.Printf("block %-8d difficulty %d -> %d after %d blocks, %.1fs apart on average\n", event.Height, event.OldDifficulty, event.NewDifficulty, event.Blocks, event.ObservedInterval)
+	}
+	fmt.Printf("Verified %d blocks: %d failures\n", len(headers), failures)
+}
+
+// verifyResults re-executes the job results confirmed in a range of blocks and reports, per executor, the
+// results whose output hash differs from the local run
+func verifyResults(args []string, genesisFile string) {
+	verifyFlags := flag.NewFlagSet("verify results", flag.ExitOnError)
+	node := verifyFlags.String("node", localNodeURL(), "URL of the node the blocks are read from")
+	from := verifyFlags.Int("from-block", 1, "First block whose results are verified")
+	to := verifyFlags.Int("to-block", 0, "Last block whose results are verified (defaults to the node's height)")
+	verifyFlags.Parse(args[1:])
+
+	// Re-execute under the same runtime limit the executors had
+	params, err := loadNetworkParams(genesisFile)
+	if err != nil {
+		fmt.Printf("Error loading network parameters: %v\n", err)
+		return
+	}
+	setNetworkParams(params)
+
+	if *to == 0 {
+		var status NodeStatus
+		if err := getNodeJSON(*node+"/status", &status); err != nil {
+			fmt.Printf("Error querying the chain height: %v\n", err)
+			return
+		}
+		*to = status.Height
+	}
+	if *from < 1 || *to < *from {
+		fmt.Printf("Invalid block range %d-%d\n", *from, *to)
+		return
+	}
+
+	workDir, err := os.MkdirTemp("", "verify-results")
+	if err != nil {
+		fmt.Printf("Error creating a work directory: %v\n", err)
+		return
+	}
+	defer os.RemoveAll(workDir)
+
+	summaries := make(map[string]*VerifySummary)
+	files := make(map[string]string) // Downloaded files keyed by CID
+	for number := *from; number <= *to; number++ {
+		var block Block
+		if err := getNodeJSON(fmt.Sprintf("%s/block?number=%d", *node, number), &block); err != nil {
+			fmt.Printf("Error fetching block %d: %v\n", number, err)
+			return
+		}
+		for _, tx := range block.Transactions {
+			if tx.Type != TxJob {
+				continue
+			}
+			summary, ok := summaries[tx.Executor]
+			if !ok {
+				summary = &VerifySummary{Executor: tx.Executor}
+				summaries[tx.Executor] = summary
+			}
+			output, err := reexecuteResult(*node, tx, workDir, files)
+			if err != nil {
+				summary.Skipped++
+				fmt.Printf("SKIP     block %d job %s: %v\n", number, tx.JobID, err)
+				continue
+			}
+			summary.Checked++
+			// Encrypted results are checked against the plaintext hash recorded with them
+			recorded, local := fmt.Sprintf("%x", sha256.Sum256([]byte(tx.Data))), fmt.Sprintf("%x", sha256.Sum256([]byte(output)))
+			if tx.ResultHash != "" {
+				recorded = tx.ResultHash
+			}
+			if tx.OutputHash != "" {
+				recorded = tx.OutputHash
+			}
+			if recorded != local {
+				summary.Mismatched++
+				fmt.Printf("MISMATCH block %d job %s executor %s: recorded %s, re-executed %s\n", number, tx.JobID, tx.Executor, recorded, local)
+			}
+		}
+	}
+
+	report := make([]*VerifySummary, 0, len(summaries))
+	for _, summary := range summaries {
+		report = append(report, summary)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Executor < report[j].Executor })
+	fmt.Printf("Verified blocks %d-%d\n", *from, *to)
+	fmt.Printf("%-64s %8s %10s %8s\n", "EXECUTOR", "CHECKED", "MISMATCHED", "SKIPPED")
+	for _, summary := range report {
+		fmt.Printf("%-64s %8d %10d %8d\n", summary.Executor, summary.Checked, summary.Mismatched, summary.Skipped)
+	}
+}
+
+// maxProofObject is the largest IPFS object copied into a proof bundle in bytes
+const maxProofObject = 64 << 20
+
+// ProofBundle is a self-contained proof that a block and the computations it confirms are part of a chain, so a
+// third party can audit them offline with block verify-proof
+type ProofBundle struct {
+	Block      Block             // Proven block with its transactions
+	Headers    []BlockHeader     // Headers following the block up to the checkpoint, in chain order
+	Checkpoint string            // Hash of the block the proof is anchored to, the block itself or the last header
+	Finalized  bool              // Whether the checkpoint was final on the exporting node
+	Proofs     []BundleProof     // Merkle proof of every transaction of the block
+	Objects    map[string][]byte // Content of the IPFS objects the block's jobs reference, keyed by CID
+	Exported   int64             // Unix time the bundle was exported
+}
+
+// BundleProof is the Merkle proof of one transaction of a proof bundle's block
+type BundleProof struct {
+	TxID     string   // ID of the transaction
+	Index    int      // Position of the transaction in the block
+	Siblings []string // Hex-encoded sibling hashes from the leaf up to the root
+}
+
+// runBlock implements the block subcommands
+func runBlock(args []string, genesisFile string) {
+	if len(args) == 0 {
+		fmt.Println("Usage: miner block export-proof [flags] <hash>|verify-proof [flags] <file>")
+		return
+	}
+	switch args[0] {
+	case "export-proof":
+		exportProof(args[1:])
+	case "verify-proof":
+		verifyProof(args[1:], genesisFile)
+	default:
+		fmt.Printf("Unknown block command %q\n", args[0])
+	}
+}
+
+// jobObjects returns the IPFS objects a job result references: its script, input files, encrypted result and
+// full output
+func jobObjects(tx Transaction) []string {
+	cids := append([]string{tx.PythonHash, tx.TxtHash}, tx.Inputs...)
+	var objects []string
+	seen := make(map[string]bool)
+	for _, cid := range append(cids, tx.ResultCID, tx.OutputCID) {
+		if cid != "" && !seen[cid] {
+			seen[cid] = true
+			objects = append(objects, cid)
+		}
+	}
+	return objects
+}
+
+// exportProof writes the proof bundle of a block read from a node. The headers run to the node's finalized block
+// when the block is final, and to the node's chain head otherwise.
+func exportProof(args []string) {
+	exportFlags := flag.NewFlagSet("block export-proof", flag.ExitOnError)
+	node := exportFlags.String("node", localNodeURL(), "URL of the node the block is read from")
+	out := exportFlags.String("out", "", "File the bundle is written to (defaults to block-<hash>.proof.json)")
+	objects := exportFlags.Bool("objects", true, "Include the scripts, inputs and results the block's jobs reference, read from IPFS")
+	exportFlags.Parse(args)
+	if exportFlags.NArg() != 1 {
+		fmt.Println("Usage: miner block export-proof [flags] <hash>")
+		return
+	}
+	hash := exportFlags.Arg(0)
+
+	bundle := ProofBundle{Objects: make(map[string][]byte), Exported: time.Now().Unix()}
+	if err := getNodeJSON(*node+"/block?hash="+url.QueryEscape(hash), &bundle.Block); err != nil {
+		fmt.Printf("Error fetching block %s: %v\n", hash, err)
+		return
+	}
+	var finality struct{ FinalizedHeight int }
+	var status NodeStatus
+	if err := getNodeJSON(*node+"/finality", &finality); err != nil {
+		fmt.Printf("Error fetching the finalized height: %v\n", err)
+		return
+	}
+	if err := getNodeJSON(*node+"/status", &status); err != nil {
+		fmt.Printf("Error fetching the chain height: %v\n", err)
+		return
+	}
+	number := bundle.Block.BlockNumber
+	checkpoint := status.Height
+	if finality.FinalizedHeight >= number {
+		checkpoint, bundle.Finalized = finality.FinalizedHeight, true
+	}
+	if checkpoint > number {
+		resp, err := nodeClient.Get(fmt.Sprintf("%s/headers?from=%d&to=%d", *node, number+1, checkpoint))
+		if err != nil {
+			fmt.Printf("Error fetching headers: %v\n", err)
+			return
+		}
+		decoder := json.NewDecoder(resp.Body)
+		for {
+			var header BlockHeader
+			if err := decoder.Decode(&header); err == io.EOF {
+				break
+			} else if err != nil {
+				resp.Body.Close()
+				fmt.Printf("Error decoding headers: %v\n", err)
+				return
+			}
+			bundle.Headers = append(bundle.Headers, header)
+		}
+		resp.Body.Close()
+	}
+	bundle.Checkpoint = bundle.Block.Hash
+	if len(bundle.Headers) > 0 {
+		bundle.Checkpoint = bundle.Headers[len(bundle.Headers)-1].Hash
+	}
+
+	for i, tx := range bundle.Block.Transactions {
+		bundle.Proofs = append(bundle.Proofs, BundleProof{TxID: txID(tx), Index: i, Siblings: merkleProof(bundle.Block.Transactions, i)})
+		if !*objects || tx.Type != TxJob {
+			continue
+		}
+		for _, cid := range jobObjects(tx) {
+			if _, ok := bundle.Objects[cid]; ok {
+				continue
+			}
+			content, err := fetchFromIPFS(cid, maxProofObject)
+			if err != nil {
+				// The verifier reports the objects a bundle lacks
+				fmt.Printf("Leaving out %s: %v\n", cid, err)
+				continue
+			}
+			bundle.Objects[cid] = content
+		}
+	}
+
+	if *out == "" {
+		*out = fmt.Sprintf("block-%s.proof.json", bundle.Block.Hash)
+	}
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		fmt.Printf("Error encoding the bundle: %v\n", err)
+		return
+	}
+	if err := os.WriteFile(*out, data, 0644); err != nil {
+		fmt.Printf("Error writing the bundle: %v\n", err)
+		return
+	}
+	fmt.Printf("Wrote the proof of block %d (%d transactions, %d objects) anchored to block %d (%s) to %s\n",
+		number, len(bundle.Block.Transactions), len(bundle.Objects), number+len(bundle.Headers), bundle.Checkpoint, *out)
+}
+
+// merkleProofRoot returns the hex-encoded Merkle root a transaction's proof leads to
+func merkleProofRoot(tx Transaction, index int, siblings []string) (string, error) {
+	return foldMerkleProof(txHash(tx), index, siblings)
+}
+
+// ProofRoot returns the hex-encoded Merkle root a proof served by /tx/proof leads to, hashing the transaction as
+// served so a client checks the exact bytes the block committed to
+func ProofRoot(proof TxProof) (string, error) {
+	return foldMerkleProof(sha256.Sum256(proof.Transaction), proof.Index, proof.Siblings)
+}
+
+// foldMerkleProof folds the hex-encoded sibling hashes of the leaf at index into the Merkle root they lead to
+func foldMerkleProof(node [32]byte, index int, siblings []string) (string, error) {
+	for _, sibling := range siblings {
+		hash, err := hex.DecodeString(sibling)
+		if err != nil || len(hash) != sha256.Size {
+			return "", fmt.Errorf("sibling hash %q is malformed", sibling)
+		}
+		if index%2 == 0 {
+			node = sha256.Sum256(append(node[:], hash...))
+		} else {
+			node = sha256.Sum256(append(hash, node[:]...))
+		}
+		index /= 2
+	}
+	return fmt.Sprintf("%x", node), nil
+}
+
+// verifyProof checks a proof bundle offline: the proof of work and links of its header chain up to the
+// checkpoint, the block's transactions against their Merkle proofs and the network rules, and the objects against
+// their CIDs and the hashes the transactions recorded. It reports every check.
+func verifyProof(args []string, genesisFile string) {
+	verifyFlags := flag.NewFlagSet("block verify-proof", flag.ExitOnError)
+	trusted := verifyFlags.String("checkpoint", "", "Hash of a block known to be in the chain, such as a finalized block, the bundle must be anchored to")
+	verifyFlags.Parse(args)
+	if verifyFlags.NArg() != 1 {
+		fmt.Println("Usage: miner block verify-proof [flags] <file>")
+		return
+	}
+	params, err := loadNetworkParams(genesisFile)
+	if err != nil {
+		fmt.Printf("Error loading network parameters: %v\n", err)
+		os.Exit(1)
+	}
+	setNetworkParams(params)
+	data, err := os.ReadFile(verifyFlags.Arg(0))
+	if err != nil {
+		fmt.Printf("Error reading the bundle: %v\n", err)
+		os.Exit(1)
+	}
+	var bundle ProofBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		fmt.Printf("Error decoding the bundle: %v\n", err)
+		os.Exit(1)
+	}
+
+	failures := 0
+	check := func(passed bool, format string, args ...interface{}) {
+		status := "PASS"
+		if !passed {
+			status = "FAIL"
+			failures++
+		}
+		fmt.Printf("%s  %s\n", status, fmt.Sprintf(format, args...))
+	}
+
+	block := bundle.Block
+	previous := BlockHeader{}
+	for i, header := range append([]BlockHeader{block.BlockHeader}, bundle.Headers...) {
+		// The difficulty is the network's, not the one the header claims, so easy blocks cannot pass
+		err := validateHeaderProofOfWork(header)
+		check(err == nil, "block %d hash %s matches its header and meets the network difficulty%s", header.BlockNumber, header.Hash, errorSuffix(err))
+		err = validateCreatorSignature(header)
+		check(err == nil, "block %d is signed by its creator%s", header.BlockNumber, errorSuffix(err))
+		if i > 0 {
+			check(header.BlockNumber == previous.BlockNumber+1 && header.PrevHash == previous.Hash, "block %d follows block %d", header.BlockNumber, previous.BlockNumber)
+		}
+		previous = header
+	}
+	check(previous.Hash == bundle.Checkpoint, "the header chain ends at checkpoint %s", bundle.Checkpoint)
+	if *trusted != "" {
+		check(bundle.Checkpoint == *trusted, "the checkpoint is the trusted block %s", *trusted)
+	} else {
+		fmt.Printf("NOTE  compare checkpoint %s (block %d) with a trusted source or pass -checkpoint\n", bundle.Checkpoint, previous.BlockNumber)
+	}
+
+	check(merkleRoot(block.Transactions) == block.TxRoot, "the %d transactions of block %d hash to its transaction root", len(block.Transactions), block.BlockNumber)
+	proven := make(map[int]bool)
+	for _, proof := range bundle.Proofs {
+		if proof.Index < 0 || proof.Index >= len(block.Transactions) {
+			check(false, "proof of %s names position %d, outside the block", proof.TxID, proof.Index)
+			continue
+		}
+		tx := block.Transactions[proof.Index]
+		root, err := merkleProofRoot(tx, proof.Index, proof.Siblings)
+		check(err == nil && root == block.TxRoot && txID(tx) == proof.TxID, "Merkle proof of transaction %s leads to the transaction root", proof.TxID)
+		proven[proof.Index] = true
+	}
+	for i, tx := range block.Transactions {
+		if !proven[i] {
+			check(false, "transaction %s has a Merkle proof", txID(tx))
+		}
+		err := validateTransaction(tx)
+		check(err == nil, "transaction %s follows the network rules%s", txID(tx), errorSuffix(err))
+	}
+
+	cids := make([]string, 0, len(bundle.Objects))
+	for cid := range bundle.Objects {
+		cids = append(cids, cid)
+	}
+	sort.Strings(cids)
+	for _, cid := range cids {
+		content := bundle.Objects[cid]
+		digest, verifiable := rawCIDDigest(cid)
+		if !verifiable {
+			fmt.Printf("NOTE  object %s cannot be checked offline: only raw CIDv1 objects carry their content hash\n", cid)
+			continue
+		}
+		sum := sha256.Sum256(content)
+		check(bytes.Equal(sum[:], digest), "object %s matches its CID", cid)
+	}
+	for _, tx := range block.Transactions {
+		if tx.Type != TxJob {
+			continue
+		}
+		for _, cid := range jobObjects(tx) {
+			if _, ok := bundle.Objects[cid]; !ok {
+				fmt.Printf("NOTE  object %s of job %s is not in the bundle\n", cid, tx.JobID)
+			}
+		}
+		if output, ok := bundle.Objects[tx.OutputCID]; ok && tx.OutputCID != "" {
+			sum := sha256.Sum256(output)
+			check(hex.EncodeToString(sum[:]) == tx.OutputHash && int64(len(output)) == tx.OutputSize && strings.HasPrefix(string(output), tx.Data),
+				"full output of job %s matches the hash, size and beginning its transaction recorded", tx.JobID)
+		}
+		if tx.ResultCID != "" {
+			fmt.Printf("NOTE  the encrypted result of job %s can only be checked against its hash by the submitter\n", tx.JobID)
+		}
+	}
+
+	anchor := "unfinalized"
+	if bundle.Finalized {
+		anchor = "finalized"
+	}
+	fmt.Printf("Verified block %d (%s) anchored to %s block %d: %d failures\n", block.BlockNumber, block.Hash, anchor, previous.BlockNumber, failures)
+	if failures > 0 {
+		os.Exit(1)
+	}
+}
+
+// errorSuffix formats an error to follow a check description, empty when there is none
+func errorSuffix(err error) string {
+	if err == nil {
+		return ""
+	}
+	return ": " + err.Error()
+}
+
+//go:embed conformance/vectors.json
+var conformanceVectors []byte
+
+// conformanceVersion is the protocol version the conformance vectors describe. It is raised whenever the network
+// deliberately breaks compatibility, and vectors of another version are not run.
+const conformanceVersion = 6
+
+// ConformanceVectors are fixed test vectors for the hashing, signing and validation rules every node of a
+// network must agree on. The vectors in conformance/vectors.json are frozen for their Version: a refactor or
+// another implementation is compatible only if it reproduces them as they are.
+type ConformanceVectors struct {
+	Version      int                 // Protocol version the vectors describe, see conformanceVersion
+	Params       NetworkParams       // Network parameters the transaction and block vectors are validated under
+	GenesisHash  string              // Hash of Params, which signed messages include
+	Hashes       []HashVector        // Block header hashes
+	MerkleRoots  []MerkleVector      // Transaction encodings, Merkle roots and proofs
+	ProofOfWork  []ProofOfWorkVector // Hashes that meet or miss a difficulty
+	Signatures   []SignatureVector   // Signed messages and their signatures
+	Transactions []TransactionVector // Valid and invalid transactions
+	Blocks       []BlockVector       // Valid and invalid blocks
+}
+
+// HashVector is a block header and the hash it must have
+type HashVector struct {
+	Name   string
+	Header BlockHeader // Header to hash with its nonce; its Hash field is ignored
+	Hash   string      // Expected hex-encoded hash
+}
+
+// MerkleVector is a list of transactions with the encoding and hash of each and their Merkle root
+type MerkleVector struct {
+	Name         string
+	Transactions []Transaction
+	Encodings    []string      // Serialized form of each transaction, the bytes hashed into its leaf
+	Leaves       []string      // Hex-encoded leaf hash of each transaction
+	Root         string        // Expected transaction root
+	Proofs       []BundleProof // Merkle proofs of transactions, as in proof bundles
+}
+
+// ProofOfWorkVector is a block hash and whether it meets a difficulty
+type ProofOfWorkVector struct {
+	Name       string
+	Hash       string
+	Difficulty int
+	Valid      bool
+}
+
+// SignatureVector is a message of the given kind, built from Payload, with a signature that must verify or not
+type SignatureVector struct {
+	Name      string
+	Kind      string          // One of transfer, peer-list, finality-vote, forward, script or time-attestation
+	Payload   json.RawMessage // Object the message is built from, see conformanceMessage
+	Message   string          // Expected signed message
+	Signer    string          // Hex-encoded ed25519 public key of the signer
+	Signature string          // Hex-encoded signature
+	Valid     bool            // Whether the signature verifies
+}
+
+// TransactionVector is a transaction, its ID and whether it is valid under the vectors' network parameters
+type TransactionVector struct {
+	Name        string
+	Transaction Transaction
+	ID          string // Expected transaction ID
+	Valid       bool
+	Reason      string // Why an invalid transaction is refused, for readers; implementations only need to agree on Valid
+}
+
+// BlockVector is a block and whether it is valid on its own under the vectors' network parameters
+type BlockVector struct {
+	Name   string
+	Block  Block
+	Valid  bool
+	Reason string // Why an invalid block is refused, for readers; implementations only need to agree on Valid
+}
+
+// runConformance runs the conformance subcommands
+func runConformance(args []string) {
+	if len(args) == 0 || args[0] != "run" {
+		fmt.Println("Usage: miner conformance run [-vectors <file>] [-v]")
+		return
+	}
+	runFlags := flag.NewFlagSet("conformance run", flag.ExitOnError)
+	file := runFlags.String("vectors", "", "File of test vectors to run instead of the ones built into the miner")
+	verbose := runFlags.Bool("v", false, "Print passing vectors too")
+	runFlags.Parse(args[1:])
+	data := conformanceVectors
+	if *file != "" {
+		var err error
+		if data, err = os.ReadFile(*file); err != nil {
+			fmt.Printf("Error reading the vectors: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	var vectors ConformanceVectors
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		fmt.Printf("Error decoding the vectors: %v\n", err)
+		os.Exit(1)
+	}
+	if vectors.Version != conformanceVersion {
+		fmt.Printf("The vectors are for protocol version %d, this build implements version %d\n", vectors.Version, conformanceVersion)
+		os.Exit(1)
+	}
+	total, failures := 0, 0
+	checkConformance(vectors, func(passed bool, section, name, detail string) {
+		total++
+		if !passed {
+			failures++
+			fmt.Printf("FAIL  %s/%s: %s\n", section, name, detail)
+		} else if *verbose {
+			fmt.Printf("PASS  %s/%s\n", section, name)
+		}
+	})
+	fmt.Printf("%d conformance checks: %d passed, %d failed\n", total, total-failures, failures)
+	if failures > 0 {
+		os.Exit(1)
+	}
+}
+
+// checkConformance runs every vector and reports each check to check. The vectors carry their own network
+// parameters, and custom validation hooks registered with the node are left out, so the results depend on neither
+// the local genesis file nor local rules; both are replaced for the rest of the process.
+func checkConformance(vectors ConformanceVectors, check func(passed bool, section, name, detail string)) {
+	setNetworkParams(vectors.Params)
+	hooks = lifecycleHooks{}
+
+	check(genesisHash == vectors.GenesisHash, "params", "genesis-hash", fmt.Sprintf("hash is %s, expected %s", genesisHash, vectors.GenesisHash))
+	for _, v := range vectors.Hashes {
+		hash := generateHash(v.Header, v.Header.Nonce)
+		check(hash == v.Hash, "hashes", v.Name, fmt.Sprintf("hash is %s, expected %s", hash, v.Hash))
+	}
+	for _, v := range vectors.MerkleRoots {
+		for i, tx := range v.Transactions {
+			encoded, _ := json.Marshal(tx)
+			leaf := txHash(tx)
+			check(i < len(v.Encodings) && string(encoded) == v.Encodings[i], "merkle", fmt.Sprintf("%s/encoding-%d", v.Name, i), "transaction encodes as "+string(encoded))
+			check(i < len(v.Leaves) && hex.EncodeToString(leaf[:]) == v.Leaves[i], "merkle", fmt.Sprintf("%s/leaf-%d", v.Name, i), fmt.Sprintf("leaf is %x", leaf))
+		}
+		root := merkleRoot(v.Transactions)
+		check(root == v.Root, "merkle", v.Name, fmt.Sprintf("root is %s, expected %s", root, v.Root))
+		for _, proof := range v.Proofs {
+			name := fmt.Sprintf("%s/proof-%d", v.Name, proof.Index)
+			if proof.Index < 0 || proof.Index >= len(v.Transactions) {
+				check(false, "merkle", name, "the proof names a position outside the transactions")
+				continue
+			}
+			tx := v.Transactions[proof.Index]
+			siblings := merkleProof(v.Transactions, proof.Index)
+			proven, err := merkleProofRoot(tx, proof.Index, proof.Siblings)
+			check(txID(tx) == proof.TxID && strings.Join(siblings, ",") == strings.Join(proof.Siblings, ",") && err == nil && proven == v.Root,
+				"merkle", name, fmt.Sprintf("proof has siblings %v and leads to %s%s", siblings, proven, errorSuffix(err)))
+		}
+	}
+	for _, v := range vectors.ProofOfWork {
+		valid := validProof(v.Hash, v.Difficulty)
+		check(valid == v.Valid, "pow", v.Name, fmt.Sprintf("meets difficulty %d: %t, expected %t", v.Difficulty, valid, v.Valid))
+	}
+	for _, v := range vectors.Signatures {
+		message, err := conformanceMessage(v.Kind, v.Payload)
+		if err != nil {
+			check(false, "signatures", v.Name, err.Error())
+			continue
+		}
+		check(string(message) == v.Message, "signatures", v.Name+"/message", fmt.Sprintf("message is %q, expected %q", message, v.Message))
+		publicKey, keyErr := hex.DecodeString(v.Signer)
+		signature, sigErr := hex.DecodeString(v.Signature)
+		valid := keyErr == nil && sigErr == nil && len(publicKey) == ed25519.PublicKeySize && ed25519.Verify(publicKey, message, signature)
+		check(valid == v.Valid, "signatures", v.Name, fmt.Sprintf("signature verifies: %t, expected %t", valid, v.Valid))
+	}
+	for _, v := range vectors.Transactions {
+		id := txID(v.Transaction)
+		check(id == v.ID, "transactions", v.Name+"/id", fmt.Sprintf("ID is %s, expected %s", id, v.ID))
+		err := validateTransaction(v.Transaction)
+		check((err == nil) == v.Valid, "transactions", v.Name, fmt.Sprintf("valid: %t, expected %t%s", err == nil, v.Valid, errorSuffix(err)))
+	}
+	for _, v := range vectors.Blocks {
+		err := validateBlock(v.Block)
+		check((err == nil) == v.Valid, "blocks", v.Name, fmt.Sprintf("valid: %t, expected %t%s", err == nil, v.Valid, errorSuffix(err)))
+	}
+}
+
+// conformanceMessage builds the signed message of a signature vector from its payload
+func conformanceMessage(kind string, payload json.RawMessage) ([]byte, error) {
+	var err error
+	switch kind {
+	case "transfer":
+		var tx Transaction
+		if err = json.Unmarshal(payload, &tx); err == nil {
+			return transferMessage(tx), nil
+		}
+	case "peer-list":
+		var list PeerList
+		if err = json.Unmarshal(payload, &list); err == nil {
+			return peerListMessage(list), nil
+		}
+	case "finality-vote":
+		var vote FinalityVote
+		if err = json.Unmarshal(payload, &vote); err == nil {
+			return finalityVoteMessage(vote), nil
+		}
+	case "forward":
+		var job struct{ JobID, Submitter string }
+		if err = json.Unmarshal(payload, &job); err == nil {
+			return forwardMessage(job.JobID, job.Submitter), nil
+		}
+	case "usage":
+		var tx Transaction
+		if err = json.Unmarshal(payload, &tx); err == nil {
+			return usageMessage(tx), nil
+		}
+	case "block":
+		var header BlockHeader
+		if err = json.Unmarshal(payload, &header); err == nil {
+			return blockMessage(header), nil
+		}
+	case "script":
+		var script struct{ CID string }
+		if err = json.Unmarshal(payload, &script); err == nil {
+			return scriptSignatureMessage(script.CID), nil
+		}
+	case "time-attestation":
+		var header BlockHeader
+		if err = json.Unmarshal(payload, &header); err == nil {
+			if header.TimeAttestation == nil {
+				return nil, fmt.Errorf("the header carries no time attestation")
+			}
+			return timeAttestationMessage(header, header.TimeAttestation.Source, header.TimeAttestation.Time), nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown signature kind %q", kind)
+	}
+	return nil, fmt.Errorf("invalid %s payload: %w", kind, err)
+}
+
+// reexecuteResult downloads the script and input of a confirmed job result and runs them locally, returning
+// the output. Files already downloaded during the audit are reused from files.
+func reexecuteResult(node string, tx Transaction, workDir string, files map[string]string) (string, error) {
+	if tx.Runtime != "python" {
+		return "", fmt.Errorf("runtime %q cannot be re-executed", tx.Runtime)
+	}
+	pythonHash, txtHash, inputs := tx.PythonHash, tx.TxtHash, tx.Inputs
+	if pythonHash == "" || txtHash == "" {
+		// Results confirmed before transactions recorded their files; the node knows them if it took the job
+		var job Job
+		if err := getNodeJSON(node+"/job?id="+url.QueryEscape(tx.JobID), &job); err != nil {
+			return "", fmt.Errorf("the result does not record its files and the job is unknown to the node")
+		}
+		pythonHash, txtHash, inputs = job.PythonHash, job.TxtHash, job.Inputs
+	}
+
+	downloads := []struct{ cid, ext string }{{pythonHash, ".py"}, {txtHash, ".txt"}}
+	for _, input := range inputs {
+		downloads = append(downloads, struct{ cid, ext string }{input, ".txt"})
+	}
+	paths := make([]string, len(downloads))
+	for i, file := range downloads {
+		path, ok := files[file.cid]
+		if !ok {
+			path = filepath.Join(workDir, file.cid+file.ext)
+			if err := downloadFromIPFS(file.cid, path); err != nil {
+				return "", fmt.Errorf("failed to download %s: %w", file.cid, err)
+			}
+			files[file.cid] = path
+		}
+		paths[i] = path
+	}
+	policy, err := parseNetworkPolicy(tx.Network)
+	if err != nil {
+		return "", err
+	}
+	output, _, err := executePythonFile(paths[0], policy, nil, append(paths[1:], tx.Args...)...)
+	if err != nil {
+		return "", err
+	}
+	return output, nil
+}
+
+// getNodeJSON fetches a JSON document from the node an operator command talks to
+func getNodeJSON(target string, v interface{}) error {
+	resp, err := nodeClient.Get(target)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		reply, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(reply)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// consoleHelp lists the console commands
+const consoleHelp = `Commands:
+  status                       chain height, head, pool size and peers
+  mempool                      transactions waiting in the pool
+  mine                         mine the waiting transactions now, even if they do not fill a block (-dev only)
+  inject job <output>          add a test job result executed by this node to the pool (-dev only)
+  inject transfer <to> <amt>   add a transfer signed by this node to the pool (-dev only)
+  dump jobs|balances|peers|stats|params|txindex|nonces|held
+                               print internal state as JSON
+  help                         show this help`
+
+// runConsoleCommand executes one console command against the node's state and returns its output
+func runConsoleCommand(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+	switch fields[0] {
+	case "help":
+		return consoleHelp
+	case "status":
+		mutex.Lock()
+		defer mutex.Unlock()
+		return fmt.Sprintf("node %s\nheight %d, head %s, finalized %d\npool %d transactions, %d peers", nodeID, currentBlock.BlockNumber, previousBlockHash, finalizedHeight, len(transactionPool), len(peers))
+	case "mempool":
+		mutex.Lock()
+		defer mutex.Unlock()
+		var out strings.Builder
+		for i, tx := range transactionPool {
+			kind := tx.Type
+			if kind == TxJob {
+				kind = "job"
+			}
+			fmt.Fprintf(&out, "%3d %-8s %s fee=%d\n", i, kind, txID(tx), tx.Fee)
+		}
+		fmt.Fprintf(&out, "%d transactions", len(transactionPool))
+		return out.String()
+	case "mine":
+		if !devMode {
+			return "mine is only available on development nodes started with -dev"
+		}
+		go mineTransactions(nodeID, networkParams.Difficulty, 1)
+		return "Mining the waiting transactions"
+	case "inject":
+		tx, err := consoleTransaction(fields[1:])
+		if err != nil {
+			return err.Error()
+		}
+		if err := addTransaction(tx); err != nil {
+			return fmt.Sprintf("Transaction rejected: %v", err)
+		}
+		go mineBlock(nodeID, networkParams.Difficulty)
+		return fmt.Sprintf("Injected %s", txID(tx))
+	case "dump":
+		if len(fields) != 2 {
+			return "Usage: dump jobs|balances|peers|stats|params|txindex|nonces|held"
+		}
+		mutex.Lock()
+		state := map[string]interface{}{
+			"jobs":     jobs,
+			"balances": balances,
+			"peers":    peers,
+			"stats":    minerStats,
+			"params":   networkParams,
+			"txindex":  txIndex,
+			"nonces":   nonces,
+			"held":     futureTransfers,
+		}[fields[1]]
+		data, err := json.MarshalIndent(state, "", "  ")
+		mutex.Unlock()
+		if state == nil || err != nil {
+			return fmt.Sprintf("Cannot dump %q", fields[1])
+		}
+		return string(data)
+	default:
+		return fmt.Sprintf("Unknown command %q, try help", fields[0])
+	}
+}
+
+// consoleTransaction builds the test transaction described by the arguments of the inject command. Test
+// transactions are only built on development nodes, where they cannot reach a real network.
+func consoleTransaction(args []string) (Transaction, error) {
+	if !devMode {
+		return Transaction{}, fmt.Errorf("inject is only available on development nodes started with -dev")
+	}
+	switch {
+	case len(args) >= 2 && args[0] == "job":
+		tx := Transaction{
+			ID:           "console",
+			Data:         strings.Join(args[1:], " "),
+			JobID:        "console-" + GenerateJobID(),
+			Executor:     nodeID,
+			Runtime:      "python",
+			ComputeUnits: computeUnits(0),
+			Network:      NetworkPolicy{}.String(), // Nothing ran, so nothing reached the network
+		}
+		tx.UsageSignature = hex.EncodeToString(ed25519.Sign(nodeKey, usageMessage(tx)))
+		return tx, nil
+	case len(args) == 3 && args[0] == "transfer":
+		amount, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			return Transaction{}, fmt.Errorf("invalid amount %q", args[2])
+		}
+		mutex.Lock()
+		nonce := nextNonce(nodeID)
+		mutex.Unlock()
+		tx := Transaction{Type: TxTransfer, From: nodeID, To: args[1], Amount: amount, Nonce: nonce, Timestamp: time.Now().Unix()}
+		tx.Signature = hex.EncodeToString(ed25519.Sign(nodeKey, transferMessage(tx)))
+		return tx, nil
+	default:
+		return Transaction{}, fmt.Errorf("Usage: inject job <output> | inject transfer <to> <amount>")
+	}
+}
+
+// consoleHeader must be sent with console commands. Browsers cannot add it to a cross-site request without a CORS
+// preflight, so a web page the operator visits cannot drive the console.
+const consoleHeader = "X-Miner-Console"
+
+// handleConsole runs a console command sent by the local operator
+func handleConsole(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if !fromLoopback(r) {
+		http.Error(w, "The console is only available from the local host", http.StatusForbidden)
+		return
+	}
+	if r.Header.Get("Origin") != "" || r.Header.Get(consoleHeader) != "1" {
+		http.Error(w, fmt.Sprintf("Console commands must be sent by miner console, with %s: 1 and no Origin", consoleHeader), http.StatusForbidden)
+		return
+	}
+
+	line, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read command", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(runConsoleCommand(string(line))))
+}
+
+// runConsole implements the console subcommand, a REPL attached to a running node
+func runConsole(args []string) {
+	consoleFlags := flag.NewFlagSet("console", flag.ExitOnError)
+	node := consoleFlags.String("node", localNodeURL(), "URL of the local node")
+	consoleFlags.Parse(args)
+
+	fmt.Printf("Attached to %s, type help for commands and Ctrl-D to leave\n", *node)
+	scanner := bufio.NewScanner(os.Stdin)
+	for fmt.Print("> "); scanner.Scan(); fmt.Print("> ") {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if line == "exit" || line == "quit" {
+			return
+		}
+		req, err := http.NewRequest(http.MethodPost, *node+"/console", strings.NewReader(line))
+		if err != nil {
+			fmt.Printf("Error sending command: %v\n", err)
+			continue
+		}
+		req.Header.Set("Content-Type", "text/plain")
+		req.Header.Set(consoleHeader, "1")
+		resp, err := nodeClient.Do(req)
+		if err != nil {
+			fmt.Printf("Error sending command: %v\n", err)
+			continue
+		}
+		reply, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		fmt.Println(strings.TrimRight(string(reply), "\n"))
+	}
+	fmt.Println()
+}
+
+// handleMiners serves the per-miner statistics ordered as a leaderboard
+func handleMiners(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	mutex.Lock()
+	leaderboard := make([]MinerStats, 0, len(minerStats))
+	for _, stats := range minerStats {
+		entry := *stats
+		if entry.JobsExecuted > 0 {
+			entry.AverageExecutionTime = float64(entry.TotalExecutionTime) / float64(entry.JobsExecuted)
+		}
+		if mined := entry.BlocksMined + entry.StaleBlocks; mined > 0 {
+			entry.StaleRate = float64(entry.StaleBlocks) / float64(mined)
+		}
+		leaderboard = append(leaderboard, entry)
+	}
+	mutex.Unlock()
+
+	sort.Slice(leaderboard, func(i, j int) bool {
+		if leaderboard[i].BlocksMined != leaderboard[j].BlocksMined {
+			return leaderboard[i].BlocksMined > leaderboard[j].BlocksMined
+		}
+		if leaderboard[i].JobsExecuted != leaderboard[j].JobsExecuted {
+			return leaderboard[i].JobsExecuted > leaderboard[j].JobsExecuted
+		}
+		return leaderboard[i].Identity < leaderboard[j].Identity
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(leaderboard)
+}
+
+// handleBlockRange streams a part of each block in a range of historical blocks in the negotiated codec, so peers
+// can sync without walking PrevCID links in IPFS one block at a time
+func handleBlockRange(part func(Block) interface{}, bodies bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		streamBlockRange(w, r, part, bodies)
+	}
+}
+
+// streamBlockRange writes part of each block numbered ?from= through ?to= (default the whole chain). When the parts
+// include the blocks' bodies, a range holding redacted results is refused: blanked results would not match the
+// headers, and the node no longer serves the originals.
+func streamBlockRange(w http.ResponseWriter, r *http.Request, part func(Block) interface{}, bodies bool) {
+	mutex.Lock()
+	height := len(blockchain)
+	mutex.Unlock()
+
+	from, to := 1, height
+	if value := r.URL.Query().Get("from"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid from parameter", http.StatusBadRequest)
+			return
+		}
+		from = n
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < from {
+			http.Error(w, "Invalid to parameter", http.StatusBadRequest)
+			return
+		}
+		to = n
+	}
+	if to > height {
+		to = height
+	}
+	if bodies {
+		mutex.Lock()
+		for number := from; number <= to && number <= len(blockchain); number++ {
+			if _, redacted := redactBlock(blockchain[number-1]); redacted > 0 {
+				mutex.Unlock()
+				http.Error(w, fmt.Sprintf("Block %d holds redacted results and is not served by this node; sync it from another peer", number), http.StatusUnavailableForLegalReasons)
+				return
+			}
+		}
+		mutex.Unlock()
+	}
+
+	codec := negotiateCodec(r.Header.Get("Accept"))
+	w.Header().Set("Content-Type", codec.StreamMediaType())
+	w.Header().Set("X-Chain-Height", strconv.Itoa(height))
+	encoder := codec.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	for number := from; number <= to; number++ {
+		mutex.Lock()
+		if number > len(blockchain) {
+			mutex.Unlock()
+			return
+		}
+		block := blockchain[number-1] // Block numbers start at 1
+		mutex.Unlock()
+
+		if err := encoder.Encode(part(block)); err != nil {
+			fmt.Printf("Error streaming block %d: %v\n", number, err)
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// Encoder writes values in a codec's wire format
+type Encoder interface {
+	Encode(v interface{}) error
+}
+
+// Decoder reads values in a codec's wire format, returning io.EOF once the stream is exhausted
+type Decoder interface {
+	Decode(v interface{}) error
+}
+
+// Codec is a serialization format used for peer communication
+type Codec interface {
+	Name() string            // Short name used in configuration and capability lists
+	MediaType() string       // Content type of a single encoded value
+	StreamMediaType() string // Content type of a sequence of encoded values
+	NewEncoder(w io.Writer) Encoder
+	NewDecoder(r io.Reader) Decoder
+}
+
+// jsonCodec encodes values as JSON, one value per line when streaming
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                   { return "json" }
+func (jsonCodec) MediaType() string              { return "application/json" }
+func (jsonCodec) StreamMediaType() string        { return "application/x-ndjson" }
+func (jsonCodec) NewEncoder(w io.Writer) Encoder { return json.NewEncoder(w) }
+func (jsonCodec) NewDecoder(r io.Reader) Decoder { return json.NewDecoder(r) }
+
+// codecs lists the supported codecs; JSON is the default and is always supported
+var codecs = []Codec{jsonCodec{}, cborCodec{}}
+
+var preferredCodec Codec = jsonCodec{} // Codec requested from peers, configurable with -codec
+
+// codecNames returns the names of the supported codecs, advertised to peers in the status handshake
+func codecNames() []string {
+	names := make([]string, 0, len(codecs))
+	for _, codec := range codecs {
+		names = append(names, codec.Name())
+	}
+	return names
+}
+
+// codecByName looks up a supported codec by name
+func codecByName(name string) (Codec, bool) {
+	for _, codec := range codecs {
+		if codec.Name() == name {
+			return codec, true
+		}
+	}
+	return nil, false
+}
+
+// codecForMediaType finds the codec matching a content type, falling back to JSON
+func codecForMediaType(contentType string) Codec {
+	mediaType := strings.TrimSpace(strings.Split(contentType, ";")[0])
+	for _, codec := range codecs {
+		if mediaType == codec.MediaType() || mediaType == codec.StreamMediaType() {
+			return codec
+		}
+	}
+	return jsonCodec{}
+}
+
+// negotiateCodec picks the first codec listed in an Accept header that this node supports, defaulting to JSON
+func negotiateCodec(accept string) Codec {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType := strings.TrimSpace(strings.Split(part, ";")[0])
+		for _, codec := range codecs {
+			if mediaType == codec.MediaType() || mediaType == codec.StreamMediaType() {
+				return codec
+			}
+		}
+	}
+	return jsonCodec{}
+}
+
+// peerGet requests an endpoint on a peer in the preferred codec, returning the codec the peer answered with
+func peerGet(peer, path string) (*http.Response, Codec, error) {
+	req, err := http.NewRequest(http.MethodGet, peerURL(peer, path), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", preferredCodec.MediaType()+", "+preferredCodec.StreamMediaType()+", application/json;q=0.5")
+	started := time.Now()
+	resp, err := peerClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	recordPeerLatency(peer, time.Since(started))
+	return resp, codecForMediaType(resp.Header.Get("Content-Type")), nil
+}
+
+// lruCache is a fixed-size least-recently-used cache that counts hits and misses
+type lruCache[K comparable, V any] struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List          // Most recently used entries at the front
+	entries  map[K]*list.Element // Elements hold *lruEntry[K, V]
+	hits     uint64
+	misses   uint64
+}
+
+type lruEntry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// newLRUCache creates an LRU cache holding at most capacity entries
+func newLRUCache[K comparable, V any](capacity int) *lruCache[K, V] {
+	return &lruCache[K, V]{capacity: capacity, order: list.New(), entries: make(map[K]*list.Element)}
+}
+
+// Get returns the cached value for key, marking it as recently used
+func (c *lruCache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		c.hits++
+		c.order.MoveToFront(element)
+		return element.Value.(*lruEntry[K, V]).value, true
+	}
+	c.misses++
+	var zero V
+	return zero, false
+}
+
+// Put stores a value, evicting the least recently used entry when the cache is full
+func (c *lruCache[K, V]) Put(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*lruEntry[K, V]).value = value
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry[K, V]{key: key, value: value})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry[K, V]).key)
+	}
+}
+
+// Purge removes every entry, used when the chain is rewritten
+func (c *lruCache[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.entries = make(map[K]*list.Element)
+}
+
+// Stats returns the number of hits, misses and cached entries
+func (c *lruCache[K, V]) Stats() (uint64, uint64, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses, c.order.Len()
+}
+
+// findBlockByHash looks up a block in the local chain through the block cache
+func findBlockByHash(hash string) (Block, bool) {
+	if block, ok := blockCache.Get(hash); ok {
+		return block, true
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	for i := len(blockchain) - 1; i >= 0; i-- {
+		if blockchain[i].Hash == hash {
+			blockCache.Put(hash, blockchain[i])
+			return blockchain[i], true
+		}
+	}
+	return Block{}, false
+}
+
+// findTransaction looks up a confirmed transaction by job ID through the transaction cache
+func findTransaction(jobID string) (TxLocation, bool) {
+	if location, ok := txCache.Get(jobID); ok {
+		return location, true
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	for i := len(blockchain) - 1; i >= 0; i-- {
+		for _, tx := range blockchain[i].Transactions {
+			if tx.JobID == jobID {
+				location := TxLocation{Transaction: tx, BlockNumber: blockchain[i].BlockNumber, BlockHash: blockchain[i].Hash}
+				txCache.Put(jobID, location)
+				return location, true
+			}
+		}
+	}
+	return TxLocation{}, false
+}
+
+// handleBlock serves a single block by hash or number
+func handleBlock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var block Block
+	found := false
+	if hash := r.URL.Query().Get("hash"); hash != "" {
+		block, found = findBlockByHash(hash)
+	} else if number, err := strconv.Atoi(r.URL.Query().Get("number")); err == nil {
+		mutex.Lock()
+		if number >= 1 && number <= len(blockchain) {
+			block, found = blockchain[number-1], true
+		}
+		mutex.Unlock()
+	}
+	if !found {
+		http.Error(w, "Unknown block", http.StatusNotFound)
+		return
+	}
+	// Redacted results are blanked, so the transactions no longer match the header's TxRoot
+	mutex.Lock()
+	block, redacted := redactBlock(block)
+	mutex.Unlock()
+	if redacted > 0 {
+		w.Header().Set("X-Redacted-Transactions", strconv.Itoa(redacted))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(block)
+}
+
+// redactBlock returns a copy of a block with the output of its redacted transactions blanked, and the number of
+// transactions blanked; the caller must hold mutex
+func redactBlock(block Block) (Block, int) {
+	redacted := 0
+	for i, tx := range block.Transactions {
+		if !(redactedJobs[tx.JobID] || redactedSubmitters[tx.ID]) {
+			continue
+		}
+		if redacted == 0 {
+			block.Transactions = append([]Transaction(nil), block.Transactions...)
+		}
+		block.Transactions[i].Data = ""
+		redacted++
+	}
+	return block, redacted
+}
+
+// handleTx serves a confirmed transaction (GET) and accepts pre-built, signed transactions into the pool (POST)
+func handleTx(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		handleTxLookup(w, r)
+	case http.MethodPost:
+		whenSynced(handleSubmitTx)(w, r)
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTxLookup serves a confirmed transaction by its ID, the ID of the job that produced it for job results,
+// or with ?label=key:value the newest transactions carrying that label
+func handleTxLookup(w http.ResponseWriter, r *http.Request) {
+	if label := r.URL.Query().Get("label"); label != "" {
+		if key, _, ok := strings.Cut(label, ":"); !ok || !validLabelKey(key) {
+			http.Error(w, "Labels are queried as key:value", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(findByLabel(label, maxLabelResult))
+		return
+	}
+
+	location, ok := findTransaction(r.URL.Query().Get("id"))
+	if !ok {
+		http.Error(w, "Unknown transaction", http.StatusNotFound)
+		return
+	}
+	mutex.Lock()
+	if redactedJobs[location.Transaction.JobID] || redactedSubmitters[location.Transaction.ID] {
+		location.Transaction.Data = ""
+		location.Redacted = true
+	}
+	mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(location)
+}
+
+// handleTxProof serves the Merkle proof of a confirmed transaction by the ID of the job that produced it, so
+// clients can check the transaction against the block header without downloading the block
+func handleTxProof(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	location, ok := findTransaction(r.URL.Query().Get("id"))
+	if !ok {
+		http.Error(w, "Unknown transaction", http.StatusNotFound)
+		return
+	}
+	mutex.Lock()
+	redacted := redactedJobs[location.Transaction.JobID] || redactedSubmitters[location.Transaction.ID]
+	mutex.Unlock()
+	if redacted {
+		// The leaf commits to the output, which is no longer served
+		http.Error(w, "The transaction's output was redacted", http.StatusGone)
+		return
+	}
+	block, ok := findBlockByHash(location.BlockHash)
+	if !ok {
+		http.Error(w, "Unknown block", http.StatusNotFound)
+		return
+	}
+	index := -1
+	for i, tx := range block.Transactions {
+		if tx.JobID == location.Transaction.JobID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		http.Error(w, "Transaction is not in its block", http.StatusNotFound)
+		return
+	}
+	encoded, err := json.Marshal(block.Transactions[index])
+	if err != nil {
+		http.Error(w, "Failed to encode the transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TxProof{
+		Transaction: encoded,
+		Index:       index,
+		Siblings:    merkleProof(block.Transactions, index),
+		Header:      block.BlockHeader,
+	})
+}
+
+// ChainObject is an object read from IPFS by /ipfs-object/, with its detected type and how it relates to the chain
+type ChainObject struct {
+	CID         string      // CID the object was read from
+	Type        string      // block, head, transaction, evidence, result, output or raw
+	Size        int         // Size of the object in bytes
+	MediaType   string      // Sniffed media type of the content
+	Validation  string      // valid, invalid, or unchecked for encrypted results and raw content
+	Error       string      // Why the object is invalid
+	BlockNumber int         // Block of the local chain holding or matching the object, 0 when there is none
+	BlockHash   string      // Hash of that block
+	Redacted    bool        // Whether the output of a transaction was removed by a redaction
+	Object      interface{} // Decoded block, head record, transaction or evidence; nil for results and raw content
+}
+
+// handleIPFSObject serves GET /ipfs-object/<cid>: it reads the CID through the IPFS gateways, detects whether it
+// holds a block, a published chain head, a transaction or an encrypted job result, and validates it against the
+// node's rules and chain. With ?raw=true the content is returned as it is.
+func handleIPFSObject(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	cid := strings.TrimPrefix(r.URL.Path, "/ipfs-object/")
+	if !validCID(cid) {
+		http.Error(w, "Invalid CID", http.StatusBadRequest)
+		return
+	}
+	// The full output of a job may be larger than a block, which bounds every other chain object
+	data, err := fetchFromIPFS(cid, max(int64(networkParams.MaxBlockSize), maxScriptOutput))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read %s from IPFS: %v", cid, err), http.StatusBadGateway)
+		return
+	}
+	// Content behind a CID never changes
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	if r.URL.Query().Get("raw") == "true" {
+		// Served as opaque bytes, so content from IPFS cannot run as a page of the node
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Write(data)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(inspectChainObject(cid, data))
+}
+
+// inspectChainObject detects the type of an object read from IPFS and validates it
+func inspectChainObject(cid string, data []byte) ChainObject {
+	object := ChainObject{CID: cid, Type: "raw", Size: len(data), MediaType: http.DetectContentType(data), Validation: "unchecked"}
+	check := func(err error) {
+		object.Validation = "valid"
+		if err != nil {
+			object.Validation, object.Error = "invalid", err.Error()
+		}
+	}
+
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(data, &fields) != nil {
+		fields = nil
+	}
+	has := func(names ...string) bool {
+		for _, name := range names {
+			if _, ok := fields[name]; !ok {
+				return false
+			}
+		}
+		return fields != nil
+	}
+	switch {
+	case has("BlockNumber", "PrevHash", "Hash"):
+		var block Block
+		if err := json.Unmarshal(data, &block); err == nil {
+			object.Type, object.Object = "block", block
+			check(validateBlock(block))
+			mutex.Lock()
+			if block.BlockNumber >= 1 && block.BlockNumber <= len(blockchain) && blockchain[block.BlockNumber-1].Hash == block.Hash {
+				object.BlockNumber, object.BlockHash = block.BlockNumber, block.Hash
+			}
+			mutex.Unlock()
+		}
+	case has("Height", "Hash", "CID"):
+		var head ChainHead
+		if err := json.Unmarshal(data, &head); err == nil {
+			object.Type, object.Object = "head", head
+			var err error
+			if head.Height < 1 || !validCID(head.CID) {
+				err = fmt.Errorf("head record points at block %d with CID %q", head.Height, head.CID)
+			}
+			check(err)
+			mutex.Lock()
+			if head.Height <= len(blockchain) && head.Height >= 1 && blockchain[head.Height-1].Hash == head.Hash {
+				object.BlockNumber, object.BlockHash = head.Height, head.Hash
+			}
+			mutex.Unlock()
+		}
+	case has("Reporter", "Headers", "Signature"):
+		var evidence Evidence
+		if err := json.Unmarshal(data, &evidence); err == nil {
+			object.Type, object.Object = "evidence", evidence
+			check(verifyEvidence(evidence))
+		}
+	case has("JobID", "Executor"):
+		var tx Transaction
+		if err := json.Unmarshal(data, &tx); err == nil {
+			object.Type = "transaction"
+			check(validateTransaction(tx))
+			mutex.Lock()
+			if number, ok := txIndex[txID(tx)]; ok && number >= 1 && number <= len(blockchain) {
+				object.BlockNumber, object.BlockHash = number, blockchain[number-1].Hash
+			}
+			if redactedJobs[tx.JobID] || redactedSubmitters[tx.ID] {
+				tx.Data = ""
+				object.Redacted = true
+			}
+			mutex.Unlock()
+			object.Object = tx
+		}
+	}
+	if object.Type != "raw" {
+		return object
+	}
+
+	// Encrypted results and full job outputs are recognized by the transaction recording their CID
+	mutex.Lock()
+	defer mutex.Unlock()
+	for i := len(blockchain) - 1; i >= 0; i-- {
+		for _, tx := range blockchain[i].Transactions {
+			if tx.ResultCID == cid {
+				object.Type, object.BlockNumber, object.BlockHash = "result", blockchain[i].BlockNumber, blockchain[i].Hash
+				return object
+			}
+			if tx.OutputCID == cid {
+				object.Type, object.BlockNumber, object.BlockHash = "output", blockchain[i].BlockNumber, blockchain[i].Hash
+				var err error
+				if hash := fmt.Sprintf("%x", sha256.Sum256(data)); hash != tx.OutputHash {
+					err = fmt.Errorf("output has hash %s, but transaction %s records %s", hash, tx.JobID, tx.OutputHash)
+				}
+				check(err)
+				return object
+			}
+		}
+	}
+	return object
+}
+
+// handleMetrics exposes node metrics in the Prometheus text format
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeMetrics(w)
+}
+
+// writeMetrics writes the node's metrics in the Prometheus text format
+func writeMetrics(w io.Writer) {
+	for _, cache := range []struct {
+		name  string
+		stats func() (uint64, uint64, int)
+	}{{"block", blockCache.Stats}, {"tx", txCache.Stats}} {
+		hits, misses, size := cache.stats()
+		fmt.Fprintf(w, "cache_hits_total{cache=%q} %d\n", cache.name, hits)
+		fmt.Fprintf(w, "cache_misses_total{cache=%q} %d\n", cache.name, misses)
+		fmt.Fprintf(w, "cache_entries{cache=%q} %d\n", cache.name, size)
+	}
+	for _, seen := range []struct {
+		kind  string
+		cache *seenCache
+	}{{"block", seenBlocks}, {"tx", seenTxs}} {
+		_, _, size := seen.cache.recent.Stats()
+		fmt.Fprintf(w, "gossip_duplicates_suppressed_total{kind=%q} %d\n", seen.kind, seen.cache.duplicates.Load())
+		fmt.Fprintf(w, "gossip_seen_entries{kind=%q} %d\n", seen.kind, size)
+	}
+	running, waiting := scheduler.Stats()
+	fmt.Fprintf(w, "job_slots_busy %d\n", running)
+	fmt.Fprintf(w, "job_queue_length %d\n", waiting)
+	held, deferred := scheduler.Deferrals()
+	fmt.Fprintf(w, "jobs_deferred %d\n", held)
+	fmt.Fprintf(w, "jobs_deferred_total %d\n", deferred)
+	maintenance := 0
+	mutex.Lock()
+	if maintenanceMode {
+		maintenance = 1
+	}
+	mutex.Unlock()
+	fmt.Fprintf(w, "maintenance_mode %d\n", maintenance)
+	fmt.Fprintf(w, "gc_runs_total %d\n", gcStats.runs.Load())
+	fmt.Fprintf(w, "gc_removed_files_total %d\n", gcStats.files.Load())
+	fmt.Fprintf(w, "gc_freed_bytes_total %d\n", gcStats.bytes.Load())
+	fmt.Fprintf(w, "gc_unpinned_total %d\n", gcStats.unpinned.Load())
+	fmt.Fprintf(w, "gc_dry_run_reclaimable_bytes %d\n", gcStats.reclaimable.Load())
+	fmt.Fprintf(w, "gc_last_run_timestamp_seconds %d\n", gcStats.lastRun.Load())
+	for _, kind := range []string{alertEquivocation, alertTimestamp, alertInvalidPoW} {
+		fmt.Fprintf(w, "alerts_total{kind=%q} %d\n", kind, alertCounts[kind].Load())
+	}
+	for _, kind := range []string{forkCompeting, forkStale, forkReorg} {
+		fmt.Fprintf(w, "forks_total{kind=%q} %d\n", kind, forkCounts[kind].Load())
+	}
+	mutex.Lock()
+	revocations := len(revoked)
+	mutex.Unlock()
+	fmt.Fprintf(w, "revoked_identities %d\n", revocations)
+}
+
+// MetricsReport is a snapshot of a node's metrics and chain head pushed to a metrics aggregator
+type MetricsReport struct {
+	NodeID    string // Identity (public key) of the reporting node
+	Height    int    // Height of the node's chain head
+	HeadHash  string // Hash of the node's chain head
+	Peers     int    // Number of peers the node knows
+	Metrics   string // The node's /metrics output in the Prometheus text format
+	Timestamp int64  // Unix time the snapshot was taken
+	Signature string // Hex-encoded ed25519 signature over the identity, timestamp, head and a digest of the metrics
+}
+
+// metricsPushTimeout bounds a single push to the metrics aggregator
+const metricsPushTimeout = 30 * time.Second
+
+// metricsReportMessage returns the bytes signed by a metrics report
+func metricsReportMessage(report MetricsReport) []byte {
+	digest := sha256.Sum256([]byte(report.Metrics))
+	return []byte(fmt.Sprintf("metrics|%s|%d|%d|%s|%d|%x", report.NodeID, report.Timestamp, report.Height, report.HeadHash, report.Peers, digest))
+}
+
+// pushMetrics sends a signed snapshot of the node's metrics and chain head to an aggregator. The token, when
+// set, is sent as a bearer token.
+func pushMetrics(aggregator, token string) error {
+	var metrics strings.Builder
+	writeMetrics(&metrics)
+	mutex.Lock()
+	report := MetricsReport{NodeID: nodeID, Height: currentBlock.BlockNumber, HeadHash: previousBlockHash, Peers: len(peers), Metrics: metrics.String(), Timestamp: time.Now().Unix()}
+	mutex.Unlock()
+	report.Signature = hex.EncodeToString(ed25519.Sign(nodeKey, metricsReportMessage(report)))
+	body, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to encode metrics report: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), metricsPushTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, aggregator, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to push metrics: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("pushing metrics failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// peerURL builds the URL of an endpoint on a peer
+func peerURL(peer, path string) string {
+	return peerScheme + "://" + net.JoinHostPort(peer, peerPort) + path
+}
+
+// localNodeURL is the default URL of the local node for operator commands
+func localNodeURL() string {
+	return peerScheme + "://" + net.JoinHostPort("127.0.0.1", peerPort)
+}
+
+// outboundAllow lists networks peer and gateway requests may always reach, configurable with -outbound-allow
+var outboundAllow []netip.Prefix
+
+// outboundDeny lists networks peer and gateway requests never reach unless allowed: link-local addresses, which
+// include the 169.254.169.254 cloud metadata service, other metadata endpoints, and unspecified, multicast and
+// broadcast addresses. -outbound-deny adds more.
+var outboundDeny = parseNetworks("169.254.0.0/16", "fe80::/10", "fd00:ec2::254/128", "100.100.100.200/32",
+	"0.0.0.0/8", "::/128", "224.0.0.0/4", "ff00::/8", "255.255.255.255/32")
+
+var outboundPorts []string // Extra ports peer and gateway requests may use, such as a proxy's, set with -outbound-ports
+
+// parseNetworks parses CIDR networks or single addresses, panicking on invalid built-in values
+func parseNetworks(values ...string) []netip.Prefix {
+	networks, err := parseNetworkList(strings.Join(values, ","))
+	if err != nil {
+		panic(err)
+	}
+	return networks
+}
+
+// parseNetworkList parses a comma-separated list of CIDR networks or single addresses
+func parseNetworkList(list string) ([]netip.Prefix, error) {
+	var networks []netip.Prefix
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(strings.Trim(value, "[]"))
+			if err != nil || addr.Zone() != "" {
+				return nil, fmt.Errorf("invalid address %q", value)
+			}
+			addr = addr.Unmap()
+			networks = append(networks, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		network, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", value)
+		}
+		if network.Addr().Is4In6() && network.Bits() >= 96 {
+			network = netip.PrefixFrom(network.Addr().Unmap(), network.Bits()-96)
+		}
+		networks = append(networks, network.Masked())
+	}
+	return networks, nil
+}
+
+// outboundDenied reports whether the outbound policy blocks an address. IPv4-mapped IPv6 addresses are checked
+// as the IPv4 addresses they carry, so they cannot slip past IPv4 rules.
+func outboundDenied(addr netip.Addr) bool {
+	addr = addr.Unmap().WithZone("")
+	for _, network := range outboundAllow {
+		if network.Contains(addr) {
+			return false
+		}
+	}
+	for _, network := range outboundDeny {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// outboundPortAllowed reports whether a port is the peer port, the port of the configured IPFS API or gateways,
+// or one of the -outbound-ports
+func outboundPortAllowed(port string) bool {
+	allowed := append([]string{peerPort}, outboundPorts...)
+	for _, configured := range append([]string{ipfsAPIURL, ipfsGatewayURL}, ipfsFallbackGateways...) {
+		if u, err := url.Parse(strings.ReplaceAll(configured, "{cid}", "cid")); err == nil {
+			switch {
+			case u.Port() != "":
+				allowed = append(allowed, u.Port())
+			case u.Scheme == "https":
+				allowed = append(allowed, "443")
+			default:
+				allowed = append(allowed, "80")
+			}
+		}
+	}
+	for _, candidate := range allowed {
+		if candidate == port {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOutboundAddress enforces the outbound policy on every connection of the peer and gateway clients. It runs
+// after name resolution, so host names that resolve to blocked addresses are refused as well.
+func checkOutboundAddress(network, address string, _ syscall.RawConn) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("refusing to dial unresolved address %s", address)
+	}
+	if !outboundPortAllowed(port) {
+		return fmt.Errorf("refusing to dial %s: port %s is not a peer or IPFS port", address, port)
+	}
+	if outboundDenied(addr) {
+		return fmt.Errorf("refusing to dial %s: the address is blocked by the outbound policy", address)
+	}
+	return nil
+}
+
+// guarded makes a transport enforce the outbound policy on the connections it dials
+func guarded(transport *http.Transport) *http.Transport {
+	dialer := &net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second, Control: checkOutboundAddress}
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+// certFingerprint returns the hex-encoded SHA-256 fingerprint of a DER-encoded certificate
+func certFingerprint(der []byte) string {
+	return fmt.Sprintf("%x", sha256.Sum256(der))
+}
+
+// loadTLSPeers reads the known certificates, one "<sha256 fingerprint> <identity>" pair per line. Blank lines
+// and lines starting with # are ignored.
+func loadTLSPeers(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known certificates: %w", err)
+	}
+	identities := make(map[string]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d of %s: expected a fingerprint and an identity", i+1, path)
+		}
+		fingerprint := strings.ToLower(strings.ReplaceAll(fields[0], ":", ""))
+		if decoded, err := hex.DecodeString(fingerprint); err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("line %d of %s: invalid SHA-256 fingerprint %q", i+1, path, fields[0])
+		}
+		identities[fingerprint] = fields[1]
+	}
+	return identities, nil
+}
+
+// tlsIdentity returns the identity of a known certificate fingerprint
+func tlsIdentity(fingerprint string) (string, bool) {
+	if fingerprint == tlsOwnFingerprint {
+		return nodeID, true
+	}
+	identity, ok := tlsIdentities[fingerprint]
+	return identity, ok
+}
+
+// verifyKnownCertificate accepts only peers presenting one of the known certificates. It replaces chain
+// verification on both ends of a connection, so self-signed certificates can be used.
+func verifyKnownCertificate(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return errors.New("no certificate presented")
+	}
+	fingerprint := certFingerprint(rawCerts[0])
+	if _, ok := tlsIdentity(fingerprint); !ok {
+		return fmt.Errorf("unknown certificate %s", fingerprint)
+	}
+	return nil
+}
+
+// ClientTLSConfig returns the mutual TLS configuration of a client of the nodes: it presents the client certificate
+// and accepts only nodes whose certificates are listed in peersFile
+func ClientTLSConfig(certFile, keyFile, peersFile string) (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	identities, err := loadTLSPeers(peersFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates:       []tls.Certificate{certificate},
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true, // Nodes are checked against the known certificates by VerifyPeerCertificate
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("no certificate presented")
+			}
+			fingerprint := certFingerprint(rawCerts[0])
+			if _, ok := identities[fingerprint]; !ok {
+				return fmt.Errorf("unknown certificate %s", fingerprint)
+			}
+			return nil
+		},
+	}, nil
+}
+
+// configureTLS loads the node's certificate and the known certificates and switches peer and operator calls to
+// mutual TLS. The returned config is used to serve the API, which then rejects unknown certificates during the
+// handshake.
+func configureTLS(certFile, keyFile, peersFile string) (*tls.Config, error) {
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	identities, err := loadTLSPeers(peersFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsIdentities, tlsOwnFingerprint = identities, certFingerprint(certificate.Certificate[0])
+
+	config := &tls.Config{
+		Certificates:          []tls.Certificate{certificate},
+		MinVersion:            tls.VersionTLS12,
+		ClientAuth:            tls.RequireAnyClientCert,
+		InsecureSkipVerify:    true, // Servers are checked against the known certificates by VerifyPeerCertificate
+		VerifyPeerCertificate: verifyKnownCertificate,
+	}
+	transport := guarded(newTransport(false))
+	transport.TLSClientConfig = config
+	peerClient = &http.Client{Transport: transport}
+	nodeClient = peerClient
+	peerScheme = "https"
+	return config, nil
+}
+
+// requestIdentity identifies the sender of a request by its client certificate under mutual TLS, and by its IP
+// address otherwise
+func requestIdentity(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		if identity, ok := tlsIdentity(certFingerprint(r.TLS.PeerCertificates[0].Raw)); ok {
+			return identity
+		}
+	}
+	return clientIPFromRequest(r)
+}
+
+// handleStatus reports this node's identity and chain tip
+func handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	mutex.Lock()
+	status := NodeStatus{NodeID: nodeID, GenesisHash: genesisHash, Height: currentBlock.BlockNumber, HeadHash: previousBlockHash, Codecs: codecNames(), Features: nodeFeatures, Rules: supportedRules(), Version: nodeVersion, Runtimes: availableRuntimes, MiningHold: miningHeld(), Pressure: resourcePressure, MaxInputSize: maxInputSize, Maintenance: maintenanceMode, InFlight: inFlightJobs(), Shedding: scheduler.Shedding()}
+	if syncProgress != nil {
+		progress := *syncProgress
+		status.Sync = &progress
+	}
+	mutex.Unlock()
+
+	codec := negotiateCodec(r.Header.Get("Accept"))
+	w.Header().Set("Content-Type", codec.MediaType())
+	codec.NewEncoder(w).Encode(status)
+}
+
+// newTransport returns a transport that pools keep-alive connections with per-host limits and dial timeouts.
+// HTTPS connections negotiate HTTP/2; with h2c, plain HTTP connections speak HTTP/2 as well.
+func newTransport(h2c bool) *http.Transport {
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          maxIdleConns,
+		MaxIdleConnsPerHost:   maxIdleConnsPerHost,
+		MaxConnsPerHost:       maxConnsPerHost,
+		IdleConnTimeout:       idleTimeout,
+		TLSHandshakeTimeout:   dialTimeout,
+		ResponseHeaderTimeout: responseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+	if h2c {
+		transport.Protocols = new(http.Protocols)
+		transport.Protocols.SetUnencryptedHTTP2(true)
+		transport.Protocols.SetHTTP2(true)
+	}
+	return transport
+}
+
+// withDeadlines bounds each request's body size and the time its handler may spend reading the request
+// and writing the response, using the endpoint's own deadline where one is configured
+func withDeadlines(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout, ok := endpointTimeouts[r.URL.Path]
+		if !ok {
+			timeout = requestTimeout
+		}
+		if timeout > 0 {
+			controller := http.NewResponseController(w)
+			deadline := time.Now().Add(timeout)
+			controller.SetReadDeadline(deadline)
+			controller.SetWriteDeadline(deadline)
+		}
+		limit, ok := endpointBodyLimits[r.URL.Path]
+		if !ok {
+			limit = maxRequestBodyBytes
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		handler.ServeHTTP(w, r)
+	})
+}
+
+var basePath string               // Path prefix the API is served under behind a reverse proxy, such as /chain; empty for the root
+var corsOrigins []string          // Origins browser pages may call the API from, "*" for any; empty disables CORS
+var trustedProxies []netip.Prefix // Reverse proxies whose X-Forwarded-For header names the client
+
+// corsExposedHeaders are the response headers browser pages may read
+const corsExposedHeaders = "X-Job-ID, X-Chain-Height, X-Submission-Window, Idempotent-Replayed, Retry-After"
+
+// basePathKey is the request context key holding the base path a request arrived under
+type basePathKey struct{}
+
+// withBasePath strips basePath from the paths of requests that carry it, so a reverse proxy can serve the API
+// under a prefix. Requests without the prefix, such as those of peers connecting directly, are served as they are.
+func withBasePath(handler http.Handler) http.Handler {
+	if basePath == "" {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rest, ok := strings.CutPrefix(r.URL.Path, basePath); ok && (rest == "" || rest[0] == '/') {
+			if rest == "" {
+				rest = "/"
+			}
+			r = r.WithContext(context.WithValue(r.Context(), basePathKey{}, basePath))
+			stripped := *r.URL
+			stripped.Path, stripped.RawPath = rest, ""
+			r.URL = &stripped
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// requestBase returns the base path a request arrived under, for links in generated pages
+func requestBase(r *http.Request) string {
+	base, _ := r.Context().Value(basePathKey{}).(string)
+	return base
+}
+
+// corsMethods returns the methods an origin may use. Any origin matched by "*" may read; origins listed by name
+// may also submit, since a page running in a browser on the node's host passes the loopback checks of the
+// operator endpoints.
+func corsMethods(origin string) []string {
+	if origin == "" {
+		return nil
+	}
+	for _, allowed := range corsOrigins {
+		if allowed == origin {
+			return []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodDelete}
+		}
+	}
+	if supports(corsOrigins, "*") {
+		return []string{http.MethodGet, http.MethodHead}
+	}
+	return nil
+}
+
+// sameOrigin reports whether a request's Origin is the node itself, such as a form of the explorer
+func sameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host)
+}
+
+// withCORS lets the browser pages of the configured origins call the API: it answers their preflight requests
+// and marks the responses to their requests readable. Browsers send simple cross-site POSTs without asking first,
+// so requests that change state are refused from any other origin, even when CORS is off; without that, a page
+// the operator visits could reach the loopback-only operator endpoints through the operator's browser.
+func withCORS(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		safe := r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions
+		if origin != "" && !safe && !sameOrigin(r, origin) && !supports(corsMethods(origin), r.Method) {
+			http.Error(w, "Cross-origin request not allowed", http.StatusForbidden)
+			return
+		}
+		if len(corsOrigins) == 0 {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		methods := corsMethods(origin)
+		if requested := r.Header.Get("Access-Control-Request-Method"); r.Method == http.MethodOptions && requested != "" {
+			if !supports(methods, requested) {
+				http.Error(w, "Cross-origin request not allowed", http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+			if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			}
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if supports(methods, r.Method) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// listenAll listens on a comma-separated list of addresses such as ":8080" or "0.0.0.0:8080,[::1]:8080". A
+// wildcard address with an empty host is dual-stack and accepts IPv4 and IPv6 clients on one socket; listing
+// several addresses binds each of them and serves them as one listener.
+func listenAll(addresses string) (net.Listener, error) {
+	var listeners []net.Listener
+	for _, address := range strings.Split(addresses, ",") {
+		if address = strings.TrimSpace(address); address == "" {
+			continue
+		}
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("failed to listen on %s: %w", address, err)
+		}
+		listeners = append(listeners, listener)
+	}
+	switch len(listeners) {
+	case 0:
+		return nil, fmt.Errorf("no listen address given")
+	case 1:
+		return listeners[0], nil
+	}
+	m := &multiListener{listeners: listeners, conns: make(chan net.Conn), errs: make(chan error), closed: make(chan struct{})}
+	for _, listener := range listeners {
+		go m.accept(listener)
+	}
+	return m, nil
+}
+
+// multiListener merges the connections of several listeners
+type multiListener struct {
+	listeners []net.Listener
+	conns     chan net.Conn
+	errs      chan error
+	closed    chan struct{}
+	once      sync.Once
+}
+
+// accept forwards the connections of one listener until it is closed
+func (m *multiListener) accept(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			select {
+			case m.errs <- err:
+				continue
+			case <-m.closed:
+				return
+			}
+		}
+		select {
+		case m.conns <- conn:
+		case <-m.closed:
+			conn.Close()
+			return
+		}
+	}
+}
+
+func (m *multiListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-m.conns:
+		return conn, nil
+	case err := <-m.errs:
+		return nil, err
+	case <-m.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (m *multiListener) Close() error {
+	var err error
+	m.once.Do(func() {
+		close(m.closed)
+		for _, listener := range m.listeners {
+			if closeErr := listener.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+	})
+	return err
+}
+
+// Addr returns the address of the first listener
+func (m *multiListener) Addr() net.Addr {
+	return m.listeners[0].Addr()
+}
+
+// limitedListener caps the number of simultaneously open connections, making further clients wait in the backlog.
+// It also caps the connections of each client address, closing the ones over the cap at once, so a single client
+// cannot take every slot. Trusted proxies are exempt, because their connections carry many clients.
+type limitedListener struct {
+	net.Listener
+	slots     chan struct{}
+	perClient int
+
+	mu      sync.Mutex
+	clients map[netip.Addr]int // Open connections of each client address
+}
+
+// limitListener wraps a listener so that at most n connections are open at once, and at most perClient from any
+// one address (0 for no per-client cap)
+func limitListener(listener net.Listener, n, perClient int) net.Listener {
+	return &limitedListener{Listener: listener, slots: make(chan struct{}, n), perClient: perClient, clients: make(map[netip.Addr]int)}
+}
+
+func (l *limitedListener) Accept() (net.Conn, error) {
+	for {
+		l.slots <- struct{}{}
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			<-l.slots
+			return nil, err
+		}
+		addrPort, err := netip.ParseAddrPort(conn.RemoteAddr().String())
+		client := addrPort.Addr().Unmap()
+		if l.perClient <= 0 || err != nil || trustedProxy(client) {
+			return &limitedConn{Conn: conn, release: func() { <-l.slots }}, nil
+		}
+		l.mu.Lock()
+		if l.clients[client] >= l.perClient {
+			l.mu.Unlock()
+			conn.Close()
+			<-l.slots
+			continue
+		}
+		l.clients[client]++
+		l.mu.Unlock()
+		return &limitedConn{Conn: conn, release: func() {
+			l.mu.Lock()
+			if l.clients[client]--; l.clients[client] == 0 {
+				delete(l.clients, client)
+			}
+			l.mu.Unlock()
+			<-l.slots
+		}}, nil
+	}
+}
+
+// streamLimits caps the long-lived streams, /events and /job/stream, which would otherwise hold connection slots
+// for as long as their clients like: maxStreams in total and maxStreamsPerClient for each client
+var streamLimits = struct {
+	sync.Mutex
+	total   int
+	clients map[string]int
+}{clients: make(map[string]int)}
+
+var maxStreams = 64 // Simultaneous streams served, configurable with -max-streams
+
+// maxStreamsPerClient is the number of simultaneous streams one client may hold
+const maxStreamsPerClient = 4
+
+// limitStreams serves a streaming handler within the stream budget, answering 503 when it is spent
+func limitStreams(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client := clientIPFromRequest(r)
+		streamLimits.Lock()
+		if streamLimits.total >= maxStreams || streamLimits.clients[client] >= maxStreamsPerClient {
+			streamLimits.Unlock()
+			w.Header().Set("Retry-After", "30")
+			http.Error(w, "Too many open streams, try again later", http.StatusServiceUnavailable)
+			return
+		}
+		streamLimits.total++
+		streamLimits.clients[client]++
+		streamLimits.Unlock()
+		defer func() {
+			streamLimits.Lock()
+			streamLimits.total--
+			if streamLimits.clients[client]--; streamLimits.clients[client] == 0 {
+				delete(streamLimits.clients, client)
+			}
+			streamLimits.Unlock()
+		}()
+		handler(w, r)
+	}
+}
+
+// limitedConn frees its listener slot when closed
+type limitedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+// readOnly restricts a handler to GET and HEAD requests
+func readOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "This node is read-only", http.StatusMethodNotAllowed)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// explorerBlocks is the number of recent blocks listed by the explorer
+const explorerBlocks = 25
+
+// explorerAssets holds the explorer's page template and static files, embedded at build time so the binary serves
+// the explorer without any files next to it
+//
+//go:embed explorer
+var explorerAssets embed.FS
+
+// explorerTemplate renders the explorer's overview of the chain
+var explorerTemplate = template.Must(template.New("index.html").Funcs(template.FuncMap{
+	"time":   func(unix int64) string { return time.Unix(unix, 0).UTC().Format(time.RFC3339) },
+	"txid":   txID,
+	"labels": formatLabels,
+}).ParseFS(explorerAssets, "explorer/index.html"))
+
+// handleExplorer renders an HTML overview of the most recent blocks and the node's performance history and, with
+// ?label=key:value, of the transactions carrying a label
+func handleExplorer(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	page := struct {
+		Height    int
+		Finalized int
+		HeadHash  string
+		Blocks    []Block
+		Label     string
+		Matches   []TxLocation
+		Charts    []PerfChart
+		Base      string
+	}{Label: strings.TrimSpace(r.URL.Query().Get("label")), Base: requestBase(r)}
+	if page.Label != "" {
+		page.Matches = findByLabel(page.Label, maxLabelResult)
+	}
+	page.Charts = perfCharts(samplesSince(0))
+	mutex.Lock()
+	page.Height, page.Finalized, page.HeadHash = currentBlock.BlockNumber, finalizedHeight, previousBlockHash
+	for i := len(blockchain) - 1; i >= 0 && len(page.Blocks) < explorerBlocks; i-- {
+		page.Blocks = append(page.Blocks, blockchain[i])
+	}
+	mutex.Unlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := explorerTemplate.Execute(w, page); err != nil {
+		fmt.Printf("Error rendering explorer: %v\n", err)
+	}
+}
+
+// fetchPeerStatus retrieves the chain status of a peer
+func fetchPeerStatus(peer string) (NodeStatus, error) {
+	var status NodeStatus
+	resp, codec, err := peerGet(peer, "/status")
+	if err != nil {
+		return status, fmt.Errorf("failed to fetch status: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return status, fmt.Errorf("status request failed with status %d", resp.StatusCode)
+	}
+	if err := codec.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return status, fmt.Errorf("failed to decode status: %w", err)
+	}
+	if status.GenesisHash != genesisHash {
+		mutex.Lock()
+		if !peerCapabilities[peer].Foreign {
+			fmt.Printf("Refusing peer %s: it runs network %q, this node runs %s\n", peer, status.GenesisHash, genesisHash)
+		}
+		peerCapabilities[peer] = PeerCapabilities{Checked: time.Now(), Foreign: true}
+		mutex.Unlock()
+		return status, fmt.Errorf("peer %s is on another network", peer)
+	}
+	recordPeerCapabilities(peer, status)
+	return status, nil
+}
+
+// fetchRange downloads the records served by a block range endpoint of a peer for blocks from through to
+func fetchRange[T any](peer, endpoint string, from, to int) ([]T, error) {
+	resp, codec, err := peerGet(peer, fmt.Sprintf("%s?from=%d&to=%d", endpoint, from, to))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s request failed with status %d", endpoint, resp.StatusCode)
+	}
+
+	records := []T{}
+	decoder := codec.NewDecoder(resp.Body)
+	for {
+		var record T
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", endpoint, err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != to-from+1 {
+		return nil, fmt.Errorf("peer returned %d records from %s for range %d-%d", len(records), endpoint, from, to)
+	}
+	return records, nil
+}
+
+// fetchBlocks downloads the blocks numbered from through to from a peer in archive mode. The headers come first
+// and are checked before the bodies are requested, so a peer serving a bogus chain costs no body downloads.
+func fetchBlocks(peer string, from, to int) ([]Block, error) {
+	headers, err := fetchRange[BlockHeader](peer, "/headers", from, to)
+	if err != nil {
+		return nil, err
+	}
+	for i, header := range headers {
+		if header.BlockNumber != from+i || (i > 0 && header.PrevHash != headers[i-1].Hash) {
+			return nil, fmt.Errorf("header %d does not follow the previous header", from+i)
+		}
+		if err := validateHeader(header); err != nil {
+			return nil, fmt.Errorf("invalid header %d: %w", header.BlockNumber, err)
+		}
+	}
+
+	bodies, err := fetchRange[BlockBody](peer, "/bodies", from, to)
+	if err != nil {
+		return nil, err
+	}
+	blocks := make([]Block, len(headers))
+	for i := range headers {
+		blocks[i] = Block{BlockHeader: headers[i], BlockBody: bodies[i]}
+	}
+	return blocks, nil
+}
+
+// knownPeers returns a snapshot of the known peers
+func knownPeers() []string {
+	mutex.Lock()
+	defer mutex.Unlock()
+	known := make([]string, 0, len(peers))
+	for _, peer := range peers {
+		// Peers on another network are left out until their next handshake
+		if caps := peerCapabilities[peer]; caps.Foreign && time.Since(caps.Checked) < capabilityTTL {
+			continue
+		}
+		known = append(known, peer)
+	}
+	return known
+}
+
+// validPeerAddress reports whether a peer list entry is an IPv4 or IPv6 address or a plausible host name. Zoned
+// IPv6 addresses only mean something on the host that lists them, so they are refused.
+func validPeerAddress(address string) bool {
+	if addr, err := netip.ParseAddr(address); err == nil {
+		return addr.Zone() == "" && !outboundDenied(addr)
+	}
+	if address == "" || len(address) > maxPeerAddressLen || strings.HasPrefix(address, "-") {
+		return false
+	}
+	for _, c := range address {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizePeerAddress returns the canonical form of a peer address, so one peer is not listed twice under
+// different spellings: IPv6 addresses lose their brackets and are compressed, and IPv4-mapped IPv6 addresses
+// become plain IPv4 addresses
+func normalizePeerAddress(address string) string {
+	address = strings.TrimSpace(address)
+	if addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")); err == nil {
+		return addr.Unmap().String()
+	}
+	return strings.ToLower(address)
+}
+
+// peerListMessage returns the bytes signed by a peer list
+func peerListMessage(list PeerList) []byte {
+	return []byte(fmt.Sprintf("%s|%d|%s", list.NodeID, list.Timestamp, strings.Join(list.Peers, ",")))
+}
+
+// verifyPeerList checks a peer list's signature and freshness
+func verifyPeerList(list PeerList) error {
+	publicKey, err := hex.DecodeString(list.NodeID)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid peer list identity")
+	}
+	signature, err := hex.DecodeString(list.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid peer list signature encoding")
+	}
+	if !ed25519.Verify(publicKey, peerListMessage(list), signature) {
+		return fmt.Errorf("peer list signature is invalid")
+	}
+	if age := time.Since(time.Unix(list.Timestamp, 0)); age > maxPEXListAge || age < -maxPEXListAge {
+		return fmt.Errorf("peer list timestamp is %s away from local time", age)
+	}
+	return nil
+}
+
+// addPeers adds valid, previously unknown addresses to the peer list, accepting at most maxPEXAccept of them
+func addPeers(candidates []string) int {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	known := make(map[string]bool, len(peers))
+	for _, peer := range peers {
+		known[peer] = true
+	}
+	added := 0
+	for _, candidate := range candidates {
+		if added >= maxPEXAccept || len(peers) >= maxPeers {
+			break
+		}
+		candidate = normalizePeerAddress(candidate)
+		if known[candidate] || !validPeerAddress(candidate) {
+			continue
+		}
+		known[candidate] = true
+		peers = append(peers, candidate)
+		added++
+	}
+	return added
+}
+
+// handlePeers serves this node's signed peer list
+func handlePeers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	list := PeerList{NodeID: nodeID, Peers: knownPeers(), Timestamp: time.Now().Unix()}
+	list.Signature = hex.EncodeToString(ed25519.Sign(nodeKey, peerListMessage(list)))
+
+	codec := negotiateCodec(r.Header.Get("Accept"))
+	w.Header().Set("Content-Type", codec.MediaType())
+	codec.NewEncoder(w).Encode(list)
+}
+
+// exchangePeers fetches and verifies the peer list of every known peer, growing the local peer list
+func exchangePeers() {
+	for _, peer := range knownPeers() {
+		resp, codec, err := peerGet(peer, "/peers")
+		if err != nil {
+			fmt.Printf("Error fetching peer list from %s: %v\n", peer, err)
+			continue
+		}
+		var list PeerList
+		err = codec.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&list)
+		resp.Body.Close()
+		if err != nil {
+			fmt.Printf("Error decoding peer list from %s: %v\n", peer, err)
+			continue
+		}
+		if err := verifyPeerList(list); err != nil {
+			fmt.Printf("Rejected peer list from %s: %v\n", peer, err)
+			continue
+		}
+		if added := addPeers(list.Peers); added > 0 {
+			fmt.Printf("Learned %d new peers from %s\n", added, peer)
+		}
+	}
+}
+
+// TailscaleStatus is the part of the status served by the tailscaled LocalAPI that tailnet discovery reads
+type TailscaleStatus struct {
+	Peer map[string]TailscalePeer // Other devices of the tailnet, keyed by node key
+}
+
+// TailscalePeer is a device of the tailnet as reported by the LocalAPI
+type TailscalePeer struct {
+	HostName     string   // Host name of the device
+	TailscaleIPs []string // Tailnet addresses of the device, IPv4 first
+	Online       bool     // Whether the device is connected to the tailnet
+	Tags         []string // ACL tags of the device, such as tag:ipfs-miner
+}
+
+// TailnetPeerEvent is published as a peer-joined or peer-left event when a tagged tailnet device comes or goes
+type TailnetPeerEvent struct {
+	Address  string // Tailnet address used as the peer address
+	HostName string // Host name of the device
+}
+
+var tailscaleSocket = "/var/run/tailscale/tailscaled.sock" // Unix socket of the local tailscaled's LocalAPI
+var tailnetTag string                                      // ACL tag marking tailnet devices as miners; discovery is off when empty
+var tailnetPeers = make(map[string]bool)                   // Online tagged devices by address, true when discovery added them to peers; guarded by mutex
+
+// fetchTailscaleStatus reads the tailnet status from the tailscaled LocalAPI
+func fetchTailscaleStatus() (TailscaleStatus, error) {
+	var status TailscaleStatus
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", tailscaleSocket)
+		}},
+	}
+	// tailscaled only answers requests addressed to its own host name
+	resp, err := client.Get("http://local-tailscaled.sock/localapi/v0/status")
+	if err != nil {
+		return status, fmt.Errorf("failed to query tailscaled at %s: %w", tailscaleSocket, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return status, fmt.Errorf("tailscaled returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 16<<20)).Decode(&status); err != nil {
+		return status, fmt.Errorf("failed to decode the tailnet status: %w", err)
+	}
+	return status, nil
+}
+
+// discoverTailnetPeers makes the online tailnet devices carrying tailnetTag peers of this node and drops the
+// devices it added once they go offline or lose the tag, publishing a peer-joined or peer-left event for each
+// change. Peers configured or learned in other ways are never dropped.
+func discoverTailnetPeers() {
+	status, err := fetchTailscaleStatus()
+	if err != nil {
+		// Keep the current peers; tailscaled may just be restarting
+		fmt.Printf("Error discovering tailnet peers: %v\n", err)
+		return
+	}
+	current := make(map[string]TailscalePeer)
+	for _, device := range status.Peer {
+		if !device.Online || !supports(device.Tags, tailnetTag) || len(device.TailscaleIPs) == 0 {
+			continue
+		}
+		if address := normalizePeerAddress(device.TailscaleIPs[0]); validPeerAddress(address) {
+			current[address] = device
+		}
+	}
+
+	var joined, left []TailnetPeerEvent
+	mutex.Lock()
+	for address, device := range current {
+		if _, known := tailnetPeers[address]; known {
+			continue
+		}
+		added := !supports(peers, address) && len(peers) < maxPeers
+		if added {
+			peers = append(peers, address)
+		}
+		tailnetPeers[address] = added
+		joined = append(joined, TailnetPeerEvent{Address: address, HostName: device.HostName})
+	}
+	for address, added := range tailnetPeers {
+		if _, online := current[address]; online {
+			continue
+		}
+		if added {
+			kept := peers[:0]
+			for _, peer := range peers {
+				if peer != address {
+					kept = append(kept, peer)
+				}
+			}
+			peers = kept
+			forgetPeer(address)
+		}
+		delete(tailnetPeers, address)
+		left = append(left, TailnetPeerEvent{Address: address})
+	}
+	mutex.Unlock()
+
+	for _, event := range joined {
+		fmt.Printf("Tailnet peer %s (%s) joined\n", event.Address, event.HostName)
+		publishEvent("peer-joined", event)
+	}
+	for _, event := range left {
+		fmt.Printf("Tailnet peer %s left\n", event.Address)
+		publishEvent("peer-left", event)
+	}
+}
+
+// reportSyncProgress records the height a sync has reached, updates its rate and ETA and publishes it as a sync
+// event
+func reportSyncProgress(height int) {
+	mutex.Lock()
+	progress := syncProgress
+	progress.CurrentHeight = height
+	if elapsed := time.Since(progress.started).Seconds(); elapsed > 0 {
+		progress.BlocksPerSecond = float64(height-progress.StartHeight) / elapsed
+	}
+	if progress.BlocksPerSecond > 0 {
+		progress.ETA = float64(progress.TargetHeight-height) / progress.BlocksPerSecond
+	}
+	snapshot := *progress
+	mutex.Unlock()
+	fmt.Printf("Synced %d of %d blocks, %.1f blocks/s, about %s left\n", height, snapshot.TargetHeight,
+		snapshot.BlocksPerSecond, time.Duration(snapshot.ETA*float64(time.Second)).Round(time.Second))
+	publishEvent("sync", snapshot)
+}
+
+// syncBatch is a range of blocks downloaded by a sync worker
+type syncBatch struct {
+	from, to int
+	blocks   []Block
+	errs     []error // Validation result of each block
+	err      error
+	done     chan struct{}
+}
+
+// syncChain catches up with the tallest peer. Batches of blocks are downloaded and validated in parallel by a
+// bounded number of workers while appending happens sequentially, in order, as batches arrive.
+func syncChain(peers []string, workers int) error {
+	best, bestHeight := "", 0
+	for _, peer := range peers {
+		status, err := fetchPeerStatus(peer)
+		if err != nil {
+			fmt.Printf("Error fetching status from %s: %v\n", peer, err)
+			continue
+		}
+		if status.Height > bestHeight {
+			best, bestHeight = peer, status.Height
+		}
+	}
+
+	mutex.Lock()
+	start := currentBlock.BlockNumber + 1
+	mutex.Unlock()
+	if best == "" || bestHeight < start {
+		return nil
+	}
+	fmt.Printf("Syncing blocks %d-%d from %s\n", start, bestHeight, best)
+	mutex.Lock()
+	syncProgress = &SyncProgress{Peer: best, StartHeight: start - 1, CurrentHeight: start - 1, TargetHeight: bestHeight, started: time.Now()}
+	mutex.Unlock()
+	defer scheduler.Rush(rushSync)()
+	defer func() {
+		mutex.Lock()
+		syncProgress = nil
+		mutex.Unlock()
+	}()
+
+	batches := []*syncBatch{}
+	for from := start; from <= bestHeight; from += syncBatchSize {
+		to := from + syncBatchSize - 1
+		if to > bestHeight {
+			to = bestHeight
+		}
+		batches = append(batches, &syncBatch{from: from, to: to, done: make(chan struct{})})
+	}
+
+	// The window bounds how far downloads may run ahead of validation
+	queue := make(chan *syncBatch)
+	window := make(chan struct{}, workers*2)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		defer close(queue)
+		for _, batch := range batches {
+			select {
+			case window <- struct{}{}:
+			case <-stop:
+				return
+			}
+			select {
+			case queue <- batch:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	for i := 0; i < workers; i++ {
+		go func() {
+			for batch := range queue {
+				batch.blocks, batch.err = fetchBlocks(best, batch.from, batch.to)
+				if batch.err == nil {
+					batch.errs = validateBlocksConcurrently(batch.blocks, validationWorkers)
+				}
+				close(batch.done)
+			}
+		}()
+	}
+
+	for _, batch := range batches {
+		<-batch.done
+		<-window
+		if batch.err != nil {
+			return fmt.Errorf("failed to download blocks %d-%d: %w", batch.from, batch.to, batch.err)
+		}
+		// Commit in order; validation already ran concurrently alongside the downloads
+		for i, block := range batch.blocks {
+			err := batch.errs[i]
+			if err == nil {
+				err = commitBlock(block)
+			}
+			if err != nil {
+				return fmt.Errorf("invalid block %d from %s: %w", block.BlockNumber, best, err)
+			}
+		}
+		reportSyncProgress(batch.to)
+	}
+	fmt.Printf("Synced to block %d\n", bestHeight)
+	mutex.Lock()
+	progress := *syncProgress
+	mutex.Unlock()
+	publishEvent("synced", progress)
+	return nil
+}
+
+// validateHeaderProofOfWork checks a header's hash and that it satisfies the network difficulty
+func validateHeaderProofOfWork(header BlockHeader) error {
+	if hash := generateHash(header, header.Nonce); hash != header.Hash {
+		return fmt.Errorf("block hash mismatch: expected %s, got %s", hash, header.Hash)
+	}
+	if !validProof(header.Hash, header.Difficulty) {
+		return fmt.Errorf("block hash %s does not satisfy difficulty %d", header.Hash, header.Difficulty)
+	}
+	if expected := expectedDifficulty(header.BlockNumber); header.Difficulty != expected {
+		return fmt.Errorf("block difficulty %d does not match network difficulty %d", header.Difficulty, expected)
+	}
+	return nil
+}
+
+// expectedDifficulty returns the difficulty the block at a height must be mined at. The network keeps the
+// difficulty of its genesis parameters at every height; validation, the difficulty history and verify difficulty
+// all go through this function, so a retarget rule only needs to be added here.
+func expectedDifficulty(height int) int {
+	return networkParams.Difficulty
+}
+
+// DifficultyEvent is a change of the difficulty blocks were mined at, the first block counting as one
+type DifficultyEvent struct {
+	Height           int     // First block mined at the new difficulty
+	OldDifficulty    int     // Difficulty of the blocks before, 0 for the first block
+	NewDifficulty    int     // Difficulty from Height on
+	Blocks           int     // Blocks mined at the old difficulty
+	ObservedInterval float64 // Average seconds between the blocks mined at the old difficulty
+}
+
+// difficultyHistory lists the difficulty changes along a chain of consecutive headers starting at block 1
+func difficultyHistory(headers []BlockHeader) []DifficultyEvent {
+	events := []DifficultyEvent{}
+	start := 0
+	for i, header := range headers {
+		if i > 0 && header.Difficulty == headers[i-1].Difficulty {
+			continue
+		}
+		event := DifficultyEvent{Height: header.BlockNumber, NewDifficulty: header.Difficulty}
+		if i > 0 {
+			event.OldDifficulty, event.Blocks = headers[i-1].Difficulty, i-start
+			event.ObservedInterval = float64(header.Timestamp-headers[start].Timestamp) / float64(i-start)
+		}
+		events = append(events, event)
+		start = i
+	}
+	return events
+}
+
+// DifficultyHistory is the response of /difficulty/history
+type DifficultyHistory struct {
+	Height     int               // Height of the chain the history covers
+	Difficulty int               // Difficulty the next block must be mined at
+	Events     []DifficultyEvent // Difficulty changes, oldest first
+}
+
+// handleDifficultyHistory reports every difficulty change of the local chain so operators can audit retargets
+func handleDifficultyHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	mutex.Lock()
+	headers := make([]BlockHeader, len(blockchain))
+	for i, block := range blockchain {
+		headers[i] = block.BlockHeader
+	}
+	mutex.Unlock()
+
+	history := DifficultyHistory{Height: len(headers), Difficulty: expectedDifficulty(len(headers) + 1), Events: difficultyHistory(headers)}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// validateHeaderSignatures checks the signatures carried by a header
+func validateHeaderSignatures(header BlockHeader) error {
+	if err := validateCreatorSignature(header); err != nil {
+		return err
+	}
+	if timeOracleEnabled {
+		if err := validateTimeAttestation(header); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blockMessage returns the bytes the creator of a block signs. The hash commits to every other header field,
+// so the signature binds the creator to the whole header.
+func blockMessage(header BlockHeader) []byte {
+	return []byte("block|" + genesisHash + "|" + header.Hash)
+}
+
+// validateCreatorSignature checks that a header is signed by its creator, so only the holder of a node's key
+// can create blocks in its name
+func validateCreatorSignature(header BlockHeader) error {
+	publicKey, err := hex.DecodeString(header.Creator)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize || header.Creator != strings.ToLower(header.Creator) {
+		return fmt.Errorf("block %d creator %q is not a node identity", header.BlockNumber, header.Creator)
+	}
+	signature, err := hex.DecodeString(header.Signature)
+	if err != nil || !ed25519.Verify(publicKey, blockMessage(header), signature) {
+		return fmt.Errorf("block %d is not signed by its creator %s", header.BlockNumber, header.Creator)
+	}
+	return nil
+}
+
+// headerValidationStages are the checks that need only a block's header, so headers can be validated before
+// their bodies are downloaded
+var headerValidationStages = []func(BlockHeader) error{
+	validateHeaderSignatures,
+	validateHeaderProofOfWork,
+}
+
+// validateHeader runs every header validation stage on a header
+func validateHeader(header BlockHeader) error {
+	for _, stage := range headerValidationStages {
+		if err := stage(header); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateBlockHeader runs the header validation stages on a full block
+func validateBlockHeader(block Block) error {
+	return validateHeader(block.BlockHeader)
+}
+
+// validateBlockBody checks that the body is the one the header commits to
+func validateBlockBody(block Block) error {
+	if root := merkleRoot(block.Transactions); root != block.TxRoot {
+		return fmt.Errorf("block %d transactions have root %s, but the header commits to %s", block.BlockNumber, root, block.TxRoot)
+	}
+	return nil
+}
+
+// validateBlockTransactions checks the block size, its compute budget and each of its transactions. A transaction
+// may appear only once: the Merkle tree repeats the last node of odd levels, so a body with its last transactions
+// repeated has the same root as the original and would otherwise be accepted under the same block hash.
+func validateBlockTransactions(block Block) error {
+	if size := serializedSize(block); size > networkParams.MaxBlockSize {
+		return &SizeError{Kind: "block", ID: block.Hash, Size: size, Limit: networkParams.MaxBlockSize}
+	}
+	if units := blockCompute(block.Transactions); units > int64(networkParams.MaxBlockCompute) {
+		return fmt.Errorf("block %d uses %d compute units, exceeding the budget of %d", block.BlockNumber, units, networkParams.MaxBlockCompute)
+	}
+	seen := make(map[string]bool, len(block.Transactions))
+	for _, tx := range block.Transactions {
+		id := txID(tx)
+		if seen[id] {
+			return fmt.Errorf("block %d contains transaction %s more than once", block.BlockNumber, id)
+		}
+		seen[id] = true
+		if err := validateTransaction(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkConfirmed returns the transactions of a block that an earlier block of the chain already confirmed, such
+// as a job result billed twice; the caller must hold mutex
+func checkConfirmed(block Block) (map[string]bool, error) {
+	confirmed := make(map[string]bool)
+	for _, tx := range block.Transactions {
+		if number, ok := txIndex[txID(tx)]; ok && number < block.BlockNumber {
+			confirmed[txID(tx)] = true
+		}
+	}
+	if len(confirmed) > 0 {
+		return confirmed, fmt.Errorf("block %d contains %d transactions already confirmed by earlier blocks", block.BlockNumber, len(confirmed))
+	}
+	return nil, nil
+}
+
+// blockValidationStages are the stateless checks of a block. They do not depend on each other or on the
+// local chain, so they can run concurrently; linking a block to the chain happens in commitBlock.
+var blockValidationStages = []func(Block) error{
+	validateBlockHeader,
+	validateBlockBody,
+	validateBlockTransactions,
+	validateBlockHooks,
+	validateUpgrades,
+}
+
+// validateBlockHooks runs the custom block validators registered with ValidateBlock
+func validateBlockHooks(block Block) error {
+	for _, validator := range hooks.validateBlock {
+		if err := validator(block); err != nil {
+			return fmt.Errorf("block %d rejected by custom validation: %w", block.BlockNumber, err)
+		}
+	}
+	return nil
+}
+
+// ConsensusRule is a validation rule added after the chain started. It only applies from the height the
+// network schedules for it in NetworkParams.Upgrades, so nodes can upgrade ahead of time instead of all at once.
+type ConsensusRule struct {
+	Description string                  // What the rule enforces
+	ValidateTx  func(Transaction) error // Checks a transaction of a block at or above the activation height
+}
+
+// consensusRules are the rules this node can enforce, by the name networks schedule them under
+var consensusRules = map[string]ConsensusRule{
+	"recorded-network-policy": {
+		Description: "job transactions must record the network policy their script ran under",
+		ValidateTx: func(tx Transaction) error {
+			if tx.Type == TxJob && tx.Network == "" {
+				return fmt.Errorf("job transaction %s does not record its network policy", tx.JobID)
+			}
+			return nil
+		},
+	},
+	"usage-signature": {
+		Description: "job transactions must carry their executor's signature over the resources they consumed",
+		ValidateTx: func(tx Transaction) error {
+			if tx.Type == TxJob && tx.UsageSignature == "" {
+				return fmt.Errorf("job transaction %s carries no usage signature from its executor", tx.JobID)
+			}
+			return nil
+		},
+	},
+	"compute-units": {
+		Description: "job transactions must declare the compute units their measured CPU time buckets into",
+		ValidateTx: func(tx Transaction) error {
+			if tx.Type == TxJob && tx.ComputeUnits != computeUnits(tx.CPUTime) {
+				return fmt.Errorf("job transaction %s declares %d compute units for %dms of CPU time, which is %d", tx.JobID, tx.ComputeUnits, tx.CPUTime, computeUnits(tx.CPUTime))
+			}
+			return nil
+		},
+	},
+}
+
+// supportedRules returns the names of the consensus rules this node can enforce, sorted
+func supportedRules() []string {
+	names := make([]string, 0, len(consensusRules))
+	for name := range consensusRules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// activeRules returns the names of the scheduled rules in force at height, sorted, and the first of them this
+// node does not support (empty when it supports them all)
+func activeRules(height int) (active []string, unsupported string) {
+	for name, activation := range networkParams.Upgrades {
+		if height >= activation {
+			active = append(active, name)
+		}
+	}
+	sort.Strings(active)
+	for _, name := range active {
+		if _, ok := consensusRules[name]; !ok {
+			return active, name
+		}
+	}
+	return active, ""
+}
+
+// checkRules checks a transaction against the consensus rules in force at height
+func checkRules(tx Transaction, height int) error {
+	active, unsupported := activeRules(height)
+	if unsupported != "" {
+		return fmt.Errorf("consensus rule %s is active from block %d but not supported by this node; upgrade it", unsupported, networkParams.Upgrades[unsupported])
+	}
+	for _, name := range active {
+		if err := consensusRules[name].ValidateTx(tx); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// validateUpgrades checks a block against the consensus rules activated at or below its height
+func validateUpgrades(block Block) error {
+	for _, tx := range block.Transactions {
+		if err := checkRules(tx, block.BlockNumber); err != nil {
+			return fmt.Errorf("block %d violates consensus rule %w", block.BlockNumber, err)
+		}
+	}
+	if _, unsupported := activeRules(block.BlockNumber); unsupported != "" {
+		return fmt.Errorf("block %d is past the activation of consensus rule %s, which this node does not support; upgrade it", block.BlockNumber, unsupported)
+	}
+	return nil
+}
+
+// UpgradeStatus reports a scheduled consensus rule and how ready the network is for it
+type UpgradeStatus struct {
+	Rule        string   // Name of the rule
+	Description string   // What the rule enforces, empty when this node does not know it
+	Height      int      // Block height the rule activates at
+	Active      bool     // Whether the chain has reached the activation height
+	Supported   bool     // Whether this node enforces the rule
+	Peers       []string // Known peers advertising support for the rule
+	Lagging     []string // Known peers that do not advertise it and will reject or fork at activation
+}
+
+// handleUpgrades lists the scheduled consensus upgrades with the readiness of this node and its peers
+func handleUpgrades(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	mutex.Lock()
+	height := currentBlock.BlockNumber
+	upgrades := []UpgradeStatus{}
+	for name, activation := range networkParams.Upgrades {
+		rule, supported := consensusRules[name]
+		upgrade := UpgradeStatus{Rule: name, Description: rule.Description, Height: activation, Active: height >= activation, Supported: supported}
+		for peer, caps := range peerCapabilities {
+			if len(caps.Codecs) == 0 {
+				continue // Unreachable at the last handshake, so nothing is known about it
+			}
+			if supports(caps.Rules, name) {
+				upgrade.Peers = append(upgrade.Peers, peer)
+			} else {
+				upgrade.Lagging = append(upgrade.Lagging, peer)
+			}
+		}
+		sort.Strings(upgrade.Peers)
+		sort.Strings(upgrade.Lagging)
+		upgrades = append(upgrades, upgrade)
+	}
+	mutex.Unlock()
+	sort.Slice(upgrades, func(i, j int) bool {
+		if upgrades[i].Height != upgrades[j].Height {
+			return upgrades[i].Height < upgrades[j].Height
+		}
+		return upgrades[i].Rule < upgrades[j].Rule
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(upgrades)
+}
+
+// validateBlock runs every stateless validation stage on a block
+func validateBlock(block Block) error {
+	for _, stage := range blockValidationStages {
+		if err := stage(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateBlocksConcurrently runs every validation stage of every block across a pool of workers,
+// returning the first error found for each block (nil when the block is valid)
+func validateBlocksConcurrently(blocks []Block, workers int) []error {
+	type task struct{ block, stage int }
+	if workers < 1 {
+		workers = 1
+	}
+	stageErrs := make([][]error, len(blocks))
+	for i := range stageErrs {
+		stageErrs[i] = make([]error, len(blockValidationStages))
+	}
+
+	tasks := make(chan task)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range tasks {
+				stageErrs[t.block][t.stage] = blockValidationStages[t.stage](blocks[t.block])
+			}
+		}()
+	}
+	for i := range blocks {
+		for stage := range blockValidationStages {
+			tasks <- task{block: i, stage: stage}
+		}
+	}
+	close(tasks)
+	wg.Wait()
+
+	errs := make([]error, len(blocks))
+	for i, stages := range stageErrs {
+		errs[i] = errors.Join(stages...)
+	}
+	return errs
+}
+
+// loadOrCreateNodeKey loads the node's ed25519 key from path, generating and saving one on first run
+func loadOrCreateNodeKey(path string) (ed25519.PrivateKey, error) {
+	key, err := loadKeyFile(path)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return key, err
+	}
+
+	_, key, err = ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate node key: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key.Seed())), 0600); err != nil {
+		return nil, fmt.Errorf("failed to save node key: %w", err)
+	}
+	return key, nil
+}
+
+// loadKeyFile loads an ed25519 key saved as a hex-encoded seed, failing with fs.ErrNotExist if path is missing
+func loadKeyFile(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	seed, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid key in %s", path)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// queryNTPTime asks an NTP server for the current time using a single SNTP request
+func queryNTPTime(server string) (time.Time, error) {
+	conn, err := net.DialTimeout("udp", server, 5*time.Second)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to contact NTP server: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	request := make([]byte, 48)
+	request[0] = 0x1B // Leap indicator 0, version 3, client mode
+	if _, err := conn.Write(request); err != nil {
+		return time.Time{}, fmt.Errorf("failed to send NTP request: %w", err)
+	}
+
+	response := make([]byte, 48)
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return time.Time{}, fmt.Errorf("failed to read NTP response: %w", err)
+	}
+
+	// The transmit timestamp counts seconds since 1900 followed by a 32-bit fraction
+	const ntpEpochOffset = 2208988800
+	seconds := int64(binary.BigEndian.Uint32(response[40:44])) - ntpEpochOffset
+	fraction := int64(binary.BigEndian.Uint32(response[44:48]))
+	return time.Unix(seconds, (fraction*1e9)>>32), nil
+}
+
+// timeAttestationMessage returns the bytes signed by a time attestation
+func timeAttestationMessage(header BlockHeader, source string, attested int64) []byte {
+	return []byte(fmt.Sprintf("%d|%s|%s|%d", header.BlockNumber, header.PrevHash, source, attested))
+}
+
+// isTimeOracle reports whether key is one of the configured time oracle keys
+func isTimeOracle(key string) bool {
+	return slices.Contains(timeOracleKeys, strings.ToLower(key))
+}
+
+// attestTime queries the NTP server and signs the observed time for the block with the node's key
+func attestTime(header BlockHeader) (*TimeAttestation, error) {
+	now, err := queryNTPTime(ntpServer)
+	if err != nil {
+		return nil, err
+	}
+	attested := now.Unix()
+	signature := ed25519.Sign(nodeKey, timeAttestationMessage(header, ntpServer, attested))
+	return &TimeAttestation{
+		Source:    ntpServer,
+		Time:      attested,
+		PublicKey: hex.EncodeToString(nodeKey.Public().(ed25519.PublicKey)),
+		Signature: hex.EncodeToString(signature),
+	}, nil
+}
+
+// obtainTimeAttestation asks -time-oracle-peer to attest the time of a block, or attests it itself when the
+// node's own key is a configured time oracle
+func obtainTimeAttestation(header BlockHeader) (*TimeAttestation, error) {
+	if timeOraclePeer == "" {
+		if !isTimeOracle(hex.EncodeToString(nodeKey.Public().(ed25519.PublicKey))) {
+			return nil, fmt.Errorf("the node key is not a time oracle key and no -time-oracle-peer is set")
+		}
+		return attestTime(header)
+	}
+
+	resp, codec, err := peerGet(timeOraclePeer, fmt.Sprintf("/time-attestation?height=%d&prev=%s", header.BlockNumber, url.QueryEscape(header.PrevHash)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach time oracle %s: %w", timeOraclePeer, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("time oracle %s answered with status %d", timeOraclePeer, resp.StatusCode)
+	}
+	var attestation TimeAttestation
+	if err := codec.NewDecoder(resp.Body).Decode(&attestation); err != nil {
+		return nil, fmt.Errorf("failed to decode the attestation of time oracle %s: %w", timeOraclePeer, err)
+	}
+	header.TimeAttestation = &attestation
+	if err := validateTimeAttestation(header); err != nil {
+		return nil, fmt.Errorf("time oracle %s returned an unusable attestation: %w", timeOraclePeer, err)
+	}
+	return &attestation, nil
+}
+
+// handleTimeAttestation attests the current NTP time for the block at height on top of prev. Only nodes whose
+// key is one of -time-oracle-keys answer; the others respond 404.
+func handleTimeAttestation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if !isTimeOracle(hex.EncodeToString(nodeKey.Public().(ed25519.PublicKey))) {
+		http.Error(w, "This node is not a time oracle", http.StatusNotFound)
+		return
+	}
+	height, err := strconv.Atoi(r.URL.Query().Get("height"))
+	if err != nil || height < 1 {
+		http.Error(w, "Invalid height", http.StatusBadRequest)
+		return
+	}
+	attestation, err := attestTime(BlockHeader{BlockNumber: height, PrevHash: r.URL.Query().Get("prev")})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	codec := negotiateCodec(r.Header.Get("Accept"))
+	w.Header().Set("Content-Type", codec.MediaType())
+	codec.NewEncoder(w).Encode(attestation)
+}
+
+// validateTimeAttestation checks that a configured time oracle signed the attestation and that the block
+// timestamp is within tolerance of it
+func validateTimeAttestation(header BlockHeader) error {
+	attestation := header.TimeAttestation
+	if attestation == nil {
+		return fmt.Errorf("block %d has no time attestation", header.BlockNumber)
+	}
+	if !isTimeOracle(attestation.PublicKey) {
+		return fmt.Errorf("block %d is attested by %s, which is not a configured time oracle", header.BlockNumber, attestation.PublicKey)
+	}
+
+	publicKey, err := hex.DecodeString(attestation.PublicKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid time attestation public key")
+	}
+	signature, err := hex.DecodeString(attestation.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid time attestation signature encoding")
+	}
+	if !ed25519.Verify(publicKey, timeAttestationMessage(header, attestation.Source, attestation.Time), signature) {
+		return fmt.Errorf("time attestation signature is invalid")
+	}
+
+	drift := time.Duration(header.Timestamp-attestation.Time) * time.Second
+	if drift < 0 {
+		drift = -drift
+	}
+	if drift > timeTolerance {
+		return fmt.Errorf("block timestamp %d diverges from attested time %d by %s (tolerance %s)", header.Timestamp, attestation.Time, drift, timeTolerance)
+	}
+	return nil
+}
+
+// Block broadcasts go out in waves of peers ordered by latency
+const (
+	broadcastWaveSize    = 8               // Peers contacted in parallel per wave
+	broadcastWaveTimeout = 2 * time.Second // Longest a wave holds back the next one
+)
+
+// measuredLatency is a peer's smoothed latency and when it was last measured
+type measuredLatency struct {
+	rtt time.Duration
+	at  time.Time
+}
+
+// recordPeerLatency folds a measured round trip into the peer's smoothed latency. Only peers in the peer list are
+// tracked, since broadcasts go to no one else.
+func recordPeerLatency(peer string, rtt time.Duration) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if !supports(peers, peer) {
+		return
+	}
+	if smoothed, ok := peerLatency[peer]; ok {
+		rtt = (7*smoothed.rtt + rtt) / 8
+	}
+	peerLatency[peer] = measuredLatency{rtt: rtt, at: time.Now()}
+}
+
+// forgetPeer drops what the node measured about a peer removed from the peer list; the caller must hold mutex
+func forgetPeer(peer string) {
+	delete(peerLatency, peer)
+	delete(invalidPoWSeen, peer)
+}
+
+// prunePeerState drops latencies of peers that left the peer list or were not measured within peerStateTTL, and
+// invalid proof-of-work counts of announcing addresses that sent none within invalidPoWWindow
+func prunePeerState() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	now := time.Now()
+	for peer, latency := range peerLatency {
+		if !supports(peers, peer) || now.Sub(latency.at) > peerStateTTL {
+			delete(peerLatency, peer)
+		}
+	}
+	for peer, seen := range invalidPoWSeen {
+		if len(seen) == 0 || now.Sub(seen[len(seen)-1].at) >= invalidPoWWindow {
+			delete(invalidPoWSeen, peer)
+		}
+	}
+}
+
+// peersByLatency returns the known peers fastest first, with peers that were never measured last
+func peersByLatency() []string {
+	mutex.Lock()
+	defer mutex.Unlock()
+	ordered := append([]string(nil), peers...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, aok := peerLatency[ordered[i]]
+		b, bok := peerLatency[ordered[j]]
+		if aok != bok {
+			return aok
+		}
+		return a.rtt < b.rtt
+	})
+	return ordered
+}
+
+// Optional protocol features advertised in the status handshake
+const (
+	featureGzip          = "gzip"           // Accepts gzip-compressed block announcements
+	featureCompactBlocks = "compact-blocks" // Accepts blocks announced by the IDs of their transactions
+)
+
+// nodeFeatures lists the optional features this node supports
+var nodeFeatures = []string{featureGzip, featureCompactBlocks}
+
+// PeerCapabilities are the codecs and features a peer advertised in its last status handshake
+type PeerCapabilities struct {
+	Identity string // Node identity the peer reported in its status
+	Codecs   []string
+	Features []string
+	Rules    []string
+	Version  string
+	Runtimes []string
+	Checked  time.Time // When the peer was last asked; peers that could not be asked get no optional features
+	Foreign  bool      // Whether the peer reported another genesis hash, so it is refused until the next handshake
+}
+
+// capabilityTTL is how long a peer's advertised capabilities are trusted before the handshake is repeated
+const capabilityTTL = 10 * time.Minute
+
+var peerCapabilities = make(map[string]PeerCapabilities) // Capabilities of each peer, guarded by mutex
+
+// recordPeerCapabilities stores what a peer advertised in its status
+func recordPeerCapabilities(peer string, status NodeStatus) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if status.Version != "" && status.Version != nodeVersion && status.Version != peerCapabilities[peer].Version {
+		fmt.Printf("Peer %s runs version %s, this node runs %s\n", peer, status.Version, nodeVersion)
+	}
+	peerCapabilities[peer] = PeerCapabilities{Identity: status.NodeID, Codecs: status.Codecs, Features: status.Features, Rules: status.Rules, Version: status.Version, Runtimes: status.Runtimes, Checked: time.Now()}
+}
+
+// capabilitiesOf returns a peer's capabilities, repeating the status handshake when they are unknown or stale
+func capabilitiesOf(peer string) PeerCapabilities {
+	mutex.Lock()
+	caps, ok := peerCapabilities[peer]
+	mutex.Unlock()
+	if ok && time.Since(caps.Checked) < capabilityTTL {
+		return caps
+	}
+	if _, err := fetchPeerStatus(peer); err != nil {
+		// Fall back to plain JSON until the next handshake
+		mutex.Lock()
+		peerCapabilities[peer] = PeerCapabilities{Checked: time.Now()}
+		mutex.Unlock()
+		return PeerCapabilities{}
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	return peerCapabilities[peer]
+}
+
+// supports reports whether a capability list contains a name
+func supports(names []string, name string) bool {
+	for _, candidate := range names {
+		if candidate == name {
+			return true
+		}
+	}
+	return false
+}
+
+// wireFormat is an encoding of a block announcement
+type wireFormat struct {
+	codec   Codec
+	gzip    bool
+	compact bool
+}
+
+// announcementFormat picks the most compact encoding a peer supports: CBOR over JSON, gzip compression and
+// compact blocks, each only when the peer advertised it
+func announcementFormat(caps PeerCapabilities) wireFormat {
+	format := wireFormat{codec: jsonCodec{}}
+	if supports(caps.Codecs, cborCodec{}.Name()) {
+		format.codec = cborCodec{}
+	}
+	format.gzip = supports(caps.Features, featureGzip)
+	format.compact = supports(caps.Features, featureCompactBlocks)
+	return format
+}
+
+// CompactBlock announces a block by the IDs of its transactions, which the receiver takes from its own pool
+type CompactBlock struct {
+	Header BlockHeader // Header of the announced block
+	TxIDs  []string    // IDs of the block's transactions, in order
+}
+
+// blockEncodings encodes one block once per wire format used during a broadcast
+type blockEncodings struct {
+	block   Block
+	mu      sync.Mutex
+	encoded map[wireFormat][]byte
+}
+
+// encode returns the block in a wire format
+func (e *blockEncodings) encode(format wireFormat) ([]byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if body, ok := e.encoded[format]; ok {
+		return body, nil
+	}
+	var message interface{} = BlockAnnouncement{Header: e.block.BlockHeader, Body: e.block.BlockBody}
+	if format.compact {
+		compact := CompactBlock{Header: e.block.BlockHeader}
+		for _, tx := range e.block.Transactions {
+			compact.TxIDs = append(compact.TxIDs, txID(tx))
+		}
+		message = compact
+	}
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var gz *gzip.Writer
+	if format.gzip {
+		gz = gzip.NewWriter(&buf)
+		w = gz
+	}
+	if err := format.codec.NewEncoder(w).Encode(message); err != nil {
+		return nil, err
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+	}
+	e.encoded[format] = buf.Bytes()
+	return buf.Bytes(), nil
+}
+
+// announceBlock sends a block to a peer in the best format it supports, measuring the peer's latency along the
+// way. A compact block the peer cannot rebuild from its pool is sent again in full.
+func announceBlock(peer string, encodings *blockEncodings) error {
+	format := announcementFormat(capabilitiesOf(peer))
+	status, err := postAnnouncement(peer, encodings, format)
+	if err == nil && status == http.StatusPreconditionFailed && format.compact {
+		format.compact = false
+		status, err = postAnnouncement(peer, encodings, format)
+	}
+	if err != nil {
+		return err
+	}
+	// A conflict means the peer already has the block or has moved past it
+	if status != http.StatusOK && status != http.StatusConflict {
+		return fmt.Errorf("block announcement failed with status %d", status)
+	}
+	return nil
+}
+
+// postAnnouncement posts a block to a peer's /announce in one wire format, returning the response status
+func postAnnouncement(peer string, encodings *blockEncodings, format wireFormat) (int, error) {
+	body, err := encodings.encode(format)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode block: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, peerURL(peer, "/announce"), bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", format.codec.MediaType())
+	if format.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if format.compact {
+		req.Header.Set("X-Block-Encoding", featureCompactBlocks)
+	}
+	started := time.Now()
+	resp, err := peerClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to announce block: %w", err)
+	}
+	resp.Body.Close()
+	recordPeerLatency(peer, time.Since(started))
+	return resp.StatusCode, nil
+}
+
+// rebuildCompactBlock fills in the transactions of a compact block from the pool, listing the IDs it lacks
+func rebuildCompactBlock(compact CompactBlock) (Block, []string) {
+	mutex.Lock()
+	pooled := make(map[string]Transaction, len(transactionPool))
+	for _, tx := range transactionPool {
+		pooled[txID(tx)] = tx
+	}
+	mutex.Unlock()
+	block := Block{BlockHeader: compact.Header}
+	var missing []string
+	for _, id := range compact.TxIDs {
+		tx, ok := pooled[id]
+		if !ok {
+			missing = append(missing, id)
+			continue
+		}
+		block.Transactions = append(block.Transactions, tx)
+	}
+	return block, missing
+}
+
+// BlockAnnouncement carries a block to peers with its header and body as separate parts
+type BlockAnnouncement struct {
+	Header BlockHeader // Header of the announced block
+	Body   BlockBody   // Transactions of the announced block
+}
+
+// Gossiped blocks and transactions are remembered for a while so messages that loop back are dropped
+const (
+	seenCacheSize = 16384            // Hashes remembered per message kind
+	seenTTL       = 10 * time.Minute // How long a hash counts as seen
+)
+
+// seenCache is a rolling record of recently seen block or transaction hashes. Gossip that loops back to a node
+// (A→B→C→A) is dropped at the first repeat instead of being validated and relayed again.
+type seenCache struct {
+	recent     *lruCache[string, time.Time]
+	duplicates atomic.Uint64 // Messages dropped as duplicates
+}
+
+var seenBlocks = newSeenCache(seenCacheSize) // Hashes of blocks accepted, mined or relayed by this node
+var seenTxs = newSeenCache(seenCacheSize)    // IDs of transactions admitted to the pool
+
+// newSeenCache creates a seen cache remembering at most capacity hashes
+func newSeenCache(capacity int) *seenCache {
+	return &seenCache{recent: newLRUCache[string, time.Time](capacity)}
+}
+
+// Seen reports whether hash was seen within seenTTL, counting the message as a suppressed duplicate if so
+func (c *seenCache) Seen(hash string) bool {
+	if at, ok := c.recent.Get(hash); ok && time.Since(at) < seenTTL {
+		c.duplicates.Add(1)
+		return true
+	}
+	return false
+}
+
+// Add records hash as seen now
+func (c *seenCache) Add(hash string) {
+	c.recent.Put(hash, time.Now())
+}
+
+// broadcastBlock broadcasts a block to the other miners, fastest peers first, in parallel waves so it reaches
+// most of the network's hash power quickly
+func broadcastBlock(block Block) {
+	seenBlocks.Add(block.Hash)
+	encodings := &blockEncodings{block: block, encoded: make(map[wireFormat][]byte)}
+	ordered := peersByLatency()
+	fmt.Printf("Broadcasting block %d to %d peers\n", block.BlockNumber, len(ordered))
+	for start := 0; start < len(ordered); start += broadcastWaveSize {
+		var wg sync.WaitGroup
+		for _, peer := range ordered[start:min(start+broadcastWaveSize, len(ordered))] {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := announceBlock(peer, encodings); err != nil {
+					fmt.Printf("Error broadcasting block %d to %s: %v\n", block.BlockNumber, peer, err)
+				}
+			}()
+		}
+		// Slow peers of one wave do not hold back the next wave for long
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(broadcastWaveTimeout):
+		}
+	}
+}
+
+// handleAnnounce accepts a block announced by a peer and relays it when it extends the local chain
+func handleAnnounce(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, "Failed to decompress block", http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		// The decompressed block is held to the same limit as an uncompressed announcement
+		body = io.LimitReader(gz, 2*int64(networkParams.MaxBlockSize))
+	}
+	codec := codecForMediaType(r.Header.Get("Content-Type"))
+
+	var block Block
+	if r.Header.Get("X-Block-Encoding") == featureCompactBlocks {
+		var compact CompactBlock
+		if err := codec.NewDecoder(body).Decode(&compact); err != nil {
+			http.Error(w, "Failed to decode block", http.StatusBadRequest)
+			return
+		}
+		if seenBlocks.Seen(compact.Header.Hash) {
+			http.Error(w, "Block already seen", http.StatusConflict)
+			return
+		}
+		var missing []string
+		if block, missing = rebuildCompactBlock(compact); len(missing) > 0 {
+			// The sender retries with the full block
+			http.Error(w, fmt.Sprintf("Missing %d transactions of the block", len(missing)), http.StatusPreconditionFailed)
+			return
+		}
+	} else {
+		var announcement BlockAnnouncement
+		if err := codec.NewDecoder(body).Decode(&announcement); err != nil {
+			http.Error(w, "Failed to decode block", http.StatusBadRequest)
+			return
+		}
+		block = Block{BlockHeader: announcement.Header, BlockBody: announcement.Body}
+		if seenBlocks.Seen(block.Hash) {
+			http.Error(w, "Block already seen", http.StatusConflict)
+			return
+		}
+	}
+	inspectAnnouncement(clientIPFromRequest(r), block.BlockHeader)
+	if err := acceptBlock(block); err != nil {
+		observeFork(clientIPFromRequest(r), block.BlockHeader)
+		http.Error(w, fmt.Sprintf("Block rejected: %v", err), http.StatusConflict)
+		return
+	}
+
+	fmt.Printf("Accepted block %d from %s\n", block.BlockNumber, clientIPFromRequest(r))
+	go broadcastBlock(block)
+	go recordBlockCID(block)
+	w.WriteHeader(http.StatusOK)
+}
+
+// uploadBlockToIPFS uploads a block to IPFS as JSON and returns its CID. Every node encodes a block the same way,
+// so uploads of the same block by different nodes yield the same CID.
+func uploadBlockToIPFS(block Block) (string, error) {
+	data, err := json.Marshal(block)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode block %d: %w", block.BlockNumber, err)
+	}
+	return uploadBytesToIPFS("block.json", data)
+}
+
+// pinBlock uploads a block added to the chain and logs the pin, so the garbage collector can remove it once a
+// reorg takes the block off the chain
+func pinBlock(block Block) (string, error) {
+	cid, err := uploadBlockToIPFS(block)
+	if err != nil {
+		return "", err
+	}
+	pinned := PublishedBlock{Height: block.BlockNumber, Hash: block.Hash, CID: cid, Time: time.Now().Unix()}
+	if err := recordPublishedBlock(pinned); err != nil {
+		fmt.Printf("Error recording uploaded block %d: %v\n", block.BlockNumber, err)
+	}
+	return cid, nil
+}
+
+// recordBlockCID uploads a block accepted from a peer and, while it is still the tip, makes its CID the PrevCID
+// of the next block mined on it
+func recordBlockCID(block Block) {
+	cid, err := pinBlock(block)
+	if err != nil {
+		fmt.Printf("Error uploading block %d to IPFS: %v\n", block.BlockNumber, err)
+		return
+	}
+	mutex.Lock()
+	if previousBlockHash == block.Hash {
+		previousBlockCID = cid
+	}
+	mutex.Unlock()
+}
+
+// addTransaction adds a new transaction to the transaction pool
+func addTransaction(transaction Transaction) error {
+	if err := validateTransaction(transaction); err != nil {
+		return err
+	}
+	mutex.Lock()
+	err := admitTransaction(transaction)
+	mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	seenTxs.Add(txID(transaction))
+	for _, hook := range hooks.onTxAccepted {
+		hook(transaction)
+	}
+	return nil
+}
+
+// admitTransaction inserts a valid transaction into the pool, checking transfers against the sender's nonce
+// sequence and balance; transfers ahead of the sender's next nonce are held until their predecessors arrive.
+// The caller must hold mutex.
+func admitTransaction(transaction Transaction) (err error) {
+	if err := checkRules(transaction, currentBlock.BlockNumber+1); err != nil {
+		return err
+	}
+	if err := checkRevoked(transaction); err != nil {
+		return err
+	}
+	defer func() {
+		// Held transfers keep the time they arrived when they are promoted
+		if _, ok := poolAdmitted[txID(transaction)]; err == nil && !ok {
+			poolAdmitted[txID(transaction)] = time.Now()
+		}
+	}()
+	if transaction.Type == TxTransfer {
+		id := txID(transaction)
+		if _, confirmed := txIndex[id]; confirmed {
+			return fmt.Errorf("transfer %s is already confirmed", id)
+		}
+		if transaction.Nonce <= nonces[transaction.From] {
+			return fmt.Errorf("nonce %d of %s was already used", transaction.Nonce, transaction.From)
+		}
+		next := nextNonce(transaction.From)
+		switch {
+		case transaction.Nonce < next:
+			return fmt.Errorf("a transfer with nonce %d of %s is already pending", transaction.Nonce, transaction.From)
+		case transaction.Nonce >= next+maxFutureNonces:
+			return fmt.Errorf("nonce %d is too far ahead of the next nonce %d", transaction.Nonce, next)
+		case transaction.Nonce > next:
+			// Holding costs memory until the gap closes, so only funded senders may do it, and only so much
+			if balance := balances[transaction.From]; transaction.Fee > balance || transaction.Amount > balance-transaction.Fee {
+				return fmt.Errorf("transfer with future nonce %d is not covered by the confirmed balance of %s", transaction.Nonce, transaction.From)
+			}
+			expireHeldTransfers(time.Now())
+			if _, held := futureTransfers[transaction.From][transaction.Nonce]; !held && heldTransferCount() >= maxHeldTransfers {
+				return fmt.Errorf("this node already holds %d transfers with future nonces", maxHeldTransfers)
+			}
+			if futureTransfers[transaction.From] == nil {
+				futureTransfers[transaction.From] = make(map[int64]Transaction)
+			}
+			futureTransfers[transaction.From][transaction.Nonce] = transaction
+			return nil
+		}
+
+		// Transfers must be covered by the sender's balance after the transfers already waiting in the pool
+		available := balances[transaction.From]
+		for _, pooled := range transactionPool {
+			if pooled.Type == TxTransfer && pooled.From == transaction.From {
+				available -= pooled.Amount + pooled.Fee
+			}
+		}
+		if transaction.Fee > available || transaction.Amount > available-transaction.Fee {
+			return fmt.Errorf("insufficient balance: %d available, %d plus a fee of %d requested", available, transaction.Amount, transaction.Fee)
+		}
+	}
+	// Keep the pool ordered by descending paid fee, first come first served among equal fees
+	position := sort.Search(len(transactionPool), func(i int) bool { return paidFee(transactionPool[i]) < paidFee(transaction) })
+	transactionPool = append(transactionPool, Transaction{})
+	copy(transactionPool[position+1:], transactionPool[position:])
+	transactionPool[position] = transaction
+	if transaction.Type == TxTransfer {
+		promoteFutureTransfers(transaction.From)
+	}
+	return nil
+}
+
+// paidFee returns the fee a transaction pays the block creator. Only transfers pay theirs from a balance; the fee
+// a job's submitter offers is billed off chain, so it does not buy the job a place in the pool.
+func paidFee(tx Transaction) int64 {
+	if tx.Type != TxTransfer {
+		return 0
+	}
+	return tx.Fee
+}
+
+// nextNonce returns the nonce the next transfer of address must use, after its confirmed and pooled transfers;
+// the caller must hold mutex
+func nextNonce(address string) int64 {
+	next := nonces[address] + 1
+	for _, pooled := range transactionPool {
+		if pooled.Type == TxTransfer && pooled.From == address && pooled.Nonce >= next {
+			next = pooled.Nonce + 1
+		}
+	}
+	return next
+}
+
+// heldTransferCount returns the number of transfers held for all senders; the caller must hold mutex
+func heldTransferCount() int {
+	count := 0
+	for _, held := range futureTransfers {
+		count += len(held)
+	}
+	return count
+}
+
+// expireHeldTransfers drops the transfers held for longer than heldTransferTTL; the caller must hold mutex
+func expireHeldTransfers(now time.Time) {
+	for address, held := range futureTransfers {
+		for nonce, tx := range held {
+			if admitted, ok := poolAdmitted[txID(tx)]; ok && now.Sub(admitted) > heldTransferTTL {
+				delete(held, nonce)
+				delete(poolAdmitted, txID(tx))
+			}
+		}
+		if len(held) == 0 {
+			delete(futureTransfers, address)
+		}
+	}
+}
+
+// promoteFutureTransfers moves held transfers of address into the pool once their nonce is next, dropping those
+// the sender can no longer pay for; the caller must hold mutex
+func promoteFutureTransfers(address string) {
+	held := futureTransfers[address]
+	for nonce := range held {
+		if nonce <= nonces[address] {
+			delete(held, nonce)
+		}
+	}
+	next := nextNonce(address)
+	if tx, ok := held[next]; ok {
+		delete(held, next)
+		// admitTransaction promotes the following nonces in turn
+		if err := admitTransaction(tx); err != nil {
+			fmt.Printf("Dropping held transfer %s: %v\n", txID(tx), err)
+			delete(poolAdmitted, txID(tx))
+		}
+	}
+	if len(held) == 0 {
+		delete(futureTransfers, address)
+	}
+}
+
+// reconcilePool brings the pool back in line with the confirmed nonces after the chain changed: transfers whose
+// nonce was used by a confirmed transfer are dropped, transfers left behind a gap are held again, and held
+// transfers that became next are promoted. The caller must hold mutex.
+func reconcilePool() {
+	senders := make(map[string][]Transaction)
+	for _, tx := range transactionPool {
+		if tx.Type == TxTransfer {
+			senders[tx.From] = append(senders[tx.From], tx)
+		}
+	}
+	dropped := make(map[string]bool)
+	for address, transfers := range senders {
+		sort.Slice(transfers, func(i, j int) bool { return transfers[i].Nonce < transfers[j].Nonce })
+		next := nonces[address] + 1
+		for _, tx := range transfers {
+			switch {
+			case tx.Nonce == next:
+				next++
+				continue
+			case tx.Nonce > next:
+				if futureTransfers[address] == nil {
+					futureTransfers[address] = make(map[int64]Transaction)
+				}
+				futureTransfers[address][tx.Nonce] = tx
+			}
+			// Transfers below next were superseded by a confirmed transfer with the same nonce
+			dropped[txID(tx)] = true
+		}
+	}
+	removeFromPool(dropped)
+	expireHeldTransfers(time.Now())
+	for address := range futureTransfers {
+		promoteFutureTransfers(address)
+	}
+}
+
+// selectTransactions picks up to limit pooled transactions for a block, highest fee first, taking each sender's
+// transfers in nonce order and keeping the jobs within the block's compute budget; the caller must hold mutex
+func selectTransactions(limit int) []Transaction {
+	var selected []Transaction
+	var units int64
+	taken := make(map[int]bool)
+	next := make(map[string]int64)
+	// A low-fee transfer may unblock a later high-fee one of the same sender, so scan until nothing more fits
+	for progress := true; progress && len(selected) < limit; {
+		progress = false
+		for i, tx := range transactionPool {
+			if taken[i] || len(selected) == limit {
+				continue
+			}
+			if units+tx.ComputeUnits > int64(networkParams.MaxBlockCompute) {
+				// A smaller job further down the pool may still fit the remaining budget
+				continue
+			}
+			if tx.Type == TxTransfer {
+				if _, ok := next[tx.From]; !ok {
+					next[tx.From] = nonces[tx.From] + 1
+				}
+				if tx.Nonce != next[tx.From] {
+					continue
+				}
+				next[tx.From]++
+			}
+			taken[i] = true
+			selected = append(selected, tx)
+			units += tx.ComputeUnits
+			progress = true
+		}
+	}
+	return selected
+}
+
+// FeeEstimate is a suggested transfer fee for inclusion within a number of blocks
+type FeeEstimate struct {
+	Blocks           int   // Number of blocks the estimate targets
+	Fee              int64 // Suggested fee
+	PoolSize         int   // Number of transactions waiting in the pool
+	RecentMinimumFee int64 // Lowest fee paid by a transfer in the recent blocks
+}
+
+// estimateFee suggests a fee that outbids enough of the pool to be mined within the given number of blocks
+// and is no lower than what recent blocks accepted; the caller must hold mutex
+func estimateFee(targetBlocks int) FeeEstimate {
+	estimate := FeeEstimate{Blocks: targetBlocks, PoolSize: len(transactionPool), RecentMinimumFee: -1}
+	for i := len(blockchain) - 1; i >= 0 && i >= len(blockchain)-feeHistoryBlocks; i-- {
+		for _, tx := range blockchain[i].Transactions {
+			if tx.Type == TxTransfer && (estimate.RecentMinimumFee < 0 || tx.Fee < estimate.RecentMinimumFee) {
+				estimate.RecentMinimumFee = tx.Fee
+			}
+		}
+	}
+	if estimate.RecentMinimumFee < 0 {
+		estimate.RecentMinimumFee = 0
+	}
+	estimate.Fee = estimate.RecentMinimumFee
+
+	// The pool is ordered by paid fee, so a transfer must outbid the last transaction that would still fit
+	if slots := targetBlocks * blockTransactions; len(transactionPool) >= slots {
+		if outbid := paidFee(transactionPool[slots-1]) + 1; outbid > estimate.Fee {
+			estimate.Fee = outbid
+		}
+	}
+	return estimate
+}
+
+// handleFeeEstimate suggests a transfer fee for inclusion within ?blocks= blocks (default 1)
+func handleFeeEstimate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	targetBlocks := 1
+	if value := r.URL.Query().Get("blocks"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > feeHistoryBlocks {
+			http.Error(w, fmt.Sprintf("blocks must be between 1 and %d", feeHistoryBlocks), http.StatusBadRequest)
+			return
+		}
+		targetBlocks = n
+	}
+
+	mutex.Lock()
+	estimate := estimateFee(targetBlocks)
+	mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(estimate)
+}
+
+// blockTxIDs returns the IDs of the transactions in a block
+func blockTxIDs(block Block) map[string]bool {
+	ids := make(map[string]bool, len(block.Transactions))
+	for _, tx := range block.Transactions {
+		ids[txID(tx)] = true
+	}
+	return ids
+}
+
+// removeFromPool drops the transactions with the given IDs from the pool; the caller must hold mutex
+func removeFromPool(ids map[string]bool) {
+	kept := transactionPool[:0:0]
+	for _, tx := range transactionPool {
+		if !ids[txID(tx)] {
+			kept = append(kept, tx)
+		} else {
+			delete(poolAdmitted, txID(tx))
+		}
+	}
+	transactionPool = kept
+}
+
+// MempoolEntry describes a transaction waiting to be mined
+type MempoolEntry struct {
+	ID           string // Transaction ID, the job ID for job results
+	Type         string // Transaction type, job for job results
+	Fee          int64  // Fee offered to the block creator
+	Size         int    // Serialized size in bytes
+	ComputeUnits int64  // Share of the block compute budget the transaction takes
+	Age          int64  // Seconds since the transaction entered this node
+	From         string // Sender of a transfer
+	Nonce        int64  // Nonce of a transfer
+	Held         bool   // Whether the transfer is held until its sender's earlier nonces arrive
+}
+
+// MempoolReport lists the transactions waiting to be mined
+type MempoolReport struct {
+	Transactions []MempoolEntry // Pooled transactions in mining order, followed by the held transfers
+	Pooled       int            // Number of transactions in the pool
+	Held         int            // Number of held transfers
+	Size         int            // Serialized size of all listed transactions in bytes
+	ComputeUnits int64          // Compute units of the pooled transactions
+}
+
+// MempoolRemoval reports the transactions an operator removed from the mempool
+type MempoolRemoval struct {
+	Removed    []string // IDs of the removed transactions
+	FailedJobs []string // Jobs of this node marked failed because their result was removed
+}
+
+// mempoolEntry describes a pooled or held transaction; the caller must hold mutex
+func mempoolEntry(tx Transaction, held bool, now time.Time) MempoolEntry {
+	entry := MempoolEntry{ID: txID(tx), Type: tx.Type, Fee: tx.Fee, Size: serializedSize(tx), ComputeUnits: tx.ComputeUnits, Held: held}
+	switch tx.Type {
+	case TxJob:
+		entry.Type = "job"
+	case TxTransfer:
+		entry.From, entry.Nonce = tx.From, tx.Nonce
+	case TxRevocation:
+		entry.From = tx.From
+	}
+	if admitted, ok := poolAdmitted[entry.ID]; ok {
+		entry.Age = int64(now.Sub(admitted).Seconds())
+	}
+	return entry
+}
+
+// mempoolReport lists the pool and the held transfers; the caller must hold mutex
+func mempoolReport() MempoolReport {
+	now := time.Now()
+	report := MempoolReport{Transactions: []MempoolEntry{}, Pooled: len(transactionPool)}
+	for _, tx := range transactionPool {
+		entry := mempoolEntry(tx, false, now)
+		report.Transactions = append(report.Transactions, entry)
+		report.Size += entry.Size
+		report.ComputeUnits += entry.ComputeUnits
+	}
+	var held []MempoolEntry
+	for _, transfers := range futureTransfers {
+		for _, tx := range transfers {
+			held = append(held, mempoolEntry(tx, true, now))
+		}
+	}
+	sort.Slice(held, func(i, j int) bool {
+		if held[i].From != held[j].From {
+			return held[i].From < held[j].From
+		}
+		return held[i].Nonce < held[j].Nonce
+	})
+	for _, entry := range held {
+		report.Size += entry.Size
+	}
+	report.Transactions = append(report.Transactions, held...)
+	report.Held = len(held)
+	return report
+}
+
+// dropFromMempool removes the pooled and held transactions matching ids, or every one when ids is nil. Jobs of
+// this node whose result is removed are marked failed, and transfers left behind a gap are held again. The
+// caller must hold mutex.
+func dropFromMempool(ids map[string]bool) MempoolRemoval {
+	removal := MempoolRemoval{Removed: []string{}, FailedJobs: []string{}}
+	drop := make(map[string]bool)
+	for _, tx := range transactionPool {
+		id := txID(tx)
+		if ids != nil && !ids[id] {
+			continue
+		}
+		drop[id] = true
+		removal.Removed = append(removal.Removed, id)
+		if job, ok := jobs[tx.JobID]; ok && tx.Type == TxJob && job.Status == JobPending {
+			job.Status, job.Error = JobFailed, "its result was removed from the mempool by the operator"
+			removal.FailedJobs = append(removal.FailedJobs, job.ID)
+		}
+	}
+	removeFromPool(drop)
+	for address, held := range futureTransfers {
+		for nonce, tx := range held {
+			if id := txID(tx); ids == nil || ids[id] {
+				delete(held, nonce)
+				delete(poolAdmitted, id)
+				removal.Removed = append(removal.Removed, id)
+			}
+		}
+		if len(held) == 0 {
+			delete(futureTransfers, address)
+		}
+	}
+	reconcilePool()
+	return removal
+}
+
+// handleMempool lists the transactions waiting to be mined at /mempool
+func handleMempool(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	mutex.Lock()
+	report := mempoolReport()
+	mutex.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// handleMempoolRemove removes transactions from the mempool for operators on the local host: DELETE
+// /mempool/<txid> removes one transaction and POST /mempool/flush removes every pooled and held transaction
+func handleMempoolRemove(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/mempool/")
+	var ids map[string]bool
+	switch {
+	case id == "flush" && r.Method == http.MethodPost:
+	case id != "" && id != "flush" && r.Method == http.MethodDelete:
+		ids = map[string]bool{id: true}
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if !fromLoopback(r) {
+		http.Error(w, "The mempool is only managed from the local host", http.StatusForbidden)
+		return
+	}
+
+	mutex.Lock()
+	removal := dropFromMempool(ids)
+	mutex.Unlock()
+	if ids != nil && len(removal.Removed) == 0 {
+		http.Error(w, "Unknown transaction", http.StatusNotFound)
+		return
+	}
+	fmt.Printf("Removed %d transactions from the mempool\n", len(removal.Removed))
+	publishEvent("mempool-removed", removal)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(removal)
+}
+
+// rawTxTypes are the transaction types clients may build, sign and submit directly at /tx. Job results are
+// created by the executing node, so they enter the chain by submitting a job at /jobs instead.
+var rawTxTypes = map[string]bool{TxTransfer: true, TxRevocation: true}
+
+// handleSubmitTx accepts a pre-built, signed transaction into the transaction pool
+func handleSubmitTx(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var tx Transaction
+	if err := json.NewDecoder(io.LimitReader(r.Body, int64(networkParams.MaxTransactionSize))).Decode(&tx); err != nil {
+		http.Error(w, "Failed to decode transaction", http.StatusBadRequest)
+		return
+	}
+	if !rawTxTypes[tx.Type] {
+		if tx.Type == TxJob {
+			http.Error(w, "Job results cannot be submitted directly; submit the job to /jobs", http.StatusBadRequest)
+		} else {
+			http.Error(w, fmt.Sprintf("Unsupported transaction type %q", tx.Type), http.StatusBadRequest)
+		}
+		return
+	}
+	if seenTxs.Seen(txID(tx)) {
+		http.Error(w, fmt.Sprintf("Transaction %s already seen", txID(tx)), http.StatusConflict)
+		return
+	}
+	if err := addTransaction(tx); err != nil {
+		http.Error(w, fmt.Sprintf("Transaction rejected: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	go mineBlock(nodeID, networkParams.Difficulty)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"TxID": txID(tx)})
+}
+
+// handleBalance reports the confirmed balance of a node identity, its last confirmed transfer nonce and the
+// nonce its next transfer must use
+func handleBalance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	address := r.URL.Query().Get("address")
+	mutex.Lock()
+	balance, nonce, next := balances[address], nonces[address], nextNonce(address)
+	mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"Address": address, "Balance": balance, "Nonce": nonce, "NextNonce": next})
+}
+
+// fetchFeeEstimate asks a node for the fee needed to be mined within the given number of blocks
+func fetchFeeEstimate(node string, within int) (int64, error) {
+	resp, err := nodeClient.Get(fmt.Sprintf("%s/fees/estimate?blocks=%d", node, within))
+	if err != nil {
+		return 0, fmt.Errorf("failed to query fee estimate: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("fee estimate returned status %d", resp.StatusCode)
+	}
+	var estimate FeeEstimate
+	if err := json.NewDecoder(resp.Body).Decode(&estimate); err != nil {
+		return 0, fmt.Errorf("failed to decode fee estimate: %w", err)
+	}
+	return estimate.Fee, nil
+}
+
+// Account is the balance and nonce state of a node identity as reported by /balance
+type Account struct {
+	Address   string // Node identity
+	Balance   int64  // Confirmed balance
+	Nonce     int64  // Nonce of the last confirmed transfer
+	NextNonce int64  // Nonce the next transfer must use, after the transfers waiting in the pool
+}
+
+// fetchAccount asks a node for the balance and nonces of an address
+func fetchAccount(node, address string) (Account, error) {
+	var account Account
+	resp, err := nodeClient.Get(node + "/balance?address=" + url.QueryEscape(address))
+	if err != nil {
+		return account, fmt.Errorf("failed to query account: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return account, fmt.Errorf("balance query returned status %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&account); err != nil {
+		return account, fmt.Errorf("failed to decode account: %w", err)
+	}
+	return account, nil
+}
+
+// runWallet implements the wallet subcommands, which sign with the node key and talk to a running node
+func runWallet(args []string, keyFile string) {
+	if len(args) == 0 {
+		fmt.Println("Usage: miner [flags] wallet address|balance|send --to <address> --amount N|revoke --to <identity>")
+		return
+	}
+	key, err := loadOrCreateNodeKey(keyFile)
+	if err != nil {
+		fmt.Printf("Error loading node key: %v\n", err)
+		return
+	}
+	address := hex.EncodeToString(key.Public().(ed25519.PublicKey))
+
+	walletFlags := flag.NewFlagSet("wallet", flag.ExitOnError)
+	node := walletFlags.String("node", localNodeURL(), "URL of the node to query and submit to")
+	to := walletFlags.String("to", "", "Recipient address of a transfer")
+	amount := walletFlags.Int64("amount", 0, "Amount to transfer")
+	fee := walletFlags.Int64("fee", -1, "Transfer fee (estimated by the node if unset)")
+	within := walletFlags.Int("within", 1, "Number of blocks the estimated fee should get the transfer mined within")
+	nonce := walletFlags.Int64("nonce", 0, "Transfer nonce (the node's next nonce for this address if unset)")
+	labelList := walletFlags.String("labels", "", "Comma-separated key=value labels attached to the transfer")
+	walletFlags.Parse(args[1:])
+
+	if args[0] == "send" || args[0] == "revoke" {
+		// Signatures cover the network's genesis hash, which the node reports
+		var status NodeStatus
+		if err := getNodeJSON(*node+"/status", &status); err != nil {
+			fmt.Printf("Error querying the node's network: %v\n", err)
+			return
+		}
+		genesisHash = status.GenesisHash
+	}
+
+	switch args[0] {
+	case "address":
+		fmt.Println(address)
+	case "balance":
+		account, err := fetchAccount(*node, address)
+		if err != nil {
+			fmt.Printf("Error querying balance: %v\n", err)
+			return
+		}
+		fmt.Printf("%s: %d\n", address, account.Balance)
+	case "send":
+		if *nonce == 0 {
+			account, err := fetchAccount(*node, address)
+			if err != nil {
+				fmt.Printf("Error querying nonce: %v\n", err)
+				return
+			}
+			*nonce = account.NextNonce
+		}
+		if *fee < 0 {
+			estimated, err := fetchFeeEstimate(*node, *within)
+			if err != nil {
+				fmt.Printf("Error estimating fee: %v\n", err)
+				return
+			}
+			*fee = estimated
+			fmt.Printf("Using estimated fee %d\n", *fee)
+		}
+		labels, err := parseLabels(*labelList)
+		if err != nil {
+			fmt.Printf("Invalid labels: %v\n", err)
+			return
+		}
+		tx := Transaction{Type: TxTransfer, From: address, To: *to, Amount: *amount, Fee: *fee, Nonce: *nonce, Timestamp: time.Now().Unix(), Labels: labels}
+		tx.Signature = hex.EncodeToString(ed25519.Sign(key, transferMessage(tx)))
+		if err := validateTransfer(tx); err != nil {
+			fmt.Printf("Invalid transfer: %v\n", err)
+			return
+		}
+		body, err := json.Marshal(tx)
+		if err != nil {
+			fmt.Printf("Error encoding transfer: %v\n", err)
+			return
+		}
+		resp, err := nodeClient.Post(*node+"/tx", "application/json", bytes.NewReader(body))
+		if err != nil {
+			fmt.Printf("Error submitting transfer: %v\n", err)
+			return
+		}
+		defer resp.Body.Close()
+		reply, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			fmt.Printf("Transfer rejected with status %d: %s\n", resp.StatusCode, strings.TrimSpace(string(reply)))
+			return
+		}
+		fmt.Printf("Transfer submitted: %s\n", strings.TrimSpace(string(reply)))
+	case "revoke":
+		labels, err := parseLabels(*labelList)
+		if err != nil {
+			fmt.Printf("Invalid labels: %v\n", err)
+			return
+		}
+		tx := Transaction{Type: TxRevocation, From: address, To: strings.ToLower(*to), Timestamp: time.Now().Unix(), Labels: labels}
+		tx.Signature = hex.EncodeToString(ed25519.Sign(key, transferMessage(tx)))
+		body, err := json.Marshal(tx)
+		if err != nil {
+			fmt.Printf("Error encoding revocation: %v\n", err)
+			return
+		}
+		// The node checks the admin key against its genesis parameters
+		resp, err := nodeClient.Post(*node+"/tx", "application/json", bytes.NewReader(body))
+		if err != nil {
+			fmt.Printf("Error submitting revocation: %v\n", err)
+			return
+		}
+		defer resp.Body.Close()
+		reply, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			fmt.Printf("Revocation rejected with status %d: %s\n", resp.StatusCode, strings.TrimSpace(string(reply)))
+			return
+		}
+		fmt.Printf("Revocation submitted: %s\n", strings.TrimSpace(string(reply)))
+	default:
+		fmt.Printf("Unknown wallet command %q\n", args[0])
+	}
+}
+
+// GenerateJobID returns a random identifier for jobs submitted without one, and for clients that follow a job
+// across retries
+func GenerateJobID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// setJobStatus updates the status of a tracked job
+func setJobStatus(id, status, reason string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if job, ok := jobs[id]; ok {
+		job.Status = status
+		job.Error = reason
+	}
+}
+
+// recordJobResult stores the computation output and resource usage of a job that is now waiting in the pool
+func recordJobResult(id string, tx Transaction) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if job, ok := jobs[id]; ok {
+		job.Status = JobPending
+		job.Result = tx.Data
+		job.ResultCID = tx.ResultCID
+		job.OutputCID = tx.OutputCID
+		job.ExecutionTime = tx.ExecutionTime
+		job.CPUTime = tx.CPUTime
+	}
+}
+
+// idempotencyScope scopes an idempotency key to its submitter so clients cannot collide with each other
+func idempotencyScope(clientIP, key string) string {
+	return clientIP + "|" + key
+}
+
+// clientIPFromRequest extracts the IP address of the client that sent the request. IPv4 clients of a dual-stack
+// listener arrive as IPv4-mapped IPv6 addresses and are reported in their IPv4 form. A request relayed by a
+// trusted proxy is attributed to the address its X-Forwarded-For header records: the header is read from the
+// right, past the trusted proxies that appended to it, up to the first address they did not add themselves.
+func clientIPFromRequest(r *http.Request) string {
+	ip := remoteIP(r)
+	if addr, err := netip.ParseAddr(ip); err != nil || !trustedProxy(addr) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.Trim(strings.TrimSpace(hops[i]), "[]"))
+		if err != nil {
+			break
+		}
+		hop = hop.Unmap().WithZone("")
+		ip = hop.String()
+		if !trustedProxy(hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// remoteIP returns the IP address of the other end of a request's connection
+func remoteIP(r *http.Request) string {
+	if addrPort, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+		return addrPort.Addr().Unmap().WithZone("").String()
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// trustedProxy reports whether addr belongs to a trusted reverse proxy
+func trustedProxy(addr netip.Addr) bool {
+	for _, network := range trustedProxies {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// fromLoopback reports whether a request came from this host over IPv4 or IPv6 and was addressed to it by a
+// loopback name. A DNS rebinding page reaches the node from the operator's browser with its own domain in Host
+// and Origin, so the address alone would let it through.
+func fromLoopback(r *http.Request) bool {
+	addr, err := netip.ParseAddr(clientIPFromRequest(r))
+	return err == nil && addr.IsLoopback() && loopbackHost(r.Host)
+}
+
+// loopbackHost reports whether a Host header names this host: localhost, a name under .localhost or a
+// loopback address, with or without a port
+func loopbackHost(host string) bool {
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	host = strings.TrimSuffix(strings.ToLower(strings.Trim(host, "[]")), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	addr, err := netip.ParseAddr(host)
+	return err == nil && addr.IsLoopback()
+}
+
+// writeJob writes a snapshot of a job as JSON
+func writeJob(w http.ResponseWriter, job Job) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// writeSizeError reports a size violation with the measured and allowed sizes so submitters can fix their payloads
+func writeSizeError(w http.ResponseWriter, err *SizeError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusRequestEntityTooLarge)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"Error": err.Error(),
+		"Kind":  err.Kind,
+		"Size":  err.Size,
+		"Limit": err.Limit,
+	})
+}
+
+// jobStream fans out the output lines of a running job to its subscribers
+type jobStream struct {
+	lines       []string             // Output produced so far, replayed to late subscribers
+	done        bool                 // Whether the job has finished executing
+	subscribers map[chan string]bool // Channels of connected subscribers
+}
+
+var jobStreams = make(map[string]*jobStream) // Output streams keyed by job ID
+var streamMutex sync.Mutex                   // Mutex to synchronize access to the output streams
+
+// jobStreamRetention is how long a finished job's output stays available for streaming
+const jobStreamRetention = 5 * time.Minute
+
+// openJobStream creates the output stream of a job that is about to execute
+func openJobStream(jobID string) {
+	streamMutex.Lock()
+	defer streamMutex.Unlock()
+	jobStreams[jobID] = &jobStream{subscribers: make(map[chan string]bool)}
+}
+
+// publishJobOutput records an output line and forwards it to subscribers. A subscriber that falls behind has its
+// channel closed and catches up from the recorded lines.
+func publishJobOutput(jobID, line string) {
+	streamMutex.Lock()
+	defer streamMutex.Unlock()
+	stream, ok := jobStreams[jobID]
+	if !ok {
+		return
+	}
+	stream.lines = append(stream.lines, line)
+	for ch := range stream.subscribers {
+		select {
+		case ch <- line:
+		default:
+			delete(stream.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// closeJobStream marks a job's output as complete and schedules the stream for removal
+func closeJobStream(jobID string) {
+	streamMutex.Lock()
+	defer streamMutex.Unlock()
+	stream, ok := jobStreams[jobID]
+	if !ok {
+		return
+	}
+	stream.done = true
+	for ch := range stream.subscribers {
+		close(ch)
+	}
+	stream.subscribers = nil
+	time.AfterFunc(jobStreamRetention, func() {
+		streamMutex.Lock()
+		defer streamMutex.Unlock()
+		if jobStreams[jobID] == stream {
+			delete(jobStreams, jobID)
+		}
+	})
+}
+
+// NodeEvent is a node-wide event delivered to /events subscribers
+type NodeEvent struct {
+	Name string // Event type, such as sync or synced
+	Data string // JSON-encoded event payload
+}
+
+var eventSubscribers = make(map[chan NodeEvent]bool) // Channels of connected /events subscribers, guarded by streamMutex
+
+// publishEvent forwards a node event to the /events subscribers, dropping subscribers that fall behind
+func publishEvent(name string, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	streamMutex.Lock()
+	defer streamMutex.Unlock()
+	for ch := range eventSubscribers {
+		select {
+		case ch <- NodeEvent{Name: name, Data: string(data)}:
+		default:
+			delete(eventSubscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// handleEvents streams node events, such as sync progress, as server-sent events
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ch := make(chan NodeEvent, 64)
+	streamMutex.Lock()
+	eventSubscribers[ch] = true
+	streamMutex.Unlock()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Start with the current sync progress so subscribers joining mid-sync need not wait for the next batch
+	mutex.Lock()
+	var progress *SyncProgress
+	if syncProgress != nil {
+		snapshot := *syncProgress
+		progress = &snapshot
+	}
+	mutex.Unlock()
+	if progress != nil {
+		data, _ := json.Marshal(progress)
+		writeEvent(w, "sync", string(data))
+	}
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			writeEvent(w, event.Name, event.Data)
+		case <-r.Context().Done():
+			streamMutex.Lock()
+			if eventSubscribers[ch] {
+				delete(eventSubscribers, ch)
+			}
+			streamMutex.Unlock()
+			return
+		}
+	}
+}
+
+// Kinds of alerts raised by the Byzantine behavior detector
+const (
+	alertEquivocation = "equivocation" // A miner produced two different blocks at the same height
+	alertTimestamp    = "timestamp"    // A block is dated too far in the future or before its parent
+	alertInvalidPoW   = "invalid-pow"  // A peer repeatedly announced blocks with invalid proof of work
+)
+
+// Thresholds of the Byzantine behavior detector
+const (
+	maxTimestampDrift   = 10 * time.Minute // How far ahead of the local clock an announced block may be dated
+	invalidPoWLimit     = 3                // Blocks with invalid proof of work a peer may announce within invalidPoWWindow
+	invalidPoWWindow    = 10 * time.Minute // Window invalid proofs of work are counted in
+	equivocationDepth   = 100              // Heights below the head whose announced blocks are remembered
+	recentAlertsKept    = 100              // Alerts served by /alerts
+	alertWebhookTimeout = 10 * time.Second // Time allowed for delivering an alert to the webhook
+)
+
+// Alert reports suspicious behavior of a peer or miner. It is published as an alert event, posted to the alert
+// webhook and logged to alerts.jsonl in the data directory.
+type Alert struct {
+	Kind     string // equivocation, timestamp or invalid-pow
+	Peer     string // Address the offending announcement came from
+	Creator  string // Miner identity the offending block claims
+	Height   int    // Height of the offending block
+	Detail   string // What was observed
+	Evidence string // IPFS CID of the signed Evidence, empty when it could not be stored
+	Time     int64  // Unix time of the detection
+}
+
+// Evidence is the record behind an alert, stored in IPFS for later review. The headers are enough to re-check
+// hashes, proofs of work and timestamps without trusting the reporter.
+type Evidence struct {
+	Kind      string        // Kind of the alert
+	Reporter  string        // Identity of the node that made the observation
+	Peer      string        // Address the offending announcements came from
+	Detail    string        // What was observed
+	Headers   []BlockHeader // Headers of the offending blocks, and of the block they conflict with
+	Time      int64         // Unix time of the detection
+	Signature string        // Hex-encoded ed25519 signature of the reporter over evidenceMessage
+}
+
+// invalidAnnouncement is a block with invalid proof of work announced by a peer
+type invalidAnnouncement struct {
+	header BlockHeader
+	at     time.Time
+}
+
+var alertWebhook string                                     // URL alerts are posted to, empty when not configured
+var alertFile = filepath.Join("data", "alerts.jsonl")       // Log of raised alerts with their evidence CIDs
+var recentAlerts []Alert                                    // Most recent alerts, guarded by mutex
+var announcedHeaders = make(map[int]map[string]BlockHeader) // First header announced per height and creator, guarded by mutex
+var invalidPoWSeen = make(map[string][]invalidAnnouncement) // Recent invalid proofs of work per peer, guarded by mutex
+
+// alertCounts counts the raised alerts by kind
+var alertCounts = map[string]*atomic.Int64{
+	alertEquivocation: new(atomic.Int64),
+	alertTimestamp:    new(atomic.Int64),
+	alertInvalidPoW:   new(atomic.Int64),
+}
+
+// inspectAnnouncement checks a block announced by peer for invalid proof of work and, in blocks signed by their
+// creator, equivocation and manipulated timestamps, raising an alert for each finding. It only observes; whether the block is accepted is up to acceptBlock.
+func inspectAnnouncement(peer string, header BlockHeader) {
+	now := time.Now()
+	if err := validateHeaderProofOfWork(header); err != nil {
+		mutex.Lock()
+		recent := []invalidAnnouncement{}
+		for _, seen := range invalidPoWSeen[peer] {
+			if now.Sub(seen.at) < invalidPoWWindow {
+				recent = append(recent, seen)
+			}
+		}
+		recent = append(recent, invalidAnnouncement{header: header, at: now})
+		invalidPoWSeen[peer] = recent
+		if len(recent) >= invalidPoWLimit {
+			delete(invalidPoWSeen, peer)
+		}
+		mutex.Unlock()
+		if len(recent) >= invalidPoWLimit {
+			headers := make([]BlockHeader, len(recent))
+			for i, seen := range recent {
+				headers[i] = seen.header
+			}
+			go raiseAlert(Alert{Kind: alertInvalidPoW, Peer: peer, Creator: header.Creator, Height: header.BlockNumber,
+				Detail: fmt.Sprintf("%d blocks with invalid proof of work within %s, the last: %v", len(recent), invalidPoWWindow, err)}, headers)
+		}
+		return
+	}
+
+	// Only blocks with valid proof of work are remembered, so equivocation cannot be claimed without real work.
+	// Equivocation and timestamp alerts blame the creator, so they are only raised for blocks the creator signed;
+	// anyone can put another node's identity into an unsigned header.
+	if validateCreatorSignature(header) != nil {
+		return
+	}
+	mutex.Lock()
+	for height := range announcedHeaders {
+		if height < currentBlock.BlockNumber-equivocationDepth {
+			delete(announcedHeaders, height)
+		}
+	}
+	var conflicting *BlockHeader
+	if header.BlockNumber >= currentBlock.BlockNumber-equivocationDepth {
+		byCreator := announcedHeaders[header.BlockNumber]
+		if byCreator == nil {
+			byCreator = make(map[string]BlockHeader)
+			announcedHeaders[header.BlockNumber] = byCreator
+		}
+		if first, ok := byCreator[header.Creator]; !ok {
+			byCreator[header.Creator] = header
+		} else if first.Hash != header.Hash {
+			conflicting = &first
+		}
+	}
+	var parent *BlockHeader
+	if n := header.BlockNumber - 1; n >= 1 && n <= len(blockchain) && blockchain[n-1].Hash == header.PrevHash {
+		parent = &blockchain[n-1].BlockHeader
+	}
+	mutex.Unlock()
+
+	if conflicting != nil {
+		go raiseAlert(Alert{Kind: alertEquivocation, Peer: peer, Creator: header.Creator, Height: header.BlockNumber,
+			Detail: fmt.Sprintf("%s produced blocks %s and %s at height %d", header.Creator, conflicting.Hash, header.Hash, header.BlockNumber)},
+			[]BlockHeader{*conflicting, header})
+	}
+	if drift := time.Unix(header.Timestamp, 0).Sub(now); drift > maxTimestampDrift {
+		go raiseAlert(Alert{Kind: alertTimestamp, Peer: peer, Creator: header.Creator, Height: header.BlockNumber,
+			Detail: fmt.Sprintf("block %s is dated %s ahead of the local clock", header.Hash, drift.Round(time.Second))}, []BlockHeader{header})
+	} else if parent != nil && header.Timestamp < parent.Timestamp {
+		go raiseAlert(Alert{Kind: alertTimestamp, Peer: peer, Creator: header.Creator, Height: header.BlockNumber,
+			Detail: fmt.Sprintf("block %s is dated %ds before its parent", header.Hash, parent.Timestamp-header.Timestamp)},
+			[]BlockHeader{*parent, header})
+	}
+}
+
+// evidenceMessage returns the bytes a reporter signs for a piece of evidence
+func evidenceMessage(e Evidence) []byte {
+	headers, _ := json.Marshal(e.Headers)
+	return []byte(fmt.Sprintf("evidence|%s|%s|%s|%d|%x|%x", e.Kind, e.Reporter, e.Peer, e.Time, sha256.Sum256([]byte(e.Detail)), sha256.Sum256(headers)))
+}
+
+// verifyEvidence checks the reporter's signature on a piece of evidence
+func verifyEvidence(e Evidence) error {
+	reporter, err := hex.DecodeString(e.Reporter)
+	if err != nil || len(reporter) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid reporter %q", e.Reporter)
+	}
+	signature, err := hex.DecodeString(e.Signature)
+	if err != nil || !ed25519.Verify(reporter, evidenceMessage(e), signature) {
+		return fmt.Errorf("evidence has an invalid signature")
+	}
+	return nil
+}
+
+// raiseAlert stores the signed evidence of an alert in IPFS, then logs, publishes and delivers the alert
+func raiseAlert(alert Alert, headers []BlockHeader) {
+	alert.Time = time.Now().Unix()
+	evidence := Evidence{Kind: alert.Kind, Reporter: nodeID, Peer: alert.Peer, Detail: alert.Detail, Headers: headers, Time: alert.Time}
+	evidence.Signature = hex.EncodeToString(ed25519.Sign(nodeKey, evidenceMessage(evidence)))
+	if data, err := json.Marshal(evidence); err == nil {
+		if cid, err := uploadBytesToIPFS("evidence.json", data); err != nil {
+			fmt.Printf("Error storing the evidence of a %s alert in IPFS: %v\n", alert.Kind, err)
+		} else {
+			alert.Evidence = cid
+		}
+	}
+	fmt.Printf("Alert (%s) from %s: %s\n", alert.Kind, alert.Peer, alert.Detail)
+
+	alertCounts[alert.Kind].Add(1)
+	mutex.Lock()
+	recentAlerts = append(recentAlerts, alert)
+	if len(recentAlerts) > recentAlertsKept {
+		recentAlerts = append([]Alert(nil), recentAlerts[len(recentAlerts)-recentAlertsKept:]...)
+	}
+	mutex.Unlock()
+	if err := recordAlert(alert); err != nil {
+		fmt.Printf("Error recording alert: %v\n", err)
+	}
+	publishEvent("alert", alert)
+	if alertWebhook != "" {
+		if err := postAlert(alertWebhook, alert); err != nil {
+			fmt.Printf("Error delivering alert to the webhook: %v\n", err)
+		}
+	}
+}
+
+// recordAlert appends an alert to the alert log
+func recordAlert(alert Alert) error {
+	if alertFile == "" {
+		return nil
+	}
+	file, err := os.OpenFile(alertFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open alert log: %w", err)
+	}
+	defer file.Close()
+	return json.NewEncoder(file).Encode(alert)
+}
+
+// postAlert delivers an alert to a webhook as JSON
+func postAlert(webhook string, alert Alert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), alertWebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// handleAlerts lists the most recent alerts, newest first
+func handleAlerts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	mutex.Lock()
+	alerts := make([]Alert, 0, len(recentAlerts))
+	for i := len(recentAlerts) - 1; i >= 0; i-- {
+		alerts = append(alerts, recentAlerts[i])
+	}
+	mutex.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alerts)
+}
+
+// Kinds of observed forks
+const (
+	forkCompeting = "competing" // A peer announced a block competing with one of the local chain
+	forkStale     = "stale"     // A block mined here lost the race for its height
+	forkReorg     = "reorg"     // Blocks were removed from the local chain
+)
+
+const (
+	forksKept         = 1000 // Forks kept in memory and served by /forks
+	forkListDefault   = 100  // Forks listed by /forks without a limit
+	forkListMaxLength = 1000 // Largest limit accepted by /forks
+)
+
+// ForkRecord is a fork observed by this node: the block the local chain kept at a height and the branch that lost
+type ForkRecord struct {
+	ID      string   // Hash of the first block of the losing branch, identifying the fork while the branch grows
+	Kind    string   // One of competing, stale or reorg
+	Height  int      // Height of the first block the branches disagree on
+	Winner  string   // Hash of the block the local chain kept at Height, empty when the chain now ends below it
+	Losers  []string // Hashes of the losing branch's blocks, from Height upwards
+	Depth   int      // Number of blocks of the losing branch
+	Peer    string   // Peer that announced the losing branch, empty for blocks of this node
+	Time    int64    // Unix time the fork was first observed
+	Updated int64    // Unix time the losing branch last grew
+}
+
+// ForkReport is the fork history served by /forks
+type ForkReport struct {
+	Forks    []ForkRecord   // Matching forks, newest first, up to the limit
+	Count    int            // Number of matching forks
+	ByKind   map[string]int // Number of matching forks of each kind
+	MaxDepth int            // Depth of the deepest matching fork
+	Blocks   int            // Blocks of the local chain mined within the queried period
+	ForkRate float64        // Matching forks per block of the local chain within the period
+}
+
+var forkFile = filepath.Join("data", "forks.jsonl") // Log of observed forks; a grown fork is appended again and supersedes its earlier record
+var recentForks []ForkRecord                        // Most recently observed forks, guarded by mutex
+var forkTips = make(map[string]string)              // Tip hash of each losing branch that may still grow, to its fork ID, guarded by mutex
+
+// forkCounts counts the observed forks by kind
+var forkCounts = map[string]*atomic.Int64{
+	forkCompeting: new(atomic.Int64),
+	forkStale:     new(atomic.Int64),
+	forkReorg:     new(atomic.Int64),
+}
+
+// observeFork records a block announced by peer that the local chain did not take. A block competing with a
+// local block on the same parent opens a fork; a block on top of a losing branch deepens that fork. Blocks
+// ahead of the local chain or on unknown parents are not forks as far as this node can tell.
+func observeFork(peer string, header BlockHeader) {
+	if validateHeaderProofOfWork(header) != nil {
+		return
+	}
+	mutex.Lock()
+	var fork ForkRecord
+	if id, ok := forkTips[header.PrevHash]; ok {
+		i := findFork(id)
+		if i < 0 {
+			mutex.Unlock()
+			return
+		}
+		delete(forkTips, header.PrevHash)
+		recentForks[i].Losers = append(recentForks[i].Losers, header.Hash)
+		recentForks[i].Depth++
+		recentForks[i].Updated = time.Now().Unix()
+		forkTips[header.Hash] = id
+		fork = recentForks[i]
+	} else {
+		n := header.BlockNumber
+		if n < 1 || n > len(blockchain) || blockchain[n-1].Hash == header.Hash || forkTips[header.Hash] != "" {
+			mutex.Unlock()
+			return
+		}
+		parent := "-1"
+		if n > 1 {
+			parent = blockchain[n-2].Hash
+		}
+		if header.PrevHash != parent {
+			mutex.Unlock()
+			return
+		}
+		now := time.Now().Unix()
+		fork = ForkRecord{ID: header.Hash, Kind: forkCompeting, Height: n, Winner: blockchain[n-1].Hash, Losers: []string{header.Hash}, Depth: 1, Peer: peer, Time: now, Updated: now}
+		forkCounts[forkCompeting].Add(1)
+		addFork(fork)
+		forkTips[header.Hash] = fork.ID
+	}
+	mutex.Unlock()
+	fmt.Printf("Fork at block %d: %s from %s lost to %s (depth %d)\n", fork.Height, fork.ID, peer, fork.Winner, fork.Depth)
+	saveFork(fork)
+}
+
+// noteFork records a stale block or a reorg of the local chain
+func noteFork(kind string, height int, winner string, losers []Block) {
+	if len(losers) == 0 {
+		return
+	}
+	now := time.Now().Unix()
+	fork := ForkRecord{ID: losers[0].Hash, Kind: kind, Height: height, Winner: winner, Depth: len(losers), Time: now, Updated: now}
+	for _, block := range losers {
+		fork.Losers = append(fork.Losers, block.Hash)
+	}
+	forkCounts[kind].Add(1)
+	mutex.Lock()
+	addFork(fork)
+	mutex.Unlock()
+	saveFork(fork)
+}
+
+// addFork adds a fork to the recent forks, dropping the oldest beyond forksKept; the caller must hold mutex
+func addFork(fork ForkRecord) {
+	recentForks = append(recentForks, fork)
+	if len(recentForks) > forksKept {
+		for _, dropped := range recentForks[:len(recentForks)-forksKept] {
+			if dropped.Kind == forkCompeting {
+				delete(forkTips, dropped.Losers[len(dropped.Losers)-1])
+			}
+		}
+		recentForks = append([]ForkRecord(nil), recentForks[len(recentForks)-forksKept:]...)
+	}
+}
+
+// findFork returns the position of a fork in the recent forks, or -1; the caller must hold mutex
+func findFork(id string) int {
+	for i := len(recentForks) - 1; i >= 0; i-- {
+		if recentForks[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// saveFork publishes a new or grown fork and appends it to the fork log
+func saveFork(fork ForkRecord) {
+	publishEvent("fork", fork)
+	if forkFile == "" {
+		return
+	}
+	file, err := os.OpenFile(forkFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Printf("Error opening fork log: %v\n", err)
+		return
+	}
+	defer file.Close()
+	if err := json.NewEncoder(file).Encode(fork); err != nil {
+		fmt.Printf("Error recording fork %s: %v\n", fork.ID, err)
+	}
+}
+
+// loadForks reads the fork history of earlier runs, keeping the latest record of each fork
+func loadForks(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read fork log: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	mutex.Lock()
+	defer mutex.Unlock()
+	for decoder.More() {
+		var fork ForkRecord
+		if err := decoder.Decode(&fork); err != nil {
+			return fmt.Errorf("failed to decode fork log: %w", err)
+		}
+		if i := findFork(fork.ID); i >= 0 {
+			delete(forkTips, recentForks[i].Losers[len(recentForks[i].Losers)-1])
+			recentForks = append(recentForks[:i], recentForks[i+1:]...)
+		}
+		if len(fork.Losers) == 0 {
+			continue
+		}
+		addFork(fork)
+		if fork.Kind == forkCompeting {
+			forkTips[fork.Losers[len(fork.Losers)-1]] = fork.ID
+		}
+	}
+	return nil
+}
+
+// handleRevocations lists the confirmed revocations, oldest first
+func handleRevocations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	mutex.Lock()
+	list := make([]Revocation, 0, len(revoked))
+	for _, revocation := range revoked {
+		list = append(list, revocation)
+	}
+	mutex.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].BlockNumber != list[j].BlockNumber {
+			return list[i].BlockNumber < list[j].BlockNumber
+		}
+		return list[i].Identity < list[j].Identity
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// handleForks serves the fork history, newest first. ?since=<unix time> and ?kind= narrow it down and ?limit=
+// caps the number of forks listed; the counts, depth and fork rate cover every matching fork.
+func handleForks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	var since int64
+	if value := query.Get("since"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "since must be a Unix time", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+	kind := query.Get("kind")
+	if kind != "" && forkCounts[kind] == nil {
+		http.Error(w, "kind must be competing, stale or reorg", http.StatusBadRequest)
+		return
+	}
+	limit := forkListDefault
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > forkListMaxLength {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", forkListMaxLength), http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	report := ForkReport{Forks: []ForkRecord{}, ByKind: make(map[string]int)}
+	mutex.Lock()
+	for i := len(recentForks) - 1; i >= 0; i-- {
+		fork := recentForks[i]
+		if fork.Updated < since || (kind != "" && fork.Kind != kind) {
+			continue
+		}
+		report.Count++
+		report.ByKind[fork.Kind]++
+		report.MaxDepth = max(report.MaxDepth, fork.Depth)
+		if len(report.Forks) < limit {
+			report.Forks = append(report.Forks, fork)
+		}
+	}
+	for i := len(blockchain) - 1; i >= 0 && blockchain[i].Timestamp >= since; i-- {
+		report.Blocks++
+	}
+	mutex.Unlock()
+	if report.Blocks > 0 {
+		report.ForkRate = float64(report.Count) / float64(report.Blocks)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// Performance history
+const (
+	perfRetention   = 1440 // Samples kept, a day at the default interval
+	perfChartWidth  = 600  // Width of an explorer chart, matching the viewBox in explorer/index.html
+	perfChartHeight = 80   // Height of an explorer chart, matching the viewBox in explorer/index.html
+)
+
+// PerfSample is a periodic sample of the node's performance, kept so operators can see its history
+type PerfSample struct {
+	Time         int64   // Unix time the sample was taken
+	HashRate     float64 // Proof-of-work hashes per second since the previous sample
+	MempoolDepth int     // Transactions waiting in the pool
+	Jobs         int64   // Jobs whose result entered the pool since the previous sample
+	JobLatency   int64   // Average milliseconds from those jobs starting on this node to their result entering the pool
+	Peers        int     // Known peers
+}
+
+var perfFile = filepath.Join("data", "perf.jsonl") // Log of performance samples, rewritten with the kept samples once it holds twice perfRetention
+var perfSamples []PerfSample                       // Most recent performance samples, oldest first, guarded by mutex
+var perfLogged int                                 // Samples in the performance log, guarded by mutex
+
+// perfCounters accumulate the activity between performance samples
+var perfCounters struct {
+	hashes     atomic.Int64 // Proof-of-work hashes computed
+	jobs       atomic.Int64 // Jobs whose result entered the pool
+	jobLatency atomic.Int64 // Total milliseconds those jobs took
+	last       time.Time    // When the previous sample was taken, only used by samplePerf
+}
+
+// samplePerf records a performance sample of the activity since the previous call. The first call only starts
+// the period the next sample covers.
+func samplePerf() {
+	now := time.Now()
+	hashes, jobCount, latency := perfCounters.hashes.Swap(0), perfCounters.jobs.Swap(0), perfCounters.jobLatency.Swap(0)
+	last := perfCounters.last
+	perfCounters.last = now
+	if last.IsZero() {
+		return
+	}
+	sample := PerfSample{Time: now.Unix(), HashRate: float64(hashes) / now.Sub(last).Seconds(), Jobs: jobCount, Peers: len(knownPeers())}
+	if jobCount > 0 {
+		sample.JobLatency = latency / jobCount
+	}
+	mutex.Lock()
+	sample.MempoolDepth = len(transactionPool)
+	perfSamples = append(perfSamples, sample)
+	if len(perfSamples) > perfRetention {
+		perfSamples = append([]PerfSample(nil), perfSamples[len(perfSamples)-perfRetention:]...)
+	}
+	var kept []PerfSample
+	perfLogged++
+	if perfLogged > 2*perfRetention {
+		kept = append(kept, perfSamples...)
+		perfLogged = len(kept)
+	}
+	mutex.Unlock()
+	if err := savePerf(sample, kept); err != nil {
+		fmt.Printf("Error recording performance sample: %v\n", err)
+	}
+}
+
+// savePerf appends a sample to the performance log, or replaces the log with kept when it is set
+func savePerf(sample PerfSample, kept []PerfSample) error {
+	if perfFile == "" {
+		return nil
+	}
+	if kept != nil {
+		if err := writeStored(perfFile+".tmp", jsonCodec{}, kept); err != nil {
+			return err
+		}
+		return os.Rename(perfFile+".tmp", perfFile)
+	}
+	file, err := os.OpenFile(perfFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open performance log: %w", err)
+	}
+	defer file.Close()
+	return json.NewEncoder(file).Encode(sample)
+}
+
+// loadPerf reads the performance samples of earlier runs, keeping the most recent perfRetention
+func loadPerf(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read performance log: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	mutex.Lock()
+	defer mutex.Unlock()
+	for decoder.More() {
+		var sample PerfSample
+		if err := decoder.Decode(&sample); err != nil {
+			// A sample cut short by a crash ends the log; the next rewrite drops it
+			fmt.Printf("Ignoring the rest of the performance log: %v\n", err)
+			break
+		}
+		perfSamples = append(perfSamples, sample)
+		perfLogged++
+	}
+	if len(perfSamples) > perfRetention {
+		perfSamples = append([]PerfSample(nil), perfSamples[len(perfSamples)-perfRetention:]...)
+	}
+	return nil
+}
+
+// samplesSince returns the kept performance samples taken at or after since
+func samplesSince(since int64) []PerfSample {
+	mutex.Lock()
+	defer mutex.Unlock()
+	start := sort.Search(len(perfSamples), func(i int) bool { return perfSamples[i].Time >= since })
+	return append([]PerfSample{}, perfSamples[start:]...)
+}
+
+// handlePerf serves the kept performance samples, oldest first; ?since=<unix time> narrows them down
+func handlePerf(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	var since int64
+	if value := r.URL.Query().Get("since"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "since must be a Unix time", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(samplesSince(since))
+}
+
+// PerfChart is a line chart of one series of the performance samples, drawn by the explorer as an SVG polyline
+type PerfChart struct {
+	Title  string // Name of the series
+	Latest string // Value of the most recent sample with its unit
+	Peak   string // Highest value of the period with its unit
+	Points string // Polyline points of the series, scaled to perfChartWidth by perfChartHeight
+}
+
+// perfCharts draws the hash rate, mempool depth, job latency and peer count of the samples
+func perfCharts(samples []PerfSample) []PerfChart {
+	if len(samples) == 0 {
+		return nil
+	}
+	series := []struct {
+		title, unit string
+		value       func(PerfSample) float64
+	}{
+		{"Hash rate", "H/s", func(s PerfSample) float64 { return s.HashRate }},
+		{"Mempool depth", "transactions", func(s PerfSample) float64 { return float64(s.MempoolDepth) }},
+		{"Job latency", "ms", func(s PerfSample) float64 { return float64(s.JobLatency) }},
+		{"Peers", "peers", func(s PerfSample) float64 { return float64(s.Peers) }},
+	}
+	charts := make([]PerfChart, 0, len(series))
+	for _, line := range series {
+		peak := 0.0
+		for _, sample := range samples {
+			peak = max(peak, line.value(sample))
+		}
+		var points []string
+		for i, sample := range samples {
+			x := 0.0
+			if len(samples) > 1 {
+				x = float64(i) * perfChartWidth / float64(len(samples)-1)
+			}
+			y := float64(perfChartHeight)
+			if peak > 0 {
+				y -= line.value(sample) / peak * perfChartHeight
+			}
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+		}
+		if len(samples) == 1 {
+			// A single sample is drawn as a level line
+			points = append(points, fmt.Sprintf("%d,%s", perfChartWidth, strings.Split(points[0], ",")[1]))
+		}
+		charts = append(charts, PerfChart{
+			Title:  line.title,
+			Latest: fmt.Sprintf("%.0f %s", line.value(samples[len(samples)-1]), line.unit),
+			Peak:   fmt.Sprintf("%.0f %s", peak, line.unit),
+			Points: strings.Join(points, " "),
+		})
+	}
+	return charts
+}
+
+// whenSynced refuses requests that would mine or execute jobs while the node is still syncing on startup or is
+// in maintenance mode
+func whenSynced(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		syncing, maintenance := initialSync, maintenanceMode
+		mutex.Unlock()
+		if syncing {
+			w.Header().Set("Retry-After", "30")
+			http.Error(w, "Node is syncing and does not accept submissions yet; see /status for progress", http.StatusServiceUnavailable)
+			return
+		}
+		if maintenance {
+			w.Header().Set("Retry-After", "300")
+			http.Error(w, "Node is in maintenance mode and does not accept submissions; submit to another node", http.StatusServiceUnavailable)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// writeEvent writes a single server-sent event
+func writeEvent(w http.ResponseWriter, event, data string) {
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// handleJobStream streams a job's output lines as server-sent events, followed by a done event with its status
+func handleJobStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	streamMutex.Lock()
+	stream, ok := jobStreams[id]
+	streamMutex.Unlock()
+	if !ok {
+		http.Error(w, "Unknown job", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Replay the lines not yet sent and subscribe for the rest. A closed channel means either that the job
+	// finished or that this client fell behind; in both cases the recorded lines tell where to resume.
+	sent := 0
+	for {
+		streamMutex.Lock()
+		history := append([]string(nil), stream.lines[sent:]...)
+		var ch chan string
+		if !stream.done {
+			ch = make(chan string, 64)
+			stream.subscribers[ch] = true
+		}
+		streamMutex.Unlock()
+
+		for _, line := range history {
+			writeEvent(w, "line", line)
+		}
+		sent += len(history)
+		if ch == nil {
+			break
+		}
+	stream:
+		for {
+			select {
+			case line, ok := <-ch:
+				if !ok {
+					break stream
+				}
+				writeEvent(w, "line", line)
+				sent++
+			case <-r.Context().Done():
+				streamMutex.Lock()
+				if stream.subscribers[ch] {
+					delete(stream.subscribers, ch)
+				}
+				streamMutex.Unlock()
+				return
+			}
+		}
+	}
+
+	mutex.Lock()
+	status := ""
+	if job, ok := jobs[id]; ok {
+		status = job.Status
+	}
+	mutex.Unlock()
+	writeEvent(w, "done", status)
+}
+
+// Redaction records that an operator purged the local data of a job or a submitter
+type Redaction struct {
+	JobID     string // Purged job, empty when a whole submitter was purged
+	Submitter string // Purged submitter, empty when a single job was purged
+	Reason    string // Operator-supplied reason, such as the reference of an erasure request
+	Time      int64  // Unix time of the purge
+}
+
+// PurgeReport lists what a purge removed
+type PurgeReport struct {
+	Redaction Redaction
+	Jobs      []string // Jobs whose history, output stream and idempotency keys were removed
+	Files     []string // Cached files deleted from the job working directory
+	Unpinned  []string // CIDs unpinned from the local IPFS node
+	Errors    []string // Steps that failed and may need manual follow-up
+}
+
+// jobWorkDir is the directory jobs download their files into
+func jobWorkDir() string {
+	return filepath.Join(os.TempDir(), "myapp_data")
+}
+
+// loadRedactions reads the redaction markers recorded by earlier purges
+func loadRedactions(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read redactions: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for decoder.More() {
+		var redaction Redaction
+		if err := decoder.Decode(&redaction); err != nil {
+			return fmt.Errorf("failed to decode redactions: %w", err)
+		}
+		markRedacted(redaction)
+	}
+	return nil
+}
+
+// markRedacted withholds the results covered by a redaction from the read APIs; the caller must hold mutex
+// once the node is serving
+func markRedacted(redaction Redaction) {
+	if redaction.JobID != "" {
+		redactedJobs[redaction.JobID] = true
+	}
+	if redaction.Submitter != "" {
+		redactedSubmitters[redaction.Submitter] = true
+	}
+}
+
+// recordRedaction appends a redaction marker to the redaction log
+func recordRedaction(redaction Redaction) error {
+	if redactionFile == "" {
+		// In-memory nodes keep redactions only until they stop
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(redactionFile), 0755); err != nil {
+		return fmt.Errorf("failed to create redaction directory: %w", err)
+	}
+	file, err := os.OpenFile(redactionFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open redaction log: %w", err)
+	}
+	defer file.Close()
+	return json.NewEncoder(file).Encode(redaction)
+}
+
+// unpinFromIPFS removes the local pin of a CID so the IPFS node can garbage-collect it
+func unpinFromIPFS(cid string) error {
+	resp, err := httpClient.Post(ipfsAPIURL+"/pin/rm?arg="+url.QueryEscape(cid), "", nil)
+	if err != nil {
+		return fmt.Errorf("failed to unpin %s: %w", cid, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unpinning %s failed with status %d: %s", cid, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// purge removes the locally stored artifacts of a job, or of every job of a submitter: job history,
+// idempotency keys, output streams, unmined results, cached files and IPFS pins. Confirmed results cannot
+// be removed from the chain, so a redaction marker withholds them from the read APIs instead.
+func purge(redaction Redaction) PurgeReport {
+	report := PurgeReport{Redaction: redaction}
+	cids := make(map[string]bool)
+
+	mutex.Lock()
+	purged := make(map[string]bool)
+	for id, job := range jobs {
+		if id != redaction.JobID && (redaction.Submitter == "" || job.Submitter != redaction.Submitter) {
+			continue
+		}
+		if job.Status == JobExecuting || job.Status == JobQueued {
+			report.Errors = append(report.Errors, fmt.Sprintf("job %s is still executing; purge it again once it finishes", id))
+			continue
+		}
+		purged[id] = true
+		report.Jobs = append(report.Jobs, id)
+		cids[job.PythonHash] = true
+		cids[job.TxtHash] = true
+		for _, input := range job.Inputs {
+			cids[input] = true
+		}
+		delete(jobs, id)
+	}
+	for key, id := range idempotencyKeys {
+		if purged[id] {
+			delete(idempotencyKeys, key)
+		}
+	}
+	removeFromPool(purged)
+	// Inputs still used by other jobs stay pinned
+	for _, job := range jobs {
+		delete(cids, job.PythonHash)
+		delete(cids, job.TxtHash)
+		for _, input := range job.Inputs {
+			delete(cids, input)
+		}
+	}
+	markRedacted(redaction)
+	mutex.Unlock()
+	flushJobs()
+	sort.Strings(report.Jobs)
+
+	streamMutex.Lock()
+	for id := range purged {
+		delete(jobStreams, id)
+	}
+	streamMutex.Unlock()
+
+	delete(cids, "")
+	for cid := range cids {
+		for _, ext := range []string{".py", ".txt"} {
+			filename := filepath.Join(jobWorkDir(), cid+ext)
+			if err := os.Remove(filename); err == nil {
+				report.Files = append(report.Files, filename)
+			} else if !os.IsNotExist(err) {
+				report.Errors = append(report.Errors, err.Error())
+			}
+		}
+		if err := unpinFromIPFS(cid); err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		} else {
+			report.Unpinned = append(report.Unpinned, cid)
+		}
+	}
+	sort.Strings(report.Files)
+	sort.Strings(report.Unpinned)
+
+	if err := recordRedaction(redaction); err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	}
+	return report
+}
+
+// handlePurge lets the local operator purge the data of a job or submitter
+func handlePurge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if !fromLoopback(r) {
+		http.Error(w, "Purges are only accepted from the local host", http.StatusForbidden)
+		return
+	}
+
+	var redaction Redaction
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&redaction); err != nil {
+		http.Error(w, "Failed to decode purge request", http.StatusBadRequest)
+		return
+	}
+	if (redaction.JobID == "") == (redaction.Submitter == "") {
+		http.Error(w, "Specify exactly one of JobID and Submitter", http.StatusBadRequest)
+		return
+	}
+	redaction.Time = time.Now().Unix()
+
+	report := purge(redaction)
+	fmt.Printf("Purged %d jobs for %+v\n", len(report.Jobs), redaction)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// runPurge implements the purge subcommand, which asks the local node to purge a job or submitter
+func runPurge(args []string) {
+	purgeFlags := flag.NewFlagSet("purge", flag.ExitOnError)
+	node := purgeFlags.String("node", localNodeURL(), "URL of the local node")
+	jobID := purgeFlags.String("job", "", "Job to purge")
+	submitter := purgeFlags.String("submitter", "", "Submitter IP address whose jobs are purged")
+	reason := purgeFlags.String("reason", "", "Reason recorded in the redaction marker")
+	purgeFlags.Parse(args)
+
+	body, err := json.Marshal(Redaction{JobID: *jobID, Submitter: *submitter, Reason: *reason})
+	if err != nil {
+		fmt.Printf("Error encoding purge request: %v\n", err)
+		return
+	}
+	resp, err := nodeClient.Post(*node+"/purge", "application/json", bytes.NewReader(body))
+	if err != nil {
+		fmt.Printf("Error requesting purge: %v\n", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		reply, _ := io.ReadAll(resp.Body)
+		fmt.Printf("Purge failed with status %d: %s\n", resp.StatusCode, strings.TrimSpace(string(reply)))
+		return
+	}
+	var report PurgeReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		fmt.Printf("Error decoding purge report: %v\n", err)
+		return
+	}
+	fmt.Printf("Purged jobs: %v\nDeleted files: %v\nUnpinned: %v\n", report.Jobs, report.Files, report.Unpinned)
+	for _, problem := range report.Errors {
+		fmt.Printf("Warning: %s\n", problem)
+	}
+}
+
+// PublishedBlock records a block pinned in IPFS when publishing the chain head, so it can be unpinned if a reorg
+// takes it off the main chain
+type PublishedBlock struct {
+	Height    int    // Height of the block
+	Hash      string // Hash of the block
+	CID       string // CID of the pinned block
+	RecordCID string // CID of the pinned ChainHead record pointing at the block, empty for a block only uploaded
+	Time      int64  // Unix time the block was published
+}
+
+// recordPublishedBlock appends a published block to the published block log
+func recordPublishedBlock(published PublishedBlock) error {
+	if publishedBlockFile == "" {
+		return nil
+	}
+	file, err := os.OpenFile(publishedBlockFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open published block log: %w", err)
+	}
+	defer file.Close()
+	return json.NewEncoder(file).Encode(published)
+}
+
+// loadPublishedBlocks reads the published block log
+func loadPublishedBlocks() ([]PublishedBlock, error) {
+	if publishedBlockFile == "" {
+		return nil, nil
+	}
+	return decodeStored[PublishedBlock](publishedBlockFile, jsonCodec{})
+}
+
+// GCPolicy configures the garbage collector of local leftovers
+type GCPolicy struct {
+	Interval    time.Duration // Interval between collections, 0 disables them
+	MaxAge      time.Duration // Age after which leftover files and orphaned published blocks are removed
+	CacheBudget int64         // Bytes of downloaded job files kept for reuse
+	DryRun      bool          // Report what would be removed without removing anything
+}
+
+var gcPolicy = GCPolicy{MaxAge: 24 * time.Hour, CacheBudget: 1 << 30} // Policy of the background collections, set by the -gc-* flags
+
+// GCReport lists what a garbage collection removed, or would have removed in a dry run
+type GCReport struct {
+	DryRun   bool
+	Files    []string // Leftover job files and scratch directories older than the maximum age
+	Evicted  []string // Cached job files removed to stay within the cache budget
+	Unpinned []string // CIDs of published blocks, and their head records, no longer on the main chain
+	Bytes    int64    // Disk space freed in the job working directory and scratch directories
+	Errors   []string // Removals that failed and will be retried by the next collection
+}
+
+// gcStats counts the work of the garbage collector for /metrics
+var gcStats struct {
+	runs        atomic.Uint64
+	files       atomic.Uint64 // Files and directories removed, including evictions
+	bytes       atomic.Uint64
+	unpinned    atomic.Uint64
+	reclaimable atomic.Int64 // Bytes the last dry run would have freed
+	lastRun     atomic.Int64 // Unix time of the last collection
+}
+
+// diskUsage returns the bytes used by a file or directory tree
+func diskUsage(path string) int64 {
+	var total int64
+	filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			if info, err := entry.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total
+}
+
+// collectGarbage removes local leftovers: job files and scratch directories older than the maximum age, cached job
+// files beyond the cache budget, least recently used first, and the pins of published blocks that a reorg took off
+// the main chain once they are older than the maximum age. Files of queued and executing jobs are never touched.
+func collectGarbage(policy GCPolicy) GCReport {
+	report := GCReport{DryRun: policy.DryRun}
+	now := time.Now()
+	mutex.Lock()
+	inUse := make(map[string]bool)
+	for _, job := range jobs {
+		if job.Status == JobExecuting || job.Status == JobQueued {
+			inUse[job.PythonHash+".py"], inUse[job.TxtHash+".txt"] = true, true
+			for _, input := range job.Inputs {
+				inUse[input+".txt"] = true
+			}
+		}
+	}
+	mutex.Unlock()
+
+	remove := func(path string, size int64, list *[]string) {
+		if !policy.DryRun {
+			if err := os.RemoveAll(path); err != nil {
+				report.Errors = append(report.Errors, err.Error())
+				return
+			}
+		}
+		*list = append(*list, path)
+		report.Bytes += size
+	}
+
+	entries, err := os.ReadDir(jobWorkDir())
+	if err != nil && !os.IsNotExist(err) {
+		report.Errors = append(report.Errors, err.Error())
+	}
+	type cachedFile struct {
+		path     string
+		size     int64
+		modified time.Time
+	}
+	var cached []cachedFile
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || inUse[entry.Name()] {
+			continue
+		}
+		path := filepath.Join(jobWorkDir(), entry.Name())
+		switch {
+		case now.Sub(info.ModTime()) > policy.MaxAge:
+			remove(path, diskUsage(path), &report.Files)
+		case !entry.IsDir():
+			cached = append(cached, cachedFile{path, info.Size(), info.ModTime()})
+		}
+	}
+	// Keep the most recently downloaded files that fit in the budget
+	sort.Slice(cached, func(i, j int) bool { return cached[i].modified.After(cached[j].modified) })
+	var kept int64
+	for _, file := range cached {
+		if kept += file.size; kept > policy.CacheBudget {
+			remove(file.path, file.size, &report.Evicted)
+		}
+	}
+	// Scratch directories of verify results runs that were interrupted
+	scratch, _ := filepath.Glob(filepath.Join(os.TempDir(), "verify-results*"))
+	for _, path := range scratch {
+		if info, err := os.Stat(path); err == nil && now.Sub(info.ModTime()) > policy.MaxAge {
+			remove(path, diskUsage(path), &report.Files)
+		}
+	}
+
+	unpinned, problems := collectPublishedBlocks(policy, now)
+	report.Unpinned = unpinned
+	report.Errors = append(report.Errors, problems...)
+
+	gcStats.runs.Add(1)
+	gcStats.lastRun.Store(now.Unix())
+	if policy.DryRun {
+		gcStats.reclaimable.Store(report.Bytes)
+	} else {
+		gcStats.files.Add(uint64(len(report.Files) + len(report.Evicted)))
+		gcStats.bytes.Add(uint64(report.Bytes))
+		gcStats.unpinned.Add(uint64(len(report.Unpinned)))
+	}
+	return report
+}
+
+// collectPublishedBlocks unpins the published blocks older than the maximum age that are no longer on the main
+// chain and not referenced as the PrevCID of a block on it, returning the unpinned CIDs and any failures
+func collectPublishedBlocks(policy GCPolicy, now time.Time) ([]string, []string) {
+	records, err := loadPublishedBlocks()
+	if err != nil {
+		return nil, []string{err.Error()}
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	mutex.Lock()
+	onChain := make(map[string]bool, len(blockchain))
+	referenced := make(map[string]bool, len(blockchain))
+	for _, block := range blockchain {
+		onChain[block.Hash] = true
+		referenced[block.PrevCID] = true
+	}
+	mutex.Unlock()
+
+	var unpinned, problems []string
+	kept := make([]PublishedBlock, 0, len(records))
+	for _, record := range records {
+		if onChain[record.Hash] || referenced[record.CID] || now.Sub(time.Unix(record.Time, 0)) <= policy.MaxAge {
+			kept = append(kept, record)
+			continue
+		}
+		cids := []string{record.CID}
+		if record.RecordCID != "" {
+			cids = append(cids, record.RecordCID)
+		}
+		if policy.DryRun {
+			unpinned = append(unpinned, cids...)
+			kept = append(kept, record)
+			continue
+		}
+		failed := false
+		for _, cid := range cids {
+			// A CID unpinned by hand counts as collected
+			if err := unpinFromIPFS(cid); err != nil && !strings.Contains(err.Error(), "not pinned") {
+				problems = append(problems, err.Error())
+				failed = true
+				continue
+			}
+			unpinned = append(unpinned, cid)
+		}
+		if failed {
+			kept = append(kept, record)
+		}
+	}
+	if len(kept) < len(records) {
+		if err := writeStored(publishedBlockFile+".tmp", jsonCodec{}, kept); err != nil {
+			problems = append(problems, err.Error())
+		} else if err := os.Rename(publishedBlockFile+".tmp", publishedBlockFile); err != nil {
+			problems = append(problems, fmt.Sprintf("failed to replace %s: %v", publishedBlockFile, err))
+		}
+	}
+	return unpinned, problems
+}
+
+// logGC prints a summary of a collection that found anything
+func logGC(report GCReport) {
+	found := len(report.Files) + len(report.Evicted) + len(report.Unpinned)
+	if found == 0 && len(report.Errors) == 0 {
+		return
+	}
+	verb := "removed"
+	if report.DryRun {
+		verb = "would remove"
+	}
+	fmt.Printf("Garbage collection %s %d leftover files, %d cached files and %d pins, %s on disk\n", verb, len(report.Files), len(report.Evicted), len(report.Unpinned), formatBytes(report.Bytes))
+	for _, problem := range report.Errors {
+		fmt.Printf("Garbage collection error: %s\n", problem)
+	}
+}
+
+// formatBytes formats a byte count with a binary unit
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// handleGC lets the local operator run a garbage collection, as a dry run with ?dry-run=true
+func handleGC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if !fromLoopback(r) {
+		http.Error(w, "Garbage collection is only accepted from the local host", http.StatusForbidden)
+		return
+	}
+	policy := gcPolicy
+	policy.DryRun = r.URL.Query().Get("dry-run") == "true"
+	report := collectGarbage(policy)
+	logGC(report)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// runGC implements the gc subcommand, which asks the local node to collect garbage
+func runGC(args []string) {
+	gcFlags := flag.NewFlagSet("gc", flag.ExitOnError)
+	node := gcFlags.String("node", localNodeURL(), "URL of the local node")
+	dryRun := gcFlags.Bool("dry-run", false, "Report what would be removed without removing anything")
+	gcFlags.Parse(args)
+
+	resp, err := nodeClient.Post(*node+"/gc?dry-run="+strconv.FormatBool(*dryRun), "", nil)
+	if err != nil {
+		fmt.Printf("Error requesting garbage collection: %v\n", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		reply, _ := io.ReadAll(resp.Body)
+		fmt.Printf("Garbage collection failed with status %d: %s\n", resp.StatusCode, strings.TrimSpace(string(reply)))
+		return
+	}
+	var report GCReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		fmt.Printf("Error decoding garbage collection report: %v\n", err)
+		return
+	}
+	verb := "Removed"
+	if report.DryRun {
+		verb = "Would remove"
+	}
+	fmt.Printf("%s leftover files: %v\n%s cached files: %v\n%s pins: %v\nDisk space: %s\n", verb, report.Files, verb, report.Evicted, verb, report.Unpinned, formatBytes(report.Bytes))
+	for _, problem := range report.Errors {
+		fmt.Printf("Warning: %s\n", problem)
+	}
+}
+
+// MaintenanceStatus reports a node's maintenance mode and how far it has drained
+type MaintenanceStatus struct {
+	Enabled     bool  // Whether the node refuses new jobs and mining
+	Since       int64 // Unix time maintenance mode was entered, 0 when it is off
+	InFlight    int   // Jobs still queued or executing
+	Unconfirmed int   // Results of finished jobs still waiting in the pool to be mined
+	Drained     bool  // Whether maintenance mode is on and no job or result is left, so the node can be stopped
+}
+
+// maintenanceStatus returns the node's maintenance status; the caller must hold mutex
+func maintenanceStatus() MaintenanceStatus {
+	status := MaintenanceStatus{Enabled: maintenanceMode, InFlight: inFlightJobs(), Unconfirmed: pooledResults()}
+	if maintenanceMode {
+		status.Since = maintenanceSince
+		status.Drained = status.InFlight == 0 && status.Unconfirmed == 0
+	}
+	return status
+}
+
+// setMaintenance enters or leaves maintenance mode. In maintenance mode the node refuses job submissions,
+// transfers and approvals, while jobs already accepted run to completion and their results are still mined;
+// after that it stops mining. Chain queries are served as usual.
+func setMaintenance(enabled bool) MaintenanceStatus {
+	mutex.Lock()
+	if enabled != maintenanceMode {
+		maintenanceMode = enabled
+		maintenanceSince = 0
+		if enabled {
+			maintenanceSince = time.Now().Unix()
+			fmt.Printf("Entering maintenance mode with %d jobs in flight\n", inFlightJobs())
+		} else {
+			fmt.Println("Leaving maintenance mode")
+		}
+	}
+	status := maintenanceStatus()
+	mutex.Unlock()
+	publishEvent("maintenance", status)
+	return status
+}
+
+// handleMaintenance reports the maintenance status (GET) and lets the local operator turn maintenance mode on or
+// off with ?enable=true|false (POST)
+func handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	var status MaintenanceStatus
+	switch r.Method {
+	case http.MethodGet:
+		mutex.Lock()
+		status = maintenanceStatus()
+		mutex.Unlock()
+	case http.MethodPost:
+		if !fromLoopback(r) {
+			http.Error(w, "Maintenance mode is only changed from the local host", http.StatusForbidden)
+			return
+		}
+		enabled, err := strconv.ParseBool(r.URL.Query().Get("enable"))
+		if err != nil {
+			http.Error(w, "Pass ?enable=true or ?enable=false", http.StatusBadRequest)
+			return
+		}
+		status = setMaintenance(enabled)
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// runMaintenance implements the maintenance subcommands, which put the local node into maintenance mode and
+// take it out again; on --wait blocks until the node has drained
+func runMaintenance(args []string) {
+	maintenanceFlags := flag.NewFlagSet("maintenance", flag.ExitOnError)
+	node := maintenanceFlags.String("node", localNodeURL(), "URL of the local node")
+	wait := maintenanceFlags.Bool("wait", false, "With on, wait until the jobs in flight have finished and their results are mined")
+	if len(args) == 0 {
+		fmt.Println("Usage: miner [flags] maintenance on|off|status [--wait] [--node URL]")
+		return
+	}
+	maintenanceFlags.Parse(args[1:])
+
+	request := func(method, query string) (MaintenanceStatus, error) {
+		var status MaintenanceStatus
+		req, err := http.NewRequest(method, *node+"/maintenance"+query, nil)
+		if err != nil {
+			return status, err
+		}
+		resp, err := nodeClient.Do(req)
+		if err != nil {
+			return status, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			reply, _ := io.ReadAll(resp.Body)
+			return status, fmt.Errorf("node returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(reply)))
+		}
+		err = json.NewDecoder(resp.Body).Decode(&status)
+		return status, err
+	}
+
+	var status MaintenanceStatus
+	var err error
+	switch args[0] {
+	case "on":
+		status, err = request(http.MethodPost, "?enable=true")
+		for err == nil && *wait && !status.Drained {
+			fmt.Printf("Waiting for %d jobs in flight and %d unconfirmed results\n", status.InFlight, status.Unconfirmed)
+			time.Sleep(2 * time.Second)
+			status, err = request(http.MethodGet, "")
+		}
+	case "off":
+		status, err = request(http.MethodPost, "?enable=false")
+	case "status":
+		status, err = request(http.MethodGet, "")
+	default:
+		fmt.Printf("Unknown maintenance command %q\n", args[0])
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error changing maintenance mode: %v\n", err)
+		return
+	}
+	switch {
+	case !status.Enabled:
+		fmt.Printf("Maintenance mode is off, %d jobs in flight\n", status.InFlight)
+	case status.Drained:
+		fmt.Printf("Maintenance mode is on since %s and the node is drained; it can be stopped\n", time.Unix(status.Since, 0).Format(time.RFC3339))
+	default:
+		fmt.Printf("Maintenance mode is on since %s, %d jobs in flight and %d unconfirmed results\n", time.Unix(status.Since, 0).Format(time.RFC3339), status.InFlight, status.Unconfirmed)
+	}
+}
+
+// Outcomes of a doctor check
+const (
+	checkPass = "PASS"
+	checkWarn = "WARN"
+	checkFail = "FAIL"
+)
+
+// Thresholds of the doctor checks
+const (
+	doctorMinDisk      = 256 << 20 // Free space below which a directory fails
+	doctorLowDisk      = 2 << 30   // Free space below which a directory gets a warning
+	doctorClockWarn    = time.Second
+	doctorProbeContent = "ipfs-blockchain doctor probe\n" // Fixed content, so repeated runs add the same CID
+)
+
+// DoctorCheck is the outcome of one check of miner doctor
+type DoctorCheck struct {
+	Name    string // What was checked
+	Outcome string // PASS, WARN or FAIL
+	Detail  string // What was found
+}
+
+// runDoctor checks the node's environment with the same flags it would be started with, printing a report, and
+// exits with status 1 when a check fails
+func runDoctor(keyFile, genesisFile, dataDir string) {
+	var checks []DoctorCheck
+	report := func(name, outcome, format string, args ...interface{}) {
+		check := DoctorCheck{Name: name, Outcome: outcome, Detail: fmt.Sprintf(format, args...)}
+		checks = append(checks, check)
+		fmt.Printf("%-4s  %-16s %s\n", check.Outcome, check.Name, check.Detail)
+	}
+	flagValue := func(name string) string { return flag.Lookup(name).Value.String() }
+
+	// Key material
+	if data, err := os.ReadFile(keyFile); os.IsNotExist(err) {
+		report("node key", checkWarn, "%s does not exist; a new identity is created on first start", keyFile)
+	} else if err != nil {
+		report("node key", checkFail, "cannot read %s: %v", keyFile, err)
+	} else if seed, err := hex.DecodeString(strings.TrimSpace(string(data))); err != nil || len(seed) != ed25519.SeedSize {
+		report("node key", checkFail, "%s does not hold a hex-encoded ed25519 seed", keyFile)
+	} else if info, err := os.Stat(keyFile); err == nil && info.Mode().Perm()&0077 != 0 {
+		report("node key", checkWarn, "identity %s, but %s is accessible to other users (mode %s)", nodeIDFromSeed(string(data[:2*ed25519.SeedSize])), keyFile, info.Mode().Perm())
+	} else {
+		report("node key", checkPass, "identity %s", nodeIDFromSeed(string(data[:2*ed25519.SeedSize])))
+	}
+	params, err := loadNetworkParams(genesisFile)
+	if err != nil {
+		report("genesis", checkFail, "%v", err)
+	} else {
+		setNetworkParams(params)
+		report("genesis", checkPass, "difficulty %d, runtimes %s", params.Difficulty, strings.Join(params.AllowedRuntimes, ", "))
+	}
+
+	// The outbound filters decide which gateways and peers the node may reach
+	if allowed, err := parseNetworkList(flagValue("outbound-allow")); err == nil {
+		outboundAllow = allowed
+	}
+	if denied, err := parseNetworkList(flagValue("outbound-deny")); err == nil {
+		outboundDeny = append(outboundDeny, denied...)
+	}
+	for _, port := range strings.Split(flagValue("outbound-ports"), ",") {
+		if port = strings.TrimSpace(port); port != "" {
+			outboundPorts = append(outboundPorts, port)
+		}
+	}
+	for _, gateway := range strings.Split(flagValue("ipfs-fallback-gateways"), ",") {
+		if gateway = strings.TrimSpace(gateway); gateway != "" {
+			ipfsFallbackGateways = append(ipfsFallbackGateways, gateway)
+		}
+	}
+
+	// IPFS: the API adds a probe file, which every gateway must then serve
+	version := "unknown"
+	if resp, err := httpClient.Post(ipfsAPIURL+"/version", "", nil); err == nil {
+		var reply struct{ Version string }
+		if resp.StatusCode == http.StatusOK && json.NewDecoder(resp.Body).Decode(&reply) == nil && reply.Version != "" {
+			version = reply.Version
+		}
+		resp.Body.Close()
+	}
+	probe, err := uploadBytesToIPFS("doctor-probe.txt", []byte(doctorProbeContent))
+	if err != nil {
+		report("ipfs api", checkFail, "%s cannot add files: %v", ipfsAPIURL, err)
+	} else {
+		report("ipfs api", checkPass, "%s adds files, version %s", ipfsAPIURL, version)
+	}
+	for _, gateway := range append([]string{ipfsGatewayURL}, ipfsFallbackGateways...) {
+		if probe == "" {
+			report("ipfs gateway", checkWarn, "%s not checked without a probe file from the API", gateway)
+			continue
+		}
+		var content bytes.Buffer
+		started := time.Now()
+		if err := copyFromGateway(gateway, probe, &content, 1<<10); err != nil {
+			report("ipfs gateway", checkFail, "%s: %v", gateway, err)
+		} else if content.String() != doctorProbeContent {
+			report("ipfs gateway", checkFail, "%s served the wrong content for %s", gateway, probe)
+		} else {
+			report("ipfs gateway", checkPass, "%s in %s", gateway, time.Since(started).Round(time.Millisecond))
+		}
+	}
+
+	// Runtimes and the script sandbox
+	for _, name := range networkParams.AllowedRuntimes {
+		if status := probeRuntime(name); !status.Available {
+			report("runtime", checkFail, "%s: %s", name, status.Detail)
+		} else {
+			report("runtime", checkPass, "%s: %s", name, status.Detail)
+		}
+	}
+	if jobSandbox == sandboxOff {
+		report("sandbox", checkWarn, "disabled; scripts run with the host's network")
+	} else if err := checkSandbox(); err != nil {
+		report("sandbox", checkFail, "%v", err)
+	} else if _, err := exec.LookPath("ip"); err != nil && flagValue("job-egress") != "" {
+		report("sandbox", checkFail, "network namespaces work, but ip from iproute2, needed for -job-egress, is missing")
+	} else {
+		report("sandbox", checkPass, "scripts run in network namespaces of their own")
+	}
+
+	// Listen addresses
+	for _, address := range strings.Split(flagValue("listen"), ",") {
+		if address = strings.TrimSpace(address); address == "" {
+			continue
+		}
+		if listener, err := net.Listen("tcp", address); err != nil {
+			report("port", checkFail, "cannot listen on %s: %v", address, err)
+		} else {
+			listener.Close()
+			report("port", checkPass, "%s is free", address)
+		}
+	}
+
+	// Disk space of the data and job directories
+	directories := []string{jobWorkDir()}
+	if dataDir != "" {
+		directories = append([]string{dataDir}, directories...)
+	}
+	for _, dir := range directories {
+		free, err := freeDiskSpace(dir)
+		switch {
+		case err != nil:
+			report("disk", checkFail, "%s: %v", dir, err)
+		case free < doctorMinDisk:
+			report("disk", checkFail, "%s has only %s free", dir, formatBytes(free))
+		case free < doctorLowDisk:
+			report("disk", checkWarn, "%s has %s free", dir, formatBytes(free))
+		default:
+			report("disk", checkPass, "%s has %s free", dir, formatBytes(free))
+		}
+	}
+
+	// Clock skew, which makes peers flag this node's blocks and breaks time attestations
+	if now, err := queryNTPTime(ntpServer); err != nil {
+		report("clock", checkWarn, "cannot query %s: %v", ntpServer, err)
+	} else {
+		skew := time.Until(now)
+		if skew < 0 {
+			skew = -skew
+		}
+		skew = skew.Round(time.Millisecond)
+		switch {
+		case skew > timeTolerance:
+			report("clock", checkFail, "off by %s from %s, more than the %s tolerance of time attestations", skew, ntpServer, timeTolerance)
+		case skew > doctorClockWarn:
+			report("clock", checkWarn, "off by %s from %s", skew, ntpServer)
+		default:
+			report("clock", checkPass, "within %s of %s", skew, ntpServer)
+		}
+	}
+
+	// Peers
+	for _, peer := range strings.Split(flagValue("peers"), ",") {
+		if peer = normalizePeerAddress(peer); peer == "" {
+			continue
+		}
+		if !validPeerAddress(peer) {
+			report("peer", checkFail, "%s is invalid or blocked by the outbound filters", peer)
+			continue
+		}
+		started := time.Now()
+		if status, err := fetchPeerStatus(peer); err != nil {
+			report("peer", checkFail, "%s: %v", peer, err)
+		} else {
+			report("peer", checkPass, "%s at height %d, answered in %s", peer, status.Height, time.Since(started).Round(time.Millisecond))
+		}
+	}
+	if tag := flagValue("tailscale-tag"); tag != "" {
+		tailscaleSocket = flagValue("tailscale-socket")
+		if status, err := fetchTailscaleStatus(); err != nil {
+			report("tailnet", checkFail, "%v", err)
+		} else {
+			online := 0
+			for _, device := range status.Peer {
+				if device.Online && supports(device.Tags, tag) {
+					online++
+				}
+			}
+			outcome := checkPass
+			if online == 0 {
+				outcome = checkWarn
+			}
+			report("tailnet", outcome, "%d online devices tagged %s among %d tailnet devices", online, tag, len(status.Peer))
+		}
+	}
+
+	failed, warned := 0, 0
+	for _, check := range checks {
+		switch check.Outcome {
+		case checkFail:
+			failed++
+		case checkWarn:
+			warned++
+		}
+	}
+	fmt.Printf("%d checks: %d passed, %d with warnings, %d failed\n", len(checks), len(checks)-failed-warned, warned, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// freeDiskSpace returns the space available to the node on the file system holding path, or its nearest existing
+// parent when path does not exist yet
+func freeDiskSpace(path string) (int64, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		available, err := availableSpace(path)
+		if err == nil {
+			return available, nil
+		}
+		if !os.IsNotExist(err) || filepath.Dir(path) == path {
+			return 0, err
+		}
+		path = filepath.Dir(path)
+	}
+}
+
+// handleJob reports the status of a job so clients can detect transactions that never confirm
+func handleJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Jobs can be looked up by ID or by the idempotency key they were submitted with
+	id := r.URL.Query().Get("id")
+	mutex.Lock()
+	if key := r.URL.Query().Get("key"); id == "" && key != "" {
+		id = idempotencyKeys[idempotencyScope(clientIPFromRequest(r), key)]
+	}
+	job, ok := jobs[id]
+	var snapshot Job
+	if ok {
+		snapshot = *job
+		snapshot.Height = currentBlock.BlockNumber
+	}
+	mutex.Unlock()
+
+	if !ok {
+		http.Error(w, "Unknown job", http.StatusNotFound)
+		return
+	}
+
+	writeJob(w, snapshot)
+}
+
+// requiredSubmitPoW returns the proof-of-work difficulty currently required of job submissions, raised by
+// one bit for every submitPoWLoadStep jobs executing on this node; the caller must hold mutex
+func requiredSubmitPoW() int {
+	if submitPoWBits <= 0 {
+		return 0
+	}
+	return min(submitPoWBits+inFlightJobs()/submitPoWLoadStep, maxSubmitPoWBits)
+}
+
+// inFlightJobs counts the jobs queued or executing on this node; the caller must hold mutex
+func inFlightJobs() int {
+	count := 0
+	for _, job := range jobs {
+		if job.Status == JobExecuting || job.Status == JobQueued {
+			count++
+		}
+	}
+	return count
+}
+
+// pooledResults counts the job results waiting in the pool to be mined; the caller must hold mutex
+func pooledResults() int {
+	count := 0
+	for _, tx := range transactionPool {
+		if tx.Type == TxJob {
+			count++
+		}
+	}
+	return count
+}
+
+// submissionPoWHash hashes a job spec together with the node's challenge and the submitter's proof-of-work nonce
+func submissionPoWHash(jobID, hashes string, args []string, challenge, nonce string) [32]byte {
+	encodedArgs, _ := json.Marshal(args)
+	return sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%s|%s|%s", jobID, hashes, encodedArgs, challenge, nonce)))
+}
+
+// submitPoWWindowAt returns the challenge window a time falls in
+func submitPoWWindowAt(t time.Time) int64 {
+	return t.Unix() / int64(submitPoWWindow/time.Second)
+}
+
+// submitPoWChallenge returns this node's proof-of-work challenge for a window: the window and a MAC over it, so
+// the node can check challenges without keeping them
+func submitPoWChallenge(window int64) string {
+	mac := hmac.New(sha256.New, submitPoWKey)
+	fmt.Fprintf(mac, "%d", window)
+	return fmt.Sprintf("%d.%x", window, mac.Sum(nil)[:16])
+}
+
+// checkSubmitPoWChallenge returns the window of a challenge this node issued for the current or previous window
+func checkSubmitPoWChallenge(challenge string) (int64, bool) {
+	text, _, _ := strings.Cut(challenge, ".")
+	window, err := strconv.ParseInt(text, 10, 64)
+	current := submitPoWWindowAt(time.Now())
+	if err != nil || window < current-1 || window > current {
+		return 0, false
+	}
+	return window, hmac.Equal([]byte(challenge), []byte(submitPoWChallenge(window)))
+}
+
+// spendSubmitPoW records an accepted stamp, reporting false when it was accepted before. The stamps of expired
+// challenges are forgotten a whole window at a time, so the cost does not grow with the stamps kept; the caller
+// must hold mutex.
+func spendSubmitPoW(stamp [32]byte, window int64) bool {
+	if spentSubmitPoW[window][stamp] {
+		return false
+	}
+	current := submitPoWWindowAt(time.Now())
+	for issued := range spentSubmitPoW {
+		if issued < current-1 {
+			delete(spentSubmitPoW, issued)
+		}
+	}
+	if spentSubmitPoW[window] == nil {
+		spentSubmitPoW[window] = make(map[[32]byte]bool)
+	}
+	spentSubmitPoW[window][stamp] = true
+	return true
+}
+
+// SolveSubmissionPoW finds a nonce whose hash with a job spec and a node's challenge has at least difficulty
+// leading zero bits, as a node asks of submitters under load
+func SolveSubmissionPoW(jobID, hashes string, args []string, challenge string, difficulty int) string {
+	for nonce := 0; ; nonce++ {
+		candidate := strconv.Itoa(nonce)
+		if leadingZeroBits(submissionPoWHash(jobID, hashes, args, challenge, candidate)) >= difficulty {
+			return candidate
+		}
+	}
+}
+
+// leadingZeroBits counts the leading zero bits of a hash
+func leadingZeroBits(hash [32]byte) int {
+	zeros := 0
+	for _, b := range hash {
+		if b != 0 {
+			return zeros + bits.LeadingZeros8(b)
+		}
+		zeros += 8
+	}
+	return zeros
+}
+
+// handleReceive handles job submissions at /jobs: the IPFS hashes of a script and its input, executed by this node
+func handleReceive(w http.ResponseWriter, r *http.Request) {
+	// Identify the client by its certificate under mutual TLS, or by its IP address
+	clientIP := requestIdentity(r)
+	fmt.Printf("Received request from: %s\n", clientIP)
+
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	// Other nodes refuse the results of a revoked identity, so its jobs would never confirm
+	mutex.Lock()
+	own, ownRevoked := revoked[nodeID]
+	mutex.Unlock()
+	if ownRevoked {
+		http.Error(w, fmt.Sprintf("This node's identity was revoked in block %d; submit to another node", own.BlockNumber), http.StatusServiceUnavailable)
+		return
+	}
+	// A node that forwarded the job vouches for its submitter. Jobs run in python, and a forwarded job is never
+	// forwarded again, so a node without it refuses them unless a cluster's workers may run them.
+	forwarder := strings.ToLower(strings.TrimSpace(r.Header.Get("X-Job-Forwarder")))
+	forwarderSignature := strings.TrimSpace(r.Header.Get("X-Job-Forwarder-Signature"))
+	if forwarder != "" {
+		if err := runtimeAvailable("python"); err != nil && !clusterEnabled {
+			http.Error(w, fmt.Sprintf("This node cannot execute jobs: %v", err), http.StatusServiceUnavailable)
+			return
+		}
+		submitter := strings.TrimSpace(r.Header.Get("X-Job-Submitter"))
+		if submitter == "" || !verifyForwarder(forwarder, forwarderSignature, r.Header.Get("X-Job-ID"), submitter) {
+			http.Error(w, "Invalid forwarder signature", http.StatusBadRequest)
+			return
+		}
+		mutex.Lock()
+		revocation, isRevoked := revoked[forwarder]
+		mutex.Unlock()
+		if isRevoked {
+			http.Error(w, fmt.Sprintf("Forwarder %s was revoked in block %d", forwarder, revocation.BlockNumber), http.StatusForbidden)
+			return
+		}
+		// Any key can sign a forward, so only peers may vouch for submitters and bypass their quotas
+		if !knownPeerIdentity(forwarder) {
+			http.Error(w, fmt.Sprintf("Forwarder %s is not a known peer of this node", forwarder), http.StatusForbidden)
+			return
+		}
+		clientIP = submitter
+	}
+
+	// The hashes arrive either streamed as NDJSON lines, acknowledged one by one, or as a comma-separated string.
+	// A streamed submission's response has already started, so the rest of it is sent as its final line.
+	var body []byte
+	var hashes []string
+	if strings.TrimSpace(strings.Split(r.Header.Get("Content-Type"), ";")[0]) == "application/x-ndjson" {
+		stream, streamed, ok := receiveStreamedHashes(w, r)
+		if !ok {
+			return
+		}
+		defer stream.finish()
+		w, hashes = stream, streamed
+		body = []byte(strings.Join(hashes, ","))
+	} else {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+			return
+		}
+		defer r.Body.Close()
+
+		// Split the received hash string by commas
+		hashes = strings.Split(string(body), ",")
+		for i := range hashes {
+			hashes[i] = strings.TrimSpace(hashes[i])
+		}
+	}
+	if len(hashes) < 2 || len(hashes) > 2+maxJobInputs {
+		http.Error(w, fmt.Sprintf("Expected the hashes of the Python file and the text file, followed by at most %d further input files", maxJobInputs), http.StatusBadRequest)
+		return
+	}
+	for _, hash := range hashes {
+		if !validCID(hash) {
+			http.Error(w, "Hashes must be IPFS CIDs", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Retrieve Python and text file hashes, and the hashes of further input files
+	pythonHash, txtHash, inputs := hashes[0], hashes[1], hashes[2:]
+	if len(inputs) == 0 {
+		inputs = nil
+	}
+
+	// Optional extra script arguments, sent as a JSON array
+	var args []string
+	if header := r.Header.Get("X-Job-Args"); header != "" {
+		if err := json.Unmarshal([]byte(header), &args); err != nil || len(args) > maxJobArgs {
+			http.Error(w, fmt.Sprintf("X-Job-Args must be a JSON array of at most %d strings", maxJobArgs), http.StatusBadRequest)
+			return
+		}
+		for _, arg := range args {
+			if len(arg) > maxJobArgLength {
+				http.Error(w, fmt.Sprintf("Job arguments are limited to %d characters", maxJobArgLength), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	// Optional JSON Schema the script's output must match, checked before the result becomes a transaction
+	outputSchema := strings.TrimSpace(r.Header.Get("X-Job-Output-Schema"))
+	if outputSchema != "" {
+		if len(outputSchema) > maxOutputSchemaBytes {
+			http.Error(w, fmt.Sprintf("Output schemas are limited to %d bytes", maxOutputSchemaBytes), http.StatusBadRequest)
+			return
+		}
+		if _, err := parseOutputSchema(outputSchema); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid X-Job-Output-Schema: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Optional metadata labels, sent as key=value pairs separated by commas
+	labels, err := parseLabels(r.Header.Get("X-Job-Labels"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid X-Job-Labels: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	// Optional X25519 public key of the submitter; the result is then stored encrypted for it
+	encryptTo := strings.ToLower(strings.TrimSpace(r.Header.Get("X-Job-Encrypt-To")))
+	if encryptTo != "" {
+		if _, err := parseResultKey(encryptTo); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid X-Job-Encrypt-To: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Nodes restricting execution refuse scripts that are neither allow-listed nor signed by a trusted author
+	// before anything is downloaded
+	scriptSignature := strings.TrimSpace(r.Header.Get("X-Job-Script-Signature"))
+	if err := checkScriptPolicy(pythonHash, scriptSignature); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	// Scripts have no network unless the job asks for egress to destinations the operator permits
+	policy, err := parseNetworkPolicy(r.Header.Get("X-Job-Network"))
+	if err != nil || policy.Host {
+		http.Error(w, "Invalid X-Job-Network: expected none or egress=<host:port,...>", http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get("X-Job-Network") != "" && jobSandbox == sandboxOff {
+		http.Error(w, "This node runs scripts without a sandbox and cannot enforce network policies", http.StatusForbidden)
+		return
+	}
+	for _, destination := range policy.Egress {
+		if !egressPermitted(destination) {
+			http.Error(w, fmt.Sprintf("This node does not let jobs reach %s", destination), http.StatusForbidden)
+			return
+		}
+	}
+
+	// Low-priority jobs may be deferred while the node mines or syncs
+	priority := strings.ToLower(strings.TrimSpace(r.Header.Get("X-Job-Priority")))
+	switch priority {
+	case "normal":
+		priority = PriorityNormal
+	case PriorityNormal, PriorityLow:
+	default:
+		http.Error(w, "Invalid X-Job-Priority: expected low or normal", http.StatusBadRequest)
+		return
+	}
+
+	// A fee is recorded in the job's transaction and billed with its usage; it is settled off chain, so it does not
+	// order the job in the pool
+	var fee int64
+	if value := r.Header.Get("X-Job-Fee"); value != "" {
+		if fee, err = strconv.ParseInt(strings.TrimSpace(value), 10, 64); err != nil || fee < 0 {
+			http.Error(w, "Invalid X-Job-Fee: expected a non-negative integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// A submitter key lets the submitter co-sign the job's usage once it confirms
+	submitterKey := strings.ToLower(strings.TrimSpace(r.Header.Get("X-Submitter-Key")))
+	if key, err := hex.DecodeString(submitterKey); submitterKey != "" && (err != nil || len(key) != ed25519.PublicKeySize) {
+		http.Error(w, "Invalid X-Submitter-Key: expected a hex-encoded ed25519 public key", http.StatusBadRequest)
+		return
+	}
+
+	// Register the job so the client can follow it until it is confirmed
+	jobID := strings.TrimSpace(r.Header.Get("X-Job-ID"))
+
+	// Under spam protection the submitter must solve a hashcash puzzle over the job spec and a recent challenge
+	// of this node, which requires choosing the job ID up front. Each stamp is accepted once. Forwarded jobs
+	// were charged by the peer that vouches for their submitter.
+	mutex.Lock()
+	required := requiredSubmitPoW()
+	mutex.Unlock()
+	if required > 0 && forwarder == "" {
+		nonce, challenge := r.Header.Get("X-Job-PoW"), r.Header.Get("X-Job-PoW-Challenge")
+		window, fresh := checkSubmitPoWChallenge(challenge)
+		stamp := submissionPoWHash(jobID, string(body), args, challenge, nonce)
+		solved := jobID != "" && nonce != "" && fresh && leadingZeroBits(stamp) >= required
+		if solved {
+			mutex.Lock()
+			solved = spendSubmitPoW(stamp, window)
+			mutex.Unlock()
+		}
+		if !solved {
+			w.Header().Set("X-PoW-Difficulty", strconv.Itoa(required))
+			w.Header().Set("X-PoW-Challenge", submitPoWChallenge(submitPoWWindowAt(time.Now())))
+			http.Error(w, fmt.Sprintf("Submission requires an X-Job-ID and an unused proof of work of %d bits over the X-PoW-Challenge in X-Job-PoW", required), http.StatusPreconditionRequired)
+			return
+		}
+	}
+
+	if jobID == "" {
+		jobID = GenerateJobID()
+	}
+	idempotencyKey := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+	mutex.Lock()
+	if idempotencyKey != "" {
+		// A resubmission with a known key returns the existing job instead of rerunning it,
+		// unless the earlier attempt failed
+		existingID := idempotencyKeys[idempotencyScope(clientIP, idempotencyKey)]
+		if existing, ok := jobs[existingID]; ok && existing.Status != JobFailed {
+			snapshot := *existing
+			snapshot.Height = currentBlock.BlockNumber
+			mutex.Unlock()
+			fmt.Printf("Replaying job %s for idempotency key %s\n", snapshot.ID, idempotencyKey)
+			w.Header().Set("X-Job-ID", snapshot.ID)
+			w.Header().Set("Idempotent-Replayed", "true")
+			writeJob(w, snapshot)
+			return
+		}
+	}
+	// Submitters choose job IDs, so an ID in use is refused instead of replacing another submitter's job; only
+	// the submitter of a failed job may run it again under the same ID
+	if existing, ok := jobs[jobID]; ok && (existing.Submitter != clientIP || existing.Status != JobFailed) || txIndex[jobID] > 0 {
+		mutex.Unlock()
+		http.Error(w, fmt.Sprintf("Job ID %s is already in use", jobID), http.StatusConflict)
+		return
+	}
+	if idempotencyKey != "" {
+		idempotencyKeys[idempotencyScope(clientIP, idempotencyKey)] = jobID
+	}
+	jobs[jobID] = &Job{ID: jobID, Submitter: clientIP, Status: JobExecuting, PythonHash: pythonHash, TxtHash: txtHash, Inputs: inputs, Args: args, OutputSchema: outputSchema, Labels: labels, EncryptTo: encryptTo, ScriptSignature: scriptSignature, Network: policy.String(), Priority: priority, Fee: fee, PoW: r.Header.Get("X-Job-PoW"), Forwarder: forwarder, ForwarderSignature: forwarderSignature, SubmitterKey: submitterKey}
+	mutex.Unlock()
+	w.Header().Set("X-Job-ID", jobID)
+
+	// Jobs on nodes with configured approvers wait for enough approval signatures before they run
+	if len(approvers) > 0 {
+		mutex.Lock()
+		job := jobs[jobID]
+		job.Status = JobAwaitingApproval
+		snapshot := *job
+		snapshot.Height = currentBlock.BlockNumber
+		mutex.Unlock()
+		fmt.Printf("Job %s is awaiting %d of %d approvals\n", jobID, approvalThreshold, len(approvers))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(snapshot)
+		return
+	}
+
+	if err := executeJob(jobID, clientIP, pythonHash, txtHash, args); err != nil {
+		var sizeErr *SizeError
+		if errors.As(err, &sizeErr) {
+			writeSizeError(w, sizeErr)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Println("Hashes processed successfully")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Hashes processed successfully"))
+}
+
+// SubmissionLine is a line of a streamed job submission: the client sends one per file, the script first and its
+// input file second, and the miner answers each with an acknowledgement or an error, ending with the outcome
+type SubmissionLine struct {
+	CID    string            // IPFS hash of a file, sent by the client and echoed in its acknowledgement
+	Line   int               // Number of the acknowledged line, counting from 1
+	Error  string            // Why the line was refused; the miner reads no further lines
+	Done   bool              // Whether this is the final line, holding the outcome of the submission
+	Status int               // HTTP status of the submission, in the final line
+	Header map[string]string // Headers of the outcome, such as X-Job-ID, in the final line
+	Body   string            // Body of the outcome, in the final line
+}
+
+// submissionStream collects the outcome of a streamed submission after its acknowledgements, so the rest of the
+// handler can answer through it as through any response writer; finish sends the outcome as the final line
+type submissionStream struct {
+	w       http.ResponseWriter
+	encoder *json.Encoder
+	header  http.Header
+	status  int
+	body    bytes.Buffer
+}
+
+func (s *submissionStream) Header() http.Header { return s.header }
+
+func (s *submissionStream) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+}
+
+func (s *submissionStream) Write(data []byte) (int, error) {
+	s.WriteHeader(http.StatusOK)
+	return s.body.Write(data)
+}
+
+// send writes a line of the response and flushes it to the client
+func (s *submissionStream) send(line SubmissionLine) {
+	s.encoder.Encode(line)
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// finish sends the outcome of the submission as the final line
+func (s *submissionStream) finish() {
+	line := SubmissionLine{Done: true, Status: s.status, Body: s.body.String(), Header: make(map[string]string)}
+	if line.Status == 0 {
+		line.Status = http.StatusOK
+	}
+	for name := range s.header {
+		line.Header[name] = s.header.Get(name)
+	}
+	s.send(line)
+}
+
+// receiveStreamedHashes reads the hashes of a submission streamed as NDJSON lines of SubmissionLine, answering
+// each with an acknowledgement as it arrives. Clients keep at most X-Submission-Window lines unacknowledged, so a
+// busy miner slows them down by reading slowly. A refused line ends the submission with its error.
+func receiveStreamedHashes(w http.ResponseWriter, r *http.Request) (*submissionStream, []string, bool) {
+	// Acknowledgements are written while the body is still being read
+	if err := http.NewResponseController(w).EnableFullDuplex(); err != nil && r.ProtoMajor == 1 {
+		http.Error(w, "Streamed submissions are not supported on this connection", http.StatusBadRequest)
+		return nil, nil, false
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Submission-Window", strconv.Itoa(submissionWindow))
+	w.WriteHeader(http.StatusOK)
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush() // Delivers the window before the first line is read
+	}
+	stream := &submissionStream{w: w, encoder: json.NewEncoder(w), header: make(http.Header)}
+
+	refuse := func(line int, status int, message string) {
+		stream.send(SubmissionLine{Line: line, Error: message})
+		http.Error(stream, message, status)
+		stream.finish()
+	}
+	var hashes []string
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, maxSubmissionLineLen), maxSubmissionLineLen)
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		number := len(hashes) + 1
+		var line SubmissionLine
+		switch {
+		case json.Unmarshal([]byte(text), &line) != nil:
+			refuse(number, http.StatusBadRequest, fmt.Sprintf("line %d is not a JSON object", number))
+			return nil, nil, false
+		case !validCID(line.CID):
+			refuse(number, http.StatusBadRequest, fmt.Sprintf("line %d does not hold an IPFS CID", number))
+			return nil, nil, false
+		case number > 2+maxJobInputs:
+			refuse(number, http.StatusBadRequest, fmt.Sprintf("a job references at most %d further input files", maxJobInputs))
+			return nil, nil, false
+		}
+		hashes = append(hashes, line.CID)
+		stream.send(SubmissionLine{Line: number, CID: line.CID})
+	}
+	if err := scanner.Err(); err != nil {
+		refuse(len(hashes)+1, http.StatusBadRequest, fmt.Sprintf("failed to read the submission: %v", err))
+		return nil, nil, false
+	}
+	return stream, hashes, true
+}
+
+// usageMessage returns the bytes an executor signs to attest the resources a job consumed and the fee offered
+// for it, which billing relies on. Jobs without a fee sign the same bytes as before job fees existed.
+func usageMessage(tx Transaction) []byte {
+	message := fmt.Sprintf("usage|%s|%s|%s|%s|%d|%d|%d", genesisHash, tx.JobID, tx.ID, tx.Executor, tx.ExecutionTime, tx.CPUTime, tx.ComputeUnits)
+	if tx.Fee != 0 {
+		message += fmt.Sprintf("|fee=%d", tx.Fee)
+	}
+	return []byte(message)
+}
+
+// verifyUsage checks the executor's usage signature of a job transaction
+func verifyUsage(tx Transaction) bool {
+	publicKey, err := hex.DecodeString(tx.Executor)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize || tx.Executor != strings.ToLower(tx.Executor) {
+		return false
+	}
+	signature, err := hex.DecodeString(tx.UsageSignature)
+	return err == nil && ed25519.Verify(publicKey, usageMessage(tx), signature)
+}
+
+// ReceiptMessage returns the bytes a submitter signs to co-sign a confirmed job's usage: the usage and fee the
+// transaction records and the executor's signature over them, which binds the receipt to the network
+func ReceiptMessage(tx Transaction) []byte {
+	return []byte(fmt.Sprintf("receipt|%s|%s|%d|%d|%d|%d|%s", tx.JobID, tx.Executor, tx.ExecutionTime, tx.CPUTime, tx.ComputeUnits, tx.Fee, tx.UsageSignature))
+}
+
+// verifyReceipt checks a submitter's hex-encoded receipt over a job transaction's usage
+func verifyReceipt(submitterKey, receipt string, tx Transaction) bool {
+	publicKey, err := hex.DecodeString(submitterKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return false
+	}
+	signature, err := hex.DecodeString(receipt)
+	return err == nil && ed25519.Verify(publicKey, ReceiptMessage(tx), signature)
+}
+
+// UsageReceipt is a submitter's co-signature over the usage of one of its confirmed jobs, posted to /job/receipt
+type UsageReceipt struct {
+	JobID     string // Confirmed job whose usage is co-signed
+	Signature string // Hex-encoded ed25519 signature of the job's submitter key over ReceiptMessage
+}
+
+// handleJobReceipt stores a submitter's receipt for a confirmed job it submitted to this node with a submitter key,
+// so the billing report can tell co-signed usage from usage only the executor attests
+func handleJobReceipt(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var receipt UsageReceipt
+	if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&receipt); err != nil {
+		http.Error(w, "Failed to decode receipt", http.StatusBadRequest)
+		return
+	}
+	location, confirmed := findTransaction(receipt.JobID)
+	mutex.Lock()
+	defer mutex.Unlock()
+	job, ok := jobs[receipt.JobID]
+	switch {
+	case !ok:
+		http.Error(w, "Unknown job", http.StatusNotFound)
+	case job.SubmitterKey == "":
+		http.Error(w, "Job was submitted without a submitter key", http.StatusConflict)
+	case !confirmed || location.Transaction.Type != TxJob:
+		http.Error(w, "Job is not confirmed", http.StatusConflict)
+	case !verifyReceipt(job.SubmitterKey, receipt.Signature, location.Transaction):
+		http.Error(w, "Invalid signature", http.StatusForbidden)
+	default:
+		job.Receipt = receipt.Signature
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// forwardMessage returns the bytes a forwarder signs to vouch for the submitter of a job it forwards
+func forwardMessage(jobID, submitter string) []byte {
+	return []byte("forward|" + genesisHash + "|" + jobID + "|" + submitter)
+}
+
+// verifyForwarder checks a forwarder's hex-encoded signature over a job ID and submitter
+func verifyForwarder(forwarder, signature, jobID, submitter string) bool {
+	publicKey, err := hex.DecodeString(forwarder)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize || forwarder != strings.ToLower(forwarder) {
+		return false
+	}
+	sig, err := hex.DecodeString(signature)
+	return err == nil && ed25519.Verify(publicKey, forwardMessage(jobID, submitter), sig)
+}
+
+// knownPeerIdentity reports whether identity is the node identity a known peer reported in its status handshake
+func knownPeerIdentity(identity string) bool {
+	for _, peer := range knownPeers() {
+		if capabilitiesOf(peer).Identity == identity {
+			return true
+		}
+	}
+	return false
+}
+
+// capableExecutors returns the known peers advertising the python runtime
+func capableExecutors() []string {
+	var capable []string
+	for _, peer := range knownPeers() {
+		caps := capabilitiesOf(peer)
+		mutex.Lock()
+		_, isRevoked := revoked[caps.Identity]
+		mutex.Unlock()
+		if supports(caps.Runtimes, "python") && !isRevoked {
+			capable = append(capable, peer)
+		}
+	}
+	return capable
+}
+
+// delegateJob forwards a job this node cannot run to the first capable peer that accepts it, vouching for its
+// submitter, and copies the peer's result into the local job record. The peer executes the job and mines its
+// transaction, which records this node as the forwarder; the job confirms here once that block arrives.
+func delegateJob(jobID string, reason error) error {
+	mutex.Lock()
+	job, ok := jobs[jobID]
+	if !ok {
+		mutex.Unlock()
+		return fmt.Errorf("unknown job %s", jobID)
+	}
+	spec := *job
+	mutex.Unlock()
+
+	transport := peerClient.Transport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = 0 // The peer only answers once the job has run
+	client := &http.Client{Transport: transport, Timeout: endpointTimeouts["/jobs"]}
+	signature := hex.EncodeToString(ed25519.Sign(nodeKey, forwardMessage(jobID, spec.Submitter)))
+	body := strings.Join(append([]string{spec.PythonHash, spec.TxtHash}, spec.Inputs...), ",")
+
+	var failures []string
+	for _, peer := range capableExecutors() {
+		req, err := http.NewRequest(http.MethodPost, peerURL(peer, "/jobs"), strings.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("X-Job-ID", jobID)
+		req.Header.Set("X-Job-Submitter", spec.Submitter)
+		req.Header.Set("X-Job-Forwarder", nodeID)
+		req.Header.Set("X-Job-Forwarder-Signature", signature)
+		if len(spec.Args) > 0 {
+			encoded, _ := json.Marshal(spec.Args)
+			req.Header.Set("X-Job-Args", string(encoded))
+		}
+		for header, value := range map[string]string{
+			"X-Job-Output-Schema":    spec.OutputSchema,
+			"X-Job-Labels":           formatLabels(spec.Labels),
+			"X-Job-Encrypt-To":       spec.EncryptTo,
+			"X-Job-Script-Signature": spec.ScriptSignature,
+			"X-Job-Priority":         spec.Priority,
+			"X-Submitter-Key":        spec.SubmitterKey,
+		} {
+			if value != "" {
+				req.Header.Set(header, value)
+			}
+		}
+		if spec.Network != (NetworkPolicy{}).String() {
+			req.Header.Set("X-Job-Network", spec.Network)
+		}
+		if spec.Fee > 0 {
+			req.Header.Set("X-Job-Fee", strconv.FormatInt(spec.Fee, 10))
+		}
+
+		fmt.Printf("Forwarding job %s to %s: %v\n", jobID, peer, reason)
+		resp, err := client.Do(req)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", peer, err))
+			continue
+		}
+		reply, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			failures = append(failures, fmt.Sprintf("%s: status %d: %s", peer, resp.StatusCode, strings.TrimSpace(string(reply))))
+			continue
+		}
+
+		// Proxy the result back into the local record so the submitter can follow the job on this node
+		executed, err := fetchPeerJob(peer, jobID)
+		mutex.Lock()
+		if job, ok := jobs[jobID]; ok {
+			job.DelegatedTo = peer
+			if err == nil {
+				job.Result, job.ResultCID, job.OutputCID = executed.Result, executed.ResultCID, executed.OutputCID
+				job.ExecutionTime, job.CPUTime = executed.ExecutionTime, executed.CPUTime
+			}
+			if job.Status != JobConfirmed {
+				job.Status = JobPending
+			}
+		}
+		mutex.Unlock()
+		fmt.Printf("Job %s was executed by peer %s\n", jobID, peer)
+		return nil
+	}
+	if len(failures) == 0 {
+		return fmt.Errorf("%w, and no known peer advertises the python runtime", reason)
+	}
+	return fmt.Errorf("%w, and no capable peer accepted the job: %s", reason, strings.Join(failures, "; "))
+}
+
+// fetchPeerJob reads a job's record from a peer
+func fetchPeerJob(peer, jobID string) (Job, error) {
+	var job Job
+	resp, err := peerClient.Get(peerURL(peer, "/job?id="+url.QueryEscape(jobID)))
+	if err != nil {
+		return job, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return job, fmt.Errorf("peer returned status %d", resp.StatusCode)
+	}
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&job)
+	return job, err
+}
+
+// scriptSignatureMessage returns the bytes an author signs to vouch for a script
+func scriptSignatureMessage(cid string) []byte {
+	return []byte("script|" + cid)
+}
+
+// checkScriptPolicy enforces -script-allowlist and -trusted-authors: when either is set, a script runs only if
+// its CID is allow-listed or the job carries a trusted author's signature over it
+func checkScriptPolicy(cid, signature string) error {
+	if scriptAllowlist == nil && len(trustedAuthors) == 0 {
+		return nil
+	}
+	if scriptAllowlist[cid] {
+		return nil
+	}
+	if signature == "" {
+		return fmt.Errorf("script %s is not allow-listed on this node and carries no author signature", cid)
+	}
+	author, encoded, _ := strings.Cut(signature, ":")
+	author = strings.ToLower(author)
+	trusted := false
+	for _, key := range trustedAuthors {
+		trusted = trusted || key == author
+	}
+	if !trusted {
+		return fmt.Errorf("script %s is signed by %q, who is not a trusted author on this node", cid, author)
+	}
+	publicKey, _ := hex.DecodeString(author)
+	sig, err := hex.DecodeString(encoded)
+	if err != nil || !ed25519.Verify(publicKey, scriptSignatureMessage(cid), sig) {
+		return fmt.Errorf("the author signature of script %s is invalid", cid)
+	}
+	return nil
+}
+
+// loadScriptAllowlist reads allow-listed script CIDs, one per line. Blank lines and lines starting with # are
+// ignored.
+func loadScriptAllowlist(path string) (map[string]bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read script allow-list: %w", err)
+	}
+	allowed := make(map[string]bool)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !validCID(line) {
+			return nil, fmt.Errorf("line %d of %s: invalid CID %q", i+1, path, line)
+		}
+		allowed[line] = true
+	}
+	return allowed, nil
+}
+
+// runScript signs script CIDs with the node key, for nodes that list this node's ID with -trusted-authors
+func runScript(args []string, keyFile string) {
+	if len(args) != 2 || args[0] != "sign" {
+		fmt.Println("Usage: miner [flags] script sign <cid>")
+		return
+	}
+	if !validCID(args[1]) {
+		fmt.Printf("Invalid CID %q\n", args[1])
+		return
+	}
+	key, err := loadOrCreateNodeKey(keyFile)
+	if err != nil {
+		fmt.Printf("Error loading node key: %v\n", err)
+		return
+	}
+	publicKey := key.Public().(ed25519.PublicKey)
+	fmt.Printf("%x:%x\n", publicKey, ed25519.Sign(key, scriptSignatureMessage(args[1])))
+}
+
+// Approval decisions
+const (
+	DecisionApprove = "approve"
+	DecisionReject  = "reject"
+)
+
+// ApprovalDecision is an approver's signed verdict on a job awaiting approval
+type ApprovalDecision struct {
+	JobID     string // Job being decided on
+	Approver  string // Hex-encoded public key of the approver
+	Signature string // Hex-encoded ed25519 signature over the decision and the job spec
+}
+
+// approvalMessage returns the bytes an approver signs, binding the decision to the job's script, inputs and
+// arguments
+func approvalMessage(decision string, job Job) []byte {
+	encodedArgs, _ := json.Marshal(job.Args)
+	inputs := job.TxtHash
+	if len(job.Inputs) > 0 {
+		inputs += "," + strings.Join(job.Inputs, ",")
+	}
+	return []byte(fmt.Sprintf("%s|%s|%s|%s|%s", decision, job.ID, job.PythonHash, inputs, encodedArgs))
+}
+
+// isApprover reports whether a public key belongs to one of the configured approvers
+func isApprover(key string) bool {
+	for _, approver := range approvers {
+		if approver == key {
+			return true
+		}
+	}
+	return false
+}
+
+// handleJobDecision records an approval or rejection of a job awaiting approval, starting the job once
+// enough approvers have signed off and rejecting it once the threshold can no longer be reached
+func handleJobDecision(decision string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var d ApprovalDecision
+		if err := json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&d); err != nil {
+			http.Error(w, "Failed to decode decision", http.StatusBadRequest)
+			return
+		}
+		if !isApprover(d.Approver) {
+			http.Error(w, "Unknown approver", http.StatusForbidden)
+			return
+		}
+		publicKey, _ := hex.DecodeString(d.Approver)
+		signature, err := hex.DecodeString(d.Signature)
+		if err != nil {
+			http.Error(w, "Invalid signature encoding", http.StatusBadRequest)
+			return
+		}
+
+		mutex.Lock()
+		job, ok := jobs[d.JobID]
+		if !ok {
+			mutex.Unlock()
+			http.Error(w, "Unknown job", http.StatusNotFound)
+			return
+		}
+		if job.Status != JobAwaitingApproval {
+			mutex.Unlock()
+			http.Error(w, fmt.Sprintf("Job is %s, not awaiting approval", job.Status), http.StatusConflict)
+			return
+		}
+		if !ed25519.Verify(publicKey, approvalMessage(decision, *job), signature) {
+			mutex.Unlock()
+			http.Error(w, "Invalid signature", http.StatusForbidden)
+			return
+		}
+		for _, decided := range append(job.Approvals, job.Rejections...) {
+			if decided == d.Approver {
+				mutex.Unlock()
+				http.Error(w, "Approver has already decided on this job", http.StatusConflict)
+				return
+			}
+		}
+
+		run := false
+		if decision == DecisionApprove {
+			job.Approvals = append(job.Approvals, d.Approver)
+			if len(job.Approvals) >= approvalThreshold {
+				job.Status = JobExecuting
+				run = true
+			}
+		} else {
+			job.Rejections = append(job.Rejections, d.Approver)
+			if len(job.Rejections) > len(approvers)-approvalThreshold {
+				job.Status = JobRejected
+				job.Error = fmt.Sprintf("rejected by %d of %d approvers", len(job.Rejections), len(approvers))
+			}
+		}
+		snapshot := *job
+		snapshot.Height = currentBlock.BlockNumber
+		mutex.Unlock()
+
+		fmt.Printf("Approver %s chose to %s job %s\n", d.Approver, decision, d.JobID)
+		if run {
+			go func() {
+				if err := executeJob(snapshot.ID, snapshot.Submitter, snapshot.PythonHash, snapshot.TxtHash, snapshot.Args); err != nil {
+					fmt.Printf("Approved job %s failed: %v\n", snapshot.ID, err)
+				}
+			}()
+		}
+		writeJob(w, snapshot)
+	}
+}
+
+// handleJobApprovals lists the jobs awaiting approval so approvers can review their specs
+func handleJobApprovals(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	mutex.Lock()
+	pending := []Job{}
+	for _, job := range jobs {
+		if job.Status == JobAwaitingApproval {
+			snapshot := *job
+			snapshot.Height = currentBlock.BlockNumber
+			pending = append(pending, snapshot)
+		}
+	}
+	mutex.Unlock()
+	sort.Slice(pending, func(i, j int) bool { return pending[i].ID < pending[j].ID })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pending)
+}
+
+// runApproval implements the approval subcommands, which let an approver review and sign off on jobs with the node key
+func runApproval(args []string, keyFile string) {
+	if len(args) == 0 {
+		fmt.Println("Usage: miner [flags] approval list|approve <job-id>|reject <job-id> [--node URL]")
+		return
+	}
+	key, err := loadOrCreateNodeKey(keyFile)
+	if err != nil {
+		fmt.Printf("Error loading node key: %v\n", err)
+		return
+	}
+
+	approvalFlags := flag.NewFlagSet("approval", flag.ExitOnError)
+	node := approvalFlags.String("node", localNodeURL(), "URL of the node holding the jobs")
+	command, rest := args[0], args[1:]
+	jobID := ""
+	if command != "list" && len(rest) > 0 {
+		jobID, rest = rest[0], rest[1:]
+	}
+	approvalFlags.Parse(rest)
+
+	var pending []Job
+	resp, err := nodeClient.Get(*node + "/job/approvals")
+	if err != nil {
+		fmt.Printf("Error listing jobs awaiting approval: %v\n", err)
+		return
+	}
+	err = json.NewDecoder(resp.Body).Decode(&pending)
+	resp.Body.Close()
+	if err != nil {
+		fmt.Printf("Error decoding jobs awaiting approval: %v\n", err)
+		return
+	}
+
+	switch command {
+	case "list":
+		for _, job := range pending {
+			fmt.Printf("%s script=%s input=%s args=%v approvals=%d rejections=%d\n", job.ID, job.PythonHash, job.TxtHash, job.Args, len(job.Approvals), len(job.Rejections))
+		}
+	case DecisionApprove, DecisionReject:
+		var job *Job
+		for i := range pending {
+			if pending[i].ID == jobID {
+				job = &pending[i]
+			}
+		}
+		if job == nil {
+			fmt.Printf("Job %q is not awaiting approval\n", jobID)
+			return
+		}
+		decision := ApprovalDecision{
+			JobID:     job.ID,
+			Approver:  hex.EncodeToString(key.Public().(ed25519.PublicKey)),
+			Signature: hex.EncodeToString(ed25519.Sign(key, approvalMessage(command, *job))),
+		}
+		body, err := json.Marshal(decision)
+		if err != nil {
+			fmt.Printf("Error encoding decision: %v\n", err)
+			return
+		}
+		resp, err := nodeClient.Post(*node+"/job/"+command, "application/json", bytes.NewReader(body))
+		if err != nil {
+			fmt.Printf("Error submitting decision: %v\n", err)
+			return
+		}
+		defer resp.Body.Close()
+		reply, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			fmt.Printf("Decision rejected with status %d: %s\n", resp.StatusCode, strings.TrimSpace(string(reply)))
+			return
+		}
+		var updated Job
+		json.Unmarshal(reply, &updated)
+		fmt.Printf("Job %s is %s (%d approvals, %d rejections)\n", updated.ID, updated.Status, len(updated.Approvals), len(updated.Rejections))
+	default:
+		fmt.Printf("Unknown approval command %q\n", command)
+	}
+}
+
+// schemaAnnotations are JSON Schema keywords accepted in output schemas without affecting validation
+var schemaAnnotations = map[string]bool{
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true, "default": true, "examples": true,
+}
+
+// schemaTypes are the values of the JSON Schema type keyword
+var schemaTypes = map[string]bool{
+	"null": true, "boolean": true, "object": true, "array": true, "number": true, "integer": true, "string": true,
+}
+
+// parseOutputSchema decodes a job output schema and checks that it only uses supported keywords: type, enum,
+// const, properties, required, additionalProperties, items, minItems, maxItems, minLength, maxLength, pattern,
+// minimum, maximum, exclusiveMinimum and exclusiveMaximum
+func parseOutputSchema(raw string) (interface{}, error) {
+	var schema interface{}
+	if err := json.Unmarshal([]byte(raw), &schema); err != nil {
+		return nil, fmt.Errorf("schema is not valid JSON: %w", err)
+	}
+	return schema, checkSchema(schema, "#")
+}
+
+// checkSchema checks a schema and its subschemas for unsupported keywords and malformed keyword values
+func checkSchema(schema interface{}, path string) error {
+	if _, ok := schema.(bool); ok {
+		return nil
+	}
+	object, ok := schema.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s: a schema must be an object or a boolean", path)
+	}
+	for keyword, value := range object {
+		at := path + "/" + keyword
+		valid := true
+		switch keyword {
+		case "type":
+			switch types := value.(type) {
+			case string:
+				valid = schemaTypes[types]
+			case []interface{}:
+				for _, t := range types {
+					name, isString := t.(string)
+					valid = valid && isString && schemaTypes[name]
+				}
+			default:
+				valid = false
+			}
+		case "enum":
+			_, valid = value.([]interface{})
+		case "const":
+		case "properties":
+			properties, isObject := value.(map[string]interface{})
+			valid = isObject
+			for name, property := range properties {
+				if err := checkSchema(property, at+"/"+name); err != nil {
+					return err
+				}
+			}
+		case "required":
+			names, isArray := value.([]interface{})
+			valid = isArray
+			for _, name := range names {
+				_, isString := name.(string)
+				valid = valid && isString
+			}
+		case "additionalProperties", "items":
+			if err := checkSchema(value, at); err != nil {
+				return err
+			}
+		case "minItems", "maxItems", "minLength", "maxLength":
+			n, isNumber := value.(float64)
+			valid = isNumber && n >= 0 && n == math.Trunc(n)
+		case "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum":
+			_, valid = value.(float64)
+		case "pattern":
+			pattern, isString := value.(string)
+			if _, err := regexp.Compile(pattern); !isString || err != nil {
+				valid = false
+			}
+		default:
+			if !schemaAnnotations[keyword] {
+				return fmt.Errorf("%s: unsupported keyword", at)
+			}
+		}
+		if !valid {
+			return fmt.Errorf("%s: invalid value", at)
+		}
+	}
+	return nil
+}
+
+// schemaType returns the JSON Schema type of a decoded JSON value, integer for whole numbers
+func schemaType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// validateSchema appends the violations of value against a checked schema to violations, stopping at
+// maxSchemaErrors
+func validateSchema(schema, value interface{}, path string, violations []string) []string {
+	if len(violations) >= maxSchemaErrors {
+		return violations
+	}
+	fail := func(format string, args ...interface{}) {
+		if len(violations) < maxSchemaErrors {
+			violations = append(violations, path+": "+fmt.Sprintf(format, args...))
+		}
+	}
+	if allowed, ok := schema.(bool); ok {
+		if !allowed {
+			fail("no value is allowed here")
+		}
+		return violations
+	}
+	object := schema.(map[string]interface{})
+
+	if declared, ok := object["type"]; ok {
+		actual := schemaType(value)
+		types, isList := declared.([]interface{})
+		if !isList {
+			types = []interface{}{declared}
+		}
+		matched := false
+		for _, t := range types {
+			matched = matched || t == actual || (t == "number" && actual == "integer")
+		}
+		if !matched {
+			fail("expected %v, got %s", declared, actual)
+			return violations
+		}
+	}
+	if options, ok := object["enum"].([]interface{}); ok {
+		found := false
+		for _, option := range options {
+			found = found || reflect.DeepEqual(option, value)
+		}
+		if !found {
+			fail("value is not one of the allowed values")
+		}
+	}
+	if constant, ok := object["const"]; ok && !reflect.DeepEqual(constant, value) {
+		fail("value does not equal the required constant")
+	}
+
+	switch v := value.(type) {
+	case float64:
+		if limit, ok := object["minimum"].(float64); ok && v < limit {
+			fail("%v is less than the minimum %v", v, limit)
+		}
+		if limit, ok := object["maximum"].(float64); ok && v > limit {
+			fail("%v is greater than the maximum %v", v, limit)
+		}
+		if limit, ok := object["exclusiveMinimum"].(float64); ok && v <= limit {
+			fail("%v is not greater than %v", v, limit)
+		}
+		if limit, ok := object["exclusiveMaximum"].(float64); ok && v >= limit {
+			fail("%v is not less than %v", v, limit)
+		}
+	case string:
+		length := float64(len([]rune(v)))
+		if limit, ok := object["minLength"].(float64); ok && length < limit {
+			fail("string is shorter than %v characters", limit)
+		}
+		if limit, ok := object["maxLength"].(float64); ok && length > limit {
+			fail("string is longer than %v characters", limit)
+		}
+		if pattern, ok := object["pattern"].(string); ok && !regexp.MustCompile(pattern).MatchString(v) {
+			fail("string does not match the pattern %q", pattern)
+		}
+	case []interface{}:
+		if limit, ok := object["minItems"].(float64); ok && float64(len(v)) < limit {
+			fail("array has fewer than %v items", limit)
+		}
+		if limit, ok := object["maxItems"].(float64); ok && float64(len(v)) > limit {
+			fail("array has more than %v items", limit)
+		}
+		if items, ok := object["items"]; ok {
+			for i, item := range v {
+				violations = validateSchema(items, item, fmt.Sprintf("%s/%d", path, i), violations)
+			}
+		}
+	case map[string]interface{}:
+		required, _ := object["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := v[name.(string)]; !ok {
+				fail("missing required property %q", name)
+			}
+		}
+		properties, _ := object["properties"].(map[string]interface{})
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if property, ok := properties[name]; ok {
+				violations = validateSchema(property, v[name], path+"/"+name, violations)
+			} else if additional, ok := object["additionalProperties"]; ok {
+				violations = validateSchema(additional, v[name], path+"/"+name, violations)
+			}
+		}
+	}
+	return violations
+}
+
+// checkJobOutput validates a script's output against the job's output schema, if it declared one. A rejected
+// output is recorded in the job together with the violations.
+func checkJobOutput(jobID, output string) error {
+	mutex.Lock()
+	job, ok := jobs[jobID]
+	raw := ""
+	if ok {
+		raw = job.OutputSchema
+	}
+	mutex.Unlock()
+	if raw == "" {
+		return nil
+	}
+	schema, err := parseOutputSchema(raw)
+	if err != nil {
+		return fmt.Errorf("invalid output schema: %w", err)
+	}
+
+	var violations []string
+	var value interface{}
+	if err := json.Unmarshal([]byte(output), &value); err != nil {
+		violations = []string{"#: output is not valid JSON: " + err.Error()}
+	} else {
+		violations = validateSchema(schema, value, "#", nil)
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	mutex.Lock()
+	job.Result, job.SchemaErrors = output, violations
+	mutex.Unlock()
+	fmt.Printf("Output of job %s does not match its schema: %s\n", jobID, strings.Join(violations, "; "))
+	return fmt.Errorf("output does not match the job's output schema: %s", violations[0])
+}
+
+// executeJob downloads a job's files from IPFS, runs the script and adds the result to the transaction pool,
+// marking the job failed if any step goes wrong
+func executeJob(jobID, submitter, pythonHash, txtHash string, args []string) (err error) {
+	started := time.Now()
+	defer func() {
+		if err != nil {
+			setJobStatus(jobID, JobFailed, err.Error())
+			return
+		}
+		perfCounters.jobs.Add(1)
+		perfCounters.jobLatency.Add(time.Since(started).Milliseconds())
+	}()
+	setJobStatus(jobID, JobExecuting, "")
+	mutex.Lock()
+	var labels map[string]string
+	var inputs []string
+	var encryptTo, scriptSignature, network, priority, forwarder, forwarderSignature string
+	var fee int64
+	if job, ok := jobs[jobID]; ok {
+		labels, encryptTo, scriptSignature, network = job.Labels, job.EncryptTo, job.ScriptSignature, job.Network
+		priority, fee = job.Priority, job.Fee
+		forwarder, forwarderSignature, inputs = job.Forwarder, job.ForwarderSignature, job.Inputs
+	}
+	mutex.Unlock()
+	if err := checkScriptPolicy(pythonHash, scriptSignature); err != nil {
+		return err
+	}
+	policy, err := parseNetworkPolicy(network)
+	if err != nil {
+		return err
+	}
+
+	// Let the client follow the script's output at /job/stream while it runs. The output of an encrypted job
+	// is never published in the clear, so its stream only reports completion.
+	openJobStream(jobID)
+	defer closeJobStream(jobID)
+	onLine := func(line string) { publishJobOutput(jobID, line) }
+	if encryptTo != "" {
+		onLine = nil
+	}
+
+	// A node fronting a cluster hands the execution to one of its workers, running the job itself only when
+	// no worker is available
+	var result, worker, enforced string
+	var cpuTime, elapsed time.Duration
+	if clusterEnabled {
+		outcome, err := dispatchJob(WorkerTask{JobID: jobID, PythonHash: pythonHash, TxtHash: txtHash, Inputs: inputs, Args: args, Network: network})
+		switch {
+		case errors.Is(err, errNoWorkers):
+			fmt.Printf("No executor worker is available, running job %s locally\n", jobID)
+		case err != nil:
+			return err
+		case outcome.Error != "":
+			return fmt.Errorf("%s on worker %s", outcome.Error, outcome.Worker)
+		default:
+			worker, result, enforced = outcome.Worker, outcome.Output, outcome.Network
+			cpuTime = time.Duration(outcome.CPUTime) * time.Millisecond
+			elapsed = time.Duration(outcome.ExecutionTime) * time.Millisecond
+			fmt.Printf("Job %s was executed by worker %s\n", jobID, worker)
+		}
+	}
+	if worker == "" {
+		if err := runtimeAvailable("python"); err != nil {
+			if forwarder != "" {
+				return err
+			}
+			return delegateJob(jobID, err)
+		}
+		release := scheduler.Acquire(submitter, priority, func() { setJobStatus(jobID, JobQueued, "") })
+		setJobStatus(jobID, JobExecuting, "")
+		result, cpuTime, elapsed, err = runJobFiles(pythonHash, txtHash, inputs, args, policy, onLine)
+		enforced = enforcedPolicy(policy).String()
+		release(elapsed)
+		if err != nil {
+			if encryptTo != "" {
+				return withheldOutput(err)
+			}
+			return err
+		}
+	}
+	if err := checkJobOutput(jobID, result); err != nil {
+		if encryptTo != "" {
+			// The violations quote values of the output, so they are withheld along with it
+			mutex.Lock()
+			if job, ok := jobs[jobID]; ok {
+				job.Result, job.SchemaErrors = "", nil
+			}
+			mutex.Unlock()
+			return errors.New("output does not match the job's output schema")
+		}
+		return err
+	}
+	mutex.Lock()
+	if job, ok := jobs[jobID]; ok {
+		job.Worker = worker
+	}
+	mutex.Unlock()
+	var resultCID, resultHash string
+	if encryptTo != "" {
+		if resultCID, resultHash, err = encryptResult(jobID, encryptTo, result); err != nil {
+			return err
+		}
+		result = ""
+	}
+	transaction := Transaction{
+		ID:            submitter,
+		Data:          result,
+		JobID:         jobID,
+		Executor:      nodeID,
+		Fee:           fee,
+		Args:          args,
+		Runtime:       "python",
+		ExecutionTime: elapsed.Milliseconds(),
+		CPUTime:       cpuTime.Milliseconds(),
+		ComputeUnits:  computeUnits(cpuTime.Milliseconds()),
+		PythonHash:    pythonHash,
+		TxtHash:       txtHash,
+		Inputs:        inputs,
+		Labels:        labels,
+		ResultCID:     resultCID,
+		ResultHash:    resultHash,
+		Network:       enforced,
+
+		Forwarder:          forwarder,
+		ForwarderSignature: forwarderSignature,
+	}
+	transaction.UsageSignature = hex.EncodeToString(ed25519.Sign(nodeKey, usageMessage(transaction)))
+	if err := truncateOutput(&transaction); err != nil {
+		return err
+	}
+
+	// Add transaction to pool, rejecting results that would make a block invalid under the network's limits
+	if err := addTransaction(transaction); err != nil {
+		var sizeErr *SizeError
+		if errors.As(err, &sizeErr) {
+			return err
+		}
+		return fmt.Errorf("execution exceeded network limits: %w", err)
+	}
+	recordJobResult(jobID, transaction)
+
+	// Start mining the block
+	go mineBlock(nodeID, networkParams.Difficulty)
+	return nil
+}
+
+// recordedOutputCap returns the number of bytes of a job's output kept in its transaction
+func recordedOutputCap() int {
+	if outputCap > 0 && outputCap < networkParams.MaxOutputSize {
+		return outputCap
+	}
+	return networkParams.MaxOutputSize
+}
+
+// truncateOutput keeps a job's output in its transaction only up to the output cap, so a chatty script cannot
+// fill blocks. Longer output is stored in full in IPFS, and the transaction records its CID, size and hash next
+// to the beginning of the output.
+func truncateOutput(tx *Transaction) error {
+	limit := recordedOutputCap()
+	if len(tx.Data) <= limit {
+		return nil
+	}
+	full := tx.Data
+	cid, err := uploadBytesToIPFS(tx.JobID+".out", []byte(full))
+	if err != nil {
+		return fmt.Errorf("failed to store the full output of %d bytes: %w", len(full), err)
+	}
+	// Cut at a character boundary so the recorded output stays valid UTF-8
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(full[cut]) {
+		cut--
+	}
+	tx.Data, tx.OutputCID, tx.OutputSize = full[:cut], cid, int64(len(full))
+	tx.OutputHash = fmt.Sprintf("%x", sha256.Sum256([]byte(full)))
+	fmt.Printf("Output of job %s is %d bytes; recording the first %d and storing it in full at %s\n", tx.JobID, len(full), cut, cid)
+	return nil
+}
+
+// resourceScheduler shares the node's CPU between the miner and job execution. Jobs run on a fixed number of
+// execution slots. When jobs have to wait, the next one is chosen by start-time fair queuing over submitters
+// rather than in arrival order: every job is tagged with the virtual time at which its submitter's previous work
+// ends, and the job with the earliest tag runs first. A submitter flooding the queue therefore only pushes back
+// its own jobs, and each submitter receives execution time in proportion to its weight.
+//
+// The miner and the sync report rushes, periods in which the node races its peers for a block or catches up
+// with them. With shedding enabled, low-priority jobs do not start during a rush, for at most maxDefer, so the
+// CPU stays with the rush; they start once the last rush ends.
+type resourceScheduler struct {
+	mu       sync.Mutex
+	slots    int                // Jobs executed at once
+	running  int                // Slots in use
+	virtual  float64            // Start tag of the most recently started job
+	finish   map[string]float64 // Virtual finish time of each submitter's latest job
+	estimate float64            // Moving average of execution times in seconds, charged when a job is queued
+	sequence uint64             // Arrival counter, ordering jobs with equal tags
+	waiting  []*scheduledJob
+
+	maxDefer time.Duration  // Longest time a low-priority job waits out rushes, 0 when jobs are not shed
+	rushes   map[string]int // Running rushes by kind
+	deferred uint64         // Low-priority jobs that were held back by a rush
+}
+
+// scheduledJob is a job waiting for an execution slot
+type scheduledJob struct {
+	submitter string
+	start     float64 // Virtual start tag
+	sequence  uint64
+	low       bool      // Whether the job has low priority
+	queued    time.Time // When the job started waiting
+	held      bool      // Whether a rush has held the job back
+	ready     chan struct{}
+}
+
+// Kinds of rushes reported to the scheduler
+const (
+	rushMining = "mining"
+	rushSync   = "sync"
+)
+
+var scheduler = newResourceScheduler(runtime.NumCPU(), 0)
+
+var submitterWeights = make(map[string]float64) // Scheduling weights set with -submitter-weights; others weigh 1
+
+// newResourceScheduler creates a scheduler with the given number of execution slots that defers low-priority
+// jobs during rushes for at most maxDefer
+func newResourceScheduler(slots int, maxDefer time.Duration) *resourceScheduler {
+	return &resourceScheduler{slots: slots, finish: make(map[string]float64), estimate: 1, maxDefer: maxDefer, rushes: make(map[string]int)}
+}
+
+// submitterWeight returns a submitter's scheduling weight
+func submitterWeight(submitter string) float64 {
+	if w, ok := submitterWeights[submitter]; ok {
+		return w
+	}
+	return 1
+}
+
+// Acquire waits for an execution slot for a job of submitter with the given priority, calling onQueued first if
+// the job has to wait. The returned function frees the slot and charges the submitter for the job's actual
+// execution time.
+func (s *resourceScheduler) Acquire(submitter, priority string, onQueued func()) func(elapsed time.Duration) {
+	s.mu.Lock()
+	w := submitterWeight(submitter)
+	job := &scheduledJob{submitter: submitter, start: max(s.virtual, s.finish[submitter]), sequence: s.sequence, ready: make(chan struct{})}
+	job.low, job.queued = priority == PriorityLow, time.Now()
+	s.sequence++
+	charged := s.estimate / w
+	s.finish[submitter] = job.start + charged
+	s.waiting = append(s.waiting, job)
+	s.dispatch()
+	s.mu.Unlock()
+	if job.low && s.maxDefer > 0 {
+		// Start the job once it has waited out rushes for maxDefer, even if they continue
+		timer := time.AfterFunc(s.maxDefer, func() {
+			s.mu.Lock()
+			s.dispatch()
+			s.mu.Unlock()
+		})
+		defer timer.Stop()
+	}
+
+	select {
+	case <-job.ready:
+	default:
+		if onQueued != nil {
+			onQueued()
+		}
+		<-job.ready
+	}
+	return func(elapsed time.Duration) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		seconds := elapsed.Seconds()
+		// Correct the estimate charged at queueing time with the real cost, unless the submitter's work
+		// has already fallen behind the virtual time
+		if finish, ok := s.finish[submitter]; ok {
+			s.finish[submitter] = finish + seconds/w - charged
+		}
+		s.estimate = 0.8*s.estimate + 0.2*max(seconds, 0.001)
+		s.running--
+		s.dispatch()
+	}
+}
+
+// dispatch starts waiting jobs in tag order while slots are free, passing over low-priority jobs that a rush
+// holds back; the caller must hold s.mu
+func (s *resourceScheduler) dispatch() {
+	for s.running < s.slots && len(s.waiting) > 0 {
+		next := -1
+		for i, job := range s.waiting {
+			if s.holds(job) {
+				continue
+			}
+			if next < 0 || job.start < s.waiting[next].start || job.start == s.waiting[next].start && job.sequence < s.waiting[next].sequence {
+				next = i
+			}
+		}
+		if next < 0 {
+			break
+		}
+		job := s.waiting[next]
+		s.waiting = append(s.waiting[:next], s.waiting[next+1:]...)
+		s.virtual = max(s.virtual, job.start)
+		s.running++
+		close(job.ready)
+	}
+	// Submitters whose work ended before the current virtual time start from it anyway
+	for submitter, finish := range s.finish {
+		if finish <= s.virtual {
+			delete(s.finish, submitter)
+		}
+	}
+}
+
+// holds reports whether a rush keeps a waiting job from starting, counting the job as deferred the first time;
+// the caller must hold s.mu
+func (s *resourceScheduler) holds(job *scheduledJob) bool {
+	if !job.low || s.maxDefer <= 0 || len(s.rushes) == 0 || time.Since(job.queued) >= s.maxDefer {
+		return false
+	}
+	if !job.held {
+		job.held = true
+		s.deferred++
+	}
+	return true
+}
+
+// Rush reports the start of a rush of the given kind. The returned function reports its end, after which
+// deferred jobs resume if no other rush is running.
+func (s *resourceScheduler) Rush(kind string) func() {
+	s.mu.Lock()
+	s.rushes[kind]++
+	s.mu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.rushes[kind]--; s.rushes[kind] <= 0 {
+				delete(s.rushes, kind)
+			}
+			s.dispatch()
+		})
+	}
+}
+
+// Shedding returns the running rushes that defer low-priority jobs, empty when shedding is off or no rush runs
+func (s *resourceScheduler) Shedding() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.maxDefer <= 0 {
+		return ""
+	}
+	kinds := make([]string, 0, len(s.rushes))
+	for kind := range s.rushes {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return strings.Join(kinds, ", ")
+}
+
+// Stats returns the number of busy slots and waiting jobs
+func (s *resourceScheduler) Stats() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running, len(s.waiting)
+}
+
+// Deferrals returns the number of low-priority jobs waiting behind a rush and the number deferred so far
+func (s *resourceScheduler) Deferrals() (int, uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	held := 0
+	for _, job := range s.waiting {
+		if job.held && s.holds(job) {
+			held++
+		}
+	}
+	return held, s.deferred
+}
+
+// parseSubmitterWeights parses comma-separated submitter=weight pairs
+func parseSubmitterWeights(list string) (map[string]float64, error) {
+	weights := make(map[string]float64)
+	for _, pair := range strings.Split(list, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		submitter, value, ok := strings.Cut(pair, "=")
+		w, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if !ok || err != nil || w <= 0 || math.IsInf(w, 0) {
+			return nil, fmt.Errorf("%q is not of the form submitter=positive-weight", pair)
+		}
+		weights[strings.TrimSpace(submitter)] = w
+	}
+	return weights, nil
+}
+
+// resultKeyInfo binds the key derived for an encrypted result to its purpose
+const resultKeyInfo = "IPFSBlockchain job result v1"
+
+// parseResultKey decodes a hex-encoded X25519 public key that job results are encrypted for
+func parseResultKey(encoded string) (*ecdh.PublicKey, error) {
+	raw, err := hex.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("the key is not hex-encoded")
+	}
+	key, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("not an X25519 public key: %w", err)
+	}
+	return key, nil
+}
+
+// sealResult encrypts a job result for a recipient with an ephemeral X25519 key, AES-256-GCM and a key derived
+// with HKDF-SHA256. The sealed result is the ephemeral public key followed by the ciphertext, and the job ID is
+// authenticated with it so a result cannot be passed off as another job's.
+func sealResult(recipient *ecdh.PublicKey, jobID string, plaintext []byte) ([]byte, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return nil, err
+	}
+	salt := append(ephemeral.PublicKey().Bytes(), recipient.Bytes()...)
+	key, err := hkdf.Key(sha256.New, shared, salt, resultKeyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	// Every result gets a fresh key, so a fixed nonce is never reused under the same key
+	nonce := make([]byte, gcm.NonceSize())
+	return gcm.Seal(ephemeral.PublicKey().Bytes(), nonce, plaintext, []byte(jobID)), nil
+}
+
+// OpenResult decrypts a result sealed by sealResult for key, as the submitter does
+func OpenResult(key *ecdh.PrivateKey, jobID string, sealed []byte) ([]byte, error) {
+	if len(sealed) < 32 {
+		return nil, fmt.Errorf("encrypted result is truncated")
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(sealed[:32])
+	if err != nil {
+		return nil, err
+	}
+	shared, err := key.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	salt := append(ephemeral.Bytes(), key.PublicKey().Bytes()...)
+	aesKey, err := hkdf.Key(sha256.New, shared, salt, resultKeyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, make([]byte, gcm.NonceSize()), sealed[32:], []byte(jobID))
+	if err != nil {
+		return nil, fmt.Errorf("result cannot be decrypted with this key")
+	}
+	return plaintext, nil
+}
+
+// encryptResult seals a job's result for its submitter and uploads the ciphertext to IPFS, returning its CID and
+// the hash of the plaintext recorded on chain
+func encryptResult(jobID, encryptTo, result string) (string, string, error) {
+	if len(result) > networkParams.MaxOutputSize {
+		return "", "", fmt.Errorf("transaction %s output is %d bytes, exceeding the maximum of %d", jobID, len(result), networkParams.MaxOutputSize)
+	}
+	recipient, err := parseResultKey(encryptTo)
+	if err != nil {
+		return "", "", err
+	}
+	sealed, err := sealResult(recipient, jobID, []byte(result))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encrypt the result: %w", err)
+	}
+	cid, err := uploadBytesToIPFS(jobID+".result", sealed)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to upload the encrypted result: %w", err)
+	}
+	return cid, fmt.Sprintf("%x", sha256.Sum256([]byte(result))), nil
+}
+
+// withheldOutput drops the script output that execution errors carry, for jobs whose output is confidential
+func withheldOutput(err error) error {
+	if message, _, found := strings.Cut(err.Error(), ", output: "); found {
+		return fmt.Errorf("%s (output withheld from an encrypted job)", message)
+	}
+	return err
+}
+
+// runJobFiles downloads a job's script and input file from IPFS and executes them with the extra arguments under
+// a network policy, passing each output line to onLine; it returns the output, the CPU time and the wall-clock
+// time of the run
+func runJobFiles(pythonHash, txtHash string, inputs, args []string, policy NetworkPolicy, onLine func(string)) (string, time.Duration, time.Duration, error) {
+	// Ensure valid file types for Python and text files
+	pythonExt := ".py"
+	txtExt := ".txt"
+
+	// Create a temporary directory for storing the files
+	tempDir := jobWorkDir()
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		return "", 0, 0, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+
+	// Define the file paths for the downloaded Python and text files
+	pythonFilename := filepath.Join(tempDir, fmt.Sprintf("%s%s", pythonHash, pythonExt))
+	txtFilename := filepath.Join(tempDir, fmt.Sprintf("%s%s", txtHash, txtExt))
+
+	// Download Python and text files from IPFS
+	fmt.Printf("Downloading Python file with hash: %s\n", pythonHash)
+	if err := downloadFromIPFS(pythonHash, pythonFilename); err != nil {
+		return "", 0, 0, fmt.Errorf("failed to download Python file: %w", err)
+	}
+
+	fmt.Printf("Downloading text file with hash: %s\n", txtHash)
+	if err := downloadFromIPFS(txtHash, txtFilename); err != nil {
+		return "", 0, 0, fmt.Errorf("failed to download text file: %w", err)
+	}
+
+	// Further input files follow the text file on the script's command line
+	inputFilenames := []string{txtFilename}
+	for _, hash := range inputs {
+		filename := filepath.Join(tempDir, hash+txtExt)
+		if err := downloadFromIPFS(hash, filename); err != nil {
+			return "", 0, 0, fmt.Errorf("failed to download input file %s: %w", hash, err)
+		}
+		inputFilenames = append(inputFilenames, filename)
+	}
+	defer func() {
+		for _, filename := range inputFilenames[1:] {
+			removeFile(filename)
+		}
+	}()
+
+	// Execute the Python file with the text file and any extra arguments
+	fmt.Printf("Executing Python file: %s with argument: %s %v\n", pythonFilename, strings.Join(inputFilenames, " "), args)
+	started := time.Now()
+	result, cpuTime, err := jobExecutor(pythonFilename, policy, onLine, append(inputFilenames, args...)...)
+	elapsed := time.Since(started)
+	if err != nil {
+		return "", cpuTime, elapsed, fmt.Errorf("failed to execute Python file: %w", err)
+	}
+
+	// Print Python script output
+	fmt.Println("Python script output:", result)
+
+	// Remove the downloaded files after processing
+	if err := removeFile(pythonFilename); err != nil {
+		return "", cpuTime, elapsed, fmt.Errorf("failed to remove Python file: %w", err)
+	}
+	if err := removeFile(txtFilename); err != nil {
+		return "", cpuTime, elapsed, fmt.Errorf("failed to remove text file: %w", err)
+	}
+	return result, cpuTime, elapsed, nil
+}
+
+// JobExecutor runs a job's script with its input file and arguments under the job's network policy, which it is
+// responsible for enforcing, passing each output line to onLine and returning the output and the CPU time consumed
+type JobExecutor func(script string, policy NetworkPolicy, onLine func(string), args ...string) (string, time.Duration, error)
+
+var jobExecutor JobExecutor = executePythonFile // Runs the scripts of jobs received by this node
+
+// Executor cluster timing
+const (
+	workerHeartbeatInterval = 5 * time.Second             // Interval between worker heartbeats
+	workerTimeout           = 3 * workerHeartbeatInterval // Silence after which a worker is dropped and its jobs fail over
+	workerLeaseWait         = 20 * time.Second            // Longest a lease request waits for a job
+	maxWorkerAttempts       = 3                           // Workers a job is handed to before it fails
+)
+
+var clusterEnabled bool // Whether job execution is dispatched to executor workers, set by -cluster
+var clusterToken string // Secret shared by a cluster's chain node and workers, from NODE_CLUSTER_TOKEN
+
+// errNoWorkers is returned by dispatchJob when no executor worker is registered
+var errNoWorkers = errors.New("no executor workers are available")
+
+// WorkerHeartbeat identifies a worker in its registration, heartbeats and lease requests
+type WorkerHeartbeat struct {
+	ID       string   // Worker identifier, chosen by the worker on startup
+	Capacity int      // Number of jobs the worker executes at once
+	Jobs     []string // Jobs the worker is executing
+}
+
+// WorkerConfig is the chain node's reply to a worker registration
+type WorkerConfig struct {
+	HeartbeatInterval int64         // Interval between heartbeats in milliseconds
+	Params            NetworkParams // Consensus parameters, which limit the jobs' runtime and output
+}
+
+// WorkerTask is a job handed to an executor worker
+type WorkerTask struct {
+	JobID      string
+	PythonHash string
+	TxtHash    string
+	Inputs     []string // Further input files, passed to the script after the input file
+	Args       []string
+	Network    string // Network policy requested for the script
+}
+
+// WorkerResult is the outcome of a task reported by the worker that executed it
+type WorkerResult struct {
+	Worker        string
+	JobID         string
+	Output        string
+	ExecutionTime int64  // Wall-clock execution time in milliseconds
+	CPUTime       int64  // CPU time consumed by the script in milliseconds
+	Network       string // Network policy the worker ran the script under
+	Error         string // Failure reason, empty when the script ran successfully
+}
+
+// ExecutorWorker is an executor worker registered with this node
+type ExecutorWorker struct {
+	ID       string
+	Capacity int
+	LastSeen int64    // Unix time of the worker's last request
+	Jobs     []string // Jobs leased to the worker
+}
+
+// clusterTask tracks a job dispatched to the cluster until a worker reports its result
+type clusterTask struct {
+	WorkerTask
+	worker   string        // Worker holding the lease, empty while the task is queued
+	leased   time.Time     // When the current lease was granted
+	attempts int           // Leases granted so far
+	result   WorkerResult  // Outcome, set before done is closed
+	err      error         // Dispatch failure, set before done is closed
+	done     chan struct{} // Closed once the task is finished
+}
+
+var clusterMutex sync.Mutex                            // Guards the cluster state below
+var executorWorkers = make(map[string]*ExecutorWorker) // Registered workers keyed by ID
+var clusterQueue []*clusterTask                        // Tasks waiting for a worker, oldest first
+var clusterTasks = make(map[string]*clusterTask)       // Queued and leased tasks keyed by job ID
+var clusterSignal = make(chan struct{})                // Closed and replaced when a task is queued, waking lease requests
+
+// clusterAuthorized reports whether a request carries the cluster token
+func clusterAuthorized(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return clusterToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(clusterToken)) == 1
+}
+
+// clusterHandler restricts a cluster endpoint to POST requests from workers holding the cluster token and
+// decodes the worker's message
+func clusterHandler[T any](handler func(http.ResponseWriter, *http.Request, T)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+			return
+		}
+		if !clusterAuthorized(r) {
+			http.Error(w, "Invalid cluster token", http.StatusUnauthorized)
+			return
+		}
+		var message T
+		if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+			http.Error(w, "Failed to decode cluster message", http.StatusBadRequest)
+			return
+		}
+		handler(w, r, message)
+	}
+}
+
+// queueTask appends a task to the cluster queue and wakes waiting lease requests; the caller must hold
+// clusterMutex
+func queueTask(task *clusterTask) {
+	task.worker = ""
+	clusterQueue = append(clusterQueue, task)
+	close(clusterSignal)
+	clusterSignal = make(chan struct{})
+}
+
+// finishTask delivers the outcome of a task to the dispatcher; the caller must hold clusterMutex
+func finishTask(task *clusterTask, result WorkerResult, err error) {
+	delete(clusterTasks, task.JobID)
+	task.result, task.err = result, err
+	close(task.done)
+}
+
+// failOver requeues a task whose worker was lost, or fails it once it has been handed to maxWorkerAttempts
+// workers; the caller must hold clusterMutex
+func failOver(task *clusterTask) {
+	if task.attempts >= maxWorkerAttempts {
+		finishTask(task, WorkerResult{}, fmt.Errorf("job was lost by %d executor workers", task.attempts))
+		return
+	}
+	fmt.Printf("Worker %s lost job %s, dispatching it again\n", task.worker, task.JobID)
+	queueTask(task)
+}
+
+// dispatchJob hands a job to the executor workers and waits for one of them to report its result. It returns
+// errNoWorkers when no worker is registered, or when the last one is lost before the job completes.
+func dispatchJob(task WorkerTask) (WorkerResult, error) {
+	clusterMutex.Lock()
+	if len(executorWorkers) == 0 {
+		clusterMutex.Unlock()
+		return WorkerResult{}, errNoWorkers
+	}
+	if _, ok := clusterTasks[task.JobID]; ok {
+		clusterMutex.Unlock()
+		return WorkerResult{}, fmt.Errorf("job %s is already dispatched", task.JobID)
+	}
+	dispatched := &clusterTask{WorkerTask: task, done: make(chan struct{})}
+	clusterTasks[task.JobID] = dispatched
+	queueTask(dispatched)
+	clusterMutex.Unlock()
+
+	// Each attempt may download both files and run for the full runtime
+	attempt := 2*downloadTimeout + time.Duration(networkParams.MaxRuntime)*time.Second + workerTimeout
+	select {
+	case <-dispatched.done:
+		return dispatched.result, dispatched.err
+	case <-time.After(maxWorkerAttempts * attempt):
+		clusterMutex.Lock()
+		defer clusterMutex.Unlock()
+		select {
+		case <-dispatched.done:
+			return dispatched.result, dispatched.err
+		default:
+		}
+		for i, queued := range clusterQueue {
+			if queued == dispatched {
+				clusterQueue = append(clusterQueue[:i], clusterQueue[i+1:]...)
+				break
+			}
+		}
+		delete(clusterTasks, task.JobID)
+		return WorkerResult{}, fmt.Errorf("no executor worker completed the job in time")
+	}
+}
+
+// expireWorkers drops workers that stopped sending heartbeats and fails their jobs over to the remaining
+// workers, or back to the node itself when none remain
+func expireWorkers() {
+	clusterMutex.Lock()
+	defer clusterMutex.Unlock()
+	cutoff := time.Now().Add(-workerTimeout).Unix()
+	for id, worker := range executorWorkers {
+		if worker.LastSeen < cutoff {
+			fmt.Printf("Executor worker %s stopped sending heartbeats\n", id)
+			delete(executorWorkers, id)
+		}
+	}
+	for _, task := range clusterTasks {
+		if _, ok := executorWorkers[task.worker]; task.worker != "" && !ok {
+			failOver(task)
+		}
+	}
+	if len(executorWorkers) == 0 {
+		for _, task := range clusterQueue {
+			finishTask(task, WorkerResult{}, errNoWorkers)
+		}
+		clusterQueue = nil
+	}
+}
+
+// handleWorkerRegister registers an executor worker, or refreshes the registration of a known one
+func handleWorkerRegister(w http.ResponseWriter, r *http.Request, heartbeat WorkerHeartbeat) {
+	if heartbeat.ID == "" || heartbeat.Capacity < 1 {
+		http.Error(w, "Workers register with an ID and a positive capacity", http.StatusBadRequest)
+		return
+	}
+	clusterMutex.Lock()
+	if _, ok := executorWorkers[heartbeat.ID]; !ok {
+		fmt.Printf("Executor worker %s registered with capacity %d\n", heartbeat.ID, heartbeat.Capacity)
+	}
+	executorWorkers[heartbeat.ID] = &ExecutorWorker{ID: heartbeat.ID, Capacity: heartbeat.Capacity, LastSeen: time.Now().Unix()}
+	clusterMutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(WorkerConfig{HeartbeatInterval: workerHeartbeatInterval.Milliseconds(), Params: networkParams})
+}
+
+// handleWorkerHeartbeat records that a worker is alive. Jobs leased to it that it does not report running were
+// lost on the way, for example with the lease response, and are dispatched again.
+func handleWorkerHeartbeat(w http.ResponseWriter, r *http.Request, heartbeat WorkerHeartbeat) {
+	clusterMutex.Lock()
+	defer clusterMutex.Unlock()
+	worker, ok := executorWorkers[heartbeat.ID]
+	if !ok {
+		http.Error(w, "Unknown worker", http.StatusNotFound)
+		return
+	}
+	worker.LastSeen = time.Now().Unix()
+	running := make(map[string]bool, len(heartbeat.Jobs))
+	for _, jobID := range heartbeat.Jobs {
+		running[jobID] = true
+	}
+	for _, task := range clusterTasks {
+		if task.worker == heartbeat.ID && !running[task.JobID] && time.Since(task.leased) > 2*workerHeartbeatInterval {
+			failOver(task)
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleWorkerLease hands the oldest queued job to a worker, waiting up to workerLeaseWait for one to arrive
+func handleWorkerLease(w http.ResponseWriter, r *http.Request, heartbeat WorkerHeartbeat) {
+	deadline := time.After(workerLeaseWait)
+	for {
+		clusterMutex.Lock()
+		worker, ok := executorWorkers[heartbeat.ID]
+		if !ok {
+			clusterMutex.Unlock()
+			http.Error(w, "Unknown worker", http.StatusNotFound)
+			return
+		}
+		worker.LastSeen = time.Now().Unix()
+		if len(clusterQueue) > 0 {
+			task := clusterQueue[0]
+			clusterQueue = clusterQueue[1:]
+			task.worker, task.leased = heartbeat.ID, time.Now()
+			task.attempts++
+			clusterMutex.Unlock()
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(task.WorkerTask)
+			return
+		}
+		signal := clusterSignal
+		clusterMutex.Unlock()
+
+		select {
+		case <-signal:
+		case <-deadline:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// handleWorkerResult accepts the result of a job from the worker holding its lease
+func handleWorkerResult(w http.ResponseWriter, r *http.Request, result WorkerResult) {
+	clusterMutex.Lock()
+	defer clusterMutex.Unlock()
+	task, ok := clusterTasks[result.JobID]
+	if !ok || task.worker != result.Worker {
+		// The job timed out or failed over to another worker in the meantime
+		http.Error(w, "Job is not leased to this worker", http.StatusConflict)
+		return
+	}
+	if worker, ok := executorWorkers[result.Worker]; ok {
+		worker.LastSeen = time.Now().Unix()
+	}
+	finishTask(task, result, nil)
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleWorkers lists the registered executor workers and the jobs leased to them, for the local operator
+func handleWorkers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if !fromLoopback(r) {
+		http.Error(w, "Worker lists are only served to the local host", http.StatusForbidden)
+		return
+	}
+
+	clusterMutex.Lock()
+	list := make([]ExecutorWorker, 0, len(executorWorkers))
+	for _, worker := range executorWorkers {
+		entry := *worker
+		entry.Jobs = []string{}
+		for _, task := range clusterTasks {
+			if task.worker == worker.ID {
+				entry.Jobs = append(entry.Jobs, task.JobID)
+			}
+		}
+		list = append(list, entry)
+	}
+	clusterMutex.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// executorWorker is the state of a worker process started with the worker command
+type executorWorker struct {
+	coordinator string // URL of the chain node dispatching jobs
+	id          string
+	capacity    int
+	interval    time.Duration   // Heartbeat interval announced by the coordinator
+	mu          sync.Mutex      // Guards running
+	running     map[string]bool // Jobs being executed
+}
+
+// call posts a message with the cluster token to the coordinator and decodes a successful reply into reply,
+// if given; it returns the response status
+func (ew *executorWorker) call(path string, message, reply interface{}) (int, error) {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(http.MethodPost, ew.coordinator+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+clusterToken)
+	resp, err := nodeClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || reply == nil {
+		io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(reply)
+}
+
+// heartbeat returns the worker's identification together with the jobs it is running
+func (ew *executorWorker) heartbeat() WorkerHeartbeat {
+	ew.mu.Lock()
+	defer ew.mu.Unlock()
+	heartbeat := WorkerHeartbeat{ID: ew.id, Capacity: ew.capacity, Jobs: []string{}}
+	for jobID := range ew.running {
+		heartbeat.Jobs = append(heartbeat.Jobs, jobID)
+	}
+	return heartbeat
+}
+
+// register registers the worker with the coordinator, retrying until it succeeds, and adopts the consensus
+// parameters it announces
+func (ew *executorWorker) register() {
+	for {
+		var config WorkerConfig
+		status, err := ew.call("/cluster/register", ew.heartbeat(), &config)
+		if err == nil && status == http.StatusOK {
+			setNetworkParams(config.Params)
+			ew.interval = time.Duration(config.HeartbeatInterval) * time.Millisecond
+			fmt.Printf("Registered as executor worker %s with %s\n", ew.id, ew.coordinator)
+			return
+		}
+		if err == nil {
+			err = fmt.Errorf("registration failed with status %d", status)
+		}
+		fmt.Printf("Error registering with %s: %v\n", ew.coordinator, err)
+		time.Sleep(workerHeartbeatInterval)
+	}
+}
+
+// heartbeats keeps the worker registered, registering again when the coordinator no longer knows it, as after
+// a restart of the coordinator
+func (ew *executorWorker) heartbeats() {
+	for {
+		time.Sleep(ew.interval)
+		status, err := ew.call("/cluster/heartbeat", ew.heartbeat(), nil)
+		switch {
+		case err != nil:
+			fmt.Printf("Error sending heartbeat: %v\n", err)
+		case status == http.StatusNotFound:
+			ew.register()
+		case status != http.StatusOK:
+			fmt.Printf("Heartbeat failed with status %d\n", status)
+		}
+	}
+}
+
+// work leases jobs from the coordinator one at a time, executes them and reports their results
+func (ew *executorWorker) work() {
+	for {
+		var task WorkerTask
+		status, err := ew.call("/cluster/lease", ew.heartbeat(), &task)
+		if err != nil || status != http.StatusOK {
+			if err != nil || status != http.StatusNoContent {
+				time.Sleep(ew.interval)
+			}
+			continue
+		}
+
+		ew.mu.Lock()
+		ew.running[task.JobID] = true
+		ew.mu.Unlock()
+		fmt.Printf("Executing job %s\n", task.JobID)
+		result := WorkerResult{Worker: ew.id, JobID: task.JobID}
+		policy, err := parseNetworkPolicy(task.Network)
+		if err == nil {
+			var output string
+			var cpuTime, elapsed time.Duration
+			output, cpuTime, elapsed, err = runJobFiles(task.PythonHash, task.TxtHash, task.Inputs, task.Args, policy, nil)
+			result.Output, result.CPUTime, result.ExecutionTime = output, cpuTime.Milliseconds(), elapsed.Milliseconds()
+			result.Network = enforcedPolicy(policy).String()
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		status, err = ew.call("/cluster/result", result, nil)
+		ew.mu.Lock()
+		delete(ew.running, task.JobID)
+		ew.mu.Unlock()
+		switch {
+		case err != nil:
+			fmt.Printf("Error reporting the result of job %s: %v\n", task.JobID, err)
+		case status == http.StatusConflict:
+			fmt.Printf("Result of job %s was discarded, the job was dispatched again\n", task.JobID)
+		case status != http.StatusOK:
+			fmt.Printf("Reporting the result of job %s failed with status %d\n", task.JobID, status)
+		}
+	}
+}
+
+// runWorker runs a stateless executor worker for a chain node started with -cluster, until the process is
+// stopped. The worker downloads and executes the jobs it leases and reports their results to the chain node.
+func runWorker(args []string) {
+	workerFlags := flag.NewFlagSet("worker", flag.ExitOnError)
+	coordinator := workerFlags.String("coordinator", localNodeURL(), "URL of the chain node dispatching jobs")
+	capacity := workerFlags.Int("capacity", 1, "Number of jobs executed at once")
+	workerFlags.Parse(args)
+
+	clusterToken = os.Getenv("NODE_CLUSTER_TOKEN")
+	if clusterToken == "" {
+		fmt.Println("Set NODE_CLUSTER_TOKEN to the cluster token of the chain node")
+		return
+	}
+	if *capacity < 1 {
+		fmt.Println("-capacity must be at least 1")
+		return
+	}
+	if jobSandbox == sandboxNetns {
+		if err := checkSandbox(); err != nil {
+			fmt.Printf("Error starting the job sandbox: %v\n", err)
+			return
+		}
+	}
+	host, _ := os.Hostname()
+	ew := &executorWorker{
+		coordinator: strings.TrimSuffix(*coordinator, "/"),
+		id:          host + "-" + GenerateJobID()[:8],
+		capacity:    *capacity,
+		running:     make(map[string]bool),
+	}
+	ew.register()
+	go ew.heartbeats()
+	for i := 1; i < ew.capacity; i++ {
+		go ew.work()
+	}
+	ew.work()
+}
+
+// Node is a full node that can be embedded in-process by other programs, for testing or integration. Options
+// only record the node's configuration; Start applies it to the chain state, which is shared by the whole
+// process, so at most one Node runs at a time.
+type Node struct {
+	keyFile        string        // File holding the node's signing key
+	dataDir        string        // Directory holding the chain store, snapshots and redactions
+	storeBackend   string        // Chain store backend, see storeBackends
+	storageCodec   Codec         // Serialization codec of the chain store
+	verifyDepth    int           // Number of most recent blocks verified on startup
+	syncWorkers    int           // Parallel block downloads while syncing from peers
+	pexInterval    time.Duration // Interval between peer list exchanges, 0 disables them
+	tailnetEvery   time.Duration // Interval between tailnet discoveries, when a tailnet tag is set
+	updateInterval time.Duration // Interval between release checks
+	metricsURL     string        // Aggregator metrics snapshots are pushed to, empty when not pushing
+	metricsToken   string        // Bearer token sent with metrics snapshots
+	metricsEvery   time.Duration // Interval between metrics snapshots
+	perfEvery      time.Duration // Interval between performance samples, 0 disables them
+	listener       net.Listener  // Listener the HTTP API is served on, :8080 when not set
+	server         *http.Server  // HTTP API server, set by Start
+	stop           chan struct{} // Closed by Stop to end the background loops
+	done           chan error    // Receives the result of serving once the server stops
+	stopOnce       sync.Once
+
+	key         ed25519.PrivateKey // Signing key, loaded by NewNode
+	ipfsAPI     string             // IPFS RPC API URL, empty to keep the process default
+	ipfsGateway string             // IPFS gateway URL, empty to keep the process default
+	params      *NetworkParams     // Consensus parameters, nil to keep the process default
+	executor    JobExecutor        // Runtime executing job scripts, nil for the Python interpreter
+	peers       []string           // Peers synced with on startup
+	gc          *GCPolicy          // Background garbage collection, nil to keep the process default
+	tailnetTag  string             // ACL tag of the tailnet devices used as peers, empty when discovery is off
+	tailnetSock string             // tailscaled LocalAPI socket read by tailnet discovery
+	webhook     string             // URL alerts are posted to, empty when alerts are not posted
+	clusterTok  string             // Token executor workers authenticate with, empty when the node runs jobs itself
+	limits      *ResourceLimits    // Resource guard limits, nil to keep the process default
+}
+
+var nodeRunning atomic.Bool // Whether a Node of this process has started and not stopped yet
 
-var previousBlockCID string = "-1"  // Genesis block's PrevCID will be -1 initially
-var previousBlockHash string = "-1" // Genesis block's PrevHash will be empty initially
+// Option configures a Node
+type Option func(*Node) error
 
-// downloadFromIPFS downloads a file from IPFS using the provided hash
-func downloadFromIPFS(hash, filename string) error {
-	url := IPFSDownloadURL + hash
-	resp, err := http.Get(url)
-	if err != nil {
-		return fmt.Errorf("failed to download file from IPFS: %w", err)
+// WithIPFS points the node at an IPFS RPC API and gateway
+func WithIPFS(apiURL, gatewayURL string) Option {
+	return func(n *Node) error {
+		n.ipfsAPI, n.ipfsGateway = apiURL, gatewayURL
+		return nil
 	}
-	defer resp.Body.Close()
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download file, status: %d", resp.StatusCode)
+// WithConsensus sets the network's consensus parameters
+func WithConsensus(params NetworkParams) Option {
+	return func(n *Node) error {
+		n.params = &params
+		return nil
 	}
+}
 
-	file, err := os.Create(filename)
-	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
+// WithExecutor replaces the Python runtime that executes job scripts
+func WithExecutor(executor JobExecutor) Option {
+	return func(n *Node) error {
+		n.executor = executor
+		return nil
 	}
-	defer file.Close()
+}
 
-	_, err = io.Copy(file, resp.Body)
-	return err
+// WithListener serves the node's HTTP API on listener instead of :8080
+func WithListener(listener net.Listener) Option {
+	return func(n *Node) error {
+		n.listener = listener
+		return nil
+	}
 }
 
-// executePythonFile executes the specified Python file with an argument and displays the output
-func executePythonFile(filename, arg string) (string, error) {
-	cmd := exec.Command("python", filename, arg) // Use python explicitly
-	output, err := cmd.CombinedOutput()          // Capture both stdout and stderr
-	if err != nil {
-		return "", fmt.Errorf("File execution failed: %v, output: %s", err, string(output))
+// WithKeyFile sets the file holding the node's signing key, created on first use
+func WithKeyFile(path string) Option {
+	return func(n *Node) error {
+		n.keyFile = path
+		return nil
 	}
-	return string(output), nil
 }
 
-// removeFile removes a file from the filesystem
-func removeFile(filename string) error {
-	err := os.Remove(filename)
-	if err != nil {
-		return fmt.Errorf("failed to remove file: %v", err)
+// WithDataDir sets where the chain store lives, its codec and how many recent blocks are verified on startup
+func WithDataDir(dir string, codec Codec, verifyDepth int) Option {
+	return func(n *Node) error {
+		n.dataDir, n.storageCodec, n.verifyDepth = dir, codec, verifyDepth
+		return nil
 	}
-	return nil
 }
 
-// proofOfWork performs the proof-of-work algorithm to find a valid nonce
-func proofOfWork(block Block, difficulty int) int {
-	nonce := 0
-	var hash string
-	for {
-		// Generate the hash of the block with the current nonce
-		hash = generateHash(block, nonce)
+// WithStore selects the chain store backend by name, such as file or sqlite
+func WithStore(backend string) Option {
+	return func(n *Node) error {
+		if _, ok := storeBackends[backend]; !ok {
+			return fmt.Errorf("unsupported chain store %q, expected one of %s", backend, strings.Join(storeNames(), ", "))
+		}
+		n.storeBackend = backend
+		return nil
+	}
+}
 
-		// Check if the hash satisfies the difficulty condition
-		if validProof(hash, difficulty) {
-			break
+// WithPeers sets the peers the node syncs with on startup and the number of parallel downloads
+func WithPeers(addresses []string, syncWorkers int) Option {
+	return func(n *Node) error {
+		if syncWorkers < 1 {
+			return fmt.Errorf("sync workers must be at least 1")
 		}
+		n.peers = append([]string(nil), addresses...)
+		n.syncWorkers = syncWorkers
+		return nil
+	}
+}
 
-		nonce++
+// WithPeerExchange sets the interval between peer list exchanges, 0 disables them
+func WithPeerExchange(interval time.Duration) Option {
+	return func(n *Node) error {
+		n.pexInterval = interval
+		return nil
 	}
-	return nonce
 }
 
-// validProof validates the proof of work by checking if the hash has the required number of leading zeros
-func validProof(hash string, difficulty int) bool {
-	prefix := strings.Repeat("0", difficulty)
-	return strings.HasPrefix(hash, prefix)
+// WithPerfSampling sets the interval between performance samples, 0 disables them
+func WithPerfSampling(interval time.Duration) Option {
+	return func(n *Node) error {
+		n.perfEvery = interval
+		return nil
+	}
 }
 
-// generateHash generates a SHA256 hash for the block with the given nonce
-func generateHash(block Block, nonce int) string {
-	block.Nonce = nonce
-	blockData := fmt.Sprintf("%s%d%d%s", block.PrevHash, block.BlockNumber, nonce, block.Transactions)
-	return fmt.Sprintf("%x", sha256.Sum256([]byte(blockData)))
+// WithUpdateInterval sets the interval between release checks when a release pointer is configured
+func WithUpdateInterval(interval time.Duration) Option {
+	return func(n *Node) error {
+		n.updateInterval = interval
+		return nil
+	}
 }
 
-// mineBlock mines a new block using proof of work and adds it to the local chain
-func mineBlock(miner string, difficulty int) {
-	mutex.Lock()
-	defer mutex.Unlock()
+// WithGarbageCollection collects local leftovers in the background according to policy
+func WithGarbageCollection(policy GCPolicy) Option {
+	return func(n *Node) error {
+		if policy.Interval < 0 || policy.MaxAge < 0 || policy.CacheBudget < 0 {
+			return fmt.Errorf("garbage collection settings must not be negative")
+		}
+		n.gc = &policy
+		return nil
+	}
+}
 
-	if len(transactionPool) >= 3 {
-		// Create a new block
-		block := Block{
-			PrevHash:     previousBlockHash,            // The hash of the previous block (starting with -1 for the genesis block)
-			PrevCID:      previousBlockCID,             // Set the PrevCID of the previous block
-			BlockNumber:  currentBlock.BlockNumber + 1, // Increment BlockNumber
-			Transactions: transactionPool[:3],          // Take the first 3 transactions
-			Timestamp:    time.Now().Unix(),            // Set the current timestamp
-			Creator:      miner,                        // Set the creator to the miner's identifier
-			Difficulty:   difficulty,                   // Set the difficulty
+// WithMetricsPush pushes a signed snapshot of the node's metrics and chain head to an aggregator every interval.
+// The token, when set, is sent as a bearer token.
+func WithMetricsPush(aggregator, token string, interval time.Duration) Option {
+	return func(n *Node) error {
+		u, err := url.Parse(aggregator)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid metrics aggregator URL %q", aggregator)
+		}
+		if interval <= 0 {
+			return fmt.Errorf("metrics push interval must be positive")
 		}
+		n.metricsURL, n.metricsToken, n.metricsEvery = aggregator, token, interval
+		return nil
+	}
+}
 
-		// Run Proof of Work in a Goroutine
-		go func() {
-			nonce := proofOfWork(block, difficulty)
-			block.Nonce = nonce
-			block.Hash = generateHash(block, nonce)
+// WithTailnetDiscovery makes the online tailnet devices tagged with tag peers of the node, reading the tailnet
+// from the tailscaled LocalAPI at socket every interval
+func WithTailnetDiscovery(tag, socket string, interval time.Duration) Option {
+	return func(n *Node) error {
+		if !strings.HasPrefix(tag, "tag:") || len(tag) == len("tag:") {
+			return fmt.Errorf("tailnet tag %q must be of the form tag:<name>", tag)
+		}
+		if interval <= 0 {
+			return fmt.Errorf("tailnet refresh interval must be positive")
+		}
+		n.tailnetTag, n.tailnetSock, n.tailnetEvery = tag, socket, interval
+		return nil
+	}
+}
 
-			// Add the mined block to the local chain (after uploading it to IPFS)
-			// Save the block's CID after it's uploaded to IPFS
-			go uploadBlockToIPFS(block)
+// WithAlertWebhook posts the alerts of the Byzantine behavior detector to a webhook as JSON
+func WithAlertWebhook(webhook string) Option {
+	return func(n *Node) error {
+		u, err := url.Parse(webhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid alert webhook URL %q", webhook)
+		}
+		n.webhook = webhook
+		return nil
+	}
+}
 
-			// Update the previous block's CID to this block's CID after successful upload
-			mutex.Lock()
-			previousBlockHash = block.Hash
-			previousBlockCID = block.PrevCID
-			currentBlock = block // Update current block to the mined one
-			mutex.Unlock()
+// WithCluster dispatches job execution to executor workers that register with token, falling back to local
+// execution while none is registered
+func WithCluster(token string) Option {
+	return func(n *Node) error {
+		if token == "" {
+			return fmt.Errorf("a cluster needs a token")
+		}
+		n.clusterTok = token
+		return nil
+	}
+}
 
-			// Broadcast the block to other miners
-			go broadcastBlock(block)
+// WithResourceGuard pauses proof of work while the host is under the given resource pressure
+func WithResourceGuard(limits ResourceLimits) Option {
+	return func(n *Node) error {
+		if limits.Load < 0 || limits.CPUPressure < 0 || limits.Temperature < 0 {
+			return fmt.Errorf("resource limits must not be negative")
+		}
+		n.limits = &limits
+		return nil
+	}
+}
 
-			// Clear the processed transactions from the pool
-			mutex.Lock()
-			transactionPool = transactionPool[3:] // Remove processed transactions
-			mutex.Unlock()
-		}()
+// NewNode configures a node and loads its signing key
+func NewNode(opts ...Option) (*Node, error) {
+	n := &Node{
+		keyFile:        "node.key",
+		dataDir:        "data",
+		storeBackend:   "file",
+		storageCodec:   jsonCodec{},
+		verifyDepth:    100,
+		syncWorkers:    4,
+		pexInterval:    5 * time.Minute,
+		updateInterval: 6 * time.Hour,
+		perfEvery:      time.Minute,
+		stop:           make(chan struct{}),
+		done:           make(chan error, 1),
+	}
+	for _, opt := range opts {
+		if err := opt(n); err != nil {
+			return nil, err
+		}
 	}
+
+	key, err := loadOrCreateNodeKey(n.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load node key: %w", err)
+	}
+	n.key = key
+	return n, nil
 }
 
-// broadcastBlock broadcasts the mined block to other miners for validation
-func broadcastBlock(block Block) {
-	// Send the block to all other miners for validation
-	fmt.Printf("\n\nBroadcasting Block:\n\n %+v\n\n", block)
-	// Implement your broadcasting logic here (e.g., send it over a network)
+// ID returns the node's identity, the hex-encoded public key of its signing key
+func (n *Node) ID() string {
+	return hex.EncodeToString(n.key.Public().(ed25519.PublicKey))
 }
 
-// uploadBlockToIPFS uploads the mined block to IPFS
-func uploadBlockToIPFS(block Block) {
-	// Implement your IPFS upload logic here
-	//fmt.Printf("Uploading Block to IPFS: %+v\n", block)
-	// Here you would typically use a Go IPFS client to upload the block to IPFS
-	// Example: ipfs.AddBlock(block)
+// apply makes the node's configuration the process's chain state
+func (n *Node) apply() {
+	nodeKey, nodeID = n.key, n.ID()
+	if n.ipfsAPI != "" {
+		ipfsAPIURL = n.ipfsAPI
+	}
+	if n.ipfsGateway != "" {
+		ipfsGatewayURL = n.ipfsGateway
+	}
+	if n.params != nil {
+		setNetworkParams(*n.params)
+	}
+	if n.executor != nil {
+		jobExecutor, customExecutor = n.executor, true
+	}
+	peers = append([]string(nil), n.peers...)
+	if n.gc != nil {
+		gcPolicy = *n.gc
+	}
+	if n.tailnetTag != "" {
+		tailnetTag, tailscaleSocket = n.tailnetTag, n.tailnetSock
+	}
+	if n.webhook != "" {
+		alertWebhook = n.webhook
+	}
+	if n.clusterTok != "" {
+		clusterEnabled, clusterToken = true, n.clusterTok
+	}
+	if n.limits != nil {
+		resourceLimits = *n.limits
+	}
 }
 
-// addTransaction adds a new transaction to the transaction pool
-func addTransaction(transaction Transaction) {
-	mutex.Lock()
-	defer mutex.Unlock()
-	transactionPool = append(transactionPool, transaction)
+// every runs task every interval until the node stops
+func (n *Node) every(interval time.Duration, task func()) {
+	go func() {
+		for {
+			task()
+			select {
+			case <-n.stop:
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
 }
 
-// handleReceive handles incoming requests with transaction hashes
-func handleReceive(w http.ResponseWriter, r *http.Request) {
-	// Log the client's IP address
-	clientIP := strings.Split(r.RemoteAddr, ":")[0] // Extract IP address only
-	fmt.Printf("Received request from IP: %s\n", clientIP)
+// Start opens the chain store, serves the HTTP API, catches up with peers and starts the background loops. It
+// returns once the initial sync is complete; until then the node neither mines nor accepts submissions.
+func (n *Node) Start() (err error) {
+	if !nodeRunning.CompareAndSwap(false, true) {
+		return fmt.Errorf("another node is already running in this process")
+	}
+	defer func() {
+		if err != nil {
+			nodeRunning.Store(false)
+		}
+	}()
+	n.apply()
+	probeRuntimes()
+	if n.dataDir == "" {
+		// Without a data directory the chain lives in memory and nothing is written to disk
+		redactionFile, invalidBlockFile, publishedBlockFile, alertFile, forkFile, perfFile = "", "", "", "", "", ""
+		fmt.Println("Keeping the chain in memory")
+	} else {
+		snapshotDir = filepath.Join(n.dataDir, "snapshots")
+		redactionFile = filepath.Join(n.dataDir, "redactions.jsonl")
+		if err := loadRedactions(redactionFile); err != nil {
+			return err
+		}
+		invalidBlockFile = filepath.Join(n.dataDir, "invalid-blocks.jsonl")
+		publishedBlockFile = filepath.Join(n.dataDir, "published-blocks.jsonl")
+		alertFile = filepath.Join(n.dataDir, "alerts.jsonl")
+		forkFile = filepath.Join(n.dataDir, "forks.jsonl")
+		if err := loadInvalidBlocks(invalidBlockFile); err != nil {
+			return err
+		}
+		if err := loadForks(forkFile); err != nil {
+			return err
+		}
+		perfFile = filepath.Join(n.dataDir, "perf.jsonl")
+		if err := loadPerf(perfFile); err != nil {
+			return err
+		}
+		corrupted, err := openChainStore(n.dataDir, n.storeBackend, n.storageCodec, n.verifyDepth)
+		if err != nil {
+			return fmt.Errorf("failed to open chain store: %w", err)
+		}
+		if corrupted && len(peers) == 0 {
+			fmt.Println("Chain store was repaired locally but no peers are configured to resync the removed blocks")
+		}
+		n.every(jobFlushInterval, flushJobs)
+	}
 
-	if r.Method != http.MethodPost {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
+	// The API is served during the initial sync so its progress can be followed, but the node neither mines
+	// nor accepts submissions until the sync completes
+	mutex.Lock()
+	initialSync = true
+	mutex.Unlock()
+	if n.listener == nil {
+		listener, err := net.Listen("tcp", ":8080")
+		if err != nil {
+			return fmt.Errorf("failed to listen: %w", err)
+		}
+		n.listener = listener
 	}
+	mux := http.NewServeMux()
+	registerHandlers(mux)
+	n.server = &http.Server{
+		Handler:           withCORS(withBasePath(withDeadlines(mux))),
+		ReadHeaderTimeout: readHeaderTimeout,
+		IdleTimeout:       idleTimeout,
+		MaxHeaderBytes:    maxHeaderBytes,
+		Protocols:         new(http.Protocols),
+	}
+	// Peers running with -peer-h2c talk HTTP/2 without TLS
+	n.server.Protocols.SetHTTP1(true)
+	n.server.Protocols.SetUnencryptedHTTP2(true)
+	go func() {
+		err := n.server.Serve(n.listener)
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+		n.done <- err
+	}()
 
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
-		return
+	// Tagged tailnet devices are synced from like configured peers
+	if tailnetTag != "" {
+		discoverTailnetPeers()
 	}
-	defer r.Body.Close()
 
-	// Split the received hash string by commas
-	hashes := strings.Split(string(body), ",")
-	if len(hashes) != 2 {
-		http.Error(w, "Expected two hashes: one for the Python file and one for the text file", http.StatusBadRequest)
-		return
+	// Catch up with peers, which also restores any blocks removed by the integrity check
+	if len(peers) > 0 {
+		if err := syncChain(knownPeers(), n.syncWorkers); err != nil {
+			fmt.Printf("Error syncing chain: %v\n", err)
+		}
+	}
+	recoverHead(n.syncWorkers)
+	mutex.Lock()
+	initialSync = false
+	mutex.Unlock()
+	n.every(peerStatePruneInterval, prunePeerState)
+	if headKey != "" {
+		n.every(headPublishInterval, func() {
+			if err := publishHead(); err != nil {
+				fmt.Printf("Error publishing chain head: %v\n", err)
+			}
+		})
+	}
+
+	if releasePointer != "" && releaseKey != "" && n.updateInterval > 0 {
+		n.every(n.updateInterval, func() {
+			if err := checkForUpdate(); err != nil {
+				fmt.Printf("Error checking for updates: %v\n", err)
+			}
+		})
+	}
+	if n.pexInterval > 0 {
+		n.every(n.pexInterval, exchangePeers)
+	}
+	if n.perfEvery > 0 {
+		n.every(n.perfEvery, samplePerf)
 	}
+	if tailnetTag != "" {
+		n.every(n.tailnetEvery, discoverTailnetPeers)
+	}
+	if clusterEnabled {
+		n.every(workerHeartbeatInterval, expireWorkers)
+	}
+	if gcPolicy.Interval > 0 {
+		n.every(gcPolicy.Interval, func() { logGC(collectGarbage(gcPolicy)) })
+	}
+	if n.metricsURL != "" {
+		n.every(n.metricsEvery, func() {
+			if err := pushMetrics(n.metricsURL, n.metricsToken); err != nil {
+				fmt.Printf("Error pushing metrics: %v\n", err)
+			}
+		})
+	}
+	if readings := resourceReadings(); len(readings) > 0 {
+		for _, reading := range readings {
+			if _, err := reading.reader(); err != nil {
+				fmt.Printf("Cannot read %s, ignoring its limit: %v\n", reading.name, err)
+			}
+		}
+		n.every(resourceCheckInterval, checkResources)
+	}
+	return nil
+}
 
-	// Retrieve Python and text file hashes
-	pythonHash := strings.TrimSpace(hashes[0])
-	txtHash := strings.TrimSpace(hashes[1])
+// Addr returns the address the node's HTTP API is served on, nil before Start
+func (n *Node) Addr() net.Addr {
+	if n.listener == nil {
+		return nil
+	}
+	return n.listener.Addr()
+}
 
-	// Ensure valid file types for Python and text files
-	pythonExt := ".py"
-	txtExt := ".txt"
+// Wait blocks until the node stops serving, returning the server's error if it failed
+func (n *Node) Wait() error {
+	return <-n.done
+}
 
-	// Create a temporary directory for storing the files
-	tempDir := filepath.Join(os.TempDir(), "myapp_data")
-	if err := os.MkdirAll(tempDir, 0755); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to create temp directory: %v", err), http.StatusInternalServerError)
+// Stop ends the background loops, shuts the HTTP API down gracefully and closes the chain store. Only the
+// first call does anything, and a node that was never started has nothing to stop.
+func (n *Node) Stop(ctx context.Context) error {
+	var err error
+	n.stopOnce.Do(func() {
+		close(n.stop)
+		if n.server == nil {
+			return
+		}
+		err = n.server.Shutdown(ctx)
+		flushJobs()
+		mutex.Lock()
+		if chainStore != nil {
+			if closeErr := chainStore.Close(); err == nil {
+				err = closeErr
+			}
+			chainStore = nil
+		}
+		mutex.Unlock()
+		nodeRunning.Store(false)
+	})
+	return err
+}
+
+// registerHandlers registers the node's HTTP API on mux
+func registerHandlers(mux *http.ServeMux) {
+	// The explorer and chain queries are always served; explorer mode restricts them to reads and leaves out
+	// job submission, transfers, approvals and operator endpoints
+	handle := mux.HandleFunc
+	if explorerMode {
+		handle = func(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+			mux.HandleFunc(pattern, readOnly(handler))
+		}
+	}
+	handle("/", handleExplorer)
+	handle("/explorer/", http.FileServer(http.FS(explorerAssets)).ServeHTTP)
+	// Explorers follow the chain through announcements too
+	mux.HandleFunc("/announce", handleAnnounce)
+	handle("/miners", handleMiners)
+	handle("/status", handleStatus)
+	handle("/events", limitStreams(handleEvents))
+	handle("/peers", handlePeers)
+	handle("/finality", handleFinality)
+	handle("/block", handleBlock)
+	handle("/tx", handleTx)
+	handle("/tx/proof", handleTxProof)
+	handle("/metrics", handleMetrics)
+	handle("/balance", handleBalance)
+	handle("/fees/estimate", handleFeeEstimate)
+	handle("/headers", handleBlockRange(func(block Block) interface{} { return block.BlockHeader }, false))
+	handle("/difficulty/history", handleDifficultyHistory)
+	handle("/upgrades", handleUpgrades)
+	handle("/ipfs-object/", handleIPFSObject)
+	handle("/alerts", handleAlerts)
+	handle("/forks", handleForks)
+	handle("/mempool", handleMempool)
+	handle("/revocations", handleRevocations)
+	handle("/perf", handlePerf)
+	handle("/version", handleVersion)
+	if archiveMode {
+		handle("/blocks", handleBlockRange(func(block Block) interface{} { return block }, true))
+		handle("/bodies", handleBlockRange(func(block Block) interface{} { return block.BlockBody }, true))
+	}
+	if !explorerMode {
+		mux.HandleFunc("/jobs", whenSynced(handleReceive))
+		// Older clients and wallets submit at the endpoints used before /jobs and /tx
+		mux.HandleFunc("/receive", whenSynced(handleReceive))
+		mux.HandleFunc("/transfer", whenSynced(handleSubmitTx))
+		mux.HandleFunc("/job", handleJob)
+		mux.HandleFunc("/job/stream", limitStreams(handleJobStream))
+		mux.HandleFunc("/job/approvals", handleJobApprovals)
+		mux.HandleFunc("/job/receipt", handleJobReceipt)
+		mux.HandleFunc("/job/approve", whenSynced(handleJobDecision(DecisionApprove)))
+		mux.HandleFunc("/job/reject", whenSynced(handleJobDecision(DecisionReject)))
+		mux.HandleFunc("/purge", handlePurge)
+		mux.HandleFunc("/gc", handleGC)
+		mux.HandleFunc("/mempool/", handleMempoolRemove)
+		mux.HandleFunc("/maintenance", handleMaintenance)
+		mux.HandleFunc("/update", handleUpdate)
+		mux.HandleFunc("/billing", handleBilling)
+		mux.HandleFunc("/time-attestation", handleTimeAttestation)
+		mux.HandleFunc("/console", handleConsole)
+		mux.HandleFunc("/debug/invalidateblock", handleInvalidateBlock)
+	}
+	if clusterEnabled && !explorerMode {
+		mux.HandleFunc("/cluster/register", clusterHandler(handleWorkerRegister))
+		mux.HandleFunc("/cluster/heartbeat", clusterHandler(handleWorkerHeartbeat))
+		mux.HandleFunc("/cluster/lease", clusterHandler(handleWorkerLease))
+		mux.HandleFunc("/cluster/result", clusterHandler(handleWorkerResult))
+		mux.HandleFunc("/cluster/workers", handleWorkers)
+	}
+
+	// Job submissions download and execute synchronously, streams stay open until the job finishes
+	// and archive ranges can be large, so they get their own deadlines
+	endpointTimeouts["/jobs"] = 2*downloadTimeout + time.Duration(networkParams.MaxRuntime)*time.Second + scheduler.maxDefer + requestTimeout
+	endpointTimeouts["/receive"] = endpointTimeouts["/jobs"]
+	endpointTimeouts["/job/stream"] = 0
+	endpointTimeouts["/events"] = 0
+	endpointTimeouts["/blocks"] = 10 * time.Minute
+	endpointBodyLimits["/announce"] = 2 * int64(networkParams.MaxBlockSize) // Leaves room for the JSON encoding overhead
+	endpointTimeouts["/cluster/lease"] = workerLeaseWait + requestTimeout
+	endpointBodyLimits["/cluster/result"] = maxRequestBodyBytes + 6*maxScriptOutput // Escaped output
+}
+
+// Main runs the miner's command line: a subcommand when one is given, and a full node otherwise
+func Main() {
+	fallbackGateways := flag.String("ipfs-fallback-gateways", "", "Comma-separated gateways, in the form of -ipfs-gateway, tried in order when a download fails or returns the wrong content")
+	flag.StringVar(&ipfsGatewayURL, "ipfs-gateway", IPFSDownloadURL, "IPFS gateway URL prefix used to download files, or a subdomain gateway template such as http://{cid}.ipfs.localhost:8080/")
+	flag.StringVar(&ipfsAPIURL, "ipfs-api", ipfsAPIURL, "IPFS RPC API URL used for uploads")
+	genesisFile := flag.String("genesis", "", "Genesis file with the network's consensus parameters")
+	flag.BoolVar(&archiveMode, "archive", false, "Serve historical block ranges to peers at /blocks")
+	peerList := flag.String("peers", "", "Comma-separated addresses of other miners to sync with")
+	allowList := flag.String("outbound-allow", "", "Comma-separated networks peer and gateway requests may reach even if denied")
+	denyList := flag.String("outbound-deny", "", "Comma-separated networks peer and gateway requests must not reach, besides link-local and metadata addresses")
+	portList := flag.String("outbound-ports", "", "Comma-separated extra ports peer and gateway requests may use, besides the peer and IPFS ports")
+	flag.IntVar(&validationWorkers, "validation-workers", validationWorkers, "Number of goroutines validating blocks during sync")
+	syncWorkers := flag.Int("sync-workers", 4, "Number of parallel block downloads during sync")
+	metricsPush := flag.String("metrics-push", "", "URL of an aggregator to push signed metrics snapshots to (token in METRICS_PUSH_TOKEN)")
+	metricsPushInterval := flag.Duration("metrics-push-interval", time.Minute, "Interval between metrics snapshots pushed to -metrics-push")
+	alertWebhookURL := flag.String("alert-webhook", "", "URL alerts about equivocation, manipulated timestamps and invalid proof of work are posted to")
+	pexInterval := flag.Duration("pex-interval", 5*time.Minute, "Interval between peer list exchanges (0 disables)")
+	perfInterval := flag.Duration("perf-interval", time.Minute, "Interval between performance samples kept for the explorer (0 disables)")
+	flag.StringVar(&pythonInterpreter, "python", pythonInterpreter, "Interpreter job scripts are run with, such as python3 or a virtualenv's python")
+	tailscaleTag := flag.String("tailscale-tag", "", "ACL tag, such as tag:ipfs-miner, of the tailnet devices to use as peers; tailnet discovery is off when empty")
+	tailscaleSocketPath := flag.String("tailscale-socket", tailscaleSocket, "Unix socket of the tailscaled LocalAPI read by -tailscale-tag")
+	tailscaleRefresh := flag.Duration("tailscale-refresh", time.Minute, "Interval between tailnet discoveries with -tailscale-tag")
+	codecName := flag.String("codec", "json", "Serialization codec requested from peers (json or cbor)")
+	dataDir := flag.String("data-dir", "data", "Directory holding the local chain store")
+	storageCodecName := flag.String("storage-codec", "json", "Serialization codec of the local chain store (json or cbor)")
+	storeName := flag.String("store", "file", "Chain store backend ("+strings.Join(storeNames(), " or ")+")")
+	verifyDepth := flag.Int("verify-depth", 100, "Number of most recent blocks verified on startup (0 verifies the whole chain)")
+	flag.IntVar(&snapshotInterval, "snapshot-interval", snapshotInterval, "Blocks between state snapshots (0 disables snapshots)")
+	flag.IntVar(&snapshotKeep, "snapshot-keep", snapshotKeep, "Number of state snapshots kept")
+	keyFile := flag.String("key-file", "node.key", "File holding the node's ed25519 signing key")
+	flag.BoolVar(&timeOracleEnabled, "time-oracle", false, "Include and require signed NTP time attestations in blocks")
+	oracleList := flag.String("time-oracle-keys", "", "Comma-separated hex public keys of the time oracles trusted to attest block times")
+	flag.StringVar(&timeOraclePeer, "time-oracle-peer", "", "Time oracle to request block time attestations from (default: attest with the node key, which must be a time oracle key)")
+	flag.StringVar(&ntpServer, "ntp-server", ntpServer, "NTP server used for time attestations")
+	flag.DurationVar(&timeTolerance, "time-tolerance", timeTolerance, "Maximum allowed difference between block timestamp and attested time")
+	jobSlots := flag.Int("job-slots", runtime.NumCPU(), "Number of jobs executed at once; waiting jobs are scheduled fairly across submitters")
+	shedDefer := flag.Duration("shed-low-priority", 0, "Longest time low-priority jobs are deferred while the node mines a block or syncs (0 runs them at once)")
+	weightList := flag.String("submitter-weights", "", "Comma-separated submitter=weight pairs giving submitters a larger or smaller share of execution time")
+	flag.IntVar(&submitPoWBits, "submit-pow", 0, "Leading zero bits of proof of work required of job submissions (0 disables it)")
+	allowlistFile := flag.String("script-allowlist", "", "File of script CIDs this node may execute, one per line")
+	defaultSandbox := sandboxOff
+	if runtime.GOOS == "linux" {
+		defaultSandbox = sandboxNetns
+	}
+	flag.StringVar(&jobSandbox, "job-sandbox", defaultSandbox, "Sandbox scripts run in: netns gives each script its own network namespace, enforcing network policies; off runs scripts with the host's network")
+	egressList := flag.String("job-egress", "", "Comma-separated host:port destinations jobs may ask to reach; hosts may be networks and ports may be *")
+	authorList := flag.String("trusted-authors", "", "Comma-separated hex public keys of authors whose signed scripts this node may execute")
+	approverList := flag.String("approvers", "", "Comma-separated hex public keys of approvers that must sign off on jobs before they run")
+	flag.IntVar(&approvalThreshold, "approval-threshold", 0, "Number of approvals a job needs (0 requires all approvers)")
+	flag.DurationVar(&requestTimeout, "request-timeout", requestTimeout, "Deadline for reading a request and writing its response")
+	flag.DurationVar(&downloadTimeout, "download-timeout", downloadTimeout, "Deadline for downloading a job file from IPFS")
+	flag.Int64Var(&maxInputSize, "max-input-size", 0, "Largest job file downloaded from IPFS in bytes, advertised in /status (0 is unlimited)")
+	flag.IntVar(&outputCap, "output-cap", 0, "Bytes of a job's output kept in its transaction, the rest being stored in IPFS (0 is the network's MaxOutputSize)")
+	flag.Int64Var(&maxScriptOutput, "max-script-output", maxScriptOutput, "Largest output captured from a script in bytes; scripts producing more are stopped")
+	peerH2C := flag.Bool("peer-h2c", false, "Talk to peers over HTTP/2 without TLS (all peers must run a version that accepts it)")
+	tlsCert := flag.String("tls-cert", "", "PEM certificate of the node for mutual TLS with peers and clients (empty serves plain HTTP)")
+	tlsKey := flag.String("tls-key", "", "PEM private key of the -tls-cert certificate")
+	tlsPeers := flag.String("tls-peers", "tls-peers.txt", "File mapping the SHA-256 fingerprints of known certificates to identities")
+	listenList := flag.String("listen", ":8080", "Comma-separated addresses to serve the HTTP API on; the default accepts IPv4 and IPv6 clients")
+	maxConnections := flag.Int("max-connections", 256, "Maximum number of simultaneously open client connections")
+	maxClientConnections := flag.Int("max-client-connections", 32, "Maximum number of simultaneously open connections from one client address (0 for no limit)")
+	flag.IntVar(&maxStreams, "max-streams", maxStreams, "Maximum number of simultaneous /events and /job/stream streams, which must leave room below -max-connections")
+	corsList := flag.String("cors-origins", "", "Comma-separated origins browser pages may call the API from; * lets any page read")
+	proxyList := flag.String("trusted-proxies", "", "Comma-separated reverse proxy addresses or networks whose X-Forwarded-For names the client")
+	flag.StringVar(&basePath, "base-path", "", "Path prefix a reverse proxy serves the API and explorer under, such as /chain")
+	flag.StringVar(&releaseKey, "release-key", "", "Hex public key of the maintainer that signs releases")
+	flag.StringVar(&releasePointer, "release-pointer", "", "IPFS path of the release manifest, such as /ipns/<name> (empty disables updates)")
+	updateInterval := flag.Duration("update-interval", 6*time.Hour, "Interval between release checks")
+	flag.BoolVar(&explorerMode, "explorer", false, "Serve only the explorer and read-only chain APIs, without compute, mining or admin endpoints")
+	flag.StringVar(&headKey, "head-key", "", "IPFS key to publish the chain head under in IPNS (empty disables publishing)")
+	flag.StringVar(&headPointer, "head-pointer", "", "IPFS path of a published chain head to recover from on startup, such as /ipns/<name>")
+	flag.BoolVar(&forceGenesis, "force-genesis", false, "Mine even when the local chain is empty or behind a known chain head")
+	gc := gcPolicy
+	flag.DurationVar(&gc.Interval, "gc-interval", time.Hour, "Interval between garbage collections of leftover job files, cached downloads and orphaned pins (0 disables)")
+	flag.DurationVar(&gc.MaxAge, "gc-max-age", gc.MaxAge, "Age after which leftover job files and pins of blocks off the main chain are collected")
+	flag.Int64Var(&gc.CacheBudget, "gc-cache-budget", gc.CacheBudget, "Bytes of downloaded job files kept in the job working directory")
+	flag.BoolVar(&gc.DryRun, "gc-dry-run", false, "Only log what garbage collections would remove")
+	var limits ResourceLimits
+	flag.Float64Var(&limits.Load, "pause-load", 0, "Pause proof of work while the one-minute load average per CPU exceeds this (0 disables)")
+	flag.Float64Var(&limits.CPUPressure, "pause-cpu-pressure", 0, "Pause proof of work while tasks waited for a CPU more than this percentage of the last 10 seconds (0 disables)")
+	flag.Float64Var(&limits.Temperature, "pause-temperature", 0, "Pause proof of work while the hottest thermal zone exceeds this many degrees Celsius (0 disables)")
+	cluster := flag.Bool("cluster", false, "Dispatch job execution to executor workers started with the worker command, authenticated by NODE_CLUSTER_TOKEN")
+	showVersion := flag.Bool("version", false, "Print the version, build information and default genesis parameters, then exit")
+	flag.BoolVar(&devMode, "dev", false, "Run a local development node: mine every transaction immediately at difficulty 0, without peers, keeping the chain in memory unless -data-dir is set")
+	flag.StringVar(&configFile, "config", configFile, "File of name = value flag settings applied unless given on the command line; created by the init command")
+	flag.Parse()
+	if err := applyConfig(configFile); err != nil {
+		fmt.Printf("Error loading configuration: %v\n", err)
 		return
 	}
 
-	// Define the file paths for the downloaded Python and text files
-	pythonFilename := filepath.Join(tempDir, fmt.Sprintf("%s%s", pythonHash, pythonExt))
-	txtFilename := filepath.Join(tempDir, fmt.Sprintf("%s%s", txtHash, txtExt))
+	if *showVersion {
+		printVersion()
+		return
+	}
+	if *peerH2C {
+		peerClient = &http.Client{Transport: guarded(newTransport(true))}
+	}
+	var tlsConfig *tls.Config
+	if *tlsCert != "" {
+		if *peerH2C {
+			fmt.Println("-peer-h2c and -tls-cert cannot be combined")
+			return
+		}
+		config, err := configureTLS(*tlsCert, *tlsKey, *tlsPeers)
+		if err != nil {
+			fmt.Printf("Error configuring TLS: %v\n", err)
+			return
+		}
+		tlsConfig = config
+	}
 
-	// Download Python and text files from IPFS
-	fmt.Printf("Downloading Python file with hash: %s\n", pythonHash)
-	if err := downloadFromIPFS(pythonHash, pythonFilename); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to download Python file: %v", err), http.StatusInternalServerError)
+	codec, ok := codecByName(*codecName)
+	if !ok {
+		fmt.Printf("Unsupported codec %q, expected one of %s\n", *codecName, strings.Join(codecNames(), ", "))
 		return
 	}
+	preferredCodec = codec
 
-	fmt.Printf("Downloading text file with hash: %s\n", txtHash)
-	if err := downloadFromIPFS(txtHash, txtFilename); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to download text file: %v", err), http.StatusInternalServerError)
+	storageCodec, ok := codecByName(*storageCodecName)
+	if !ok {
+		fmt.Printf("Unsupported storage codec %q, expected one of %s\n", *storageCodecName, strings.Join(codecNames(), ", "))
+		return
+	}
+	if _, ok := storeBackends[*storeName]; !ok {
+		fmt.Printf("Unsupported chain store %q, expected one of %s\n", *storeName, strings.Join(storeNames(), ", "))
+		return
+	}
+	if jobSandbox != sandboxNetns && jobSandbox != sandboxOff {
+		fmt.Printf("Unsupported -job-sandbox %q, expected %s or %s\n", jobSandbox, sandboxNetns, sandboxOff)
 		return
 	}
+	if runCommand(flag.Args(), *keyFile, *genesisFile, *dataDir, *storeName, storageCodec) {
+		return
+	}
+	if jobSandbox == sandboxNetns {
+		if err := checkSandbox(); err != nil {
+			fmt.Printf("Error starting the job sandbox: %v\n", err)
+			return
+		}
+	}
+	egressRules, err := parseEgressRules(*egressList)
+	if err != nil {
+		fmt.Printf("Invalid -job-egress: %v\n", err)
+		return
+	}
+	jobEgressRules = egressRules
 
-	// Execute the Python file with the text file as an argument
-	fmt.Printf("Executing Python file: %s with argument: %s\n", pythonFilename, txtFilename)
-	result, err := executePythonFile(pythonFilename, txtFilename)
+	params, err := loadNetworkParams(*genesisFile)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to execute Python file: %v", err), http.StatusInternalServerError)
+		fmt.Printf("Error loading network parameters: %v\n", err)
 		return
 	}
 
-	// Print Python script output
-	fmt.Println("Python script output:", result)
+	if trustedProxies, err = parseNetworkList(*proxyList); err != nil {
+		fmt.Printf("Invalid -trusted-proxies: %v\n", err)
+		return
+	}
+	for _, origin := range strings.Split(*corsList, ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			corsOrigins = append(corsOrigins, origin)
+		}
+	}
+	if basePath != "" {
+		basePath = "/" + strings.Trim(basePath, "/")
+		if basePath != path.Clean(basePath) || basePath == "/" {
+			fmt.Printf("Invalid -base-path %q\n", basePath)
+			return
+		}
+		if len(trustedProxies) == 0 {
+			fmt.Println("Warning: -base-path is set without -trusted-proxies; a proxy on this host makes every client look local to the loopback-only endpoints")
+		}
+	}
 
-	// Remove the downloaded files after processing
-	if err := removeFile(pythonFilename); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to remove Python file: %v", err), http.StatusInternalServerError)
+	var peers []string
+	if outboundAllow, err = parseNetworkList(*allowList); err != nil {
+		fmt.Printf("Invalid -outbound-allow: %v\n", err)
 		return
 	}
-	if err := removeFile(txtFilename); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to remove text file: %v", err), http.StatusInternalServerError)
+	denied, err := parseNetworkList(*denyList)
+	if err != nil {
+		fmt.Printf("Invalid -outbound-deny: %v\n", err)
 		return
 	}
+	outboundDeny = append(outboundDeny, denied...)
+	for _, port := range strings.Split(*portList, ",") {
+		if port = strings.TrimSpace(port); port != "" {
+			outboundPorts = append(outboundPorts, port)
+		}
+	}
+	for _, gateway := range strings.Split(*fallbackGateways, ",") {
+		if gateway = strings.TrimSpace(gateway); gateway != "" {
+			ipfsFallbackGateways = append(ipfsFallbackGateways, gateway)
+		}
+	}
 
-	// Add transaction to pool
-	addTransaction(Transaction{ID: clientIP, Data: result})
+	for _, peer := range strings.Split(*peerList, ",") {
+		if peer = normalizePeerAddress(peer); peer == "" {
+			continue
+		}
+		if !validPeerAddress(peer) {
+			fmt.Printf("Invalid or blocked peer address %q\n", peer)
+			return
+		}
+		peers = append(peers, peer)
+	}
 
-	// Start mining the block
-	go mineBlock(clientIP, 4)
+	if devMode {
+		if explorerMode {
+			fmt.Println("-dev and -explorer cannot be combined")
+			return
+		}
+		params.Difficulty = 0
+		peers, *pexInterval = nil, 0
+		headPointer, forceGenesis = "", true
+		dataDirSet := false
+		flag.Visit(func(f *flag.Flag) { dataDirSet = dataDirSet || f.Name == "data-dir" })
+		if !dataDirSet {
+			*dataDir = ""
+		}
+		fmt.Println("Running in development mode: blocks are mined instantly and peers are disabled")
+	}
 
-	fmt.Println("Hashes processed successfully")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Hashes processed successfully"))
-}
+	for _, approver := range strings.Split(*approverList, ",") {
+		if approver = strings.TrimSpace(approver); approver == "" {
+			continue
+		}
+		if key, err := hex.DecodeString(approver); err != nil || len(key) != ed25519.PublicKeySize {
+			fmt.Printf("Invalid approver public key %q\n", approver)
+			return
+		}
+		approvers = append(approvers, approver)
+	}
+	if approvalThreshold == 0 {
+		approvalThreshold = len(approvers)
+	}
+	if *jobSlots < 1 {
+		fmt.Println("-job-slots must be at least 1")
+		return
+	}
+	if maxScriptOutput < 1 || outputCap < 0 {
+		fmt.Println("-max-script-output must be at least 1 and -output-cap cannot be negative")
+		return
+	}
+	if *shedDefer < 0 {
+		fmt.Println("-shed-low-priority cannot be negative")
+		return
+	}
+	scheduler = newResourceScheduler(*jobSlots, *shedDefer)
+	if submitterWeights, err = parseSubmitterWeights(*weightList); err != nil {
+		fmt.Printf("Invalid -submitter-weights: %v\n", err)
+		return
+	}
+	if *allowlistFile != "" {
+		if scriptAllowlist, err = loadScriptAllowlist(*allowlistFile); err != nil {
+			fmt.Printf("Error loading the script allow-list: %v\n", err)
+			return
+		}
+	}
+	for _, author := range strings.Split(*authorList, ",") {
+		if author = strings.ToLower(strings.TrimSpace(author)); author == "" {
+			continue
+		}
+		if key, err := hex.DecodeString(author); err != nil || len(key) != ed25519.PublicKeySize {
+			fmt.Printf("Invalid trusted author public key %q\n", author)
+			return
+		}
+		trustedAuthors = append(trustedAuthors, author)
+	}
+	for _, oracle := range strings.Split(*oracleList, ",") {
+		if oracle = strings.ToLower(strings.TrimSpace(oracle)); oracle == "" {
+			continue
+		}
+		if key, err := hex.DecodeString(oracle); err != nil || len(key) != ed25519.PublicKeySize {
+			fmt.Printf("Invalid time oracle public key %q\n", oracle)
+			return
+		}
+		timeOracleKeys = append(timeOracleKeys, oracle)
+	}
+	if timeOracleEnabled && len(timeOracleKeys) == 0 {
+		fmt.Println("-time-oracle requires -time-oracle-keys")
+		return
+	}
+	if len(approvers) > 0 && (approvalThreshold < 1 || approvalThreshold > len(approvers)) {
+		fmt.Printf("Approval threshold must be between 1 and %d\n", len(approvers))
+		return
+	}
+
+	if *maxConnections < 1 {
+		fmt.Println("-max-connections must be at least 1")
+		return
+	}
+	if maxStreams < 0 || maxStreams >= *maxConnections {
+		fmt.Println("-max-streams must be at least 0 and below -max-connections, so streams cannot hold every connection")
+		return
+	}
+	listener, err := listenAll(*listenList)
+	if err != nil {
+		fmt.Printf("Error starting server: %v\n", err)
+		return
+	}
+	listener = limitListener(listener, *maxConnections, *maxClientConnections)
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
 
-func main() {
-	http.HandleFunc("/receive", handleReceive)
-	fmt.Println("Server is listening on port 8080...")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
+	options := []Option{
+		WithConsensus(params),
+		WithKeyFile(*keyFile),
+		WithDataDir(*dataDir, storageCodec, *verifyDepth),
+		WithStore(*storeName),
+		WithPeers(peers, *syncWorkers),
+		WithPeerExchange(*pexInterval),
+		WithPerfSampling(*perfInterval),
+		WithUpdateInterval(*updateInterval),
+		WithListener(listener),
+		WithResourceGuard(limits),
+		WithGarbageCollection(gc),
+	}
+	if *cluster {
+		token := os.Getenv("NODE_CLUSTER_TOKEN")
+		if token == "" {
+			fmt.Println("Set NODE_CLUSTER_TOKEN to the secret executor workers authenticate with")
+			return
+		}
+		options = append(options, WithCluster(token))
+	}
+	if *alertWebhookURL != "" {
+		options = append(options, WithAlertWebhook(*alertWebhookURL))
+	}
+	if *tailscaleTag != "" {
+		options = append(options, WithTailnetDiscovery(*tailscaleTag, *tailscaleSocketPath, *tailscaleRefresh))
+	}
+	if *metricsPush != "" {
+		options = append(options, WithMetricsPush(*metricsPush, os.Getenv("METRICS_PUSH_TOKEN"), *metricsPushInterval))
+	}
+	node, err := NewNode(options...)
+	if err != nil {
+		fmt.Printf("Error creating node: %v\n", err)
+		return
+	}
+	if err := node.Start(); err != nil {
+		fmt.Printf("Error starting node: %v\n", err)
+		return
+	}
+	fmt.Printf("Server is listening on %s...\n", *listenList)
+	if err := node.Wait(); err != nil {
 		fmt.Printf("Error starting server: %v\n", err)
 	}
 }
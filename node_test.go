@@ -0,0 +1,95 @@
+package blockchain
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNodeInProcess(t *testing.T) {
+	useIPFSMock(t)
+	withChain(t, nil)
+	savedKey, savedID, savedCodec := nodeKey, nodeID, preferredCodec
+	t.Cleanup(func() { nodeKey, nodeID, preferredCodec = savedKey, savedID, savedCodec })
+	dir := t.TempDir()
+
+	start := func() *Node {
+		t.Helper()
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		node, err := NewNode(WithListener(listener), WithKeyFile(filepath.Join(dir, "node.key")),
+			WithDataDir(filepath.Join(dir, "data"), jsonCodec{}, 0), WithPeerExchange(0), WithPerfSampling(0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := node.Start(); err != nil {
+			t.Fatalf("start: %v", err)
+		}
+		return node
+	}
+	stop := func(node *Node) {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := node.Stop(ctx); err != nil {
+			t.Fatalf("stop: %v", err)
+		}
+		if err := node.Wait(); err != nil {
+			t.Fatalf("serve: %v", err)
+		}
+	}
+
+	node := start()
+	resp, err := http.Get("http://" + node.Addr().String() + "/status")
+	if err != nil {
+		stop(node)
+		t.Fatal(err)
+	}
+	var status NodeStatus
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	resp.Body.Close()
+	if err != nil || status.NodeID != node.ID() || status.GenesisHash != genesisHash {
+		stop(node)
+		t.Fatalf("status %+v, %v; want node %s on network %s", status, err, node.ID(), genesisHash)
+	}
+
+	// The chain state is shared by the process, so a second node waits for the first to stop
+	second, err := NewNode(WithKeyFile(filepath.Join(dir, "node.key")), WithDataDir(filepath.Join(dir, "data"), jsonCodec{}, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Start(); err == nil {
+		t.Fatal("second node started while the first was running")
+	}
+	stop(node)
+
+	restarted := start()
+	if restarted.ID() != node.ID() {
+		t.Errorf("restarted node has identity %s, want %s", restarted.ID(), node.ID())
+	}
+	stop(restarted)
+}
+
+func TestClientProofHelpers(t *testing.T) {
+	key, creator := testKey("creator")
+	block := signedBlock(key, creator)
+	block.Transactions = []Transaction{{JobID: "a"}, {JobID: "b"}, {JobID: "c"}}
+	block.TxRoot = merkleRoot(block.Transactions)
+	block.Hash = generateHash(block.BlockHeader, block.Nonce)
+	if BlockHash(block.BlockHeader) != block.Hash {
+		t.Fatal("BlockHash differs from the hash the miners compute")
+	}
+	for i, tx := range block.Transactions {
+		encoded, _ := json.Marshal(tx)
+		root, err := ProofRoot(TxProof{Transaction: encoded, Index: i, Siblings: merkleProof(block.Transactions, i), Header: block.BlockHeader})
+		if err != nil || root != block.TxRoot {
+			t.Fatalf("proof of transaction %d leads to %s, %v; want %s", i, root, err, block.TxRoot)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package blockchain
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLoopbackEndpointsRefuseRebinding(t *testing.T) {
+	handler := withCORS(http.HandlerFunc(handleMaintenance))
+	for _, c := range []struct {
+		name, host, origin string
+		want               int
+	}{
+		{"rebinding page", "rebind.example:8080", "http://rebind.example:8080", http.StatusForbidden},
+		{"rebinding page without origin", "rebind.example:8080", "", http.StatusForbidden},
+		{"foreign origin", "127.0.0.1:8080", "http://attacker.example", http.StatusForbidden},
+		{"operator tool", "127.0.0.1:8080", "", http.StatusBadRequest},
+		{"operator tool over IPv6", "[::1]:8080", "", http.StatusBadRequest},
+		{"local page", "localhost:8080", "http://localhost:8080", http.StatusBadRequest},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			// An invalid ?enable= is answered with 400 once the request is let through, so no state changes
+			r := httptest.NewRequest(http.MethodPost, "/maintenance?enable=maybe", nil)
+			r.RemoteAddr, r.Host = "127.0.0.1:40000", c.host
+			if c.host == "[::1]:8080" {
+				r.RemoteAddr = "[::1]:40000"
+			}
+			if c.origin != "" {
+				r.Header.Set("Origin", c.origin)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != c.want {
+				t.Fatalf("status %d, want %d: %s", w.Code, c.want, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+//go:build windows
+
+package blockchain
+
+import (
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+// killProcessGroupOnCancel starts cmd in a new process group. Windows has no signal for a whole group, so a done
+// context kills the script process itself, which is what exec.CommandContext does by default.
+func killProcessGroupOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+var getDiskFreeSpaceEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// availableSpace returns the space available to the node's user on the volume holding path
+func availableSpace(path string) (int64, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var available uint64
+	if ok, _, err := getDiskFreeSpaceEx.Call(uintptr(unsafe.Pointer(name)), uintptr(unsafe.Pointer(&available)), 0, 0); ok == 0 {
+		return 0, err
+	}
+	return int64(available), nil
+}
@@ -0,0 +1,59 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestUsageReceipts(t *testing.T) {
+	executor, executorID := testKey("executor")
+	submitter, submitterKey := testKey("submitter")
+	tx := Transaction{ID: "192.0.2.7", JobID: "receipt-job", Type: TxJob, Executor: executorID, ExecutionTime: 1500, CPUTime: 1200, ComputeUnits: 2, Fee: 3}
+	tx.UsageSignature = hex.EncodeToString(ed25519.Sign(executor, usageMessage(tx)))
+	withChain(t, []Block{{BlockHeader: BlockHeader{BlockNumber: 1, Timestamp: time.Now().Unix(), Hash: "receipt-block"}, BlockBody: BlockBody{Transactions: []Transaction{tx}}}})
+	savedJobs := jobs
+	jobs = map[string]*Job{tx.JobID: {ID: tx.JobID, Submitter: tx.ID, Status: JobConfirmed, SubmitterKey: submitterKey}}
+	t.Cleanup(func() { jobs = savedJobs; txCache.Purge() })
+
+	post := func(receipt UsageReceipt) int {
+		body, _ := json.Marshal(receipt)
+		w := httptest.NewRecorder()
+		handleJobReceipt(w, httptest.NewRequest(http.MethodPost, "/job/receipt", bytes.NewReader(body)))
+		return w.Code
+	}
+	cosigned := func() int {
+		report := billingReport(time.Unix(0, 0), time.Now().Add(time.Hour), "")
+		if len(report) != 1 {
+			t.Fatalf("billing report %+v, want one submitter", report)
+		}
+		return report[0].CoSigned
+	}
+
+	// Only the submitter key given at submission can co-sign the usage the chain records
+	inflated := tx
+	inflated.CPUTime = 60000
+	for name, receipt := range map[string]UsageReceipt{
+		"another key":     {JobID: tx.JobID, Signature: hex.EncodeToString(ed25519.Sign(executor, ReceiptMessage(tx)))},
+		"different usage": {JobID: tx.JobID, Signature: hex.EncodeToString(ed25519.Sign(submitter, ReceiptMessage(inflated)))},
+	} {
+		if code := post(receipt); code != http.StatusForbidden {
+			t.Errorf("%s: status %d, want %d", name, code, http.StatusForbidden)
+		}
+	}
+	if cosigned() != 0 {
+		t.Fatal("usage counted as co-signed without a valid receipt")
+	}
+
+	if code := post(UsageReceipt{JobID: tx.JobID, Signature: hex.EncodeToString(ed25519.Sign(submitter, ReceiptMessage(tx)))}); code != http.StatusNoContent {
+		t.Fatalf("valid receipt: status %d", code)
+	}
+	if cosigned() != 1 {
+		t.Fatal("co-signed usage not counted by the billing report")
+	}
+}
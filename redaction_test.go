@@ -0,0 +1,50 @@
+package blockchain
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// withChain replaces the local chain and redactions for the duration of the test
+func withChain(t *testing.T, blocks []Block) {
+	savedChain, savedJobs, savedSubmitters := blockchain, redactedJobs, redactedSubmitters
+	blockchain, redactedJobs, redactedSubmitters = blocks, make(map[string]bool), make(map[string]bool)
+	t.Cleanup(func() { blockchain, redactedJobs, redactedSubmitters = savedChain, savedJobs, savedSubmitters })
+}
+
+func TestRedactedBlocks(t *testing.T) {
+	blocks := testBlocks(3)
+	for i := range blocks {
+		blocks[i].BlockNumber = i + 1
+	}
+	withChain(t, blocks)
+	redactedJobs["job-1"] = true
+
+	resp := httptest.NewRecorder()
+	handleBlock(resp, httptest.NewRequest(http.MethodGet, "/block?number=2", nil))
+	var block Block
+	if err := json.NewDecoder(resp.Body).Decode(&block); err != nil {
+		t.Fatalf("decode /block: %v", err)
+	}
+	if block.Transactions[0].Data != "" || resp.Header().Get("X-Redacted-Transactions") != "1" {
+		t.Errorf("/block served redacted output %q", block.Transactions[0].Data)
+	}
+	if blockchain[1].Transactions[0].Data == "" {
+		t.Error("redacting a served block changed the local chain")
+	}
+
+	for path, want := range map[string]int{
+		"/blocks?from=1&to=3":  http.StatusUnavailableForLegalReasons,
+		"/bodies?from=2&to=2":  http.StatusUnavailableForLegalReasons,
+		"/bodies?from=3&to=3":  http.StatusOK,
+		"/headers?from=1&to=3": http.StatusOK,
+	} {
+		resp := httptest.NewRecorder()
+		handleBlockRange(func(block Block) interface{} { return block }, path[:8] != "/headers")(resp, httptest.NewRequest(http.MethodGet, path, nil))
+		if resp.Code != want {
+			t.Errorf("%s returned %d, want %d", path, resp.Code, want)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package blockchain
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"testing"
+)
+
+// signedBlock mines an empty block at height 1 created by the identity creator and signed by key
+func signedBlock(key ed25519.PrivateKey, creator string) Block {
+	block := Block{BlockHeader: BlockHeader{PrevHash: "-1", PrevCID: "-1", BlockNumber: 1, Timestamp: 1700000000, Creator: creator}}
+	block.TxRoot = merkleRoot(nil)
+	block.Hash = generateHash(block.BlockHeader, block.Nonce)
+	block.Signature = hex.EncodeToString(ed25519.Sign(key, blockMessage(block.BlockHeader)))
+	return block
+}
+
+func TestRevokedCreator(t *testing.T) {
+	params, saved := networkParams, revoked
+	networkParams, revoked = NetworkParams{}, make(map[string]Revocation)
+	t.Cleanup(func() { networkParams, revoked = params, saved })
+
+	mallory, malloryID := testKey("mallory")
+	alice, aliceID := testKey("alice")
+	revoked[malloryID] = Revocation{Identity: malloryID, BlockNumber: 1}
+
+	own := signedBlock(mallory, malloryID)
+	if err := validateHeader(own.BlockHeader); err != nil {
+		t.Fatalf("block signed by its creator refused: %v", err)
+	}
+	if _, err := checkRevocations(own); err == nil {
+		t.Fatal("block created by a revoked identity accepted")
+	}
+
+	// The revoked node cannot pass its block off as another identity's, because it lacks that identity's key
+	impersonated := signedBlock(mallory, aliceID)
+	if err := validateHeader(impersonated.BlockHeader); err == nil {
+		t.Fatal("block signed by another key than its creator's accepted")
+	}
+	if err := validateHeader(signedBlock(alice, aliceID).BlockHeader); err != nil {
+		t.Fatalf("block of an identity that is not revoked refused: %v", err)
+	}
+}
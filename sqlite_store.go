@@ -0,0 +1,322 @@
+//go:build sqlite
+
+// sqlite_store.go adds a SQLite chain store, selected with -store sqlite. It keeps blocks, transactions and the
+// job history in indexed relational tables of data/chain.db, so operators can query the chain with the sqlite3
+// shell or any other SQL tool. It uses the pure-Go modernc.org/sqlite driver and is compiled in with:
+//
+//	go build -tags sqlite -o miner ./cmd/miner
+package blockchain
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	_ "modernc.org/sqlite"
+)
+
+func init() {
+	RegisterStore("sqlite", openSQLiteStore)
+}
+
+// sqliteSchema creates the store's tables. The header and record columns hold the complete JSON encoding the
+// node reloads from; the other columns are extracted for querying.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS blocks (
+	number     INTEGER PRIMARY KEY,
+	hash       TEXT NOT NULL UNIQUE,
+	prev_hash  TEXT NOT NULL,
+	prev_cid   TEXT NOT NULL,
+	timestamp  INTEGER NOT NULL,
+	creator    TEXT NOT NULL,
+	difficulty INTEGER NOT NULL,
+	nonce      INTEGER NOT NULL,
+	tx_root    TEXT NOT NULL,
+	tx_count   INTEGER NOT NULL,
+	header     TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS blocks_creator ON blocks (creator);
+CREATE INDEX IF NOT EXISTS blocks_timestamp ON blocks (timestamp);
+
+CREATE TABLE IF NOT EXISTS transactions (
+	block_number   INTEGER NOT NULL REFERENCES blocks (number),
+	position       INTEGER NOT NULL,
+	id             TEXT NOT NULL,
+	type           TEXT NOT NULL,
+	job_id         TEXT NOT NULL,
+	executor       TEXT NOT NULL,
+	sender         TEXT NOT NULL,
+	recipient      TEXT NOT NULL,
+	amount         INTEGER NOT NULL,
+	fee            INTEGER NOT NULL,
+	nonce          INTEGER NOT NULL,
+	execution_time INTEGER NOT NULL,
+	cpu_time       INTEGER NOT NULL,
+	data           TEXT NOT NULL,
+	record         TEXT NOT NULL,
+	PRIMARY KEY (block_number, position)
+);
+CREATE INDEX IF NOT EXISTS transactions_id ON transactions (id);
+CREATE INDEX IF NOT EXISTS transactions_job_id ON transactions (job_id);
+CREATE INDEX IF NOT EXISTS transactions_executor ON transactions (executor);
+CREATE INDEX IF NOT EXISTS transactions_sender ON transactions (sender, nonce);
+CREATE INDEX IF NOT EXISTS transactions_recipient ON transactions (recipient);
+
+CREATE TABLE IF NOT EXISTS labels (
+	block_number INTEGER NOT NULL,
+	position     INTEGER NOT NULL,
+	key          TEXT NOT NULL,
+	value        TEXT NOT NULL,
+	PRIMARY KEY (block_number, position, key),
+	FOREIGN KEY (block_number, position) REFERENCES transactions (block_number, position)
+);
+CREATE INDEX IF NOT EXISTS labels_key_value ON labels (key, value);
+
+CREATE TABLE IF NOT EXISTS jobs (
+	id             TEXT PRIMARY KEY,
+	submitter      TEXT NOT NULL,
+	status         TEXT NOT NULL,
+	error          TEXT NOT NULL,
+	result         TEXT NOT NULL,
+	block_number   INTEGER NOT NULL,
+	python_hash    TEXT NOT NULL,
+	txt_hash       TEXT NOT NULL,
+	execution_time INTEGER NOT NULL,
+	cpu_time       INTEGER NOT NULL,
+	record         TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS jobs_submitter ON jobs (submitter);
+CREATE INDEX IF NOT EXISTS jobs_status ON jobs (status);
+CREATE INDEX IF NOT EXISTS jobs_block_number ON jobs (block_number);
+`
+
+// sqliteStore keeps the chain and job history in a SQLite database. The storage codec does not apply to it.
+type sqliteStore struct {
+	db    *sql.DB
+	saved map[string]string // Stored record of each job by ID, so SaveJobs writes only what changed; nil until read
+}
+
+// openSQLiteStore opens or creates chain.db in dataDir
+func openSQLiteStore(dataDir string, _ Codec) (ChainStore, error) {
+	path := filepath.Join(dataDir, "chain.db")
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	// A single connection keeps writes ordered; WAL still lets outside tools read while the node runs
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create the schema of %s: %w", path, err)
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+func (s *sqliteStore) Load() ([]Block, error) {
+	rows, err := s.db.Query(`SELECT header FROM blocks ORDER BY number`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blocks: %w", err)
+	}
+	blocks := []Block{}
+	for rows.Next() {
+		var header string
+		var block Block
+		if err := rows.Scan(&header); err != nil {
+			rows.Close()
+			return blocks, fmt.Errorf("failed to read block %d: %w", len(blocks)+1, err)
+		}
+		if err := json.Unmarshal([]byte(header), &block.BlockHeader); err != nil {
+			rows.Close()
+			return blocks, fmt.Errorf("failed to decode block %d: %w", len(blocks)+1, err)
+		}
+		blocks = append(blocks, block)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return blocks, fmt.Errorf("failed to read blocks: %w", err)
+	}
+
+	// Attach the bodies; a block whose transactions cannot be read ends the intact part of the chain
+	rows, err = s.db.Query(`SELECT block_number, record FROM transactions ORDER BY block_number, position`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transactions: %w", err)
+	}
+	defer rows.Close()
+	positions := make(map[int]int, len(blocks))
+	for i, block := range blocks {
+		positions[block.BlockNumber] = i
+	}
+	for rows.Next() {
+		var number int
+		var record string
+		var tx Transaction
+		if err := rows.Scan(&number, &record); err != nil {
+			return blocks, fmt.Errorf("failed to read transactions: %w", err)
+		}
+		i, ok := positions[number]
+		if !ok {
+			return blocks, fmt.Errorf("transactions stored for missing block %d", number)
+		}
+		if err := json.Unmarshal([]byte(record), &tx); err != nil {
+			return blocks[:i], fmt.Errorf("failed to decode a transaction of block %d: %w", number, err)
+		}
+		blocks[i].Transactions = append(blocks[i].Transactions, tx)
+	}
+	return blocks, rows.Err()
+}
+
+func (s *sqliteStore) Append(block Block) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := insertBlock(tx, block); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) Rewrite(blocks []Block) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM labels; DELETE FROM transactions; DELETE FROM blocks`); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to clear the chain: %w", err)
+	}
+	for _, block := range blocks {
+		if err := insertBlock(tx, block); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// insertBlock inserts a block and its transactions within tx
+func insertBlock(tx *sql.Tx, block Block) error {
+	header, err := json.Marshal(block.BlockHeader)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO blocks (number, hash, prev_hash, prev_cid, timestamp, creator, difficulty, nonce,
+		tx_root, tx_count, header) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		block.BlockNumber, block.Hash, block.PrevHash, block.PrevCID, block.Timestamp, block.Creator,
+		block.Difficulty, block.Nonce, block.TxRoot, len(block.Transactions), string(header))
+	if err != nil {
+		return fmt.Errorf("failed to store block %d: %w", block.BlockNumber, err)
+	}
+	for position, t := range block.Transactions {
+		record, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO transactions (block_number, position, id, type, job_id, executor, sender,
+			recipient, amount, fee, nonce, execution_time, cpu_time, data, record)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			block.BlockNumber, position, txID(t), t.Type, t.JobID, t.Executor, t.From, t.To, t.Amount, t.Fee,
+			t.Nonce, t.ExecutionTime, t.CPUTime, t.Data, string(record))
+		if err != nil {
+			return fmt.Errorf("failed to store transaction %d of block %d: %w", position, block.BlockNumber, err)
+		}
+		for key, value := range t.Labels {
+			_, err = tx.Exec(`INSERT INTO labels (block_number, position, key, value) VALUES (?, ?, ?, ?)`,
+				block.BlockNumber, position, key, value)
+			if err != nil {
+				return fmt.Errorf("failed to store the labels of transaction %d of block %d: %w", position, block.BlockNumber, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *sqliteStore) LoadJobs() ([]Job, error) {
+	rows, err := s.db.Query(`SELECT id, record FROM jobs`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stored := []Job{}
+	saved := make(map[string]string)
+	for rows.Next() {
+		var id, record string
+		var job Job
+		if err := rows.Scan(&id, &record); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(record), &job); err != nil {
+			return nil, fmt.Errorf("failed to decode a stored job: %w", err)
+		}
+		stored = append(stored, job)
+		saved[id] = record
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	s.saved = saved
+	return stored, nil
+}
+
+// SaveJobs makes the jobs table match jobs. Only new and changed jobs are written, and jobs no longer in the
+// history, such as ones purged by a redaction, are deleted.
+func (s *sqliteStore) SaveJobs(jobs []Job) error {
+	if s.saved == nil {
+		if _, err := s.LoadJobs(); err != nil {
+			return fmt.Errorf("failed to read the stored jobs: %w", err)
+		}
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	saved := make(map[string]string, len(jobs))
+	for _, job := range jobs {
+		job.Height = 0 // Only meaningful at lookup time
+		data, err := json.Marshal(job)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		record := string(data)
+		saved[job.ID] = record
+		if s.saved[job.ID] == record {
+			continue
+		}
+		_, err = tx.Exec(`INSERT INTO jobs (id, submitter, status, error, result, block_number, python_hash, txt_hash,
+			execution_time, cpu_time, record) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET submitter = excluded.submitter, status = excluded.status,
+			error = excluded.error, result = excluded.result, block_number = excluded.block_number,
+			python_hash = excluded.python_hash, txt_hash = excluded.txt_hash, execution_time = excluded.execution_time,
+			cpu_time = excluded.cpu_time, record = excluded.record`,
+			job.ID, job.Submitter, job.Status, job.Error, job.Result, job.BlockNumber, job.PythonHash, job.TxtHash,
+			job.ExecutionTime, job.CPUTime, record)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to store job %s: %w", job.ID, err)
+		}
+	}
+	for id := range s.saved {
+		if _, ok := saved[id]; ok {
+			continue
+		}
+		if _, err := tx.Exec(`DELETE FROM jobs WHERE id = ?`, id); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to delete job %s: %w", id, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.saved = saved
+	return nil
+}
+
+// Sync is a no-op: every write is committed in its own transaction
+func (s *sqliteStore) Sync() error { return nil }
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
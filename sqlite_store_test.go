@@ -0,0 +1,66 @@
+//go:build sqlite
+
+package blockchain
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	testChainStore(t, func(dataDir string) (ChainStore, error) { return openSQLiteStore(dataDir, nil) })
+}
+
+func TestSQLiteStoreJobs(t *testing.T) {
+	dir := t.TempDir()
+	store, err := openSQLiteStore(dir, nil)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	s := store.(*sqliteStore)
+	changes := func() int {
+		var n int
+		if err := s.db.QueryRow(`SELECT total_changes()`).Scan(&n); err != nil {
+			t.Fatalf("count changes: %v", err)
+		}
+		return n
+	}
+	save := func(jobs ...Job) {
+		if err := store.SaveJobs(jobs); err != nil {
+			t.Fatalf("save jobs: %v", err)
+		}
+	}
+
+	a := Job{ID: "a", Submitter: "192.0.2.1", Status: JobPending}
+	b := Job{ID: "b", Submitter: "192.0.2.2", Status: JobConfirmed, BlockNumber: 3}
+	save(a, b)
+	before := changes()
+	save(a, b)
+	if changes() != before {
+		t.Fatalf("saving unchanged jobs wrote %d rows", changes()-before)
+	}
+
+	// Only the updated, new and dropped jobs are touched
+	a.Status, a.Result = JobConfirmed, "42"
+	c := Job{ID: "c", Submitter: "192.0.2.3", Status: JobPending}
+	save(a, c)
+	if written := changes() - before; written != 3 {
+		t.Fatalf("saving one updated, one new and one dropped job wrote %d rows", written)
+	}
+	store.Close()
+
+	store, err = openSQLiteStore(dir, nil)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer store.Close()
+	loaded, err := store.LoadJobs()
+	if err != nil {
+		t.Fatalf("load jobs: %v", err)
+	}
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].ID < loaded[j].ID })
+	if !reflect.DeepEqual(loaded, []Job{a, c}) {
+		t.Fatalf("loaded %+v, want %+v", loaded, []Job{a, c})
+	}
+}
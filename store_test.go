@@ -0,0 +1,248 @@
+package blockchain
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// testBlocks returns a short chain of blocks with transactions and labels, enough to round-trip through a store
+func testBlocks(n int) []Block {
+	blocks := make([]Block, n)
+	for i := range blocks {
+		block := Block{}
+		block.BlockNumber = i
+		block.Hash = fmt.Sprintf("%064x", i+1)
+		block.PrevHash = fmt.Sprintf("%064x", i)
+		block.Timestamp = int64(1700000000 + i)
+		block.Creator = "creator"
+		block.Difficulty = 2
+		block.Transactions = []Transaction{
+			{ID: fmt.Sprintf("job-%d", i), JobID: fmt.Sprintf("job-%d", i), Data: "output", Labels: map[string]string{"project": "alpha"}},
+			{Type: "transfer", From: "a", To: "b", Amount: 5, Fee: 1, Nonce: int64(i + 1)},
+		}
+		block.TxRoot = merkleRoot(block.Transactions)
+		blocks[i] = block
+	}
+	return blocks
+}
+
+// testChainStore checks that blocks appended to or rewritten into a store opened by open are loaded back intact
+func testChainStore(t *testing.T, open func(dataDir string) (ChainStore, error)) {
+	dir := t.TempDir()
+	store, err := open(dir)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	blocks := testBlocks(3)
+	for _, block := range blocks {
+		if err := store.Append(block); err != nil {
+			t.Fatalf("append block %d: %v", block.BlockNumber, err)
+		}
+	}
+	if err := store.Sync(); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	loaded, err := store.Load()
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, blocks) {
+		t.Fatalf("loaded %+v, want %+v", loaded, blocks)
+	}
+
+	if err := store.Rewrite(blocks[:2]); err != nil {
+		t.Fatalf("rewrite: %v", err)
+	}
+	if err := store.Append(blocks[2]); err != nil {
+		t.Fatalf("append after rewrite: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	// A reopened store sees the rewritten chain
+	store, err = open(dir)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer store.Close()
+	loaded, err = store.Load()
+	if err != nil {
+		t.Fatalf("load after reopen: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, blocks) {
+		t.Fatalf("loaded %+v after rewrite, want %+v", loaded, blocks)
+	}
+	if err := store.Rewrite(nil); err != nil {
+		t.Fatalf("rewrite to empty: %v", err)
+	}
+	if loaded, err = store.Load(); err != nil || len(loaded) != 0 {
+		t.Fatalf("load of emptied store returned %d blocks, %v", len(loaded), err)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	for _, codec := range codecs {
+		t.Run(codec.Name(), func(t *testing.T) {
+			testChainStore(t, func(dataDir string) (ChainStore, error) { return openFileStore(dataDir, codec) })
+		})
+	}
+}
+
+func TestReplayWALCompletesAppend(t *testing.T) {
+	for _, codec := range codecs {
+		t.Run(codec.Name(), func(t *testing.T) {
+			dir := t.TempDir()
+			store, err := openFileStore(dir, codec)
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			blocks := testBlocks(3)
+			for _, block := range blocks[:2] {
+				if err := store.Append(block); err != nil {
+					t.Fatalf("append block %d: %v", block.BlockNumber, err)
+				}
+			}
+			store.Close()
+
+			// Journal the append of the third block, then leave only part of its body behind as a crash would
+			headerPath, bodyPath := chainStorePaths(dir, codec)
+			headerInfo, _ := os.Stat(headerPath)
+			bodyInfo, _ := os.Stat(bodyPath)
+			record := walRecord{Op: walAppend, Block: blocks[2], HeaderSize: headerInfo.Size(), BodySize: bodyInfo.Size()}
+			if err := writeWAL(walPath(dir, codec), codec, record); err != nil {
+				t.Fatalf("journal: %v", err)
+			}
+			bodies, _ := os.OpenFile(bodyPath, os.O_WRONLY|os.O_APPEND, 0644)
+			bodies.Write([]byte{0x9f, 0x7b, 0x22})
+			bodies.Close()
+
+			store, err = openFileStore(dir, codec)
+			if err != nil {
+				t.Fatalf("reopen: %v", err)
+			}
+			defer store.Close()
+			loaded, err := store.Load()
+			if err != nil {
+				t.Fatalf("load: %v", err)
+			}
+			if !reflect.DeepEqual(loaded, blocks) {
+				t.Fatalf("loaded %d blocks after replay, want the %d journaled", len(loaded), len(blocks))
+			}
+			if info, err := os.Stat(walPath(dir, codec)); err != nil || info.Size() != 0 {
+				t.Errorf("write-ahead log was not cleared after replay")
+			}
+		})
+	}
+}
+
+func TestReplayWALDiscardsIncompleteRecord(t *testing.T) {
+	dir := t.TempDir()
+	codec := jsonCodec{}
+	if err := os.WriteFile(walPath(dir, codec), []byte(`{"Op":"append","Block":{`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store, err := openFileStore(dir, codec)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer store.Close()
+	if loaded, err := store.Load(); err != nil || len(loaded) != 0 {
+		t.Fatalf("loaded %d blocks, %v; want an empty chain", len(loaded), err)
+	}
+}
+
+func TestVerifyChainIntegrity(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ipfs/bafkreipublished" {
+			http.NotFound(w, r)
+		}
+	}))
+	defer gateway.Close()
+	savedGateway := ipfsGatewayURL
+	ipfsGatewayURL = gateway.URL + "/ipfs/"
+	t.Cleanup(func() { ipfsGatewayURL = savedGateway })
+
+	key, creator := testKey("miner")
+	chain := func(prevCIDs ...string) []Block {
+		blocks := make([]Block, len(prevCIDs))
+		prevHash := "-1"
+		for i := range blocks {
+			block := Block{BlockHeader: BlockHeader{PrevHash: prevHash, PrevCID: prevCIDs[i], BlockNumber: i + 1, Timestamp: int64(1700000000 + i), Creator: creator}}
+			block.TxRoot = merkleRoot(nil)
+			block.Hash = generateHash(block.BlockHeader, 0)
+			block.Signature = hex.EncodeToString(ed25519.Sign(key, blockMessage(block.BlockHeader)))
+			blocks[i], prevHash = block, block.Hash
+		}
+		return blocks
+	}
+
+	blocks := chain("-1", "bafkreipublished", "bafkreipublished")
+	if intact, err := verifyChainIntegrity(blocks, 0); intact != len(blocks) || err != nil {
+		t.Fatalf("intact chain: %d blocks intact, %v", intact, err)
+	}
+	blocks[1].Timestamp++
+	if intact, err := verifyChainIntegrity(blocks, 0); intact != 1 || err == nil {
+		t.Fatalf("tampered block 2: %d blocks intact, %v", intact, err)
+	}
+
+	// A PrevCID the gateway does not have breaks the chain at that block
+	if intact, err := verifyChainIntegrity(chain("-1", "bafkreipublished", "bafkreimissing"), 0); intact != 2 || err == nil {
+		t.Fatalf("missing PrevCID in block 3: %d blocks intact, %v", intact, err)
+	}
+
+	// An unreachable gateway says nothing about the chain
+	ipfsGatewayURL = "http://127.0.0.1:1/ipfs/"
+	if intact, err := verifyChainIntegrity(chain("-1", "bafkreimissing"), 0); intact != 2 || err != nil {
+		t.Fatalf("unreachable gateway: %d blocks intact, %v", intact, err)
+	}
+}
+
+func TestStoreTruncationHook(t *testing.T) {
+	withChain(t, nil)
+	withLedger(t)
+	savedHooks, savedStore, savedTip := hooks, chainStore, currentBlock
+	t.Cleanup(func() { hooks, chainStore, currentBlock = savedHooks, savedStore, savedTip })
+
+	key, creator := testKey("miner")
+	dir := t.TempDir()
+	store, err := openStore("file", dir, jsonCodec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prevHash := "-1"
+	for i := 1; i <= 3; i++ {
+		block := Block{BlockHeader: BlockHeader{PrevHash: prevHash, PrevCID: "-1", BlockNumber: i, Timestamp: int64(1700000000 + i), Creator: creator}}
+		block.TxRoot = merkleRoot(nil)
+		block.Hash = generateHash(block.BlockHeader, 0)
+		block.Signature = hex.EncodeToString(ed25519.Sign(key, blockMessage(block.BlockHeader)))
+		if i == 2 {
+			block.Timestamp++ // Stored after it was hashed, as a damaged file would hold it
+		}
+		if err := store.Append(block); err != nil {
+			t.Fatal(err)
+		}
+		prevHash = block.Hash
+	}
+	store.Close()
+
+	// Dropping the damaged tail of the store is not a reorg of the chain the node runs with
+	hooks = lifecycleHooks{}
+	var truncated []Block
+	OnStoreTruncated(func(removed []Block) { truncated = removed })
+	OnReorg(func(removed []Block) { t.Errorf("startup truncation of %d blocks reported as a reorg", len(removed)) })
+	corrupted, err := openChainStore(dir, "file", jsonCodec{}, 0)
+	if err != nil {
+		t.Fatalf("open chain store: %v", err)
+	}
+	defer chainStore.Close()
+	if !corrupted || len(truncated) != 2 || truncated[0].BlockNumber != 2 {
+		t.Fatalf("corrupted %v, truncated %d blocks; want blocks 2 and 3 dropped", corrupted, len(truncated))
+	}
+}
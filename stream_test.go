@@ -0,0 +1,57 @@
+package blockchain
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// gatedRecorder holds back the first write until gate is closed, simulating a slow client
+type gatedRecorder struct {
+	*httptest.ResponseRecorder
+	once    sync.Once
+	gate    chan struct{}
+	written chan struct{}
+}
+
+func (g *gatedRecorder) Write(p []byte) (int, error) {
+	g.once.Do(func() {
+		close(g.written)
+		<-g.gate
+	})
+	return g.ResponseRecorder.Write(p)
+}
+
+func TestJobStreamSlowSubscriber(t *testing.T) {
+	const id, total = "slow-subscriber", 500
+	openJobStream(id)
+	publishJobOutput(id, "line 0")
+
+	w := &gatedRecorder{ResponseRecorder: httptest.NewRecorder(), gate: make(chan struct{}), written: make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		handleJobStream(w, httptest.NewRequest("GET", "/job/stream?id="+id, nil))
+		close(done)
+	}()
+
+	// The handler is stuck writing the first line while far more lines arrive than its channel holds
+	<-w.written
+	for i := 1; i < total; i++ {
+		publishJobOutput(id, fmt.Sprintf("line %d", i))
+	}
+	close(w.gate)
+	closeJobStream(id)
+	<-done
+
+	body := w.Body.String()
+	for i := 0; i < total; i++ {
+		if want := fmt.Sprintf("data: line %d\n", i); strings.Count(body, want) != 1 {
+			t.Fatalf("line %d delivered %d times", i, strings.Count(body, want))
+		}
+	}
+	if !strings.HasSuffix(body, "event: done\ndata: \n\n") {
+		t.Fatalf("stream does not end with the done event: %q", body[max(0, len(body)-80):])
+	}
+}
@@ -0,0 +1,36 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"testing"
+	"time"
+)
+
+func TestSpendSubmitPoW(t *testing.T) {
+	saved := spentSubmitPoW
+	spentSubmitPoW = make(map[int64]map[[32]byte]bool)
+	t.Cleanup(func() { spentSubmitPoW = saved })
+
+	current := submitPoWWindowAt(time.Now())
+	stale := sha256.Sum256([]byte("stale"))
+	spentSubmitPoW[current-5] = map[[32]byte]bool{stale: true}
+
+	stamp := sha256.Sum256([]byte("stamp"))
+	if !spendSubmitPoW(stamp, current) {
+		t.Fatal("fresh stamp refused")
+	}
+	if spendSubmitPoW(stamp, current) {
+		t.Fatal("stamp accepted twice")
+	}
+	if !spendSubmitPoW(sha256.Sum256([]byte("previous")), current-1) {
+		t.Fatal("stamp over the previous challenge refused")
+	}
+
+	// Expired challenges are dropped with all their stamps, while the live windows are kept
+	if _, ok := spentSubmitPoW[current-5]; ok {
+		t.Fatal("stamps of an expired challenge kept")
+	}
+	if len(spentSubmitPoW) != 2 {
+		t.Fatalf("%d windows of stamps kept, want the current and previous one", len(spentSubmitPoW))
+	}
+}
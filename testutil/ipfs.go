@@ -0,0 +1,249 @@
+// Package testutil provides in-process stand-ins for the external services used by the miner and client,
+// so development and CI do not require a running IPFS daemon.
+package testutil
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+// Multicodec codes used when building CIDs
+const (
+	codecRaw     = 0x55
+	codecDagJSON = 0x0129
+	codecLibp2p  = 0x72
+	multihashSHA = 0x12
+)
+
+// IPFSMock is an in-memory implementation of the subset of the Kubo RPC API and HTTP gateway used by the project.
+// It serves add, cat, pin, dag and name under /api/v0/ and path-style gateway requests under /ipfs/.
+type IPFSMock struct {
+	mu      sync.Mutex
+	objects map[string][]byte // Content keyed by CID
+	pins    map[string]bool   // CIDs that are currently pinned
+	names   map[string]string // IPNS records, mapping names to the CIDs they point to
+}
+
+// NewIPFSMock creates an empty IPFS mock
+func NewIPFSMock() *IPFSMock {
+	return &IPFSMock{
+		objects: make(map[string][]byte),
+		pins:    make(map[string]bool),
+		names:   make(map[string]string),
+	}
+}
+
+// NewIPFSServer starts an IPFS mock on a local test server; point the node's API and gateway URLs at server.URL
+func NewIPFSServer() (*IPFSMock, *httptest.Server) {
+	mock := NewIPFSMock()
+	return mock, httptest.NewServer(mock)
+}
+
+// ListenAndServe serves the mock on addr, for offline development against a real miner and client
+func (m *IPFSMock) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, m)
+}
+
+// makeCID builds a base32 CIDv1 for data using a sha2-256 multihash and the given codec
+func makeCID(codec uint64, data []byte) string {
+	digest := sha256.Sum256(data)
+	buf := make([]byte, 0, 4+len(digest))
+	buf = binary.AppendUvarint(buf, 1) // CID version
+	buf = binary.AppendUvarint(buf, codec)
+	buf = binary.AppendUvarint(buf, multihashSHA)
+	buf = binary.AppendUvarint(buf, uint64(len(digest)))
+	buf = append(buf, digest[:]...)
+	return "b" + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(buf))
+}
+
+// Add stores data as a raw block and returns its CID
+func (m *IPFSMock) Add(data []byte) string {
+	return m.put(codecRaw, data)
+}
+
+// put stores data under the CID computed for codec
+func (m *IPFSMock) put(codec uint64, data []byte) string {
+	cid := makeCID(codec, data)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[cid] = append([]byte(nil), data...)
+	return cid
+}
+
+// Get returns the content stored under cid
+func (m *IPFSMock) Get(cid string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[cid]
+	return data, ok
+}
+
+// resolve maps a CID, /ipfs/ path or /ipns/ path to the CID it refers to
+func (m *IPFSMock) resolve(path string) string {
+	if name, ok := strings.CutPrefix(path, "/ipns/"); ok {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return m.names[name]
+	}
+	return strings.TrimPrefix(path, "/ipfs/")
+}
+
+// Pinned reports whether cid is pinned
+func (m *IPFSMock) Pinned(cid string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.pins[cid]
+}
+
+// ServeHTTP dispatches RPC API and gateway requests
+func (m *IPFSMock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/ipfs/"):
+		m.handleGateway(w, r)
+	case r.URL.Path == "/api/v0/add":
+		m.handleAdd(w, r, codecRaw)
+	case r.URL.Path == "/api/v0/dag/put":
+		m.handleAdd(w, r, codecDagJSON)
+	case r.URL.Path == "/api/v0/cat", r.URL.Path == "/api/v0/dag/get":
+		m.handleCat(w, r)
+	case r.URL.Path == "/api/v0/pin/add":
+		m.handlePin(w, r, true)
+	case r.URL.Path == "/api/v0/pin/rm":
+		m.handlePin(w, r, false)
+	case r.URL.Path == "/api/v0/pin/ls":
+		m.handlePinLs(w, r)
+	case r.URL.Path == "/api/v0/name/publish":
+		m.handleNamePublish(w, r)
+	default:
+		http.Error(w, fmt.Sprintf("unsupported endpoint %s", r.URL.Path), http.StatusNotFound)
+	}
+}
+
+// handleAdd stores the uploaded "file" form part, mirroring the responses of add and dag/put
+func (m *IPFSMock) handleAdd(w http.ResponseWriter, r *http.Request, codec uint64) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read form file: %v", err), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read file content: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if codec == codecDagJSON && !json.Valid(data) {
+		http.Error(w, "dag/put expects a JSON document", http.StatusBadRequest)
+		return
+	}
+
+	cid := m.put(codec, data)
+	if r.URL.Query().Get("pin") == "true" {
+		m.mu.Lock()
+		m.pins[cid] = true
+		m.mu.Unlock()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if codec == codecDagJSON {
+		json.NewEncoder(w).Encode(map[string]interface{}{"Cid": map[string]string{"/": cid}})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"Name": header.Filename, "Hash": cid, "Size": fmt.Sprint(len(data))})
+}
+
+// handleCat returns the content for the CID or path passed in the arg parameter
+func (m *IPFSMock) handleCat(w http.ResponseWriter, r *http.Request) {
+	data, ok := m.Get(m.resolve(r.URL.Query().Get("arg")))
+	if !ok {
+		http.Error(w, "block was not found locally (offline)", http.StatusInternalServerError)
+		return
+	}
+	w.Write(data)
+}
+
+// handlePin pins or unpins the CID passed in the arg parameter
+func (m *IPFSMock) handlePin(w http.ResponseWriter, r *http.Request, pin bool) {
+	cid := r.URL.Query().Get("arg")
+	m.mu.Lock()
+	_, exists := m.objects[cid]
+	if exists {
+		if pin {
+			m.pins[cid] = true
+		} else {
+			delete(m.pins, cid)
+		}
+	}
+	m.mu.Unlock()
+
+	if !exists {
+		http.Error(w, "block was not found locally (offline)", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"Pins": {cid}})
+}
+
+// handleNamePublish points the IPNS name of the key parameter (default "self") at the path in the arg parameter
+func (m *IPFSMock) handleNamePublish(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		key = "self"
+	}
+	path := r.URL.Query().Get("arg")
+	cid := m.resolve(path)
+	if _, ok := m.Get(cid); !ok {
+		http.Error(w, "block was not found locally (offline)", http.StatusInternalServerError)
+		return
+	}
+	name := makeCID(codecLibp2p, []byte(key))
+	m.mu.Lock()
+	m.names[name] = cid
+	m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"Name": name, "Value": path})
+}
+
+// handlePinLs lists the pinned CIDs
+func (m *IPFSMock) handlePinLs(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	keys := make(map[string]map[string]string, len(m.pins))
+	for cid := range m.pins {
+		keys[cid] = map[string]string{"Type": "recursive"}
+	}
+	m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"Keys": keys})
+}
+
+// handleGateway serves path-style gateway requests (/ipfs/<cid>)
+func (m *IPFSMock) handleGateway(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	cid := strings.TrimPrefix(r.URL.Path, "/ipfs/")
+	data, ok := m.Get(cid)
+	if !ok {
+		http.Error(w, "ipfs resolve: not found", http.StatusNotFound)
+		return
+	}
+	w.Write(data)
+}
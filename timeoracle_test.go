@@ -0,0 +1,45 @@
+package blockchain
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"testing"
+)
+
+// attestedHeader returns header with a time attestation for attested signed by key
+func attestedHeader(header BlockHeader, key ed25519.PrivateKey, attested int64) BlockHeader {
+	header.TimeAttestation = &TimeAttestation{Source: "pool.ntp.org", Time: attested, PublicKey: hex.EncodeToString(key.Public().(ed25519.PublicKey))}
+	header.TimeAttestation.Signature = hex.EncodeToString(ed25519.Sign(key, timeAttestationMessage(header, header.TimeAttestation.Source, attested)))
+	return header
+}
+
+func TestTimeAttestationOracleKeys(t *testing.T) {
+	saved := timeOracleKeys
+	t.Cleanup(func() { timeOracleKeys = saved })
+
+	miner, minerID := testKey("miner")
+	oracle, oracleID := testKey("oracle")
+	header := signedBlock(miner, minerID).BlockHeader
+
+	timeOracleKeys = []string{oracleID}
+	if err := validateTimeAttestation(attestedHeader(header, oracle, header.Timestamp+5)); err != nil {
+		t.Fatalf("attestation of a configured oracle refused: %v", err)
+	}
+	// A miner vouching for its own timestamp proves nothing
+	if err := validateTimeAttestation(attestedHeader(header, miner, header.Timestamp)); err == nil {
+		t.Fatal("attestation signed by the block creator accepted")
+	}
+	if err := validateTimeAttestation(attestedHeader(header, oracle, header.Timestamp+3600)); err == nil {
+		t.Fatal("timestamp an hour away from the attested time accepted")
+	}
+	forged := attestedHeader(header, miner, header.Timestamp)
+	forged.TimeAttestation.PublicKey = oracleID
+	if err := validateTimeAttestation(forged); err == nil {
+		t.Fatal("attestation claiming an oracle key it was not signed with accepted")
+	}
+
+	timeOracleKeys = nil
+	if err := validateTimeAttestation(attestedHeader(header, oracle, header.Timestamp)); err == nil {
+		t.Fatal("attestation accepted without configured oracles")
+	}
+}
@@ -0,0 +1,166 @@
+package blockchain
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"testing"
+	"time"
+)
+
+// testKey derives a deterministic key pair and its hex identity from name
+func testKey(name string) (ed25519.PrivateKey, string) {
+	seed := sha256.Sum256([]byte("test key " + name))
+	key := ed25519.NewKeyFromSeed(seed[:])
+	return key, hex.EncodeToString(key.Public().(ed25519.PublicKey))
+}
+
+// signedTransfer builds a transfer from key to the identity to, signed by key
+func signedTransfer(key ed25519.PrivateKey, to string, amount, fee, nonce int64) Transaction {
+	tx := Transaction{Type: TxTransfer, From: hex.EncodeToString(key.Public().(ed25519.PublicKey)), To: to,
+		Amount: amount, Fee: fee, Nonce: nonce, Timestamp: 1700000000}
+	tx.Signature = hex.EncodeToString(ed25519.Sign(key, transferMessage(tx)))
+	return tx
+}
+
+// withLedger replaces the balances, nonces and transaction pool for the duration of the test
+func withLedger(t *testing.T) {
+	savedBalances, savedNonces, savedPool := balances, nonces, transactionPool
+	balances, nonces, transactionPool = make(map[string]int64), make(map[string]int64), nil
+	t.Cleanup(func() { balances, nonces, transactionPool = savedBalances, savedNonces, savedPool })
+}
+
+func TestValidateTransfer(t *testing.T) {
+	alice, _ := testKey("alice")
+	_, bob := testKey("bob")
+	valid := signedTransfer(alice, bob, 10, 1, 1)
+	if err := validateTransfer(valid); err != nil {
+		t.Fatalf("valid transfer refused: %v", err)
+	}
+
+	tampered := valid
+	tampered.Amount = 11
+	selfTransfer := signedTransfer(alice, valid.From, 10, 1, 1)
+	tests := map[string]Transaction{
+		"tampered amount": tampered,
+		"zero amount":     signedTransfer(alice, bob, 0, 1, 1),
+		"negative fee":    signedTransfer(alice, bob, 10, -1, 1),
+		"zero nonce":      signedTransfer(alice, bob, 10, 1, 0),
+		"self transfer":   selfTransfer,
+		"bad recipient":   signedTransfer(alice, "bob", 10, 1, 1),
+		"overflowing fee": signedTransfer(alice, bob, math.MaxInt64, 2, 1),
+	}
+	for name, tx := range tests {
+		if err := validateTransfer(tx); err == nil {
+			t.Errorf("%s: transfer accepted", name)
+		}
+	}
+}
+
+func TestNextNonce(t *testing.T) {
+	withLedger(t)
+	alice, from := testKey("alice")
+	_, bob := testKey("bob")
+	if next := nextNonce(from); next != 1 {
+		t.Fatalf("first nonce is %d, want 1", next)
+	}
+	nonces[from] = 4
+	if next := nextNonce(from); next != 5 {
+		t.Fatalf("nonce after 4 confirmed transfers is %d, want 5", next)
+	}
+	transactionPool = []Transaction{signedTransfer(alice, bob, 1, 0, 5), signedTransfer(alice, bob, 1, 0, 6)}
+	if next := nextNonce(from); next != 7 {
+		t.Fatalf("nonce after pooled transfers 5 and 6 is %d, want 7", next)
+	}
+}
+
+func TestCheckBlockBalances(t *testing.T) {
+	withLedger(t)
+	alice, from := testKey("alice")
+	_, bob := testKey("bob")
+	balances[from] = 20
+	nonces[from] = 2
+
+	block := Block{}
+	block.BlockNumber = 5
+	inOrder := signedTransfer(alice, bob, 10, 1, 3)
+	gap := signedTransfer(alice, bob, 1, 0, 5)
+	overdrawn := signedTransfer(alice, bob, 9, 1, 4)
+	block.Transactions = []Transaction{inOrder, gap, overdrawn}
+	invalid, err := checkBlockBalances(block)
+	if err == nil {
+		t.Fatal("block with invalid transfers accepted")
+	}
+	if invalid[txID(inOrder)] || !invalid[txID(gap)] || !invalid[txID(overdrawn)] {
+		t.Fatalf("refused %v, want only the transfers with nonce 5 and 4", invalid)
+	}
+
+	// An amount and fee that wrap around when summed must not pass as covered
+	block.Transactions = []Transaction{signedTransfer(alice, bob, math.MaxInt64, math.MaxInt64, 3)}
+	if invalid, _ := checkBlockBalances(block); len(invalid) != 1 {
+		t.Fatal("transfer whose amount and fee overflow passed the balance check")
+	}
+
+	block.Transactions = []Transaction{inOrder, signedTransfer(alice, bob, 8, 1, 4)}
+	if invalid, err := checkBlockBalances(block); err != nil {
+		t.Fatalf("covered transfers refused: %v %v", invalid, err)
+	}
+}
+
+func TestTransferBoundToNetwork(t *testing.T) {
+	params, network := networkParams, genesisHash
+	t.Cleanup(func() { networkParams, genesisHash = params, network })
+
+	alice, _ := testKey("alice")
+	_, bob := testKey("bob")
+	tx := signedTransfer(alice, bob, 10, 1, 1)
+	if err := validateTransfer(tx); err != nil {
+		t.Fatalf("transfer refused on its own network: %v", err)
+	}
+	other := networkParams
+	other.Difficulty++
+	setNetworkParams(other)
+	if err := validateTransfer(tx); err == nil {
+		t.Fatal("transfer signed for another network accepted")
+	}
+}
+
+func TestHeldTransferLimits(t *testing.T) {
+	withLedger(t)
+	savedHeld, savedAdmitted := futureTransfers, poolAdmitted
+	futureTransfers, poolAdmitted = make(map[string]map[int64]Transaction), make(map[string]time.Time)
+	t.Cleanup(func() { futureTransfers, poolAdmitted = savedHeld, savedAdmitted })
+
+	alice, from := testKey("alice")
+	mallory, _ := testKey("mallory")
+	_, bob := testKey("bob")
+	balances[from] = 100
+
+	// A fresh key with nothing on chain cannot park transfers
+	if err := admitTransaction(signedTransfer(mallory, bob, 1, 0, 3)); err == nil || heldTransferCount() != 0 {
+		t.Fatalf("unfunded future-nonce transfer held: %v", err)
+	}
+	held := signedTransfer(alice, bob, 10, 1, 3)
+	if err := admitTransaction(held); err != nil || heldTransferCount() != 1 {
+		t.Fatalf("funded future-nonce transfer not held: %v", err)
+	}
+
+	// The held pool is capped across all senders
+	filler := make(map[int64]Transaction)
+	for i := 0; i < maxHeldTransfers; i++ {
+		filler[int64(i+2)] = Transaction{Type: TxTransfer, From: "filler", Nonce: int64(i + 2)}
+	}
+	futureTransfers["filler"] = filler
+	if err := admitTransaction(signedTransfer(alice, bob, 10, 1, 4)); err == nil {
+		t.Fatal("transfer held beyond the global cap")
+	}
+	delete(futureTransfers, "filler")
+
+	// Held transfers expire
+	poolAdmitted[txID(held)] = time.Now().Add(-heldTransferTTL - time.Minute)
+	expireHeldTransfers(time.Now())
+	if heldTransferCount() != 0 {
+		t.Fatal("expired held transfer kept")
+	}
+}
@@ -0,0 +1,53 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestDownloadRelease(t *testing.T) {
+	mock := useIPFSMock(t)
+	data := bytes.Repeat([]byte("release binary\n"), 1000)
+	digest := sha256.Sum256(data)
+	binary := ReleaseBinary{CID: mock.Add(data), SHA256: hex.EncodeToString(digest[:])}
+	dir := t.TempDir()
+	staged := filepath.Join(dir, "miner.new")
+
+	// A binary that does not match the signed digest is never staged, and its download is removed
+	tampered := binary
+	tampered.SHA256 = hex.EncodeToString(make([]byte, sha256.Size))
+	if err := downloadRelease(tampered, staged); err == nil {
+		t.Fatal("binary with another digest staged")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("rejected download left %d files behind", len(entries))
+	}
+
+	if err := downloadRelease(binary, staged); err != nil {
+		t.Fatalf("download release: %v", err)
+	}
+	got, err := os.ReadFile(staged)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("staged binary differs from the release: %v", err)
+	}
+	if info, _ := os.Stat(staged); runtime.GOOS != "windows" && info.Mode().Perm()&0100 == 0 {
+		t.Fatalf("staged binary is not executable: %v", info.Mode())
+	}
+}
+
+func TestReleaseKeyNotCreated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "relase.key")
+	if _, err := loadKeyFile(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("loading a missing key returned %v", err)
+	}
+	if _, err := os.Stat(path); err == nil {
+		t.Fatal("loading a missing release key created one")
+	}
+}